@@ -0,0 +1,238 @@
+package luma
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TrackedContext is a render context that records the paths templates
+// read from it. Create one with TrackAccess and pass it to Execute or
+// Render in place of the context; the reads of every render add up, so
+// one TrackedContext can be shared by all the templates of a chart.
+type TrackedContext struct {
+	value interface{}
+
+	mu       sync.Mutex
+	reads    map[string]*accessRead
+	disabled Conversion
+}
+
+// accessRead is what the renders did with one context path
+type accessRead struct {
+	// found is set when the path had a value
+	found bool
+	// whole is set when the value was used as a whole, rather than
+	// looked into
+	whole bool
+	// iterated is set when a loop iterated over the value
+	iterated bool
+}
+
+// AccessReport tells which paths of a tracked context the renders read.
+// Paths join map keys and field names with dots and list indexes in
+// brackets, like spec.containers[0].image.
+type AccessReport struct {
+	// Read holds the paths read that had a value
+	Read []string
+	// Missing holds the paths read that had no value. Only the first
+	// missing segment of a path is reported: reading a.b.c without an a
+	// reports a.
+	Missing []string
+	// Unused holds the paths of the context no render read, neither
+	// themselves nor anything below them. Values nested in an unused
+	// value are not listed separately.
+	Unused []string
+}
+
+// TrackAccess wraps a render context so that renders record the paths
+// they read from it. Templates rendered with tracking are compiled with
+// instrumented reads, in separate Lua states, and their output is never
+// served from the result cache.
+//
+// Example:
+//
+//	values := luma.TrackAccess(chartValues)
+//	for _, tmpl := range templates {
+//	    if _, err := tmpl.Execute(values); err != nil {
+//	        log.Fatal(err)
+//	    }
+//	}
+//	report := values.Report()
+//	for _, path := range report.Unused {
+//	    log.Printf("values key %s is never used", path)
+//	}
+func TrackAccess(context interface{}) *TrackedContext {
+	return &TrackedContext{value: context, reads: make(map[string]*accessRead)}
+}
+
+// ExecuteWithAccessReport renders the template like Execute and reports
+// the paths of the context it read.
+func (t *Template) ExecuteWithAccessReport(context interface{}) (string, *AccessReport, error) {
+	tracked := TrackAccess(context)
+	output, err := t.Execute(tracked)
+	return output, tracked.Report(), err
+}
+
+// trackedContext returns the TrackedContext a render context is, if any
+func trackedContext(context interface{}) *TrackedContext {
+	if valid, ok := context.(*validContext); ok {
+		context = valid.value
+	}
+	if localized, ok := context.(*localizedContext); ok {
+		context = localized.value
+	}
+	tracked, _ := context.(*TrackedContext)
+	return tracked
+}
+
+// contextValue returns the value a render context wraps with
+// TrackAccess and WithLocale
+func contextValue(context interface{}) interface{} {
+	for {
+		switch c := context.(type) {
+		case *TrackedContext:
+			context = c.value
+		case *localizedContext:
+			context = c.value
+		default:
+			return context
+		}
+	}
+}
+
+// enableAccessTracking makes the vm's templates record the context
+// paths they read
+func (v *vm) enableAccessTracking() error {
+	runtime, err := requireModule(v.L, "luma.runtime")
+	if err != nil {
+		return err
+	}
+	err = v.L.CallByParam(lua.P{Fn: v.L.GetField(runtime, "set_access_tracking"), NRet: 0, Protect: true}, lua.LTrue)
+	if err != nil {
+		return err
+	}
+	v.beginAccess = v.L.GetField(runtime, "begin_access")
+	v.takeAccess = v.L.GetField(runtime, "take_access")
+	return nil
+}
+
+// trackReads starts recording the reads of a render's context. It is
+// called before the globals are added, so that only the names the
+// context provides count as context paths.
+func (v *vm) trackReads(ctxTable *lua.LTable) error {
+	roots := v.L.NewTable()
+	ctxTable.ForEach(func(key, _ lua.LValue) {
+		roots.RawSet(key, lua.LTrue)
+	})
+	if _, err := v.call(v.beginAccess, roots); err != nil {
+		return fmt.Errorf("failed to track context access: %w", err)
+	}
+	return nil
+}
+
+// collect adds the reads a render recorded in v
+func (c *TrackedContext) collect(e *Environment, v *vm) error {
+	reads, err := v.call(v.takeAccess)
+	if err != nil {
+		return fmt.Errorf("failed to track context access: %w", err)
+	}
+	tbl, ok := reads.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disabled = e.opts.DisabledConversions
+	tbl.ForEach(func(path, info lua.LValue) {
+		fields, ok := info.(*lua.LTable)
+		if !ok {
+			return
+		}
+		read := c.reads[path.String()]
+		if read == nil {
+			read = new(accessRead)
+			c.reads[path.String()] = read
+		}
+		read.found = read.found || lua.LVAsBool(fields.RawGetString("found"))
+		read.whole = read.whole || lua.LVAsBool(fields.RawGetString("whole"))
+		read.iterated = read.iterated || lua.LVAsBool(fields.RawGetString("iterated"))
+	})
+	return nil
+}
+
+// Report returns the paths the renders so far read, sorted.
+func (c *TrackedContext) Report() *AccessReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &AccessReport{Read: []string{}, Missing: []string{}, Unused: []string{}}
+	for path, read := range c.reads {
+		if read.found {
+			report.Read = append(report.Read, path)
+		} else {
+			report.Missing = append(report.Missing, path)
+		}
+	}
+
+	inst := instanceEncoder{disabled: c.disabled, visiting: make(map[seenKey]bool)}
+	if root, ok := inst.value(reflect.ValueOf(contextValue(c.value)), 0).(map[string]interface{}); ok {
+		for _, key := range sortedKeys(root) {
+			c.unused(report, key, root[key], false)
+		}
+	}
+
+	sort.Strings(report.Read)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unused)
+	return report
+}
+
+// unused adds the paths no render read at or below path to the report.
+// Loop variables are used without reading paths, so the elements of
+// collections a loop iterated over count as read: scalars entirely, maps
+// and lists as far as the template looked into them.
+func (c *TrackedContext) unused(report *AccessReport, path string, value interface{}, iterated bool) {
+	_, container := value.(map[string]interface{})
+	if _, ok := value.([]interface{}); ok {
+		container = true
+	}
+	read := c.reads[path]
+	switch {
+	case read == nil && iterated && !container:
+		return
+	case read == nil && !iterated:
+		report.Unused = append(report.Unused, path)
+		return
+	case read == nil:
+		read = new(accessRead)
+	case read.whole:
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			c.unused(report, path+"."+key, v[key], read.iterated)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			c.unused(report, path+"["+strconv.Itoa(i)+"]", elem, read.iterated)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
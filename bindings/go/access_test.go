@@ -0,0 +1,95 @@
+package luma_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestAccessReport(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deploy.yaml": "name: ${name}\n@for c in containers\n- ${c.image} ${c.probe.port}\n@end\ntls: ${ tls.cert | default(\"none\") }",
+		"labels.yaml": "@for k, v in labels\n$k=$v\n@end\n${ annotations | length }",
+	}})
+	values := luma.TrackAccess(map[string]interface{}{
+		"name": "web",
+		"containers": []map[string]interface{}{
+			{"image": "nginx", "resources": map[string]interface{}{"cpu": 1}},
+		},
+		"labels":      map[string]string{"app": "web"},
+		"annotations": map[string]string{"a": "b"},
+		"replicas":    3,
+		"service":     map[string]interface{}{"port": 80},
+	})
+
+	for _, name := range []string{"deploy.yaml", "labels.yaml"} {
+		tmpl, err := env.GetTemplate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tmpl.Execute(values); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := values.Report()
+	want := &luma.AccessReport{
+		Read:    []string{"annotations", "containers", "containers[0].image", "labels", "name"},
+		Missing: []string{"containers[0].probe", "tls"},
+		Unused:  []string{"containers[0].resources", "replicas", "service"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Report() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAccessReportIndexes(t *testing.T) {
+	tmpl, err := luma.NewEnvironment(luma.Options{}).Compile("${ports[1]} ${ports[0] | default(\"-\")} ${ports[3]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, report, err := tmpl.ExecuteWithAccessReport(map[string]interface{}{"ports": []int{80, 443}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "80 - " {
+		t.Errorf("output = %q", out)
+	}
+	want := &luma.AccessReport{
+		Read:    []string{"ports", "ports[0]"},
+		Missing: []string{"ports[2]"},
+		Unused:  []string{"ports[1]"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+}
+
+func TestExecuteWithAccessReport(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{ResultCache: &luma.ResultCacheOptions{}})
+	env.AddGlobal("site", "example.com")
+	tmpl, err := env.Compile("${site} ${user.name} ${missing}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context := map[string]interface{}{"user": map[string]interface{}{"name": "Ada", "age": 36}}
+	for i := 0; i < 2; i++ {
+		out, report, err := tmpl.ExecuteWithAccessReport(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "example.com Ada " {
+			t.Errorf("output = %q", out)
+		}
+		want := &luma.AccessReport{
+			Read:    []string{"user", "user.name"},
+			Missing: []string{"missing"},
+			Unused:  []string{"user.age"},
+		}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("report %d = %+v, want %+v", i, report, want)
+		}
+	}
+}
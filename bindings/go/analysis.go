@@ -0,0 +1,129 @@
+package luma
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// elementSegment is the path segment standing for any element of a list
+// or value of a map, see luma.compiler.analysis
+const elementSegment = "[]"
+
+// reference is a context path a template reads, found by static
+// analysis
+type reference struct {
+	// path lists the segments of the path, elementSegment for elements
+	path []string
+	// positions holds where each segment is read
+	positions []SourceLocation
+	// position is where the whole path is used
+	position SourceLocation
+	// iterate is "list" or "pairs" when a loop iterates over the path
+	iterate string
+	// call reports whether the path is called as a function
+	call bool
+	// optional reports whether the path is read behind an is defined
+	// test or a default filter
+	optional bool
+	// fallback is the literal a default filter supplies, nil if none
+	fallback interface{}
+}
+
+// String formats the path as a.b[].c
+func (r reference) String() string {
+	return pathString(r.path)
+}
+
+// pathString formats path segments as a.b[].c
+func pathString(path []string) string {
+	var b strings.Builder
+	for i, segment := range path {
+		if segment == elementSegment {
+			b.WriteString(segment)
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// references finds the context paths the template reads, following its
+// parents and the templates it includes with context
+func (t *Template) references() ([]reference, error) {
+	source, err := t.currentSource()
+	if err != nil {
+		return nil, err
+	}
+	v, err := t.env.acquireVM(vmPlain)
+	if err != nil {
+		return nil, err
+	}
+	defer t.env.releaseVM(v)
+
+	analysis, err := requireModule(v.L, "luma.compiler.analysis")
+	if err != nil {
+		return nil, err
+	}
+	result, err := v.call(v.L.GetField(analysis, "references"), lua.LString(source), renderOptions(v.L, t.name))
+	if err != nil {
+		return nil, fmt.Errorf("analysis error: %w", templateError(t.name, err))
+	}
+
+	tbl, ok := result.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("analysis error: unexpected %s", result.Type())
+	}
+	refs := make([]reference, 0, tbl.Len())
+	for i := 1; i <= tbl.Len(); i++ {
+		entry, ok := tbl.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			continue
+		}
+		ref := reference{
+			position: analysisLocation(entry.RawGetString("position")),
+			iterate:  lua.LVAsString(entry.RawGetString("iterate")),
+			call:     lua.LVAsBool(entry.RawGetString("call")),
+			optional: lua.LVAsBool(entry.RawGetString("optional")),
+		}
+		switch def := entry.RawGetString("default").(type) {
+		case lua.LString:
+			ref.fallback = string(def)
+		case lua.LNumber:
+			ref.fallback = float64(def)
+		case lua.LBool:
+			ref.fallback = bool(def)
+		}
+		path, _ := entry.RawGetString("path").(*lua.LTable)
+		positions, _ := entry.RawGetString("positions").(*lua.LTable)
+		if path == nil || positions == nil {
+			continue
+		}
+		for j := 1; j <= path.Len(); j++ {
+			ref.path = append(ref.path, lua.LVAsString(path.RawGetInt(j)))
+			ref.positions = append(ref.positions, analysisLocation(positions.RawGetInt(j)))
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// analysisLocation converts a { template, line, column } position
+func analysisLocation(value lua.LValue) SourceLocation {
+	tbl, ok := value.(*lua.LTable)
+	if !ok {
+		return SourceLocation{}
+	}
+	l := SourceLocation{
+		Line:   int(lua.LVAsNumber(tbl.RawGetInt(2))),
+		Column: int(lua.LVAsNumber(tbl.RawGetInt(3))),
+	}
+	if name, ok := tbl.RawGetInt(1).(lua.LString); ok {
+		l.Template = string(name)
+	}
+	return l
+}
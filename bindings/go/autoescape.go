@@ -0,0 +1,166 @@
+package luma
+
+import (
+	"html/template"
+	"reflect"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// EscapeMode names the escaping applied to interpolated values.
+type EscapeMode string
+
+const (
+	// EscapeHTML escapes &, <, >, " and ' as HTML entities. It is the
+	// default mode.
+	EscapeHTML EscapeMode = "html"
+
+	// EscapeXML escapes like EscapeHTML but writes ' as &apos;.
+	EscapeXML EscapeMode = "xml"
+
+	// EscapeYAML leaves numbers, booleans and plain-safe strings as they
+	// are and double-quotes strings that YAML would otherwise misread,
+	// such as "a: b", "# note", "yes" or "007". Lists and maps become
+	// flow collections.
+	EscapeYAML EscapeMode = "yaml"
+
+	// EscapeJSON writes every value as JSON: strings are quoted, and
+	// lists and maps are encoded with sorted keys.
+	EscapeJSON EscapeMode = "json"
+
+	// EscapeShell single-quotes values containing anything but letters,
+	// digits and @%+=:,./_- so they form one POSIX shell word.
+	EscapeShell EscapeMode = "shell"
+
+	// EscapeHCL writes values as HCL expressions: strings are quoted with
+	// ${ and %{ escaped, and lists and maps become HCL collections.
+	EscapeHCL EscapeMode = "hcl"
+
+	// EscapeNone disables autoescaping.
+	EscapeNone EscapeMode = "off"
+)
+
+// defaultAutoescape selects the escape mode when Options.Autoescape is
+// nil
+var defaultAutoescape = SelectAutoescape(map[string]EscapeMode{
+	".xml":       EscapeXML,
+	".yaml":      EscapeYAML,
+	".yml":       EscapeYAML,
+	".json":      EscapeJSON,
+	".sh":        EscapeShell,
+	".tf":        EscapeHCL,
+	".hcl":       EscapeHCL,
+	".xml.luma":  EscapeXML,
+	".yaml.luma": EscapeYAML,
+	".yml.luma":  EscapeYAML,
+	".json.luma": EscapeJSON,
+	".sh.luma":   EscapeShell,
+	".tf.luma":   EscapeHCL,
+	".hcl.luma":  EscapeHCL,
+}, EscapeHTML)
+
+// Autoescaper chooses the escape mode of a template from its name. The
+// name is empty for templates rendered from a string.
+//
+// An EscapeMode is an Autoescaper that always returns itself, so
+// Options.Autoescape accepts either a fixed mode or a function.
+type Autoescaper interface {
+	Mode(name string) EscapeMode
+}
+
+// Mode implements Autoescaper.
+func (m EscapeMode) Mode(string) EscapeMode {
+	return m
+}
+
+// AutoescapeFunc adapts a function to the Autoescaper interface.
+type AutoescapeFunc func(name string) EscapeMode
+
+// Mode implements Autoescaper.
+func (f AutoescapeFunc) Mode(name string) EscapeMode {
+	return f(name)
+}
+
+// SelectAutoescape returns an Autoescaper that picks the mode by file
+// name suffix, like Jinja's select_autoescape. The longest matching
+// suffix wins; names without a match, including string templates, use
+// fallback.
+//
+// Example:
+//
+//	luma.SelectAutoescape(map[string]luma.EscapeMode{
+//	    ".html": luma.EscapeHTML,
+//	    ".xml":  luma.EscapeXML,
+//	}, luma.EscapeNone)
+func SelectAutoescape(modes map[string]EscapeMode, fallback EscapeMode) Autoescaper {
+	return AutoescapeFunc(func(name string) EscapeMode {
+		mode, matched := fallback, ""
+		for suffix, m := range modes {
+			if len(suffix) > len(matched) && strings.HasSuffix(name, suffix) {
+				mode, matched = m, suffix
+			}
+		}
+		return mode
+	})
+}
+
+// SafeString is a string that is already escaped for the output format.
+// It is rendered as is, like a value passed through the safe filter.
+// html/template.HTML values are treated the same way.
+type SafeString string
+
+// safeTypeName is the Lua type name of the safe string metatable
+const safeTypeName = "luma.safe"
+
+var (
+	safeStringType   = reflect.TypeOf(SafeString(""))
+	templateHTMLType = reflect.TypeOf(template.HTML(""))
+)
+
+// safeToLua wraps s in the runtime's safe string representation
+func (b *bridge) safeToLua(s string) *lua.LTable {
+	tbl := b.L.NewTable()
+	tbl.RawSetString("__luma_safe", lua.LTrue)
+	tbl.RawSetString("value", lua.LString(s))
+	b.L.SetMetatable(tbl, b.safeMetatable())
+	return tbl
+}
+
+func (b *bridge) safeMetatable() lua.LValue {
+	if mt := b.L.GetTypeMetatable(safeTypeName); mt != lua.LNil {
+		return mt
+	}
+	mt := b.L.NewTypeMetatable(safeTypeName)
+	b.L.SetField(mt, "__tostring", b.L.NewFunction(func(L *lua.LState) int {
+		L.Push(L.CheckTable(1).RawGetString("value"))
+		return 1
+	}))
+	return mt
+}
+
+// installAutoescape passes the environment's autoescape setting to the
+// Lua runtime
+func (e *Environment) installAutoescape(L *lua.LState) error {
+	autoescape := e.opts.Autoescape
+	if autoescape == nil {
+		autoescape = defaultAutoescape
+	}
+
+	var setting lua.LValue
+	switch a := autoescape.(type) {
+	case EscapeMode:
+		setting = lua.LString(a)
+	default:
+		setting = L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LString(a.Mode(L.OptString(1, ""))))
+			return 1
+		})
+	}
+
+	runtime, err := requireModule(L, "luma.runtime")
+	if err != nil {
+		return err
+	}
+	return L.CallByParam(lua.P{Fn: L.GetField(runtime, "set_autoescape"), NRet: 0, Protect: true}, setting)
+}
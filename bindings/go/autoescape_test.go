@@ -0,0 +1,287 @@
+package luma_test
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestAutoescapeModes(t *testing.T) {
+	context := map[string]interface{}{
+		"text":    `<a href='x'>Tom & "Jerry"</a>`,
+		"safe":    luma.SafeString("<b>bold</b>"),
+		"trusted": template.HTML("<i>italic</i>"),
+	}
+
+	tests := []struct {
+		name     string
+		mode     luma.Autoescaper
+		template string
+		want     string
+	}{
+		{
+			name:     "html by default",
+			template: "$text",
+			want:     "&lt;a href=&#x27;x&#x27;&gt;Tom &amp; &quot;Jerry&quot;&lt;/a&gt;",
+		},
+		{
+			name:     "xml",
+			mode:     luma.EscapeXML,
+			template: "$text",
+			want:     "&lt;a href=&apos;x&apos;&gt;Tom &amp; &quot;Jerry&quot;&lt;/a&gt;",
+		},
+		{
+			name:     "off",
+			mode:     luma.EscapeNone,
+			template: "$text",
+			want:     `<a href='x'>Tom & "Jerry"</a>`,
+		},
+		{
+			name:     "SafeString is not escaped",
+			mode:     luma.EscapeHTML,
+			template: "$safe",
+			want:     "<b>bold</b>",
+		},
+		{
+			name:     "template.HTML is not escaped",
+			mode:     luma.EscapeHTML,
+			template: "$trusted",
+			want:     "<i>italic</i>",
+		},
+		{
+			name:     "safe values survive filters that keep them",
+			mode:     luma.EscapeHTML,
+			template: "${safe | default('x')}",
+			want:     "<b>bold</b>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := luma.NewEnvironment(luma.Options{Autoescape: tt.mode})
+			got, err := env.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoescapeFilterResult(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	env.AddFilter("bold", func(s string) luma.SafeString {
+		return luma.SafeString("<b>" + template.HTMLEscapeString(s) + "</b>")
+	})
+
+	got, err := env.Render("${name | bold}", map[string]interface{}{"name": "<Ada>"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "<b>&lt;Ada&gt;</b>"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestSelectAutoescape(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{
+		Autoescape: luma.SelectAutoescape(map[string]luma.EscapeMode{
+			".html": luma.EscapeHTML,
+			".xml":  luma.EscapeXML,
+		}, luma.EscapeNone),
+		Loader: luma.MapLoader{
+			"email.html": `<p>$name</p>{% include "footer.txt" %}`,
+			"email.txt":  `Hi $name`,
+			"feed.xml":   `<title>$name</title>`,
+			"footer.txt": ` -- $name`,
+		},
+	})
+	context := map[string]interface{}{"name": "Tom & 'Jerry'"}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"email.html", "<p>Tom &amp; &#x27;Jerry&#x27;</p> -- Tom & 'Jerry'"},
+		{"email.txt", "Hi Tom & 'Jerry'"},
+		{"feed.xml", "<title>Tom &amp; &apos;Jerry&apos;</title>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := env.GetTemplate(tt.name)
+			if err != nil {
+				t.Fatalf("GetTemplate() error = %v", err)
+			}
+			got, err := tmpl.Execute(context)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// String templates have no name and use the fallback
+	got, err := env.Render("$name", context)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Tom & 'Jerry'" {
+		t.Errorf("Render() = %q", got)
+	}
+}
+
+func TestContextualEscaping(t *testing.T) {
+	context := map[string]interface{}{
+		"plain":   "nginx:1.25",
+		"colon":   "a: b",
+		"comment": "x # y",
+		"yes":     "yes",
+		"digits":  "007",
+		"port":    8080,
+		"enabled": true,
+		"quote":   `it's "quoted"`,
+		"cmd":     "rm -rf /; echo $HOME",
+		"interp":  "${var.secret} %{if x}",
+		"list":    []interface{}{"a", 1},
+		"dict":    map[string]interface{}{"b": 2, "a": "x"},
+		"raw":     "<b>",
+		"noMap":   map[string]string{},
+		"noList":  []string{},
+		"ports":   map[int]string{1: "http"},
+	}
+
+	tests := []struct {
+		mode     luma.EscapeMode
+		template string
+		want     string
+	}{
+		{luma.EscapeYAML, "image: $plain", "image: nginx:1.25"},
+		{luma.EscapeYAML, "value: $colon", `value: "a: b"`},
+		{luma.EscapeYAML, "value: $comment", `value: "x # y"`},
+		{luma.EscapeYAML, "value: $yes", `value: "yes"`},
+		{luma.EscapeYAML, "value: $digits", `value: "007"`},
+		{luma.EscapeYAML, "port: $port", "port: 8080"},
+		{luma.EscapeYAML, "enabled: $enabled", "enabled: true"},
+		{luma.EscapeYAML, "items: $list", `items: ["a",1]`},
+		{luma.EscapeYAML, "raw: ${raw | safe}", "raw: <b>"},
+		{luma.EscapeJSON, `{"v": $quote}`, `{"v": "it's \"quoted\""}`},
+		{luma.EscapeJSON, `{"port": $port, "on": $enabled}`, `{"port": 8080, "on": true}`},
+		{luma.EscapeJSON, `$dict`, `{"a":"x","b":2}`},
+		{luma.EscapeJSON, `$noMap $noList $ports`, `{} [] {"1":"http"}`},
+		{luma.EscapeYAML, "labels: $noMap", "labels: {}"},
+		{luma.EscapeHCL, "tags = $noMap", "tags = {}"},
+		{luma.EscapeShell, "docker run $plain", "docker run nginx:1.25"},
+		{luma.EscapeShell, "sh -c $cmd", `sh -c 'rm -rf /; echo $HOME'`},
+		{luma.EscapeShell, "echo $quote", `echo 'it'\''s "quoted"'`},
+		{luma.EscapeHCL, "name = $quote", `name = "it's \"quoted\""`},
+		{luma.EscapeHCL, "value = $interp", `value = "$${var.secret} %%{if x}"`},
+		{luma.EscapeHCL, "count = $port", "count = 8080"},
+		{luma.EscapeHCL, "tags = $list", `tags = ["a",1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode)+" "+tt.template, func(t *testing.T) {
+			env := luma.NewEnvironment(luma.Options{Autoescape: tt.mode})
+			got, err := env.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	env := luma.NewEnvironment(luma.Options{Autoescape: luma.EscapeShell})
+	for _, name := range []string{"dict", "noList"} {
+		if _, err := env.Render("echo $"+name, context); err == nil || !strings.Contains(err.Error(), "cannot write a list or map in shell output") {
+			t.Errorf("Render() of %s in shell mode error = %v, want a list or map error", name, err)
+		}
+	}
+}
+
+func TestEscapingByExtension(t *testing.T) {
+	source := "$value"
+	env := luma.NewEnvironment(luma.Options{
+		Loader: luma.MapLoader{
+			"values.yaml.luma": source,
+			"config.json.luma": source,
+			"install.sh.luma":  source,
+			"main.tf.luma":     source,
+			"index.html":       source,
+			"deployment.yaml":  source,
+			"nested.yaml.luma": `script: {% include "run.sh.luma" %}`,
+			"run.sh.luma":      `echo $value`,
+			"inline.yaml.luma": "{% autoescape 'shell' %}$value{% endautoescape %}",
+		},
+	})
+	context := map[string]interface{}{"value": "a: <b>"}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"values.yaml.luma", `"a: <b>"`},
+		{"config.json.luma", `"a: <b>"`},
+		{"install.sh.luma", `'a: <b>'`},
+		{"main.tf.luma", `"a: <b>"`},
+		{"index.html", "a: &lt;b&gt;"},
+		{"deployment.yaml", `"a: <b>"`},
+		{"nested.yaml.luma", `script: echo 'a: <b>'`},
+		{"inline.yaml.luma", `'a: <b>'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := env.GetTemplate(tt.name)
+			if err != nil {
+				t.Fatalf("GetTemplate() error = %v", err)
+			}
+			got, err := tmpl.Execute(context)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotingFilters(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	context := map[string]interface{}{
+		"value": `it's <"x">`,
+		"items": []interface{}{"a", "b"},
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"${value | yaml_quote}", `"it's <\"x\">"`},
+		{"${value | shell_quote}", `'it'\''s <"x">'`},
+		{"${value | hcl_quote}", `"it's <\"x\">"`},
+		{"${value | json}", `"it's \u003c\"x\"\u003e"`},
+		{"${items | json}", `["a","b"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := env.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
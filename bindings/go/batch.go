@@ -0,0 +1,76 @@
+package luma
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Result is the outcome of rendering one template in a batch.
+type Result struct {
+	Output string
+	Err    error
+}
+
+// ExecuteBatch renders the template once for each context, in parallel
+// up to Options.MaxConcurrency renders at a time. The outputs and errors
+// are in the order of the contexts; a failed render leaves its output
+// empty and does not stop the others.
+func (t *Template) ExecuteBatch(contexts []interface{}) ([]string, []error) {
+	outputs := make([]string, len(contexts))
+	errs := make([]error, len(contexts))
+	t.env.parallel(len(contexts), func(i int) {
+		outputs[i], errs[i] = t.Execute(contexts[i])
+	})
+	return outputs, errs
+}
+
+// RenderAll loads and renders each named template with the same context,
+// in parallel up to Options.MaxConcurrency renders at a time. Every name
+// has an entry in the result, holding either its output or the error
+// that loading or rendering it produced.
+func (e *Environment) RenderAll(names []string, context interface{}) map[string]Result {
+	results := make([]Result, len(names))
+	e.parallel(len(names), func(i int) {
+		tmpl, err := e.GetTemplate(names[i])
+		if err != nil {
+			results[i].Err = err
+			return
+		}
+		results[i].Output, results[i].Err = tmpl.Execute(context)
+	})
+
+	byName := make(map[string]Result, len(names))
+	for i, name := range names {
+		byName[name] = results[i]
+	}
+	return byName
+}
+
+// parallel calls fn for each index below n, running at most
+// Options.MaxConcurrency calls at once, and waits for them to finish
+func (e *Environment) parallel(n int, fn func(i int)) {
+	workers := e.opts.MaxConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
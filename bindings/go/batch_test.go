@@ -0,0 +1,92 @@
+package luma_test
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestExecuteBatch(t *testing.T) {
+	tmpl, err := luma.NewEnvironment(luma.Options{}).Compile("tenant $id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contexts := make([]interface{}, 50)
+	for i := range contexts {
+		contexts[i] = map[string]interface{}{"id": i}
+	}
+	contexts[7] = 42
+
+	outputs, errs := tmpl.ExecuteBatch(contexts)
+	if len(outputs) != len(contexts) || len(errs) != len(contexts) {
+		t.Fatalf("ExecuteBatch() returned %d outputs and %d errors for %d contexts", len(outputs), len(errs), len(contexts))
+	}
+	for i := range contexts {
+		if i == 7 {
+			if errs[i] == nil || outputs[i] != "" {
+				t.Errorf("context 7: got %q, %v, want an error", outputs[i], errs[i])
+			}
+			continue
+		}
+		if want := fmt.Sprintf("tenant %d", i); outputs[i] != want || errs[i] != nil {
+			t.Errorf("context %d: got %q, %v, want %q", i, outputs[i], errs[i], want)
+		}
+	}
+}
+
+func TestExecuteBatchConcurrencyLimit(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{MaxConcurrency: 3})
+	var running, peak atomic.Int64
+	env.AddGlobal("work", func() string {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return "done"
+	})
+	tmpl, err := env.Compile("${work()}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, errs := tmpl.ExecuteBatch(make([]interface{}, 20))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("context %d: %v", i, err)
+		}
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d renders ran at once, want at most 3", p)
+	}
+}
+
+func TestRenderAll(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deployment.yaml": "name: $name",
+		"service.yaml":    "service: $name",
+	}})
+
+	results := env.RenderAll([]string{"deployment.yaml", "service.yaml", "missing.yaml"}, map[string]interface{}{"name": "web"})
+	if len(results) != 3 {
+		t.Fatalf("RenderAll() returned %d results, want 3", len(results))
+	}
+	if r := results["deployment.yaml"]; r.Output != "name: web" || r.Err != nil {
+		t.Errorf("deployment.yaml = %+v", r)
+	}
+	if r := results["service.yaml"]; r.Output != "service: web" || r.Err != nil {
+		t.Errorf("service.yaml = %+v", r)
+	}
+	if r := results["missing.yaml"]; !errors.Is(r.Err, luma.ErrTemplateNotFound) {
+		t.Errorf("missing.yaml error = %v, want ErrTemplateNotFound", r.Err)
+	}
+}
@@ -0,0 +1,727 @@
+package luma
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// goValueKey is the metatable field that holds the original Go value
+// behind a converted struct, so it can be passed back to Go functions
+// unchanged.
+const goValueKey = "__goval"
+
+// arrayMarker and objectMarker are the metatable fields that tell the
+// output encoders of luma.runtime.escapers whether a converted table was
+// a slice or a map or struct, which an empty table cannot show
+const (
+	arrayMarker  = "__luma_array"
+	objectMarker = "__luma_object"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// bridge converts values between Go and Lua for a single Lua state.
+// It carries the Environment whose rules decide what Go values expose.
+type bridge struct {
+	L    *lua.LState
+	env  *Environment
+	seen map[seenKey]*lua.LTable
+}
+
+// seenKey identifies a pointer already converted during this render,
+// so cyclic and shared structures map to the same Lua table.
+type seenKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func newBridge(L *lua.LState, env *Environment) *bridge {
+	return &bridge{
+		L:    L,
+		env:  env,
+		seen: make(map[seenKey]*lua.LTable),
+	}
+}
+
+// toLua converts a Go value to a Lua value
+func (b *bridge) toLua(val interface{}) lua.LValue {
+	if val == nil {
+		return lua.LNil
+	}
+
+	switch v := val.(type) {
+	case lua.LValue:
+		return v
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		tbl := b.L.NewTable()
+		for i, item := range v {
+			tbl.RawSetInt(i+1, b.toLua(item))
+		}
+		b.L.SetMetatable(tbl, b.collectionMetatable(arrayMarker))
+		return tbl
+	case map[string]interface{}:
+		tbl := b.L.NewTable()
+		for key, item := range v {
+			tbl.RawSetString(key, b.namedToLua(key, reflect.ValueOf(item)))
+		}
+		b.L.SetMetatable(tbl, b.collectionMetatable(objectMarker))
+		return tbl
+	default:
+		return b.valueToLua(reflect.ValueOf(v))
+	}
+}
+
+// valueToLua converts an arbitrary Go value using reflection
+func (b *bridge) valueToLua(rv reflect.Value) lua.LValue {
+	if rv.IsValid() {
+		if lv, ok := b.specialToLua(rv); ok {
+			return lv
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return lua.LNil
+	case reflect.Bool:
+		return lua.LBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return lua.LNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(rv.Float())
+	case reflect.String:
+		return lua.LString(rv.String())
+	case reflect.Slice, reflect.Map:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		if rv.Kind() == reflect.Map {
+			return b.mapToLua(rv)
+		}
+		return b.sliceToLua(rv)
+	case reflect.Array:
+		return b.sliceToLua(rv)
+	case reflect.Struct:
+		return b.structToLua(rv, rv)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		if rv.Elem().Kind() != reflect.Struct {
+			return b.valueToLua(rv.Elem())
+		}
+		key := seenKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if tbl, ok := b.seen[key]; ok {
+			return tbl
+		}
+		return b.structToLua(rv.Elem(), rv)
+	case reflect.Interface:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		return b.valueToLua(rv.Elem())
+	case reflect.Func:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		return b.funcToLua("function", rv)
+	default:
+		return lua.LString(fmt.Sprintf("%v", rv.Interface()))
+	}
+}
+
+// namedToLua converts a value stored under name, using the name to
+// label errors from functions
+func (b *bridge) namedToLua(name string, rv reflect.Value) lua.LValue {
+	if rv.Kind() == reflect.Interface && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Func && !rv.IsNil() {
+		return b.funcToLua(name, rv)
+	}
+	return b.valueToLua(rv)
+}
+
+func (b *bridge) sliceToLua(rv reflect.Value) *lua.LTable {
+	tbl := b.L.CreateTable(rv.Len(), 0)
+	for i := 0; i < rv.Len(); i++ {
+		tbl.RawSetInt(i+1, b.valueToLua(rv.Index(i)))
+	}
+	b.L.SetMetatable(tbl, b.collectionMetatable(arrayMarker))
+	return tbl
+}
+
+func (b *bridge) mapToLua(rv reflect.Value) *lua.LTable {
+	tbl := b.L.CreateTable(0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key := b.keyToLua(iter.Key())
+		tbl.RawSet(key, b.namedToLua(key.String(), iter.Value()))
+	}
+	b.L.SetMetatable(tbl, b.collectionMetatable(objectMarker))
+	return tbl
+}
+
+// collectionMetatable returns the shared metatable marking converted
+// slices or maps, with marker set
+func (b *bridge) collectionMetatable(marker string) lua.LValue {
+	name := "luma" + marker
+	if mt := b.L.GetTypeMetatable(name); mt != lua.LNil {
+		return mt
+	}
+	mt := b.L.NewTypeMetatable(name)
+	mt.RawSetString(marker, lua.LTrue)
+	return mt
+}
+
+// keyToLua converts a map key. Numeric keys stay numbers so they can be
+// indexed like arrays; anything else is keyed by its string form.
+func (b *bridge) keyToLua(rv reflect.Value) lua.LValue {
+	switch rv.Kind() {
+	case reflect.String:
+		return lua.LString(rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return b.valueToLua(rv)
+	default:
+		return lua.LString(fmt.Sprint(rv.Interface()))
+	}
+}
+
+// structToLua converts a struct to a table of its exported fields.
+// recv is the value methods are looked up on: the struct itself, or
+// the pointer it was reached through so pointer methods are callable.
+func (b *bridge) structToLua(rv, recv reflect.Value) *lua.LTable {
+	tbl := b.L.NewTable()
+	if recv.Kind() == reflect.Ptr {
+		b.seen[seenKey{ptr: recv.Pointer(), typ: recv.Type()}] = tbl
+	}
+
+	for _, f := range reflect.VisibleFields(rv.Type()) {
+		if !f.IsExported() {
+			continue
+		}
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		fv, err := rv.FieldByIndexErr(f.Index)
+		if err != nil {
+			// Promoted through a nil embedded pointer
+			continue
+		}
+		tbl.RawSetString(name, b.namedToLua(name, fv))
+	}
+
+	mt := b.L.NewTable()
+	mt.RawSetString(goValueKey, &lua.LUserData{Value: recv.Interface()})
+	mt.RawSetString(objectMarker, lua.LTrue)
+	if recv.NumMethod() > 0 {
+		mt.RawSetString("__index", b.methodIndex(recv))
+	}
+	if fn := b.stringerMetamethod(recv); fn != nil {
+		mt.RawSetString("__tostring", fn)
+	}
+	b.L.SetMetatable(tbl, mt)
+	return tbl
+}
+
+// methodIndex returns an __index function that resolves exported
+// methods of recv by name, bound to recv.
+func (b *bridge) methodIndex(recv reflect.Value) *lua.LFunction {
+	typeName := indirectType(recv.Type()).Name()
+	bound := make(map[string]*lua.LFunction)
+
+	return b.L.NewFunction(func(L *lua.LState) int {
+		name, ok := L.Get(2).(lua.LString)
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if fn, ok := bound[string(name)]; ok {
+			L.Push(fn)
+			return 1
+		}
+		method := recv.MethodByName(string(name))
+		if !method.IsValid() || !b.methodAllowed(recv.Type(), string(name)) {
+			L.Push(lua.LNil)
+			return 1
+		}
+		fn := b.funcToLua(typeName+"."+string(name), method)
+		bound[string(name)] = fn
+		L.Push(fn)
+		return 1
+	})
+}
+
+func (b *bridge) methodAllowed(t reflect.Type, name string) bool {
+	if b.env == nil {
+		return true
+	}
+	return b.env.methodAllowed(t, name)
+}
+
+// funcToLua wraps a Go function so templates can call it. Lua arguments
+// are converted to the function's parameter types; a trailing error
+// result is raised as a template error.
+func (b *bridge) funcToLua(name string, fn reflect.Value) *lua.LFunction {
+	return b.L.NewFunction(func(L *lua.LState) int {
+		args := make([]lua.LValue, L.GetTop())
+		for i := range args {
+			args[i] = L.Get(i + 1)
+		}
+
+		in, err := b.callArgs(fn.Type(), args)
+		if err != nil {
+			L.RaiseError("%s: %s", name, err.Error())
+			return 0
+		}
+
+		out, err := callGo(fn, in)
+		if err != nil {
+			L.RaiseError("%s: %s", name, err.Error())
+			return 0
+		}
+
+		// A trailing error result becomes a template error
+		if n := len(out); n > 0 && fn.Type().Out(n-1) == errorType {
+			if errv := out[n-1]; !errv.IsNil() {
+				L.RaiseError("%s: %s", name, errv.Interface().(error).Error())
+				return 0
+			}
+			out = out[:n-1]
+		}
+
+		for _, v := range out {
+			L.Push(b.valueToLua(v))
+		}
+		return len(out)
+	})
+}
+
+// callGo calls fn, turning a panic into an error
+func callGo(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// callArgs maps Lua call arguments onto the parameters of a Go function.
+// Missing arguments take their zero value, extra arguments are collected
+// by a variadic parameter, and keyword arguments (passed by the compiler
+// as a trailing table) fill a final struct or map parameter.
+func (b *bridge) callArgs(ft reflect.Type, args []lua.LValue) ([]reflect.Value, error) {
+	numIn := ft.NumIn()
+	fixed := numIn
+	if ft.IsVariadic() {
+		fixed--
+	}
+
+	// f(x, key=value) against func(x, y int, opts Options): route the
+	// keyword table to opts and leave y at its zero value
+	if !ft.IsVariadic() && len(args) > 0 && len(args) < numIn &&
+		isKeywordTable(args[len(args)-1]) && isKeywordType(ft.In(numIn-1)) {
+		padded := make([]lua.LValue, numIn)
+		copy(padded, args[:len(args)-1])
+		for i := len(args) - 1; i < numIn-1; i++ {
+			padded[i] = lua.LNil
+		}
+		padded[numIn-1] = args[len(args)-1]
+		args = padded
+	}
+
+	if !ft.IsVariadic() && len(args) > numIn {
+		return nil, fmt.Errorf("too many arguments: got %d, want %d", len(args), numIn)
+	}
+
+	in := make([]reflect.Value, 0, len(args))
+	for i := 0; i < fixed; i++ {
+		var lv lua.LValue = lua.LNil
+		if i < len(args) {
+			lv = args[i]
+		}
+		v, err := b.fromLua(lv, ft.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in = append(in, v)
+	}
+
+	if ft.IsVariadic() {
+		elem := ft.In(fixed).Elem()
+		for i := fixed; i < len(args); i++ {
+			v, err := b.fromLua(args[i], elem)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i+1, err)
+			}
+			in = append(in, v)
+		}
+	}
+
+	return in, nil
+}
+
+// isKeywordTable reports whether lv looks like the named-argument table
+// the compiler appends to calls: a plain table with only string keys.
+func isKeywordTable(lv lua.LValue) bool {
+	tbl, ok := lv.(*lua.LTable)
+	if !ok || tbl.Metatable != lua.LNil || tbl.Len() > 0 {
+		return false
+	}
+	keyed := false
+	onlyStrings := true
+	tbl.ForEach(func(k, _ lua.LValue) {
+		keyed = true
+		if _, ok := k.(lua.LString); !ok {
+			onlyStrings = false
+		}
+	})
+	return keyed && onlyStrings
+}
+
+func isKeywordType(t reflect.Type) bool {
+	t = indirectType(t)
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Map && t.Key().Kind() == reflect.String)
+}
+
+// fromLua converts a Lua value to a Go value of type t
+func (b *bridge) fromLua(lv lua.LValue, t reflect.Type) (reflect.Value, error) {
+	if lv == lua.LNil {
+		return reflect.Zero(t), nil
+	}
+
+	// Values that started out in Go come back unchanged
+	if gv, ok := goValue(lv); ok {
+		rv := reflect.ValueOf(gv)
+		if rv.Type().AssignableTo(t) {
+			return rv, nil
+		}
+		if rv.Kind() == reflect.Ptr && rv.Elem().Type().AssignableTo(t) {
+			return rv.Elem(), nil
+		}
+	}
+
+	switch t {
+	case timeType:
+		tm, err := toTime(lv)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(tm), nil
+	case durationType:
+		if s, ok := lv.(lua.LString); ok {
+			d, err := time.ParseDuration(string(s))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(d), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		v := b.toInterface(lv)
+		if v == nil {
+			return reflect.Zero(t), nil
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.Type().Implements(t) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		out := reflect.New(t).Elem()
+		out.Set(rv)
+		return out, nil
+
+	case reflect.String:
+		s, ok := luaString(lv)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+
+	case reflect.Bool:
+		return reflect.ValueOf(lua.LVAsBool(lv)).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return numberFromLua(lv, t)
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if s, ok := luaString(lv); ok {
+				return reflect.ValueOf([]byte(s)).Convert(t), nil
+			}
+		}
+		tbl, ok := lv.(*lua.LTable)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		n := tbl.Len()
+		out := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			v, err := b.fromLua(tbl.RawGetInt(i+1), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", i+1, err)
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+
+	case reflect.Array:
+		tbl, ok := lv.(*lua.LTable)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		out := reflect.New(t).Elem()
+		for i := 0; i < t.Len(); i++ {
+			v, err := b.fromLua(tbl.RawGetInt(i+1), t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", i+1, err)
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+
+	case reflect.Map:
+		tbl, ok := lv.(*lua.LTable)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		out := reflect.MakeMap(t)
+		var err error
+		tbl.ForEach(func(k, v lua.LValue) {
+			if err != nil {
+				return
+			}
+			var kv, vv reflect.Value
+			if kv, err = b.fromLua(k, t.Key()); err != nil {
+				return
+			}
+			if vv, err = b.fromLua(v, t.Elem()); err != nil {
+				err = fmt.Errorf("key %s: %w", k.String(), err)
+				return
+			}
+			out.SetMapIndex(kv, vv)
+		})
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return out, nil
+
+	case reflect.Struct:
+		tbl, ok := lv.(*lua.LTable)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+		}
+		return b.structFromLua(tbl, t)
+
+	case reflect.Ptr:
+		v, err := b.fromLua(lv, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+}
+
+// structFromLua fills a struct from a table, matching keys to field
+// names (or luma tags) without regard to case.
+func (b *bridge) structFromLua(tbl *lua.LTable, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	fields := make(map[string]reflect.StructField)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		if name, ok := fieldName(f); ok {
+			fields[strings.ToLower(name)] = f
+		}
+	}
+
+	var err error
+	tbl.ForEach(func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		key, ok := k.(lua.LString)
+		if !ok {
+			return
+		}
+		f, ok := fields[strings.ToLower(string(key))]
+		if !ok {
+			err = fmt.Errorf("unknown field %q in %s", string(key), t)
+			return
+		}
+		var fv, dst reflect.Value
+		if fv, err = b.fromLua(v, f.Type); err != nil {
+			err = fmt.Errorf("field %s: %w", f.Name, err)
+			return
+		}
+		if dst, err = out.FieldByIndexErr(f.Index); err != nil {
+			return
+		}
+		dst.Set(fv)
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return out, nil
+}
+
+// toInterface converts a Lua value to its natural Go representation
+func (b *bridge) toInterface(lv lua.LValue) interface{} {
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		return nil
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LUserData:
+		return v.Value
+	case *lua.LTable:
+		if gv, ok := goValue(v); ok {
+			return gv
+		}
+		if s, ok := safeString(v); ok {
+			return s
+		}
+		n := v.Len()
+		count := 0
+		v.ForEach(func(_, _ lua.LValue) { count++ })
+		if count == n {
+			list := make([]interface{}, n)
+			for i := range list {
+				list[i] = b.toInterface(v.RawGetInt(i + 1))
+			}
+			return list
+		}
+		m := make(map[string]interface{}, count)
+		v.ForEach(func(k, item lua.LValue) {
+			m[k.String()] = b.toInterface(item)
+		})
+		return m
+	default:
+		return lv
+	}
+}
+
+// goValue returns the Go value a Lua value was converted from, if any
+func goValue(lv lua.LValue) (interface{}, bool) {
+	switch v := lv.(type) {
+	case *lua.LUserData:
+		return v.Value, true
+	case *lua.LTable:
+		mt, ok := v.Metatable.(*lua.LTable)
+		if !ok {
+			return nil, false
+		}
+		if ud, ok := mt.RawGetString(goValueKey).(*lua.LUserData); ok {
+			return ud.Value, true
+		}
+	}
+	return nil, false
+}
+
+// safeString unwraps a value marked safe by the runtime
+func safeString(tbl *lua.LTable) (string, bool) {
+	if tbl.RawGetString("__luma_safe") != lua.LTrue {
+		return "", false
+	}
+	s, _ := luaString(tbl.RawGetString("value"))
+	return s, true
+}
+
+// luaString converts scalars and safe strings to a Go string
+func luaString(lv lua.LValue) (string, bool) {
+	switch v := lv.(type) {
+	case lua.LString:
+		return string(v), true
+	case lua.LNumber, lua.LBool:
+		return v.String(), true
+	case *lua.LTable:
+		return safeString(v)
+	}
+	return "", false
+}
+
+func numberFromLua(lv lua.LValue, t reflect.Type) (reflect.Value, error) {
+	var n float64
+	switch v := lv.(type) {
+	case lua.LNumber:
+		n = float64(v)
+	case lua.LString:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot use %q as %s", string(v), t)
+		}
+		n = f
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", lv.Type(), t)
+	}
+
+	out := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		out.SetFloat(n)
+		return out, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n != float64(int64(n)) || out.OverflowInt(int64(n)) {
+			return reflect.Value{}, fmt.Errorf("%v does not fit in %s", n, t)
+		}
+		out.SetInt(int64(n))
+	default:
+		if n < 0 || n != float64(uint64(n)) || out.OverflowUint(uint64(n)) {
+			return reflect.Value{}, fmt.Errorf("%v does not fit in %s", n, t)
+		}
+		out.SetUint(uint64(n))
+	}
+	return out, nil
+}
+
+// fieldName returns the template name of a struct field: its luma tag
+// if present, otherwise the Go field name. A tag of "-" hides the field.
+func fieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("luma")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,228 @@
+package luma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// defaultCacheMaxBytes bounds the compiled template cache unless
+// Options.CacheMaxBytes is set
+const defaultCacheMaxBytes = 64 << 20
+
+// cacheFormat identifies the layout of cache entries; entries written in
+// another format are ignored
+const cacheFormat = 1
+
+// diskCache stores generated template code in a directory. Entries are
+// written atomically, so several processes may share a directory, and
+// the least recently used entries are evicted once the directory grows
+// beyond max bytes. All errors are treated as cache misses: the cache
+// only ever saves work.
+type diskCache struct {
+	dir string
+	max int64
+
+	mu      sync.Mutex
+	size    int64 // approximate size of the entries in dir
+	scanned bool
+}
+
+// cacheEntry is the on-disk form of a cached template
+type cacheEntry struct {
+	Format  int               `json:"format"`
+	Code    string            `json:"code"`
+	Parents map[string]string `json:"parents,omitempty"`
+}
+
+func newDiskCache(dir string, max int64) *diskCache {
+	if max <= 0 {
+		max = defaultCacheMaxBytes
+	}
+	return &diskCache{dir: dir, max: max}
+}
+
+// fingerprint returns the hex SHA-256 digest of data
+func fingerprint(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns the file of the entry for key
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// validKey reports whether key is a fingerprint, and so safe to use as
+// a file name
+func validKey(key string) bool {
+	if len(key) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// get returns the cached code for key and the fingerprints of the parent
+// templates it was generated with
+func (c *diskCache) get(key string) (string, map[string]string, bool) {
+	if !validKey(key) {
+		return "", nil, false
+	}
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Format != cacheFormat {
+		os.Remove(path)
+		return "", nil, false
+	}
+
+	// Mark the entry as recently used
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return entry.Code, entry.Parents, true
+}
+
+// put stores code for key, evicting old entries if the cache is full
+func (c *diskCache) put(key, code string, parents map[string]string) {
+	if !validKey(key) {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Format: cacheFormat, Code: code, Parents: parents})
+	if err != nil {
+		return
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+key+"-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.scanned {
+		c.scan()
+	} else {
+		c.size += int64(len(data))
+	}
+	if c.size > c.max {
+		c.evict()
+	}
+}
+
+// cacheFile is an entry found while scanning the cache directory
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// scan measures the cache directory and returns its entries.
+// c.mu must be held.
+func (c *diskCache) scan() []cacheFile {
+	var files []cacheFile
+	c.size = 0
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		c.size += info.Size()
+		return nil
+	})
+	c.scanned = true
+	return files
+}
+
+// evict removes the least recently used entries until the cache fits in
+// its bound. c.mu must be held.
+func (c *diskCache) evict() {
+	// Other processes may share the directory, so measure it again
+	files := c.scan()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if c.size <= c.max {
+			break
+		}
+		if err := os.Remove(f.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			c.size -= f.size
+		}
+	}
+}
+
+// installCodeCache makes the Lua compiler store generated code in the
+// environment's disk cache.
+func (e *Environment) installCodeCache(L *lua.LState) error {
+	if e.cache == nil {
+		return nil
+	}
+	compiler, err := requireModule(L, "luma.compiler")
+	if err != nil {
+		return err
+	}
+
+	c := e.cache
+	cache := L.NewTable()
+	L.SetField(cache, "fingerprint", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(fingerprint(L.CheckString(1))))
+		return 1
+	}))
+	L.SetField(cache, "get", L.NewFunction(func(L *lua.LState) int {
+		code, parents, ok := c.get(L.CheckString(1))
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		tbl := L.NewTable()
+		for name, fp := range parents {
+			tbl.RawSetString(name, lua.LString(fp))
+		}
+		L.Push(lua.LString(code))
+		L.Push(tbl)
+		return 2
+	}))
+	L.SetField(cache, "put", L.NewFunction(func(L *lua.LState) int {
+		parents := make(map[string]string)
+		L.OptTable(3, L.NewTable()).ForEach(func(k, v lua.LValue) {
+			parents[k.String()] = v.String()
+		})
+		c.put(L.CheckString(1), L.CheckString(2), parents)
+		return 0
+	}))
+
+	return L.CallByParam(lua.P{Fn: L.GetField(compiler, "set_code_cache"), NRet: 0, Protect: true}, cache)
+}
@@ -0,0 +1,182 @@
+package luma_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+// cacheEntries returns the entry files in a cache directory
+func cacheEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && filepath.Ext(path) == ".json" {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func mustRender(t *testing.T, env *luma.Environment, source string, context interface{}) string {
+	t.Helper()
+	got, err := env.Render(source, context)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	return got
+}
+
+func TestCompiledCache(t *testing.T) {
+	dir := t.TempDir()
+	context := map[string]interface{}{"name": "World"}
+
+	env := luma.NewEnvironment(luma.Options{CacheDir: dir})
+	if got := mustRender(t, env, "Hello, $name!", context); got != "Hello, World!" {
+		t.Fatalf("Render() = %q", got)
+	}
+	entries := cacheEntries(t, dir)
+	if len(entries) != 1 {
+		t.Fatalf("cache has %d entries, want 1", len(entries))
+	}
+
+	// A later environment uses the stored code instead of compiling
+	data, err := os.ReadFile(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	entry["code"] = strings.Replace(entry["code"].(string), "Hello", "Howdy", 1)
+	if data, err = json.Marshal(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entries[0], data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := luma.NewEnvironment(luma.Options{CacheDir: dir})
+	if got := mustRender(t, next, "Hello, $name!", context); got != "Howdy, World!" {
+		t.Errorf("Render() = %q, want the cached code's output", got)
+	}
+
+	// Options are part of the key
+	other := luma.NewEnvironment(luma.Options{CacheDir: dir, Autoescape: luma.EscapeNone})
+	mustRender(t, other, "Hello, $name!", context)
+	if n := len(cacheEntries(t, dir)); n != 2 {
+		t.Errorf("cache has %d entries after rendering with other options, want 2", n)
+	}
+}
+
+func TestCompiledCacheExtensions(t *testing.T) {
+	dir := t.TempDir()
+	source := "a\n@feature x\nbody\n@end\nb"
+	context := map[string]interface{}{"x": "on"}
+	// render renders source with a fresh environment, the feature
+	// extension registered unless block is nil
+	render := func(cacheDir string, block *bool) (string, error) {
+		env := luma.NewEnvironment(luma.Options{CacheDir: cacheDir})
+		if block != nil {
+			err := env.AddExtension(luma.Extension{
+				Name:  "feature",
+				Block: *block,
+				Render: func(call luma.ExtensionCall) (string, error) {
+					return fmt.Sprintf("[%v|%q]", call.Args, call.Body), nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return env.Render(source, context)
+	}
+
+	yes, no := true, false
+	for _, block := range []*bool{&yes, &no, nil} {
+		want, wantErr := render("", block)
+		got, err := render(dir, block)
+		if got != want || (err == nil) != (wantErr == nil) {
+			t.Errorf("Render() with a shared cache = %q, %v, want %q, %v", got, err, want, wantErr)
+		}
+	}
+}
+
+func TestCompiledCacheCorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	env := luma.NewEnvironment(luma.Options{CacheDir: dir})
+	mustRender(t, env, "Hello, $name!", nil)
+
+	entries := cacheEntries(t, dir)
+	if len(entries) != 1 {
+		t.Fatalf("cache has %d entries, want 1", len(entries))
+	}
+	if err := os.WriteFile(entries[0], []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := luma.NewEnvironment(luma.Options{CacheDir: dir})
+	if got := mustRender(t, next, "Hello, $name!", map[string]interface{}{"name": "again"}); got != "Hello, again!" {
+		t.Errorf("Render() = %q with a corrupt cache entry", got)
+	}
+}
+
+func TestCompiledCacheParentChange(t *testing.T) {
+	dir := t.TempDir()
+	templates := luma.MapLoader{"base.luma": "v1\n@block body\n@end"}
+	child := "@extends \"base.luma\"\n@block body\nchild\n@end"
+
+	env := luma.NewEnvironment(luma.Options{CacheDir: dir, Loader: templates})
+	if got := mustRender(t, env, child, nil); !strings.HasPrefix(got, "v1") {
+		t.Fatalf("Render() = %q, want the v1 parent", got)
+	}
+
+	templates["base.luma"] = "v2\n@block body\n@end"
+	next := luma.NewEnvironment(luma.Options{CacheDir: dir, Loader: templates})
+	if got := mustRender(t, next, child, nil); !strings.HasPrefix(got, "v2") {
+		t.Errorf("Render() = %q, want the changed parent", got)
+	}
+}
+
+func TestCompiledCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	env := luma.NewEnvironment(luma.Options{CacheDir: dir})
+	mustRender(t, env, "Hello, $name0!", nil)
+	info, err := os.Stat(cacheEntries(t, dir)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := 2*info.Size() + info.Size()/2
+	env = luma.NewEnvironment(luma.Options{CacheDir: dir, CacheMaxBytes: limit})
+	for _, name := range []string{"name1", "name2", "name3", "name4"} {
+		mustRender(t, env, "Hello, $"+name+"!", nil)
+	}
+
+	var total int64
+	entries := cacheEntries(t, dir)
+	for _, path := range entries {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	if total > limit {
+		t.Errorf("cache holds %d bytes, want at most %d", total, limit)
+	}
+	if len(entries) != 2 {
+		t.Errorf("cache has %d entries, want the 2 most recent", len(entries))
+	}
+}
@@ -0,0 +1,531 @@
+package luma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Catalog holds the translations of one language, loaded from a gettext
+// PO or MO file or from JSON. Register it for a locale with
+// Environment.AddCatalog.
+type Catalog struct {
+	// messages maps message ids to their translations, one per plural
+	// form
+	messages map[string][]string
+	// plural picks the plural form for a count
+	plural pluralExpr
+}
+
+// Gettext returns the translation of message, or message itself when
+// the catalog does not translate it.
+func (c *Catalog) Gettext(message string) string {
+	if forms := c.messages[message]; len(forms) > 0 && forms[0] != "" {
+		return forms[0]
+	}
+	return message
+}
+
+// Ngettext returns the translation of a message with a plural form for
+// the count n. Untranslated messages use singular when n is 1 and
+// plural otherwise.
+func (c *Catalog) Ngettext(singular, plural string, n int) string {
+	forms := c.messages[singular]
+	if i := c.plural(n); i >= 0 && i < len(forms) && forms[i] != "" {
+		return forms[i]
+	}
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// newCatalog creates an empty catalog with the plural rule of a
+// Plural-Forms header, English-like when the header is empty
+func newCatalog(pluralForms string) (*Catalog, error) {
+	c := &Catalog{messages: make(map[string][]string)}
+	if pluralForms == "" {
+		c.plural = germanicPlural
+		return c, nil
+	}
+	plural, err := parsePluralForms(pluralForms)
+	if err != nil {
+		return nil, err
+	}
+	c.plural = plural
+	return c, nil
+}
+
+// germanicPlural is the plural rule of languages without a Plural-Forms
+// header: one form for 1 and another for every other count
+func germanicPlural(n int) int {
+	if n == 1 {
+		return 0
+	}
+	return 1
+}
+
+// LoadCatalog loads a catalog file, choosing the format by its
+// extension: .po, .mo or .json.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".po":
+		return ParsePO(data)
+	case ".mo":
+		return ParseMO(data)
+	case ".json":
+		return ParseJSONCatalog(data)
+	default:
+		return nil, fmt.Errorf("unsupported catalog format %q: use .po, .mo or .json", ext)
+	}
+}
+
+// ParseJSONCatalog parses a catalog in JSON. Messages map a message id
+// to its translation, or for messages with a plural form, the singular
+// message id to the list of translations of each plural form:
+//
+//	{
+//	  "plural_forms": "nplurals=2; plural=(n != 1);",
+//	  "messages": {
+//	    "Welcome back!": "Willkommen zurück!",
+//	    "%(count)s new message": ["%(count)s neue Nachricht", "%(count)s neue Nachrichten"]
+//	  }
+//	}
+//
+// Without plural_forms, the first form is used for 1 and the second for
+// every other count.
+func ParseJSONCatalog(data []byte) (*Catalog, error) {
+	var doc struct {
+		PluralForms string                     `json:"plural_forms"`
+		Messages    map[string]json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON catalog: %w", err)
+	}
+	c, err := newCatalog(doc.PluralForms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON catalog: %w", err)
+	}
+	for id, raw := range doc.Messages {
+		var translation string
+		if json.Unmarshal(raw, &translation) == nil {
+			c.messages[id] = []string{translation}
+			continue
+		}
+		var forms []string
+		if err := json.Unmarshal(raw, &forms); err != nil {
+			return nil, fmt.Errorf("invalid JSON catalog: message %q must be a string or a list of strings", id)
+		}
+		c.messages[id] = forms
+	}
+	return c, nil
+}
+
+// poEntry is a message being read from a PO file
+type poEntry struct {
+	context, id, plural string
+	forms               []string
+	fuzzy               bool
+}
+
+// ParsePO parses a gettext PO file. Fuzzy and obsolete entries are left
+// out, like msgfmt does, and the plural rule comes from the Plural-Forms
+// header. Entries with a msgctxt context are left out too, since
+// templates have no function to look them up.
+func ParsePO(data []byte) (*Catalog, error) {
+	var entries []*poEntry
+	entry := new(poEntry)
+	// target is the string continuation lines append to
+	var target *string
+	// flush ends the entry being read once it has its translations
+	flush := func() {
+		if entry.forms == nil {
+			return
+		}
+		entries = append(entries, entry)
+		entry = new(poEntry)
+		target = nil
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		lineNo := i + 1
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#~"):
+			// Obsolete entries are kept in comments
+			flush()
+			target = nil
+			continue
+		case strings.HasPrefix(line, "#,"):
+			flush()
+			for _, flag := range strings.Split(line[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					entry.fuzzy = true
+				}
+			}
+			continue
+		case strings.HasPrefix(line, "#"):
+			flush()
+			continue
+		case strings.HasPrefix(line, `"`):
+			if target == nil {
+				return nil, fmt.Errorf("invalid PO catalog: line %d: string outside of a keyword", lineNo)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PO catalog: line %d: %w", lineNo, err)
+			}
+			*target += s
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		value, err := strconv.Unquote(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PO catalog: line %d: %w", lineNo, err)
+		}
+		switch {
+		case keyword == "msgctxt":
+			flush()
+			entry.context = value
+			target = &entry.context
+		case keyword == "msgid":
+			flush()
+			entry.id = value
+			target = &entry.id
+		case keyword == "msgid_plural":
+			entry.plural = value
+			target = &entry.plural
+		case keyword == "msgstr":
+			entry.forms = append(entry.forms, value)
+			target = &entry.forms[len(entry.forms)-1]
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			n, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil || n != len(entry.forms) {
+				return nil, fmt.Errorf("invalid PO catalog: line %d: unexpected %s", lineNo, keyword)
+			}
+			entry.forms = append(entry.forms, value)
+			target = &entry.forms[n]
+		default:
+			return nil, fmt.Errorf("invalid PO catalog: line %d: unknown keyword %q", lineNo, keyword)
+		}
+	}
+	flush()
+
+	var header string
+	for _, e := range entries {
+		if e.id == "" && e.context == "" && len(e.forms) > 0 {
+			header = e.forms[0]
+		}
+	}
+	c, err := newCatalog(headerField(header, "Plural-Forms"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PO catalog: %w", err)
+	}
+	for _, e := range entries {
+		if e.fuzzy || e.id == "" || e.context != "" {
+			continue
+		}
+		c.messages[e.id] = e.forms
+	}
+	return c, nil
+}
+
+// headerField returns a field of a catalog header
+func headerField(header, name string) string {
+	for _, line := range strings.Split(header, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// ParseMO parses a compiled gettext MO file, in either byte order.
+// Messages with a context are left out, as in ParsePO.
+func ParseMO(data []byte) (*Catalog, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("invalid MO catalog: file too short")
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(data) {
+	case 0x950412de:
+		order = binary.LittleEndian
+	case 0xde120495:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid MO catalog: bad magic number")
+	}
+	count := int(order.Uint32(data[8:]))
+	originals := int(order.Uint32(data[12:]))
+	translations := int(order.Uint32(data[16:]))
+
+	// str reads the i-th string of the table at offset
+	str := func(table, i int) (string, error) {
+		at := table + 8*i
+		if at < 0 || at+8 > len(data) {
+			return "", fmt.Errorf("invalid MO catalog: string table out of range")
+		}
+		length := int(order.Uint32(data[at:]))
+		offset := int(order.Uint32(data[at+4:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return "", fmt.Errorf("invalid MO catalog: string out of range")
+		}
+		return string(data[offset : offset+length]), nil
+	}
+
+	keys := make([]string, count)
+	values := make([]string, count)
+	header := ""
+	for i := 0; i < count; i++ {
+		var err error
+		if keys[i], err = str(originals, i); err != nil {
+			return nil, err
+		}
+		if values[i], err = str(translations, i); err != nil {
+			return nil, err
+		}
+		if keys[i] == "" {
+			header = values[i]
+		}
+	}
+
+	c, err := newCatalog(headerField(header, "Plural-Forms"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MO catalog: %w", err)
+	}
+	for i, key := range keys {
+		// A message with a context is stored after the context and an
+		// EOT byte
+		if key == "" || strings.Contains(key, "\x04") {
+			continue
+		}
+		// The plural id follows the singular after a NUL byte
+		singular, _, _ := strings.Cut(key, "\x00")
+		c.messages[singular] = strings.Split(values[i], "\x00")
+	}
+	return c, nil
+}
+
+// parsePluralForms compiles the plural expression of a Plural-Forms
+// header, such as "nplurals=2; plural=(n != 1);"
+func parsePluralForms(header string) (pluralExpr, error) {
+	var expr string
+	for _, field := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if ok && strings.TrimSpace(key) == "plural" {
+			expr = value
+		}
+	}
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("Plural-Forms %q has no plural expression", header)
+	}
+	p := pluralParser{src: []byte(expr)}
+	fn, err := p.ternary()
+	if err == nil {
+		p.space()
+		if p.pos < len(p.src) {
+			err = fmt.Errorf("unexpected %q", p.src[p.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Plural-Forms %q: %w", header, err)
+	}
+	return fn, nil
+}
+
+// pluralParser compiles the C expressions of Plural-Forms headers.
+// Expressions become closures of n; comparisons and logic yield 0 or 1.
+type pluralParser struct {
+	src []byte
+	pos int
+}
+
+// pluralExpr is a compiled plural expression
+type pluralExpr = func(n int) int
+
+// pluralOperators lists the binary operators by precedence, lowest
+// first
+var pluralOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pluralParser) space() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// accept consumes op if it comes next
+func (p *pluralParser) accept(op string) bool {
+	p.space()
+	if bytes.HasPrefix(p.src[p.pos:], []byte(op)) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+// ternary parses cond ? a : b, which binds loosest
+func (p *pluralParser) ternary() (pluralExpr, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(":") {
+		return nil, fmt.Errorf("expected ':'")
+	}
+	otherwise, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return func(n int) int {
+		if cond(n) != 0 {
+			return then(n)
+		}
+		return otherwise(n)
+	}, nil
+}
+
+// binary parses the operators of pluralOperators[level] and tighter
+func (p *pluralParser) binary(level int) (pluralExpr, error) {
+	if level == len(pluralOperators) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range pluralOperators[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = pluralOperation(op, left, right)
+	}
+}
+
+// pluralOperation combines two expressions with a binary operator
+func pluralOperation(op string, a, b pluralExpr) pluralExpr {
+	truth := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "||":
+		return func(n int) int { return truth(a(n) != 0 || b(n) != 0) }
+	case "&&":
+		return func(n int) int { return truth(a(n) != 0 && b(n) != 0) }
+	case "==":
+		return func(n int) int { return truth(a(n) == b(n)) }
+	case "!=":
+		return func(n int) int { return truth(a(n) != b(n)) }
+	case "<=":
+		return func(n int) int { return truth(a(n) <= b(n)) }
+	case ">=":
+		return func(n int) int { return truth(a(n) >= b(n)) }
+	case "<":
+		return func(n int) int { return truth(a(n) < b(n)) }
+	case ">":
+		return func(n int) int { return truth(a(n) > b(n)) }
+	case "+":
+		return func(n int) int { return a(n) + b(n) }
+	case "-":
+		return func(n int) int { return a(n) - b(n) }
+	case "*":
+		return func(n int) int { return a(n) * b(n) }
+	case "/":
+		return func(n int) int {
+			if d := b(n); d != 0 {
+				return a(n) / d
+			}
+			return 0
+		}
+	default: // %
+		return func(n int) int {
+			if d := b(n); d != 0 {
+				return a(n) % d
+			}
+			return 0
+		}
+	}
+}
+
+// unary parses !x, n, numbers and parenthesized expressions
+func (p *pluralParser) unary() (pluralExpr, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(n int) int {
+			if operand(n) == 0 {
+				return 1
+			}
+			return 0
+		}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("expected ')'")
+		}
+		return inner, nil
+	}
+	if p.accept("n") {
+		return func(n int) int { return n }, nil
+	}
+
+	p.space()
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos == len(p.src) {
+			return nil, fmt.Errorf("unexpected end of expression")
+		}
+		return nil, fmt.Errorf("unexpected %q", p.src[p.pos])
+	}
+	value, err := strconv.Atoi(string(p.src[start:p.pos]))
+	if err != nil {
+		return nil, err
+	}
+	return func(int) int { return value }, nil
+}
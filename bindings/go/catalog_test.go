@@ -0,0 +1,179 @@
+package luma_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+const polishPO = `# Polish translations
+msgid ""
+msgstr ""
+"Language: pl\n"
+"Plural-Forms: nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && "
+"(n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+#: mail.luma:3
+msgid "Hello"
+msgstr "Cześć"
+
+msgid "%(count)s file"
+msgid_plural "%(count)s files"
+msgstr[0] "%(count)s plik"
+msgstr[1] "%(count)s pliki"
+msgstr[2] "%(count)s plików"
+
+#, fuzzy
+msgid "Goodbye"
+msgstr "Do zobaczenia"
+
+msgid "Untranslated"
+msgstr ""
+
+msgid ""
+"Two\n"
+"lines"
+msgstr "Dwie\nlinie"
+
+msgctxt "menu"
+msgid "Hello"
+msgstr "Menu"
+
+#~ msgid "Old"
+#~ msgstr "Stary"
+`
+
+func TestParsePO(t *testing.T) {
+	c, err := luma.ParsePO([]byte(polishPO))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for message, want := range map[string]string{
+		"Hello":         "Cześć",
+		"Goodbye":       "Goodbye",
+		"Untranslated":  "Untranslated",
+		"Two\nlines":    "Dwie\nlinie",
+		"Old":           "Old",
+		"menu\x04Hello": "menu\x04Hello",
+	} {
+		if got := c.Gettext(message); got != want {
+			t.Errorf("Gettext(%q) = %q, want %q", message, got, want)
+		}
+	}
+	for n, want := range map[int]string{
+		1:  "%(count)s plik",
+		3:  "%(count)s pliki",
+		5:  "%(count)s plików",
+		12: "%(count)s plików",
+		22: "%(count)s pliki",
+	} {
+		if got := c.Ngettext("%(count)s file", "%(count)s files", n); got != want {
+			t.Errorf("Ngettext(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestParsePOInvalid(t *testing.T) {
+	for _, src := range []string{
+		"msgid \"a\"\nmsgstr[1] \"b\"\n",
+		"\"dangling\"\n",
+		"msgid unquoted\n",
+		"msgid \"\"\nmsgstr \"Plural-Forms: nplurals=2; plural=n !;\\n\"\n",
+	} {
+		if _, err := luma.ParsePO([]byte(src)); err == nil {
+			t.Errorf("ParsePO(%q) succeeded, want an error", src)
+		}
+	}
+}
+
+// buildMO encodes messages as a little-endian MO file
+func buildMO(keys, values []string) []byte {
+	var strs bytes.Buffer
+	n := len(keys)
+	tableSize := 28 + 16*n
+	// entry stores s after the tables and returns its length and offset
+	entry := func(s string) []uint32 {
+		e := []uint32{uint32(len(s)), uint32(tableSize + strs.Len())}
+		strs.WriteString(s)
+		strs.WriteByte(0)
+		return e
+	}
+	var originals, translations []uint32
+	for _, key := range keys {
+		originals = append(originals, entry(key)...)
+	}
+	for _, value := range values {
+		translations = append(translations, entry(value)...)
+	}
+
+	var buf bytes.Buffer
+	for _, v := range []uint32{0x950412de, 0, uint32(n), 28, uint32(28 + 8*n), 0, 0} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	binary.Write(&buf, binary.LittleEndian, originals)
+	binary.Write(&buf, binary.LittleEndian, translations)
+	buf.Write(strs.Bytes())
+	return buf.Bytes()
+}
+
+func TestParseMO(t *testing.T) {
+	data := buildMO(
+		[]string{"", "%(count)s file\x00%(count)s files", "Hello", "menu\x04Hello"},
+		[]string{"Plural-Forms: nplurals=2; plural=(n > 1);\n", "%(count)s fichier\x00%(count)s fichiers", "Bonjour", "Menu"},
+	)
+	c, err := luma.ParseMO(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Gettext("Hello"); got != "Bonjour" {
+		t.Errorf("Gettext() = %q, want Bonjour", got)
+	}
+	// Messages with a context are not loaded
+	if got := c.Gettext("menu\x04Hello"); got != "menu\x04Hello" {
+		t.Errorf("Gettext() of a message with a context = %q", got)
+	}
+	// French uses the singular for 0
+	if got := c.Ngettext("%(count)s file", "%(count)s files", 0); got != "%(count)s fichier" {
+		t.Errorf("Ngettext(0) = %q", got)
+	}
+	if got := c.Ngettext("%(count)s file", "%(count)s files", 2); got != "%(count)s fichiers" {
+		t.Errorf("Ngettext(2) = %q", got)
+	}
+
+	if _, err := luma.ParseMO([]byte("not a catalog at all")); err == nil {
+		t.Error("ParseMO() of garbage succeeded, want an error")
+	}
+}
+
+func TestLoadCatalogJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "de.json")
+	doc := `{"messages": {"Hello": "Hallo", "%(count)s file": ["%(count)s Datei", "%(count)s Dateien"]}}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := luma.LoadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Gettext("Hello"); got != "Hallo" {
+		t.Errorf("Gettext() = %q, want Hallo", got)
+	}
+	if got := c.Ngettext("%(count)s file", "%(count)s files", 4); got != "%(count)s Dateien" {
+		t.Errorf("Ngettext(4) = %q", got)
+	}
+
+	if _, err := luma.ParseJSONCatalog([]byte(`{"messages": {"a": 1}}`)); err == nil {
+		t.Error("ParseJSONCatalog() with a number succeeded, want an error")
+	}
+	yamlPath := filepath.Join(t.TempDir(), "de.yaml")
+	if err := os.WriteFile(yamlPath, []byte("Hello: Hallo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := luma.LoadCatalog(yamlPath); err == nil {
+		t.Error("LoadCatalog() of a .yaml file succeeded, want an error")
+	}
+}
@@ -0,0 +1,448 @@
+package luma
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Check verifies against the type of the context a template is rendered
+// with that every context path the template reads exists and that the
+// values its @for loops iterate over are iterable. Paths read through
+// loop variables and assignments are followed, as are the template's
+// parents and the templates it includes with context. Names set with
+// AddGlobal need not be on the type, nor paths the template only reads
+// behind an is defined test or a default filter.
+//
+// The type is a reflect.Type of a struct or map, or a JSON Schema, as a
+// *Schema or its JSON text in a []byte or json.RawMessage. An object
+// schema allows the properties it declares, and others only when it
+// has patternProperties or additionalProperties matching them.
+//
+// The problems found are returned as Errors of kind "CheckError", at
+// the template position of the offending path segment.
+//
+// Example:
+//
+//	if err := luma.Check(tmpl, reflect.TypeOf(Config{})); err != nil {
+//	    log.Fatal(err) // deploy.yaml:12:13: CheckError: Config.Image has no field "Tagg"
+//	}
+func Check(tmpl *Template, typ interface{}) error {
+	root, err := rootShape(tmpl.env, typ)
+	if err != nil {
+		return err
+	}
+	refs, err := tmpl.references()
+	if err != nil {
+		return err
+	}
+
+	c := checker{env: tmpl.env, root: root, seen: make(map[string]bool)}
+	for _, ref := range refs {
+		c.check(ref)
+	}
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		a, b := c.errs[i], c.errs[j]
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.errs.Err()
+}
+
+// rootShape returns the shape of a context type passed to Check
+func rootShape(env *Environment, typ interface{}) (shape, error) {
+	switch t := typ.(type) {
+	case reflect.Type:
+		return goShape{env: env, t: t}, nil
+	case *Schema:
+		if err := t.prepare(); err != nil {
+			return nil, err
+		}
+		return schemaShape{t}, nil
+	case []byte:
+		s, err := ParseSchema(t)
+		if err != nil {
+			return nil, err
+		}
+		return schemaShape{s}, nil
+	case json.RawMessage:
+		return rootShape(env, []byte(t))
+	default:
+		return nil, fmt.Errorf("cannot check against %T: want a reflect.Type or a JSON Schema", typ)
+	}
+}
+
+// checker checks references against a context shape
+type checker struct {
+	env  *Environment
+	root shape
+	errs Errors
+	// seen holds the diagnostics reported, to report each once
+	seen map[string]bool
+}
+
+// report adds a diagnostic at a location
+func (c *checker) report(at SourceLocation, format string, args ...interface{}) {
+	e := &Error{
+		Kind:     "CheckError",
+		Template: at.Template,
+		Line:     at.Line,
+		Column:   at.Column,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if key := e.Error(); !c.seen[key] {
+		c.seen[key] = true
+		c.errs = append(c.errs, e)
+	}
+}
+
+// check follows a reference through the context shape, reporting the
+// first segment that does not resolve unless the reference is optional
+func (c *checker) check(ref reference) {
+	name := ref.path[0]
+	cur, ok := c.root.member(name)
+	if !ok {
+		if ref.optional || c.env.hasGlobal(name) {
+			return
+		}
+		c.report(ref.positions[0], "undefined variable %q", name)
+		return
+	}
+
+	for i := 1; i < len(ref.path) && cur != nil; i++ {
+		parent, segment := pathString(ref.path[:i]), ref.path[i]
+		var next shape
+		if segment == elementSegment {
+			next, ok = cur.element()
+			if !ok {
+				if ref.optional {
+					return
+				}
+				c.report(ref.positions[i], "cannot index %s (%s)", parent, cur)
+				return
+			}
+		} else {
+			next, ok = cur.member(segment)
+			if !ok {
+				if ref.optional {
+					return
+				}
+				c.report(ref.positions[i], "%s (%s) has no field %q", parent, cur, segment)
+				return
+			}
+		}
+		cur = next
+	}
+	if cur == nil {
+		return
+	}
+
+	switch {
+	case ref.iterate != "" && !cur.iterable(ref.iterate == "pairs"):
+		if ref.iterate == "list" && cur.iterable(true) {
+			c.report(ref.position, "%s (%s) must be iterated with two loop variables", ref, cur)
+		} else {
+			c.report(ref.position, "cannot iterate over %s (%s)", ref, cur)
+		}
+	case ref.call && !cur.callable():
+		c.report(ref.position, "%s (%s) is not a function", ref, cur)
+	}
+}
+
+// hasGlobal reports whether a global is set under name
+func (e *Environment) hasGlobal(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.globals[name]
+	return ok
+}
+
+// shape describes the values a context path may hold, for Check. A nil
+// shape allows anything.
+type shape interface {
+	// member returns the shape of a field or key, false if there is none
+	member(name string) (shape, bool)
+	// element returns the shape of an element or map value, false if the
+	// value cannot be indexed
+	element() (shape, bool)
+	// iterable reports whether a loop can iterate over the value, with
+	// two variables when pairs is set
+	iterable(pairs bool) bool
+	// callable reports whether the value is a function
+	callable() bool
+	String() string
+}
+
+// goShape is the shape of a Go type, as the template sees it after
+// conversion
+type goShape struct {
+	env *Environment
+	t   reflect.Type
+}
+
+// opaque reports whether values of the type convert to something other
+// than their kind suggests, whose members cannot be known statically
+func (g goShape) opaque() bool {
+	t := g.t
+	switch t {
+	case timeType, durationType:
+		return true
+	}
+	if g.env.opts.DisabledConversions&ConvertJSONMarshaler == 0 &&
+		(t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType)) {
+		return true
+	}
+	return t.Kind() == reflect.Interface
+}
+
+// scalar reports whether values of the type convert to a string, number
+// or boolean
+func (g goShape) scalar() bool {
+	t := g.t
+	if t == safeStringType || t == templateHTMLType {
+		return true
+	}
+	if g.env.opts.DisabledConversions&ConvertTextMarshaler == 0 &&
+		(t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)) {
+		return true
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// deref returns the shape with pointers removed, nil if it is opaque
+func (g goShape) deref() (goShape, bool) {
+	g.t = indirectType(g.t)
+	return g, !g.opaque()
+}
+
+func (g goShape) member(name string) (shape, bool) {
+	d, ok := g.deref()
+	if !ok {
+		return nil, true
+	}
+	if d.scalar() {
+		return nil, false
+	}
+	switch d.t.Kind() {
+	case reflect.Struct:
+		for _, f := range reflect.VisibleFields(d.t) {
+			if !f.IsExported() {
+				continue
+			}
+			if fname, ok := fieldName(f); ok && fname == name {
+				return goShape{env: g.env, t: f.Type}, true
+			}
+		}
+		if _, ok := reflect.PointerTo(d.t).MethodByName(name); ok && g.env.methodAllowed(d.t, name) {
+			return funcShape{}, true
+		}
+		return nil, false
+	case reflect.Map:
+		return goShape{env: g.env, t: d.t.Elem()}, true
+	}
+	return nil, false
+}
+
+func (g goShape) element() (shape, bool) {
+	d, ok := g.deref()
+	if !ok {
+		return nil, true
+	}
+	if d.scalar() {
+		return nil, false
+	}
+	switch d.t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return goShape{env: g.env, t: d.t.Elem()}, true
+	case reflect.Struct:
+		// Fields looked up by a computed name
+		return nil, true
+	}
+	return nil, false
+}
+
+func (g goShape) iterable(pairs bool) bool {
+	d, ok := g.deref()
+	if !ok {
+		return true
+	}
+	if d.scalar() {
+		return false
+	}
+	switch d.t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return true
+	case reflect.Map, reflect.Struct:
+		return pairs
+	}
+	return false
+}
+
+func (g goShape) callable() bool {
+	d, ok := g.deref()
+	return !ok || d.t.Kind() == reflect.Func
+}
+
+func (g goShape) String() string {
+	return g.t.String()
+}
+
+// funcShape is the shape of a method, whose result is not checked
+type funcShape struct{}
+
+func (funcShape) member(string) (shape, bool) { return nil, false }
+func (funcShape) element() (shape, bool)      { return nil, false }
+func (funcShape) iterable(bool) bool          { return false }
+func (funcShape) callable() bool              { return true }
+func (funcShape) String() string              { return "method" }
+
+// schemaShape is the shape of a JSON Schema: a value matching any of
+// its branches, see Schema.branches
+type schemaShape struct {
+	s *Schema
+}
+
+// schemaUnion returns the shape of a value matching any of the
+// schemas, or anything when free is set
+func schemaUnion(schemas []*Schema, free bool) (shape, bool) {
+	switch {
+	case free:
+		return nil, true
+	case len(schemas) == 0:
+		return nil, false
+	case len(schemas) == 1:
+		return schemaShape{schemas[0]}, true
+	}
+	return schemaShape{&Schema{AnyOf: schemas}}, true
+}
+
+func (sh schemaShape) member(name string) (shape, bool) {
+	var found []*Schema
+	free := false
+	for _, s := range sh.s.branches() {
+		switch {
+		case s.Bool != nil:
+			free = free || *s.Bool
+		case !s.allows("object"):
+		case !s.declaresMembers():
+			free = free || !s.combines()
+		default:
+			if p, ok := s.Properties[name]; ok {
+				found = append(found, p)
+				continue
+			}
+			matched := false
+			for pattern, re := range s.patterns {
+				if re.MatchString(name) {
+					found = append(found, s.PatternProperties[pattern])
+					matched = true
+				}
+			}
+			if !matched && s.AdditionalProperties != nil {
+				found = append(found, s.AdditionalProperties)
+			}
+		}
+	}
+	return schemaUnion(allowing(found), free)
+}
+
+func (sh schemaShape) element() (shape, bool) {
+	var found []*Schema
+	free := false
+	for _, s := range sh.s.branches() {
+		if s.Bool != nil {
+			free = free || *s.Bool
+			continue
+		}
+		if s.combines() && len(s.Type) == 0 && !s.declaresMembers() {
+			continue
+		}
+		if s.allows("array") {
+			if s.Items != nil || len(s.PrefixItems) > 0 {
+				found = append(found, s.Items)
+				found = append(found, s.PrefixItems...)
+			} else if len(s.Type) > 0 {
+				free = true
+			}
+		}
+		if s.allows("object") {
+			if !s.declaresMembers() {
+				free = true
+				continue
+			}
+			for _, p := range s.Properties {
+				found = append(found, p)
+			}
+			for _, p := range s.PatternProperties {
+				found = append(found, p)
+			}
+			found = append(found, s.AdditionalProperties)
+		}
+	}
+	return schemaUnion(allowing(found), free)
+}
+
+func (sh schemaShape) iterable(pairs bool) bool {
+	for _, s := range sh.s.branches() {
+		switch {
+		case s.Bool != nil:
+			if *s.Bool {
+				return true
+			}
+		case s.combines() && len(s.Type) == 0:
+		case s.allows("array") || (pairs && s.allows("object")):
+			return true
+		}
+	}
+	return false
+}
+
+func (sh schemaShape) callable() bool {
+	return false
+}
+
+func (sh schemaShape) String() string {
+	types := make(map[string]bool)
+	for _, s := range sh.s.branches() {
+		for _, t := range s.Type {
+			types[t] = true
+		}
+	}
+	if len(types) == 0 {
+		return "any"
+	}
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// allowing drops the missing and false schemas, which no value matches
+func allowing(schemas []*Schema) []*Schema {
+	out := schemas[:0]
+	for _, s := range schemas {
+		if s != nil && (s.Bool == nil || *s.Bool) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package luma_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+type checkImage struct {
+	Repository string
+	Tag        string `luma:"tag"`
+}
+
+type checkContainer struct {
+	Name  string
+	Image checkImage
+	Ports []int
+}
+
+type checkConfig struct {
+	Name       string
+	Replicas   int
+	Containers []checkContainer
+	Labels     map[string]string
+	Owner      *checkUser
+}
+
+type checkUser struct {
+	First, Last string
+}
+
+func (u checkUser) FullName() string { return u.First + " " + u.Last }
+
+// checkErrors runs Check and returns its diagnostics as strings
+func checkErrors(t *testing.T, env *luma.Environment, name string, typ interface{}) []string {
+	t.Helper()
+	tmpl, err := env.GetTemplate(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = luma.Check(tmpl, typ)
+	if err == nil {
+		return nil
+	}
+	var errs luma.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Check() error = %v, want luma.Errors", err)
+	}
+	var out []string
+	for _, e := range errs {
+		if e.Kind != "CheckError" {
+			t.Errorf("error kind = %q, want CheckError", e.Kind)
+		}
+		out = append(out, e.Error())
+	}
+	return out
+}
+
+func TestCheckStruct(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deploy.yaml": strings.Join([]string{
+			"name: $Name",
+			"replicas: ${Replicas}",
+			"@for c in Containers",
+			"- image: ${c.Image.Repository}:${c.Image.tag}",
+			"  ports: ${c.Ports | join(\",\")}",
+			"@end",
+			"@for k, v in Labels",
+			"  $k: $v",
+			"@end",
+			"owner: ${Owner.FullName()}",
+		}, "\n"),
+	}})
+	if errs := checkErrors(t, env, "deploy.yaml", reflect.TypeOf(checkConfig{})); errs != nil {
+		t.Errorf("Check() = %q, want no errors", errs)
+	}
+}
+
+func TestCheckReportsPositions(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deploy.yaml": strings.Join([]string{
+			"name: $Nmae",
+			"@for c in Containers",
+			"- image: ${c.Image.Tagg}",
+			"@end",
+			"@for r in Replicas",
+			"@end",
+			"@for l in Labels",
+			"@end",
+			"${ Name() }",
+		}, "\n"),
+	}})
+	got := checkErrors(t, env, "deploy.yaml", reflect.TypeOf(checkConfig{}))
+	want := []string{
+		`deploy.yaml:1:7: CheckError: undefined variable "Nmae"`,
+		`deploy.yaml:3:19: CheckError: Containers[].Image (luma_test.checkImage) has no field "Tagg"`,
+		`deploy.yaml:5:1: CheckError: cannot iterate over Replicas (int)`,
+		`deploy.yaml:7:1: CheckError: Labels (map[string]string) must be iterated with two loop variables`,
+		`deploy.yaml:9:4: CheckError: Name (string) is not a function`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckAllowsGuardedPaths(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"page.luma": strings.Join([]string{
+			"@if Nope is defined",
+			"${Nope}",
+			"@end",
+			"${ Owner.Middle | default(\"-\") }",
+			"${ Nmae }",
+		}, "\n"),
+	}})
+	got := checkErrors(t, env, "page.luma", reflect.TypeOf(checkConfig{}))
+	want := []string{`page.luma:5:4: CheckError: undefined variable "Nmae"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckAllowsGlobalsAndIncludes(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"page.luma":      "${ site }\n@for c in Containers\n@include \"container.luma\"\n@end",
+		"container.luma": "${ c.Nme }",
+	}})
+	env.AddGlobal("site", "example.com")
+
+	got := checkErrors(t, env, "page.luma", reflect.TypeOf(checkConfig{}))
+	want := []string{`container.luma:1:5: CheckError: Containers[] (luma_test.checkContainer) has no field "Nme"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckRestrictedMethods(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{
+		RestrictMethods: true,
+		Loader:          luma.MapLoader{"page.luma": "${ Owner.FullName() }"},
+	})
+	if errs := checkErrors(t, env, "page.luma", reflect.TypeOf(checkConfig{})); len(errs) != 1 {
+		t.Errorf("Check() = %q, want a missing FullName", errs)
+	}
+	env.AllowMethods(checkUser{}, "FullName")
+	if errs := checkErrors(t, env, "page.luma", reflect.TypeOf(checkConfig{})); errs != nil {
+		t.Errorf("Check() = %q after AllowMethods, want no errors", errs)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	schema := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"containers": {"type": "array", "items": {"$ref": "#/$defs/container"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"extra": {},
+			"port": {"anyOf": [{"type": "integer"}, {"type": "object", "properties": {"number": {"type": "integer"}}}]}
+		},
+		"$defs": {
+			"container": {
+				"type": "object",
+				"properties": {"image": {"type": "string"}},
+				"patternProperties": {"^x-": true}
+			}
+		}
+	}`)
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"ok.luma": strings.Join([]string{
+			"$name ${labels.app} ${extra.anything.goes} ${port.number}",
+			"@for c in containers",
+			`${c.image} ${c["x-debug"]}`,
+			"@end",
+			"@for k, v in labels",
+			"$k=$v",
+			"@end",
+		}, "\n"),
+		"bad.luma": strings.Join([]string{
+			"${nmae}",
+			"@for c in containers",
+			"${c.imag}",
+			"@end",
+			"@for x in name",
+			"@end",
+			"${port.numbr}",
+		}, "\n"),
+	}})
+
+	if errs := checkErrors(t, env, "ok.luma", schema); errs != nil {
+		t.Errorf("Check(ok.luma) = %q, want no errors", errs)
+	}
+	got := checkErrors(t, env, "bad.luma", schema)
+	want := []string{
+		`bad.luma:1:3: CheckError: undefined variable "nmae"`,
+		`bad.luma:3:4: CheckError: containers[] (object) has no field "imag"`,
+		`bad.luma:5:1: CheckError: cannot iterate over name (string)`,
+		`bad.luma:7:7: CheckError: port (integer|object) has no field "numbr"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(bad.luma) =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckInvalidType(t *testing.T) {
+	tmpl, err := luma.NewEnvironment(luma.Options{}).Compile("$x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := luma.Check(tmpl, 42); err == nil {
+		t.Error("Check() with an int type = nil, want an error")
+	}
+	if err := luma.Check(tmpl, []byte(`{"$ref": "other.json"}`)); err == nil {
+		t.Error("Check() with a remote $ref = nil, want an error")
+	}
+}
@@ -0,0 +1,153 @@
+package luma
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Clock tells templates the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls f.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// FixedClock returns a Clock that always reports t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// systemClock reports the wall clock time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Now returns the current time according to Options.Clock. It backs the
+// now() global.
+func (e *Environment) Now() time.Time {
+	e.volatile.Add(1)
+	return e.opts.Clock.Now()
+}
+
+// Random returns a reader of random bytes for filters and globals that
+// need randomness. It draws from Options.Rand when one is set, and from
+// crypto/rand otherwise.
+func (e *Environment) Random() io.Reader {
+	return randomReader{e}
+}
+
+// randomReader reads bytes from the environment's random source
+type randomReader struct {
+	e *Environment
+}
+
+func (r randomReader) Read(p []byte) (int, error) {
+	r.e.volatile.Add(1)
+	if r.e.opts.Rand == nil {
+		return crand.Read(p)
+	}
+	r.e.randMu.Lock()
+	defer r.e.randMu.Unlock()
+	return r.e.rand.Read(p)
+}
+
+// newRand returns the generator behind math.random: one using source,
+// or one seeded from crypto/rand when source is nil
+func newRand(source rand.Source) *rand.Rand {
+	if source == nil {
+		var seed [8]byte
+		if _, err := crand.Read(seed[:]); err != nil {
+			binary.LittleEndian.PutUint64(seed[:], uint64(time.Now().UnixNano()))
+		}
+		source = rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:])))
+	}
+	return rand.New(source)
+}
+
+// installRandom replaces math.random so templates draw from the
+// environment's random source. math.randomseed is a no-op because the
+// source is shared by every render.
+func (e *Environment) installRandom(L *lua.LState) {
+	math, ok := L.GetGlobal("math").(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	L.SetField(math, "random", L.NewFunction(func(L *lua.LState) int {
+		e.volatile.Add(1)
+		e.randMu.Lock()
+		defer e.randMu.Unlock()
+
+		switch L.GetTop() {
+		case 0:
+			L.Push(lua.LNumber(e.rand.Float64()))
+		case 1:
+			m := L.CheckInt64(1)
+			if m < 1 {
+				L.ArgError(1, "interval is empty")
+			}
+			L.Push(lua.LNumber(e.rand.Int63n(m) + 1))
+		default:
+			m, n := L.CheckInt64(1), L.CheckInt64(2)
+			if m > n {
+				L.ArgError(2, "interval is empty")
+			}
+			L.Push(lua.LNumber(m + e.rand.Int63n(n-m+1)))
+		}
+		return 1
+	}))
+	L.SetField(math, "randomseed", L.NewFunction(func(L *lua.LState) int {
+		return 0
+	}))
+}
+
+// installClock makes os.time and os.date report the environment's clock
+// when called without an explicit time
+func (e *Environment) installClock(L *lua.LState) {
+	os, ok := L.GetGlobal("os").(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	osTime := L.GetField(os, "time")
+	L.SetField(os, "time", L.NewFunction(func(L *lua.LState) int {
+		if L.GetTop() == 0 || L.Get(1) == lua.LNil {
+			L.Push(lua.LNumber(e.Now().Unix()))
+			return 1
+		}
+		return callOriginal(L, osTime, L.Get(1))
+	}))
+
+	osDate := L.GetField(os, "date")
+	L.SetField(os, "date", L.NewFunction(func(L *lua.LState) int {
+		format := L.OptString(1, "%c")
+		if L.Get(2) == lua.LNil {
+			return callOriginal(L, osDate, lua.LString(format), lua.LNumber(e.Now().Unix()))
+		}
+		return callOriginal(L, osDate, lua.LString(format), L.Get(2))
+	}))
+}
+
+// callOriginal calls a replaced library function and returns its results
+func callOriginal(L *lua.LState, fn lua.LValue, args ...lua.LValue) int {
+	top := L.GetTop()
+	L.Push(fn)
+	for _, arg := range args {
+		L.Push(arg)
+	}
+	L.Call(len(args), lua.MultRet)
+	return L.GetTop() - top
+}
@@ -0,0 +1,41 @@
+package luma
+
+import (
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestClockState(t *testing.T) {
+	now := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	env := NewEnvironment(Options{Clock: FixedClock(now)})
+
+	tests := []struct {
+		name  string
+		chunk string
+		want  string
+	}{
+		{"os.time", `return tostring(os.time())`, "1792229400"},
+		{"os.date", `return os.date("!%Y-%m-%d %H:%M")`, "2026-10-17 09:30"},
+		{"os.date with time", `return os.date("!%Y", 0)`, "1970"},
+		{"os.time with table", `return tostring(os.time({year = 2000, month = 1, day = 1, hour = 0}) ~= nil)`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newVM(env, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer v.L.Close()
+
+			if err := v.L.DoString(tt.chunk); err != nil {
+				t.Fatalf("DoString() error = %v", err)
+			}
+			if got := lua.LVAsString(v.L.Get(-1)); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.chunk, got, tt.want)
+			}
+		})
+	}
+}
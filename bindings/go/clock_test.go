@@ -0,0 +1,94 @@
+package luma_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	env := luma.NewEnvironment(luma.Options{Clock: luma.FixedClock(now)})
+
+	got, err := env.Render("${now()} ${now() | date('%Y')}", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "2026-10-17T09:30:00Z 2026"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+	if !env.Now().Equal(now) {
+		t.Errorf("Now() = %v, want %v", env.Now(), now)
+	}
+}
+
+func TestClockGlobalOverride(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	env.AddGlobal("now", func() string { return "custom" })
+
+	got, err := env.Render("${now()}", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "custom" {
+		t.Errorf("Render() = %q, want custom", got)
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	const template = "${math.random()} ${math.random(6)} ${math.random(10, 20)}"
+
+	render := func(seed int64) string {
+		env := luma.NewEnvironment(luma.Options{Rand: rand.NewSource(seed)})
+		var out string
+		for i := 0; i < 3; i++ {
+			got, err := env.Render(template, nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			out += got + "\n"
+		}
+		return out
+	}
+
+	first := render(42)
+	if second := render(42); second != first {
+		t.Errorf("renders with the same seed differ:\n%s---\n%s", first, second)
+	}
+	if other := render(43); other == first {
+		t.Error("renders with different seeds are identical")
+	}
+}
+
+func TestRandSourceConcurrent(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Rand: rand.NewSource(1)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := env.Render("${math.random(100)}", nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRandomIntervals(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Rand: rand.NewSource(1)})
+
+	if _, err := env.Render("${math.random(0)}", nil); err == nil {
+		t.Error("math.random(0) succeeded, want an empty interval error")
+	}
+	if _, err := env.Render("${math.random(5, 1)}", nil); err == nil {
+		t.Error("math.random(5, 1) succeeded, want an empty interval error")
+	}
+}
@@ -0,0 +1,520 @@
+package luma
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Coverage collects which lines, branches and macros of templates run.
+// Set Options.Coverage to collect coverage of every template the
+// environment renders, then write an LCOV or HTML report. A Coverage may
+// be shared by several environments and is safe for concurrent use.
+// Renders served from Options.ResultCache are not counted.
+//
+// Example:
+//
+//	cov := luma.NewCoverage()
+//	env := luma.NewEnvironment(luma.Options{Loader: loader, Coverage: cov})
+//	// ... run the template tests ...
+//	f, _ := os.Create("templates.lcov")
+//	cov.WriteLCOV(f)
+type Coverage struct {
+	mu        sync.Mutex
+	templates map[string]*templateCounts
+}
+
+// templateCounts accumulates the coverage of one template
+type templateCounts struct {
+	source   string
+	lines    map[int]int64
+	branches map[branchKey]int64
+	macros   map[macroKey]int64
+}
+
+// branchKey identifies a branch of an if or for statement
+type branchKey struct {
+	line, column, branch int
+	kind                 string
+}
+
+// macroKey identifies a macro definition
+type macroKey struct {
+	line int
+	name string
+}
+
+// TemplateCoverage is the coverage of one template.
+type TemplateCoverage struct {
+	// Name is the template name, empty for templates rendered from a
+	// string.
+	Name string
+	// Source is the template source.
+	Source string
+	// Lines lists the lines holding text or statements, in order.
+	Lines []LineCoverage
+	// Branches lists the branches of the if and for statements, in
+	// order.
+	Branches []BranchCoverage
+	// Macros lists the macro definitions, in order.
+	Macros []MacroCoverage
+}
+
+// LineCoverage counts how often a template line ran.
+type LineCoverage struct {
+	Line int
+	Hits int64
+}
+
+// BranchCoverage counts how often a branch of an if or for statement
+// was taken.
+type BranchCoverage struct {
+	Line   int
+	Column int
+	// Kind is "if" or "for".
+	Kind string
+	// Branch is 0 for the then branch of an if (each elif is an if of
+	// its own) and the body of a for, 1 for the else branch of an if,
+	// taken when no condition holds even without an @else, and the
+	// empty branch of a for.
+	Branch int
+	Hits   int64
+}
+
+// MacroCoverage counts the calls to a macro.
+type MacroCoverage struct {
+	Name string
+	Line int
+	Hits int64
+}
+
+// LinePercent returns the percentage of lines that ran.
+func (t TemplateCoverage) LinePercent() float64 {
+	covered := 0
+	for _, l := range t.Lines {
+		if l.Hits > 0 {
+			covered++
+		}
+	}
+	return percent(covered, len(t.Lines))
+}
+
+// BranchPercent returns the percentage of branches that were taken.
+func (t TemplateCoverage) BranchPercent() float64 {
+	covered := 0
+	for _, b := range t.Branches {
+		if b.Hits > 0 {
+			covered++
+		}
+	}
+	return percent(covered, len(t.Branches))
+}
+
+// MacroPercent returns the percentage of macros that were called.
+func (t TemplateCoverage) MacroPercent() float64 {
+	covered := 0
+	for _, m := range t.Macros {
+		if m.Hits > 0 {
+			covered++
+		}
+	}
+	return percent(covered, len(t.Macros))
+}
+
+// percent returns covered out of total as a percentage, 100 when there
+// is nothing to cover
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{templates: make(map[string]*templateCounts)}
+}
+
+// Reset zeroes every count. Templates seen so far stay in the reports,
+// with nothing covered.
+func (c *Coverage) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.templates {
+		for k := range t.lines {
+			t.lines[k] = 0
+		}
+		for k := range t.branches {
+			t.branches[k] = 0
+		}
+		for k := range t.macros {
+			t.macros[k] = 0
+		}
+	}
+}
+
+// Templates returns the coverage of every template seen so far, sorted
+// by name.
+func (c *Coverage) Templates() []TemplateCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	templates := make([]TemplateCoverage, 0, len(c.templates))
+	for name, t := range c.templates {
+		tc := TemplateCoverage{Name: name, Source: t.source}
+		for line, hits := range t.lines {
+			tc.Lines = append(tc.Lines, LineCoverage{Line: line, Hits: hits})
+		}
+		for k, hits := range t.branches {
+			tc.Branches = append(tc.Branches, BranchCoverage{
+				Line: k.line, Column: k.column, Kind: k.kind, Branch: k.branch, Hits: hits,
+			})
+		}
+		for k, hits := range t.macros {
+			tc.Macros = append(tc.Macros, MacroCoverage{Name: k.name, Line: k.line, Hits: hits})
+		}
+		sort.Slice(tc.Lines, func(i, j int) bool { return tc.Lines[i].Line < tc.Lines[j].Line })
+		sort.Slice(tc.Branches, func(i, j int) bool {
+			a, b := tc.Branches[i], tc.Branches[j]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			if a.Column != b.Column {
+				return a.Column < b.Column
+			}
+			return a.Branch < b.Branch
+		})
+		sort.Slice(tc.Macros, func(i, j int) bool {
+			if tc.Macros[i].Line != tc.Macros[j].Line {
+				return tc.Macros[i].Line < tc.Macros[j].Line
+			}
+			return tc.Macros[i].Name < tc.Macros[j].Name
+		})
+		templates = append(templates, tc)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// template returns the counts of the template called name, creating them
+// if needed. c.mu must be held.
+func (c *Coverage) template(name string) *templateCounts {
+	t := c.templates[name]
+	if t == nil {
+		t = &templateCounts{
+			lines:    make(map[int]int64),
+			branches: make(map[branchKey]int64),
+			macros:   make(map[macroKey]int64),
+		}
+		c.templates[name] = t
+	}
+	return t
+}
+
+// coverageProbe is a probe emitted by the compiler, see codegen.lua
+type coverageProbe struct {
+	kind     string
+	template string
+	line     int
+	x, y     int
+	name     string
+}
+
+// add merges the counts of a set of probes. Probes of the same line are
+// different statements on it, so the line ran as often as the most
+// frequent of them.
+func (c *Coverage) add(probes []coverageProbe, counts []int64) {
+	type lineKey struct {
+		template string
+		line     int
+	}
+	lines := make(map[lineKey]int64)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range probes {
+		t, n := c.template(p.template), counts[i]
+		switch p.kind {
+		case "line":
+			for line := p.line; line <= p.x; line++ {
+				k := lineKey{p.template, line}
+				if seen, ok := lines[k]; !ok || n > seen {
+					lines[k] = n
+				}
+			}
+		case "branch":
+			t.branches[branchKey{line: p.line, column: p.x, branch: p.y, kind: p.name}] += n
+		case "macro":
+			t.macros[macroKey{line: p.line, name: p.name}] += n
+		}
+	}
+	for k, n := range lines {
+		c.templates[k.template].lines[k.line] += n
+	}
+}
+
+// setSource records the source of a template
+func (c *Coverage) setSource(name, source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.template(name).source = source
+}
+
+// installCoverage compiles templates with coverage probes when
+// Options.Coverage is set, and returns runtime.take_coverage
+func (e *Environment) installCoverage(L *lua.LState) (lua.LValue, error) {
+	if e.opts.Coverage == nil {
+		return nil, nil
+	}
+	runtime, err := requireModule(L, "luma.runtime")
+	if err != nil {
+		return nil, err
+	}
+	err = L.CallByParam(lua.P{Fn: L.GetField(runtime, "set_coverage"), NRet: 0, Protect: true}, lua.LTrue)
+	return L.GetField(runtime, "take_coverage"), err
+}
+
+// collectCoverage moves the coverage counted by the renders in v to
+// Options.Coverage
+func (e *Environment) collectCoverage(v *vm) error {
+	L := v.L
+	if err := L.CallByParam(lua.P{Fn: v.takeCoverage, NRet: 2, Protect: true}); err != nil {
+		return fmt.Errorf("failed to collect coverage: %w", err)
+	}
+	taken, sources := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+
+	cov := e.opts.Coverage
+	if sources, ok := sources.(*lua.LTable); ok {
+		sources.ForEach(func(k, source lua.LValue) {
+			cov.setSource(lua.LVAsString(k), lua.LVAsString(source))
+		})
+	}
+	entries, ok := taken.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	entries.ForEach(func(_, entry lua.LValue) {
+		tbl, ok := entry.(*lua.LTable)
+		if !ok {
+			return
+		}
+		probeTable, _ := tbl.RawGetString("probes").(*lua.LTable)
+		countTable, _ := tbl.RawGetString("counts").(*lua.LTable)
+		if probeTable == nil || countTable == nil {
+			return
+		}
+		probes := make([]coverageProbe, probeTable.Len())
+		counts := make([]int64, len(probes))
+		for i := range probes {
+			p, _ := probeTable.RawGetInt(i + 1).(*lua.LTable)
+			if p == nil {
+				continue
+			}
+			probes[i] = coverageProbe{
+				kind: lua.LVAsString(p.RawGetInt(1)),
+				line: int(lua.LVAsNumber(p.RawGetInt(3))),
+				x:    int(lua.LVAsNumber(p.RawGetInt(4))),
+				y:    int(lua.LVAsNumber(p.RawGetInt(5))),
+				name: lua.LVAsString(p.RawGetInt(6)),
+			}
+			if name, ok := p.RawGetInt(2).(lua.LString); ok {
+				probes[i].template = string(name)
+			}
+			counts[i] = int64(lua.LVAsNumber(countTable.RawGetInt(i + 1)))
+		}
+		cov.add(probes, counts)
+	})
+	return nil
+}
+
+// WriteLCOV writes the coverage in the LCOV trace file format read by
+// genhtml and most coverage services. Templates rendered from a string
+// are named <string>.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	for _, t := range c.Templates() {
+		fmt.Fprintf(&b, "SF:%s\n", templateLabel(t.Name))
+		macrosHit := 0
+		for _, m := range t.Macros {
+			fmt.Fprintf(&b, "FN:%d,%s\n", m.Line, m.Name)
+		}
+		for _, m := range t.Macros {
+			fmt.Fprintf(&b, "FNDA:%d,%s\n", m.Hits, m.Name)
+			if m.Hits > 0 {
+				macrosHit++
+			}
+		}
+		fmt.Fprintf(&b, "FNF:%d\nFNH:%d\n", len(t.Macros), macrosHit)
+
+		// Number the statements in order; a statement none of whose
+		// branches ran was never reached
+		branchesHit := 0
+		block, reached := -1, map[[2]int]bool{}
+		for _, br := range t.Branches {
+			if br.Hits > 0 {
+				reached[[2]int{br.Line, br.Column}] = true
+			}
+		}
+		var last [2]int
+		for i, br := range t.Branches {
+			pos := [2]int{br.Line, br.Column}
+			if i == 0 || pos != last {
+				block++
+				last = pos
+			}
+			taken := "-"
+			if reached[pos] {
+				taken = fmt.Sprint(br.Hits)
+			}
+			if br.Hits > 0 {
+				branchesHit++
+			}
+			fmt.Fprintf(&b, "BRDA:%d,%d,%d,%s\n", br.Line, block, br.Branch, taken)
+		}
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", len(t.Branches), branchesHit)
+
+		linesHit := 0
+		for _, l := range t.Lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", l.Line, l.Hits)
+			if l.Hits > 0 {
+				linesHit++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", len(t.Lines), linesHit)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes the coverage as a single HTML page in the style of go
+// tool cover: a menu of templates with their line coverage, and each
+// template's source with lines that ran in green and lines that did not
+// in red. Branches and macros that never ran are listed after the
+// source.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	type htmlLine struct {
+		Number int
+		Text   string
+		Class  string
+		Hits   int64
+	}
+	type htmlFile struct {
+		Label    string
+		Percent  float64
+		Lines    []htmlLine
+		Branches []string
+		Macros   []string
+	}
+
+	var files []htmlFile
+	for _, t := range c.Templates() {
+		hits := make(map[int]int64, len(t.Lines))
+		for _, l := range t.Lines {
+			hits[l.Line] = l.Hits
+		}
+		f := htmlFile{Label: templateLabel(t.Name), Percent: t.LinePercent()}
+		for i, text := range strings.Split(strings.TrimSuffix(t.Source, "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Text: text, Class: "cov-none"}
+			if n, ok := hits[i+1]; ok {
+				line.Hits = n
+				line.Class = "cov-miss"
+				if n > 0 {
+					line.Class = "cov-hit"
+				}
+			}
+			f.Lines = append(f.Lines, line)
+		}
+		for _, br := range t.Branches {
+			if br.Hits == 0 {
+				f.Branches = append(f.Branches, fmt.Sprintf("line %d:%d: %s", br.Line, br.Column, branchLabel(br)))
+			}
+		}
+		for _, m := range t.Macros {
+			if m.Hits == 0 {
+				f.Macros = append(f.Macros, fmt.Sprintf("line %d: %s", m.Line, m.Name))
+			}
+		}
+		files = append(files, f)
+	}
+	return coverageHTML.Execute(w, files)
+}
+
+// branchLabel describes a branch in reports
+func branchLabel(br BranchCoverage) string {
+	switch {
+	case br.Kind == "for" && br.Branch == 0:
+		return "for body"
+	case br.Kind == "for":
+		return "for empty"
+	case br.Branch == 0:
+		return "if then"
+	default:
+		return "if else"
+	}
+}
+
+var coverageHTML = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Luma template coverage</title>
+<style>
+body { background: black; color: rgb(80, 80, 80); font-family: Menlo, monospace; }
+#topbar { background: black; position: fixed; top: 0; left: 0; right: 0; height: 42px; border-bottom: 1px solid rgb(80, 80, 80); }
+#nav, #legend { float: left; margin: 10px; }
+#legend span { margin: 0 5px; }
+#content { margin-top: 50px; }
+pre { font-size: 14px; }
+.cov-none { color: rgb(80, 80, 80); }
+.cov-miss { color: rgb(192, 0, 0); }
+.cov-hit { color: rgb(44, 212, 149); }
+.missed { color: rgb(192, 0, 0); }
+</style>
+</head>
+<body>
+<div id="topbar">
+<div id="nav">
+<select id="files">
+{{range $i, $f := .}}<option value="file{{$i}}">{{$f.Label}} ({{printf "%.1f" $f.Percent}}%)</option>
+{{end}}</select>
+</div>
+<div id="legend">
+<span>not tracked</span>
+<span class="cov-miss">not covered</span>
+<span class="cov-hit">covered</span>
+</div>
+</div>
+<div id="content">
+{{range $i, $f := .}}<div class="file" id="file{{$i}}" style="display: none">
+<pre>{{range $f.Lines}}<span class="{{.Class}}"{{if ne .Class "cov-none"}} title="{{.Hits}}"{{end}}>{{.Text}}</span>
+{{end}}</pre>
+{{if $f.Branches}}<p>Branches not taken:</p>
+<pre class="missed">{{range $f.Branches}}{{.}}
+{{end}}</pre>
+{{end}}{{if $f.Macros}}<p>Macros not called:</p>
+<pre class="missed">{{range $f.Macros}}{{.}}
+{{end}}</pre>
+{{end}}</div>
+{{end}}</div>
+<script>
+(function() {
+	var files = document.getElementById('files');
+	var visible;
+	function select(id) {
+		if (visible) visible.style.display = 'none';
+		visible = document.getElementById(id);
+		if (visible) visible.style.display = 'block';
+	}
+	files.addEventListener('change', function() { select(files.value); }, false);
+	if (files.value) select(files.value);
+})();
+</script>
+</body>
+</html>
+`))
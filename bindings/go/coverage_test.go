@@ -0,0 +1,135 @@
+package luma_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+var coveredTemplates = luma.MapLoader{
+	"base.luma":   "<h1>$title</h1>\n@block body\n@end\nfooter\n",
+	"page.luma":   "@extends \"base.luma\"\n@block body\n@if admin\nadmin\n@else\nuser\n@end\n@for item in items\n$item\n@end\n@end\n",
+	"macros.luma": "@macro used()\nu\n@end\n@macro unused()\nn\n@end\n@call used()\n",
+}
+
+// templateCoverage returns the coverage of the template called name
+func templateCoverage(t *testing.T, cov *luma.Coverage, name string) luma.TemplateCoverage {
+	t.Helper()
+	for _, tc := range cov.Templates() {
+		if tc.Name == name {
+			return tc
+		}
+	}
+	t.Fatalf("no coverage for %q", name)
+	return luma.TemplateCoverage{}
+}
+
+// lineHits returns the hits of each tracked line
+func lineHits(tc luma.TemplateCoverage) map[int]int64 {
+	hits := make(map[int]int64)
+	for _, l := range tc.Lines {
+		hits[l.Line] = l.Hits
+	}
+	return hits
+}
+
+func TestCoverage(t *testing.T) {
+	cov := luma.NewCoverage()
+	env := luma.NewEnvironment(luma.Options{Loader: coveredTemplates, Coverage: cov})
+	page, err := env.GetTemplate("page.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, page, map[string]interface{}{"title": "T", "admin": false, "items": []string{"a", "b"}})
+	mustExecute(t, page, map[string]interface{}{"title": "T", "admin": false, "items": []string{"c"}})
+
+	tc := templateCoverage(t, cov, "page.luma")
+	if tc.Source != coveredTemplates["page.luma"] {
+		t.Errorf("Source = %q", tc.Source)
+	}
+	hits := lineHits(tc)
+	if hits[4] != 0 || hits[6] != 2 || hits[9] != 3 {
+		t.Errorf("line hits = %v, want line 4 missed, 6 run twice and 9 three times", hits)
+	}
+	want := []string{"if 3:0 0", "if 3:1 2", "for 8:0 3", "for 8:1 0"}
+	var got []string
+	for _, b := range tc.Branches {
+		got = append(got, fmt.Sprintf("%s %d:%d %d", b.Kind, b.Line, b.Branch, b.Hits))
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("branches = %v, want %v", got, want)
+	}
+	if p := tc.BranchPercent(); p != 50 {
+		t.Errorf("BranchPercent() = %v, want 50", p)
+	}
+
+	base := lineHits(templateCoverage(t, cov, "base.luma"))
+	if base[1] != 2 || base[4] != 2 {
+		t.Errorf("base.luma line hits = %v, want lines 1 and 4 run twice", base)
+	}
+
+	cov.Reset()
+	if lineHits(templateCoverage(t, cov, "page.luma"))[6] != 0 {
+		t.Error("Reset() kept the counts")
+	}
+}
+
+func TestCoverageMacros(t *testing.T) {
+	cov := luma.NewCoverage()
+	env := luma.NewEnvironment(luma.Options{Loader: coveredTemplates, Coverage: cov})
+	tmpl, err := env.GetTemplate("macros.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tmpl, nil)
+
+	var lcov bytes.Buffer
+	if err := cov.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"SF:macros.luma\n",
+		"FN:1,used\nFN:4,unused\nFNDA:1,used\nFNDA:0,unused\nFNF:2\nFNH:1\n",
+		"DA:2,1\n",
+		"DA:5,0\n",
+		"end_of_record\n",
+	} {
+		if !strings.Contains(lcov.String(), want) {
+			t.Errorf("LCOV report lacks %q:\n%s", want, lcov.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := cov.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<option value="file0">macros.luma`,
+		`<span class="cov-hit" title="1">u</span>`,
+		`<span class="cov-miss" title="0">n</span>`,
+		"line 4: unused",
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML report lacks %q", want)
+		}
+	}
+}
+
+func TestCoverageStringTemplates(t *testing.T) {
+	cov := luma.NewCoverage()
+	env := luma.NewEnvironment(luma.Options{Coverage: cov})
+	if _, err := env.Render("@if x\nyes\n@end", map[string]interface{}{"x": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var lcov bytes.Buffer
+	if err := cov.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(lcov.String(), "SF:<string>\n") || !strings.Contains(lcov.String(), "BRDA:1,0,1,0\n") {
+		t.Errorf("LCOV report:\n%s", lcov.String())
+	}
+}
@@ -0,0 +1,521 @@
+package luma
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Options configures an Environment.
+type Options struct {
+	// RestrictMethods limits the methods templates may call on Go
+	// values to those registered with Environment.AllowMethods. By
+	// default every exported method is callable; enable this when
+	// rendering templates you do not trust.
+	RestrictMethods bool
+
+	// DisabledConversions turns off converting Go values through the
+	// listed interfaces. By default json.Marshaler, encoding.TextMarshaler
+	// and fmt.Stringer values are all converted through them.
+	DisabledConversions Conversion
+
+	// TimeFormat is the layout used when a time.Time is rendered
+	// directly. It defaults to time.RFC3339.
+	TimeFormat string
+
+	// Loader provides the templates used by include, import and
+	// extends. Without one, templates are read from the file system if
+	// the sandbox policy allows it.
+	Loader Loader
+
+	// Autoescape selects how interpolated values are escaped, either as
+	// a fixed EscapeMode or per template name (see SelectAutoescape).
+	// By default the mode follows the template's extension: .yaml, .yml,
+	// .json, .sh, .tf, .hcl and .xml (optionally followed by .luma) use
+	// the matching mode, everything else, including string templates,
+	// uses EscapeHTML. SafeString and html/template.HTML values are never
+	// escaped.
+	Autoescape Autoescaper
+
+	// Sandbox limits what templates and the Lua runtime can reach on
+	// the host. It defaults to DefaultSandbox; use StrictSandbox for
+	// untrusted templates.
+	Sandbox *SandboxPolicy
+
+	// Clock is the time source for the now() global, os.time and os.date,
+	// and for Go filters that read the time through Environment.Now. It
+	// defaults to the system clock; use FixedClock for reproducible output.
+	Clock Clock
+
+	// Rand is the random source for math.random and for Go filters that
+	// read random bytes through Environment.Random. By default math.random
+	// is randomly seeded and Random reads from crypto/rand. Renders share
+	// the source, so output is reproducible when templates are rendered
+	// in the same order.
+	Rand rand.Source
+
+	// CacheDir, if set, is a directory where generated template code is
+	// kept between runs, so unchanged templates are not compiled again.
+	// Entries are keyed by the template source, the Luma version and the
+	// compile options, and are ignored when a parent template they were
+	// generated with has changed. The directory may be shared by several
+	// processes.
+	CacheDir string
+
+	// CacheMaxBytes bounds the size of CacheDir. The least recently used
+	// entries are removed when it grows beyond this. It defaults to 64 MiB.
+	CacheMaxBytes int64
+
+	// DumpGeneratedTo, if set, is a directory where the Lua code of every
+	// compiled template is written, at the template's name with .lua
+	// appended, for debugging. Templates rendered from a string are named
+	// after a hash of their code.
+	DumpGeneratedTo string
+
+	// ResultCache, if set, memoizes Template.Execute: executing a template
+	// again with an equal context returns the earlier output without
+	// rendering. Contexts are compared by a canonical hash of their
+	// contents, so they must not be modified while a render is running,
+	// and methods and globals are assumed to return the same results for
+	// the same values. Renders that read the clock or the random source
+	// are never cached, and Template.DisableResultCache opts a template
+	// out. The cache is cleared when filters, globals or allowed methods
+	// change, or when a ReloadingLoader reports changed templates.
+	ResultCache *ResultCacheOptions
+
+	// MaxConcurrency bounds how many renders Template.ExecuteBatch and
+	// Environment.RenderAll run at once. It defaults to GOMAXPROCS.
+	MaxConcurrency int
+
+	// Hooks, if set, is told about every compile, render, include and
+	// filter call, with its duration and size. See Profiler for a Hooks
+	// implementation that finds slow templates.
+	Hooks Hooks
+
+	// Coverage, if set, collects which lines, branches and macros of the
+	// rendered templates run. Templates are compiled with extra code to
+	// count them, so leave it unset outside of tests.
+	Coverage *Coverage
+
+	// Schema, if set, is the JSON Schema render contexts must match.
+	// Render and Template.Execute validate the context before rendering
+	// and fail with a ValidationErrors listing every mismatch; missing
+	// properties whose schema has a default are rendered with the
+	// default. Template.SetSchema gives a template its own schema.
+	Schema *Schema
+
+	// Syntax, if set, changes the delimiters and sigils templates are
+	// written with. Invalid syntax fails every render with an error
+	// naming the offending field.
+	Syntax *Syntax
+
+	// Locale is the locale renders are translated to when their context
+	// is not wrapped with WithLocale. See Environment.AddCatalog.
+	Locale string
+}
+
+// Environment holds the configuration shared by a set of templates:
+// custom filters, global variables and the rules for exposing Go values.
+// An Environment is safe for concurrent use.
+//
+// Example:
+//
+//	env := luma.NewEnvironment(luma.Options{})
+//	env.AddGlobal("now", time.Now)
+//	env.AddFilter("shout", func(s string) string { return strings.ToUpper(s) + "!" })
+//	result, err := env.Render("${name | shout}", map[string]interface{}{"name": "hi"})
+type Environment struct {
+	opts Options
+
+	mu         sync.RWMutex
+	filters    map[string]reflect.Value
+	globals    map[string]interface{}
+	methods    map[reflect.Type]map[string]bool
+	extensions map[string]Extension
+	catalogs   map[string]*Catalog
+
+	// generation changes whenever a change requires fresh Lua states
+	generation uint64
+	// pools holds the idle Lua states of each vmKind
+	pools [vmKinds]sync.Pool
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	// cache stores generated code when Options.CacheDir is set
+	cache *diskCache
+
+	// results memoizes Template.Execute when Options.ResultCache is set
+	results *resultCache
+	// volatile counts reads of the clock and the random source
+	volatile atomic.Uint64
+}
+
+// defaultEnvironment backs the package-level Render and Compile
+var defaultEnvironment = NewEnvironment(Options{})
+
+// NewEnvironment creates an Environment with the given options.
+func NewEnvironment(opts Options) *Environment {
+	if opts.Sandbox == nil {
+		opts.Sandbox = DefaultSandbox()
+	} else {
+		policy := *opts.Sandbox
+		opts.Sandbox = &policy
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+
+	e := &Environment{
+		opts: opts,
+		filters: map[string]reflect.Value{
+			"date":      reflect.ValueOf(dateFilter),
+			"isoformat": reflect.ValueOf(isoformatFilter),
+		},
+		globals:    make(map[string]interface{}),
+		methods:    make(map[reflect.Type]map[string]bool),
+		extensions: make(map[string]Extension),
+		catalogs:   make(map[string]*Catalog),
+		rand:       newRand(opts.Rand),
+	}
+	e.globals["now"] = e.Now
+	if opts.CacheDir != "" {
+		e.cache = newDiskCache(opts.CacheDir, opts.CacheMaxBytes)
+	}
+	if opts.ResultCache != nil {
+		e.results = newResultCache(*opts.ResultCache)
+	}
+	if opts.Schema != nil {
+		// Resolved now so that renders only read it; an invalid schema
+		// fails every render with the error prepare keeps
+		_ = opts.Schema.prepare()
+	}
+	return e
+}
+
+// AddFilter registers a Go function as a filter. The filtered value is
+// passed as the first argument and filter arguments follow; keyword
+// arguments fill a trailing struct or map parameter. A trailing error
+// result is reported as a template error.
+func (e *Environment) AddFilter(name string, fn interface{}) error {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return fmt.Errorf("filter %s: not a function", name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filters[name] = rv
+	e.generation++
+	e.clearResults()
+	return nil
+}
+
+// AddGlobal makes a value available to every template rendered by the
+// environment. Context values with the same name take precedence.
+func (e *Environment) AddGlobal(name string, value interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.globals[name] = value
+	e.clearResults()
+}
+
+// AllowMethods permits templates to call the named methods on values of
+// v's type when Options.RestrictMethods is set. v may be a value or a
+// pointer; both receive the permission.
+func (e *Environment) AllowMethods(v interface{}, names ...string) {
+	t := indirectType(reflect.TypeOf(v))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	allowed := e.methods[t]
+	if allowed == nil {
+		allowed = make(map[string]bool)
+		e.methods[t] = allowed
+	}
+	for _, name := range names {
+		allowed[name] = true
+	}
+	e.clearResults()
+}
+
+// clearResults empties the render result cache, if there is one
+func (e *Environment) clearResults() {
+	if e.results != nil {
+		e.results.clear()
+	}
+}
+
+// methodAllowed reports whether templates may call method name on t
+func (e *Environment) methodAllowed(t reflect.Type, name string) bool {
+	if !e.opts.RestrictMethods {
+		return true
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.methods[indirectType(t)][name]
+}
+
+// Render renders a template string with the given context.
+func (e *Environment) Render(source string, context interface{}) (string, error) {
+	context, err := e.validate(e.schema(nil), context)
+	if err != nil {
+		return "", err
+	}
+	return e.render("", source, context)
+}
+
+// schema returns the schema contexts are validated against: s if it is
+// set, otherwise Options.Schema
+func (e *Environment) schema(s *Schema) *Schema {
+	if s != nil {
+		return s
+	}
+	return e.opts.Schema
+}
+
+// render renders source as the template called name
+func (e *Environment) render(name, source string, context interface{}) (string, error) {
+	output, _, err := e.renderMapped(name, source, context, false)
+	return output, err
+}
+
+// renderMapped renders source as the template called name, along with
+// its source map when sourceMap is set
+func (e *Environment) renderMapped(name, source string, context interface{}, sourceMap bool) (string, *SourceMap, error) {
+	var kind vmKind
+	if sourceMap {
+		kind |= vmSourceMaps
+	}
+	if trackedContext(context) != nil {
+		kind |= vmTrackAccess
+	}
+	v, err := e.acquireVM(kind)
+	if err != nil {
+		return "", nil, err
+	}
+	defer e.releaseVM(v)
+
+	if v.hooks != nil {
+		v.hooks.start(hookRender, name)
+	}
+	output, err := e.renderIn(v, name, source, context)
+	if v.hooks != nil {
+		v.hooks.finish(len(output), err)
+	}
+	if v.takeCoverage != nil {
+		if covErr := e.collectCoverage(v); err == nil {
+			err = covErr
+		}
+	}
+	if !sourceMap {
+		return output, nil, err
+	}
+	m, mapErr := v.sourceMap(output)
+	if err == nil {
+		err = mapErr
+	}
+	return output, m, err
+}
+
+// renderIn renders source as the template called name in v
+func (e *Environment) renderIn(v *vm, name, source string, context interface{}) (string, error) {
+	ctxTable, err := e.contextTable(v.bridge, context)
+	if err != nil {
+		return "", err
+	}
+	tracked := trackedContext(context)
+	if tracked != nil {
+		if err := v.trackReads(ctxTable); err != nil {
+			return "", err
+		}
+	}
+	e.addGlobals(v.bridge, ctxTable)
+	if v.setTranslator != nil {
+		if err := v.translate(e.catalog(e.locale(context))); err != nil {
+			return "", err
+		}
+		defer v.translate(nil)
+	}
+
+	result, err := v.call(v.render, lua.LString(source), ctxTable, renderOptions(v.L, name))
+	if tracked != nil {
+		if trackErr := tracked.collect(e, v); err == nil {
+			err = trackErr
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("render error: %w", templateError(name, err))
+	}
+	return lua.LVAsString(result), nil
+}
+
+// Compile compiles a template string for later execution with this
+// environment.
+func (e *Environment) Compile(source string) (*Template, error) {
+	return e.compile("", source)
+}
+
+// compile compiles source as the template called name
+func (e *Environment) compile(name, source string) (*Template, error) {
+	v, err := e.acquireVM(vmPlain)
+	if err != nil {
+		return nil, err
+	}
+	defer e.releaseVM(v)
+
+	// Validate template syntax by parsing it, reporting every error
+	errs, err := v.parseErrors(name, source)
+	if err != nil {
+		return nil, fmt.Errorf("compilation error: %w", err)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("compilation error: %w", errs)
+	}
+
+	// Store the source for later execution
+	// A full implementation would cache the compiled Lua function
+	return &Template{
+		name:   name,
+		source: source,
+		env:    e,
+	}, nil
+}
+
+// renderOptions builds the options table passed to luma.render
+func renderOptions(L *lua.LState, name string) *lua.LTable {
+	opts := L.NewTable()
+	if name != "" {
+		opts.RawSetString("name", lua.LString(name))
+	}
+	return opts
+}
+
+// vmKind selects what the templates a Lua state compiles record. States
+// of different kinds are pooled apart, since their templates are
+// compiled differently.
+type vmKind int
+
+// vmPlain states record nothing besides the output
+const vmPlain vmKind = 0
+
+const (
+	// vmSourceMaps states record source maps
+	vmSourceMaps vmKind = 1 << iota
+	// vmTrackAccess states record the context values templates read
+	vmTrackAccess
+
+	// vmKinds is the number of combinations of kinds
+	vmKinds = 1 << iota
+)
+
+// acquireVM takes a Lua state of a kind from the pool, creating one if
+// none is idle or the pooled ones predate a configuration change, and
+// drops any templates the loader reports as changed from its cache.
+func (e *Environment) acquireVM(kind vmKind) (*vm, error) {
+	e.mu.RLock()
+	generation := e.generation
+	e.mu.RUnlock()
+
+	pool := &e.pools[kind]
+	for {
+		v, ok := pool.Get().(*vm)
+		if !ok {
+			var err error
+			if v, err = newVM(e, generation); err != nil {
+				return nil, err
+			}
+			if err := v.enable(kind); err != nil {
+				v.L.Close()
+				return nil, err
+			}
+		} else if v.generation != generation {
+			v.L.Close()
+			continue
+		}
+
+		if err := e.reloadChanged(v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// releaseVM returns a Lua state to the pool
+func (e *Environment) releaseVM(v *vm) {
+	v.reset()
+	e.pools[v.kind].Put(v)
+}
+
+// registerFilters installs the environment's Go filters in L
+func (e *Environment) registerFilters(L *lua.LState, b *bridge) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.filters) == 0 {
+		return nil
+	}
+
+	filters, err := requireModule(L, "luma.filters")
+	if err != nil {
+		return err
+	}
+	register := L.GetField(filters, "register")
+	for name, fn := range e.filters {
+		err := L.CallByParam(lua.P{Fn: register, NRet: 0, Protect: true},
+			lua.LString(name), b.funcToLua(name, fn))
+		if err != nil {
+			return fmt.Errorf("failed to register filter %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// contextTable converts a render context to a Lua table, with the
+// defaults its schema supplies.
+func (e *Environment) contextTable(b *bridge, context interface{}) (*lua.LTable, error) {
+	valid, _ := context.(*validContext)
+	if valid != nil {
+		context = valid.value
+	}
+	context = contextValue(context)
+	var ctxTable *lua.LTable
+	switch v := b.toLua(context).(type) {
+	case *lua.LNilType:
+		ctxTable = b.L.NewTable()
+	case *lua.LTable:
+		ctxTable = v
+	default:
+		return nil, fmt.Errorf("context must be a map or struct, got %T", context)
+	}
+	if valid != nil {
+		valid.applyDefaults(b, ctxTable)
+	}
+	return ctxTable, nil
+}
+
+// addGlobals adds the environment's globals to a context table, under
+// the names the context does not use.
+func (e *Environment) addGlobals(b *bridge, ctxTable *lua.LTable) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for name, value := range e.globals {
+		if ctxTable.RawGetString(name) == lua.LNil {
+			ctxTable.RawSetString(name, b.namedToLua(name, reflect.ValueOf(value)))
+		}
+	}
+}
+
+// requireModule loads a Lua module and returns its table
+func requireModule(L *lua.LState, name string) (lua.LValue, error) {
+	err := L.CallByParam(lua.P{Fn: L.GetGlobal("require"), NRet: 1, Protect: true}, lua.LString(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", name, err)
+	}
+	mod := L.Get(-1)
+	L.Pop(1)
+	return mod, nil
+}
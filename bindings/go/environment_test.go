@@ -0,0 +1,224 @@
+package luma_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+type testUser struct {
+	First string
+	Last  string
+	Email string `luma:"email"`
+	Token string `luma:"-"`
+}
+
+func (u testUser) FullName() string {
+	return u.First + " " + u.Last
+}
+
+func (u *testUser) Greet(greeting string, names ...string) string {
+	return greeting + ", " + strings.Join(names, " and ") + "!"
+}
+
+func (u testUser) Secret() string {
+	return u.Token
+}
+
+type padOptions struct {
+	Width int
+	Fill  string
+}
+
+func TestEnvironmentCallables(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	if err := env.AddFilter("pad", func(s string, opts padOptions) string {
+		return s + strings.Repeat(opts.Fill, opts.Width)
+	}); err != nil {
+		t.Fatalf("AddFilter() error = %v", err)
+	}
+
+	user := &testUser{First: "Ada", Last: "Lovelace", Email: "ada@example.com", Token: "s3cret"}
+	context := map[string]interface{}{
+		"user": user,
+		"lookup": func(key string) string {
+			return "value of " + key
+		},
+		"sum": func(nums ...int) int {
+			total := 0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "context function",
+			template: "${lookup('region')}",
+			want:     "value of region",
+		},
+		{
+			name:     "variadic function",
+			template: "${sum(1, 2, 3)}",
+			want:     "6",
+		},
+		{
+			name:     "value method in simple interpolation",
+			template: "$user.FullName()",
+			want:     "Ada Lovelace",
+		},
+		{
+			name:     "method without a call",
+			template: "[$user.FullName] [${lookup}]",
+			want:     "[] []",
+		},
+		{
+			name:     "parentheses after a plain value",
+			template: "$user.First() {",
+			want:     "Ada() {",
+		},
+		{
+			name:     "pointer method with variadic arguments",
+			template: "${user.Greet('Hello', 'Alan', 'Grace')}",
+			want:     "Hello, Alan and Grace!",
+		},
+		{
+			name:     "keyword arguments fill struct parameter",
+			template: "${'x' | pad(width=3, fill='-')}",
+			want:     "x---",
+		},
+		{
+			name:     "luma tag renames field",
+			template: "$user.email",
+			want:     "ada@example.com",
+		},
+		{
+			name:     "luma tag hides field",
+			template: "${user.Token is defined}",
+			want:     "false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := env.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentCallableErrors(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	context := map[string]interface{}{
+		"lookup": func(key string) (string, error) {
+			return "", errors.New("no such key: " + key)
+		},
+		"count": func(n int) int { return n },
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		wantErr  string
+	}{
+		{
+			name:     "error result",
+			template: "${lookup('region')}",
+			wantErr:  "lookup: no such key: region",
+		},
+		{
+			name:     "argument conversion",
+			template: "${count('many')}",
+			wantErr:  "count: argument 1",
+		},
+		{
+			name:     "too many arguments",
+			template: "${count(1, 2)}",
+			wantErr:  "count: too many arguments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := env.Render(tt.template, context)
+			if err == nil {
+				t.Fatal("Render() expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Render() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvironmentRestrictMethods(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{RestrictMethods: true})
+	env.AllowMethods(testUser{}, "FullName")
+
+	user := &testUser{First: "Ada", Last: "Lovelace", Token: "s3cret"}
+	context := map[string]interface{}{"user": user}
+
+	got, err := env.Render("$user.FullName()", context)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Ada Lovelace" {
+		t.Errorf("Render() = %q, want %q", got, "Ada Lovelace")
+	}
+
+	got, err = env.Render("${user.Secret is defined}", context)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "false" {
+		t.Errorf("unlisted method is visible: Render() = %q", got)
+	}
+}
+
+func TestEnvironmentGlobals(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	env.AddGlobal("site", "example.com")
+	env.AddGlobal("greet", func(name string) string { return "Hi " + name })
+
+	got, err := env.Render("${greet('Ada')} from $site", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Hi Ada from example.com" {
+		t.Errorf("Render() = %q", got)
+	}
+
+	// Context values shadow globals
+	got, err = env.Render("$site", map[string]interface{}{"site": "override.org"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "override.org" {
+		t.Errorf("Render() = %q, want %q", got, "override.org")
+	}
+}
+
+func TestRenderStructContext(t *testing.T) {
+	user := testUser{First: "Grace", Last: "Hopper"}
+
+	got, err := luma.Render("$First: $FullName()", user)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Grace: Grace Hopper" {
+		t.Errorf("Render() = %q", got)
+	}
+}
@@ -0,0 +1,201 @@
+package luma
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Error is an error Luma found in a template, with its position.
+type Error struct {
+	// Kind is the error type, such as "LexerError", "ParseError" or
+	// "RuntimeError".
+	Kind string
+	// Template is the template name, empty for templates rendered from
+	// a string.
+	Template string
+	// Line and Column are 1-based, 0 when unknown.
+	Line, Column int
+	Message      string
+}
+
+// Error formats the error as name:line:column: Kind: message, leaving
+// out the parts of the position that are unknown.
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(templateLabel(e.Template))
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	b.WriteString(": ")
+	if e.Kind != "" {
+		b.WriteString(e.Kind)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Errors is a list of errors reported together, such as every syntax
+// error in a template or the failures of rendering many templates. Use
+// errors.As to get it from an error a function returned.
+//
+// Example:
+//
+//	_, err := env.Compile(source)
+//	var errs luma.Errors
+//	if errors.As(err, &errs) {
+//	    for _, e := range errs {
+//	        fmt.Printf("%d:%d: %s\n", e.Line, e.Column, e.Message)
+//	    }
+//	}
+type Errors []*Error
+
+// Error lists the errors one per line.
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Err returns the list as an error, or nil when it is empty.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Append adds the errors err holds to the list and returns it: each
+// error of an Errors, a *Error as is and any other error as an *Error
+// without a position. Errors without a template name get template.
+//
+// Example:
+//
+//	var errs luma.Errors
+//	for name, r := range env.RenderAll(names, values) {
+//	    errs = errs.Append(name, r.Err)
+//	}
+//	return errs.Err()
+func (e Errors) Append(template string, err error) Errors {
+	if err == nil {
+		return e
+	}
+	var found Errors
+	var single *Error
+	switch {
+	case errors.As(err, &found):
+	case errors.As(err, &single):
+		found = Errors{single}
+	default:
+		found = Errors{{Message: err.Error()}}
+	}
+	for _, f := range found {
+		if f.Template == "" && template != "" {
+			copied := *f
+			copied.Template = template
+			f = &copied
+		}
+		e = append(e, f)
+	}
+	return e
+}
+
+// parseErrors parses source as the template called name, collecting
+// every syntax error in source order instead of stopping at the first
+func (v *vm) parseErrors(name, source string) (Errors, error) {
+	err := v.L.CallByParam(lua.P{Fn: v.parseAll, NRet: 2, Protect: true}, lua.LString(source), renderOptions(v.L, name))
+	if err != nil {
+		return nil, err
+	}
+	list, _ := v.L.Get(-1).(*lua.LTable)
+	v.L.Pop(2)
+	if list == nil {
+		return nil, nil
+	}
+
+	var errs Errors
+	list.ForEach(func(_, value lua.LValue) {
+		if tbl, ok := value.(*lua.LTable); ok {
+			errs = append(errs, errorFromTable(name, tbl))
+		}
+	})
+	return errs, nil
+}
+
+// errorFromTable converts an error object of luma.utils.errors
+func errorFromTable(name string, tbl *lua.LTable) *Error {
+	e := &Error{
+		Kind:     lua.LVAsString(tbl.RawGetString("type")),
+		Template: lua.LVAsString(tbl.RawGetString("source_name")),
+		Line:     int(lua.LVAsNumber(tbl.RawGetString("line"))),
+		Column:   int(lua.LVAsNumber(tbl.RawGetString("column"))),
+		Message:  lua.LVAsString(tbl.RawGetString("message")),
+	}
+	if e.Template == "template" && name == "" {
+		e.Template = ""
+	}
+	return e
+}
+
+var (
+	// luaErrorKind finds the error types in a formatted Luma error
+	luaErrorKind = regexp.MustCompile(`\b([A-Z]\w*Error): `)
+	// luaErrorPosition finds the position line of a formatted Luma error
+	luaErrorPosition = regexp.MustCompile(`\n  at (.+?):(\d+)(?::(\d+))?(?:\n|$)`)
+	// luaChunkPosition matches the Lua source positions error() prefixes
+	// messages with
+	luaChunkPosition = regexp.MustCompile(`^(?:\S+:\d+: )+`)
+)
+
+// templateError converts an error raised by Luma while rendering the
+// template called name into an *Error. Errors raised from inside other
+// errors, such as one in an included template, report the innermost
+// error. Errors in another format are returned unchanged.
+func templateError(name string, err error) error {
+	msg := err.Error()
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) {
+		msg = apiErr.Object.String()
+	}
+
+	e := &Error{Template: name}
+	head := msg
+	if at := luaErrorPosition.FindStringSubmatchIndex(msg); at != nil {
+		head = msg[:at[0]]
+		e.Template = msg[at[2]:at[3]]
+		e.Line, _ = strconv.Atoi(msg[at[4]:at[5]])
+		if at[6] >= 0 {
+			e.Column, _ = strconv.Atoi(msg[at[6]:at[7]])
+		}
+		if e.Template == "template" && name == "" {
+			e.Template = ""
+		}
+	}
+	kinds := luaErrorKind.FindAllStringSubmatchIndex(head, -1)
+	if kinds == nil {
+		return err
+	}
+	last := kinds[len(kinds)-1]
+	e.Kind = head[last[2]:last[3]]
+	e.Message = luaChunkPosition.ReplaceAllString(strings.TrimSpace(head[last[1]:]), "")
+	return e
+}
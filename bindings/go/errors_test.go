@@ -0,0 +1,91 @@
+package luma_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestCompileReportsAllSyntaxErrors(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"page.luma": "ok\n${ 1 + }\nfine $name\n@set = 2\n${ a b }\nlast",
+	}})
+	_, err := env.GetTemplate("page.luma")
+
+	var errs luma.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("GetTemplate() error = %v, want luma.Errors", err)
+	}
+	want := []struct{ line, column int }{{2, 8}, {4, 6}, {5, 6}}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		e := errs[i]
+		if e.Kind != "ParseError" || e.Template != "page.luma" || e.Line != w.line || e.Column != w.column {
+			t.Errorf("error %d = %+v, want a ParseError at page.luma:%d:%d", i, e, w.line, w.column)
+		}
+	}
+
+	var first *luma.Error
+	if !errors.As(err, &first) || first != errs[0] {
+		t.Errorf("errors.As(*luma.Error) = %v, want the first error", first)
+	}
+	if got := errs[0].Error(); got != "page.luma:2:8: ParseError: Unexpected token: INTERP_END" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestCompileValidTemplate(t *testing.T) {
+	if _, err := luma.NewEnvironment(luma.Options{}).Compile("Hello $name\n@if x\nyes\n@end"); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+}
+
+func TestRenderErrorPosition(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"page.luma":  "title\n@include \"inner.luma\"",
+		"inner.luma": "ok\n${ 1 + {} }",
+	}})
+	tmpl, err := env.GetTemplate("page.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Execute(nil)
+
+	var e *luma.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Execute() error = %v, want a *luma.Error", err)
+	}
+	if e.Kind != "RuntimeError" || e.Template != "inner.luma" || e.Line != 2 {
+		t.Errorf("Execute() error = %+v, want a RuntimeError at inner.luma:2", e)
+	}
+}
+
+func TestErrorsAppend(t *testing.T) {
+	var errs luma.Errors
+	if errs.Err() != nil {
+		t.Error("Err() of an empty list is not nil")
+	}
+
+	errs = errs.Append("a.luma", nil)
+	errs = errs.Append("a.luma", fmt.Errorf("render error: %w", &luma.Error{Kind: "RuntimeError", Line: 3, Message: "boom"}))
+	errs = errs.Append("b.luma", luma.Errors{
+		{Kind: "ParseError", Template: "b.luma", Line: 1, Column: 2, Message: "first"},
+		{Kind: "ParseError", Template: "c.luma", Line: 4, Message: "second"},
+	})
+	errs = errs.Append("d.luma", errors.New("plain"))
+
+	want := "a.luma:3: RuntimeError: boom\n" +
+		"b.luma:1:2: ParseError: first\n" +
+		"c.luma:4: ParseError: second\n" +
+		"d.luma: plain"
+	if got := errs.Err().Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if len(errs.Unwrap()) != 4 {
+		t.Errorf("Unwrap() returned %d errors, want 4", len(errs.Unwrap()))
+	}
+}
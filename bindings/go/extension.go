@@ -0,0 +1,162 @@
+package luma
+
+import (
+	"errors"
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Extension is a custom directive implemented in Go. Templates write it
+// like a built-in directive, @name args in native syntax or
+// {% name args %} in Jinja syntax, with comma-separated expressions as
+// arguments. A block extension encloses a body ended by @end, or by
+// {% endname %} or {% end %} in Jinja syntax.
+//
+// Example:
+//
+//	// @feature "beta"
+//	// ...
+//	// @end
+//	env.AddExtension(luma.Extension{
+//	    Name:  "feature",
+//	    Block: true,
+//	    Render: func(call luma.ExtensionCall) (string, error) {
+//	        name, _ := call.Args[0].(string)
+//	        if !features[name] {
+//	            return "", nil
+//	        }
+//	        return call.Body, nil
+//	    },
+//	})
+type Extension struct {
+	// Name is the directive name. It must be an identifier that is not
+	// a built-in directive or keyword.
+	Name string
+
+	// Block makes the directive enclose a body
+	Block bool
+
+	// Render returns the directive's output, which is inserted as is,
+	// without autoescaping. An error fails the render.
+	Render func(call ExtensionCall) (string, error)
+}
+
+// ExtensionCall is one use of an extension in a render
+type ExtensionCall struct {
+	// Args holds the values of the positional arguments
+	Args []interface{}
+	// Kwargs holds the values of the name=value arguments, or nil
+	// without any
+	Kwargs map[string]interface{}
+	// Body is the rendered body of a block extension, with the render's
+	// context. It is empty for other extensions.
+	Body string
+}
+
+// AddExtension registers a custom directive. Templates already compiled
+// keep the syntax they were compiled with.
+func (e *Environment) AddExtension(ext Extension) error {
+	if ext.Render == nil {
+		return fmt.Errorf("extension %s: Render is nil", ext.Name)
+	}
+	if err := e.checkExtension(ext); err != nil {
+		return fmt.Errorf("extension %s: %w", ext.Name, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.extensions[ext.Name] = ext
+	e.generation++
+	e.clearResults()
+	return nil
+}
+
+// checkExtension reports whether the Lua registry would reject ext
+func (e *Environment) checkExtension(ext Extension) error {
+	v, err := e.acquireVM(vmPlain)
+	if err != nil {
+		return err
+	}
+	defer e.releaseVM(v)
+
+	extensions, err := requireModule(v.L, "luma.extensions")
+	if err != nil {
+		return err
+	}
+	spec := v.L.NewTable()
+	spec.RawSetString("render", v.L.NewFunction(func(*lua.LState) int { return 0 }))
+	result, err := v.call(v.L.GetField(extensions, "check"), lua.LString(ext.Name), spec)
+	if err != nil {
+		return err
+	}
+	if msg, ok := result.(lua.LString); ok {
+		return errors.New(string(msg))
+	}
+	return nil
+}
+
+// registerExtensions installs the environment's extensions in L
+func (e *Environment) registerExtensions(L *lua.LState, b *bridge) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.extensions) == 0 {
+		return nil
+	}
+
+	extensions, err := requireModule(L, "luma.extensions")
+	if err != nil {
+		return err
+	}
+	register := L.GetField(extensions, "register")
+	for name, ext := range e.extensions {
+		spec := L.NewTable()
+		spec.RawSetString("block", lua.LBool(ext.Block))
+		spec.RawSetString("render", b.extensionToLua(ext))
+		err := L.CallByParam(lua.P{Fn: register, NRet: 0, Protect: true}, lua.LString(name), spec)
+		if err != nil {
+			return fmt.Errorf("failed to register extension %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// extensionToLua wraps an extension's Render as the render function of
+// the Lua registry, which is called with the arguments, the named
+// arguments and the body
+func (b *bridge) extensionToLua(ext Extension) *lua.LFunction {
+	return b.L.NewFunction(func(L *lua.LState) int {
+		call := ExtensionCall{Body: L.OptString(3, "")}
+		if args, ok := L.Get(1).(*lua.LTable); ok {
+			n := int(lua.LVAsNumber(args.RawGetString("n")))
+			call.Args = make([]interface{}, n)
+			for i := range call.Args {
+				call.Args[i] = b.toInterface(args.RawGetInt(i + 1))
+			}
+		}
+		if named, ok := L.Get(2).(*lua.LTable); ok {
+			call.Kwargs = make(map[string]interface{})
+			named.ForEach(func(key, value lua.LValue) {
+				call.Kwargs[key.String()] = b.toInterface(value)
+			})
+		}
+
+		output, err := renderExtension(ext, call)
+		if err != nil {
+			L.RaiseError("%s: %s", ext.Name, err.Error())
+			return 0
+		}
+		L.Push(lua.LString(output))
+		return 1
+	})
+}
+
+// renderExtension calls ext.Render, turning a panic into an error
+func renderExtension(ext Extension, call ExtensionCall) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return ext.Render(call)
+}
@@ -0,0 +1,121 @@
+package luma_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestAddExtensionBlock(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	features := map[string]bool{"beta": true}
+	err := env.AddExtension(luma.Extension{
+		Name:  "feature",
+		Block: true,
+		Render: func(call luma.ExtensionCall) (string, error) {
+			name, _ := call.Args[0].(string)
+			if !features[name] {
+				return "", nil
+			}
+			return call.Body, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := "a\n@feature \"beta\"\nbeta $user\n@end\n@feature \"gamma\"\ngamma\n@end"
+	out, err := env.Render(source, map[string]interface{}{"user": "ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\nbeta ada\n\n"; out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+
+	out, err = env.Render("{% feature 'beta' %}<{{ user }}>{% endfeature %}", map[string]interface{}{"user": "ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<ada>"; out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+}
+
+func TestAddExtensionArguments(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	err := env.AddExtension(luma.Extension{
+		Name: "stamp",
+		Render: func(call luma.ExtensionCall) (string, error) {
+			return fmt.Sprintf("%v %v<b>", call.Args, call.Kwargs), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.Render("@stamp 1 + 1, name, sep=\"-\"\n@stamp\n", map[string]interface{}{"name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[2 x] map[sep:-]<b>[] map[]<b>"; out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+}
+
+func TestAddExtensionInline(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	err := env.AddExtension(luma.Extension{
+		Name: "stamp",
+		Render: func(call luma.ExtensionCall) (string, error) {
+			return fmt.Sprintf("<S%v>", call.Args), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := env.Render("inline @stamp here, @stamp(name) there", map[string]interface{}{"name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "inline <S[]> here, <S[x]> there"; out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+}
+
+func TestAddExtensionError(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	err := env.AddExtension(luma.Extension{
+		Name: "fail",
+		Render: func(luma.ExtensionCall) (string, error) {
+			return "", errors.New("boom")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Render("@fail\n", nil); err == nil || !strings.Contains(err.Error(), "fail: boom") {
+		t.Errorf("Render() error = %v, want fail: boom", err)
+	}
+}
+
+func TestAddExtensionInvalid(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	render := func(luma.ExtensionCall) (string, error) { return "", nil }
+	for _, ext := range []luma.Extension{
+		{Name: "if", Render: render},
+		{Name: "not-a-name", Render: render},
+		{Name: "nop"},
+	} {
+		if err := env.AddExtension(ext); err == nil {
+			t.Errorf("AddExtension(%q) succeeded, want an error", ext.Name)
+		}
+	}
+	if out, err := env.Render("ok", nil); err != nil || out != "ok" {
+		t.Errorf("Render() = %q, %v after rejected extensions", out, err)
+	}
+}
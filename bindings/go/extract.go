@@ -0,0 +1,148 @@
+package luma
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Message is a translatable message found in templates
+type Message struct {
+	// ID is the message id, with %(name)s standing for variables
+	ID string
+	// Plural is the plural message id, empty without a plural form
+	Plural string
+	// Locations lists where the message is used
+	Locations []SourceLocation
+}
+
+// ExtractMessages finds the translatable messages of templates: the
+// text of @trans blocks and the string literals passed to _(),
+// gettext() and ngettext(). A message used more than once is listed
+// once, with every location, in the order it is first found. Parent
+// and included templates are not followed; extract them too.
+//
+// Example:
+//
+//	messages, err := luma.ExtractMessages(templates...)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	f, _ := os.Create("locale/messages.pot")
+//	defer f.Close()
+//	luma.WritePOT(f, messages)
+func ExtractMessages(templates ...*Template) ([]Message, error) {
+	var messages []Message
+	index := make(map[string]int)
+	for _, tmpl := range templates {
+		found, err := tmpl.messages()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range found {
+			i, ok := index[m.ID]
+			if !ok {
+				index[m.ID] = len(messages)
+				messages = append(messages, m)
+				continue
+			}
+			if messages[i].Plural == "" {
+				messages[i].Plural = m.Plural
+			}
+			messages[i].Locations = append(messages[i].Locations, m.Locations...)
+		}
+	}
+	return messages, nil
+}
+
+// messages finds the translatable messages of the template, one per use
+func (t *Template) messages() ([]Message, error) {
+	source, err := t.currentSource()
+	if err != nil {
+		return nil, err
+	}
+	v, err := t.env.acquireVM(vmPlain)
+	if err != nil {
+		return nil, err
+	}
+	defer t.env.releaseVM(v)
+
+	analysis, err := requireModule(v.L, "luma.compiler.analysis")
+	if err != nil {
+		return nil, err
+	}
+	result, err := v.call(v.L.GetField(analysis, "messages"), lua.LString(source), renderOptions(v.L, t.name))
+	if err != nil {
+		return nil, fmt.Errorf("extraction error: %w", templateError(t.name, err))
+	}
+
+	tbl, ok := result.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("extraction error: unexpected %s", result.Type())
+	}
+	messages := make([]Message, 0, tbl.Len())
+	for i := 1; i <= tbl.Len(); i++ {
+		entry, ok := tbl.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			continue
+		}
+		messages = append(messages, Message{
+			ID:        lua.LVAsString(entry.RawGetString("id")),
+			Plural:    lua.LVAsString(entry.RawGetString("plural")),
+			Locations: []SourceLocation{analysisLocation(entry.RawGetString("position"))},
+		})
+	}
+	return messages, nil
+}
+
+// WritePOT writes messages as a gettext template (.pot file), the
+// starting point of the PO file of each language. Locations are written
+// as reference comments, name:line.
+func WritePOT(w io.Writer, messages []Message) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("msgid \"\"\nmsgstr \"\"\n")
+	bw.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	bw.WriteString("\"Content-Transfer-Encoding: 8bit\\n\"\n")
+
+	for _, m := range messages {
+		bw.WriteString("\n")
+		for _, l := range m.Locations {
+			fmt.Fprintf(bw, "#: %s:%d\n", templateLabel(l.Template), l.Line)
+		}
+		if strings.Contains(m.ID+m.Plural, "%(") {
+			bw.WriteString("#, python-format\n")
+		}
+		writePOString(bw, "msgid", m.ID)
+		if m.Plural == "" {
+			writePOString(bw, "msgstr", "")
+			continue
+		}
+		writePOString(bw, "msgid_plural", m.Plural)
+		writePOString(bw, "msgstr[0]", "")
+		writePOString(bw, "msgstr[1]", "")
+	}
+	return bw.Flush()
+}
+
+// poEscaper escapes strings for PO files
+var poEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+// writePOString writes a PO keyword and its string, split after each
+// newline when the string has several lines
+func writePOString(w *bufio.Writer, keyword, s string) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 1 {
+		fmt.Fprintf(w, "%s \"%s\"\n", keyword, poEscaper.Replace(s))
+		return
+	}
+	fmt.Fprintf(w, "%s \"\"\n", keyword)
+	for _, line := range lines {
+		fmt.Fprintf(w, "\"%s\"\n", poEscaper.Replace(line))
+	}
+}
@@ -0,0 +1,54 @@
+package luma_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestExtractMessages(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"welcome.luma": "@trans name=user.name\nWelcome, $name!\n@end\n${_(\"Settings\")} ${_(title)}\n",
+		"digest.luma": "{% trans count=n %}One \"new\" message{% pluralize %}{{ count }} new messages{% endtrans %}\n" +
+			"{{ gettext('Settings') }}\n{{ ngettext('%(num)s day', '%(num)s days', days) }}\n",
+	}})
+	var templates []*luma.Template
+	for _, name := range []string{"welcome.luma", "digest.luma"} {
+		tmpl, err := env.GetTemplate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates = append(templates, tmpl)
+	}
+
+	messages, err := luma.ExtractMessages(templates...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	want := []string{"Welcome, %(name)s!", "Settings", "One \"new\" message", "%(num)s day"}
+	if strings.Join(ids, "|") != strings.Join(want, "|") {
+		t.Fatalf("ExtractMessages() ids = %q, want %q", ids, want)
+	}
+	if got := messages[1].Locations; len(got) != 2 || got[0].String() != "welcome.luma:4:3" || got[1].Template != "digest.luma" {
+		t.Errorf("Settings locations = %v", got)
+	}
+
+	var pot strings.Builder
+	if err := luma.WritePOT(&pot, messages); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{
+		"#: welcome.luma:1\n#, python-format\nmsgid \"Welcome, %(name)s!\"\nmsgstr \"\"\n",
+		"#: welcome.luma:4\n#: digest.luma:2\nmsgid \"Settings\"\nmsgstr \"\"\n",
+		"msgid \"One \\\"new\\\" message\"\nmsgid_plural \"%(count)s new messages\"\nmsgstr[0] \"\"\nmsgstr[1] \"\"\n",
+	} {
+		if !strings.Contains(pot.String(), entry) {
+			t.Errorf("WritePOT() output lacks %q:\n%s", entry, pot.String())
+		}
+	}
+}
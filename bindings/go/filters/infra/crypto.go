@@ -0,0 +1,233 @@
+package infra
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Certificate is a PEM-encoded certificate and private key, as returned
+// by genCA, genSelfSignedCert and genSignedCert. Templates read the
+// fields as $ca.Cert and $ca.Key.
+type Certificate struct {
+	Cert string
+	Key  string
+}
+
+const alphaNum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// uuidv4 returns a random version 4 UUID
+func (f *funcs) uuidv4() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(f.rand, b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randAlphaNum returns n random letters and digits
+func (f *funcs) randAlphaNum(n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("negative length %d", n)
+	}
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := io.ReadFull(f.rand, buf[:n-len(out)]); err != nil {
+			return "", err
+		}
+		for _, c := range buf[:n-len(out)] {
+			// Reject the bytes that would bias the result
+			if int(c) < len(alphaNum)*(256/len(alphaNum)) {
+				out = append(out, alphaNum[int(c)%len(alphaNum)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// htpasswd returns an htpasswd entry with a bcrypt hash of password
+func (f *funcs) htpasswd(username, password string) (string, error) {
+	if strings.Contains(username, ":") {
+		return "", fmt.Errorf("username %q may not contain ':'", username)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return username + ":" + string(hash), nil
+}
+
+// genPrivateKey returns a PEM-encoded private key of the given type:
+// "rsa" (4096 bits), "ecdsa" (P-256) or "ed25519". Only ed25519 keys are
+// derived from the configured random source.
+func (f *funcs) genPrivateKey(typ string) (string, error) {
+	var key crypto.Signer
+	var err error
+	switch typ {
+	case "rsa":
+		key, err = rsa.GenerateKey(f.rand, 4096)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), f.rand)
+	case "ed25519":
+		key, err = f.ed25519Key()
+	default:
+		return "", fmt.Errorf("unknown key type %q", typ)
+	}
+	if err != nil {
+		return "", err
+	}
+	return encodeKey(key)
+}
+
+// ed25519Key derives an Ed25519 key from the random source
+func (f *funcs) ed25519Key() (ed25519.PrivateKey, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(f.rand, seed); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// genCA returns a certificate authority valid for days days. Its key is
+// an Ed25519 key, so the result is reproducible with a seeded source.
+func (f *funcs) genCA(cn string, days int) (Certificate, error) {
+	template, err := f.certTemplate(cn, nil, nil, days)
+	if err != nil {
+		return Certificate{}, err
+	}
+	template.KeyUsage |= x509.KeyUsageCertSign
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	return f.issue(template, nil)
+}
+
+// genSelfSignedCert returns a self-signed certificate for cn and the
+// given IP addresses and DNS names, valid for days days
+func (f *funcs) genSelfSignedCert(cn string, ips, dnsNames []string, days int) (Certificate, error) {
+	template, err := f.certTemplate(cn, ips, dnsNames, days)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return f.issue(template, nil)
+}
+
+// genSignedCert returns a certificate for cn and the given IP addresses
+// and DNS names signed by ca, valid for days days
+func (f *funcs) genSignedCert(cn string, ips, dnsNames []string, days int, ca Certificate) (Certificate, error) {
+	template, err := f.certTemplate(cn, ips, dnsNames, days)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return f.issue(template, &ca)
+}
+
+// certTemplate builds the certificate fields shared by all generators
+func (f *funcs) certTemplate(cn string, ips, dnsNames []string, days int) (*x509.Certificate, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("validity must be at least one day, got %d", days)
+	}
+	serial, err := rand.Int(f.rand, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := f.now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Duration(days) * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+	}
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+	return template, nil
+}
+
+// issue creates a certificate with a new key, signed by ca or by the new
+// key itself when ca is nil
+func (f *funcs) issue(template *x509.Certificate, ca *Certificate) (Certificate, error) {
+	key, err := f.ed25519Key()
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	parent, signer := template, crypto.Signer(key)
+	if ca != nil {
+		if parent, signer, err = parseCA(ca); err != nil {
+			return Certificate{}, err
+		}
+	}
+
+	der, err := x509.CreateCertificate(f.rand, template, parent, key.Public(), signer)
+	if err != nil {
+		return Certificate{}, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{
+		Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:  keyPEM,
+	}, nil
+}
+
+// parseCA decodes a certificate authority returned by genCA
+func parseCA(ca *Certificate) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode([]byte(ca.Cert))
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("invalid CA certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBlock, _ := pem.Decode([]byte(ca.Key))
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid CA key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA key cannot sign")
+	}
+	return cert, signer, nil
+}
+
+// encodeKey encodes a private key as PKCS #8 PEM
+func encodeKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
@@ -0,0 +1,136 @@
+// Package infra provides Go-backed filters for infrastructure templating,
+// modeled on the sprig functions Helm charts rely on: encoding, hashing,
+// YAML and JSON conversion, semantic version checks, random values and
+// certificate generation.
+//
+// The filters are not part of the default environment. Register them on
+// the environments that need them:
+//
+//	env := luma.NewEnvironment(luma.Options{})
+//	if err := infra.Register(env, infra.Options{}); err != nil {
+//	    log.Fatal(err)
+//	}
+//	out, err := env.Render(`password: ${16 | randAlphaNum | b64enc}`, nil)
+//
+// Random values and certificate validity periods come from the
+// environment's Rand and Clock options unless Options overrides them.
+// Set those, or use Deterministic, to get reproducible output, for
+// example in golden-file tests.
+package infra
+
+import (
+	crand "crypto/rand"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	luma "github.com/santosr2/luma/bindings/go"
+)
+
+// Options configures the filters.
+type Options struct {
+	// Rand is the source of random bytes for uuidv4, randAlphaNum,
+	// certificate serial numbers and generated keys. It defaults to the
+	// environment's Random. It may be shared by concurrent renders, so
+	// readers that are not safe for concurrent use are serialized.
+	Rand io.Reader
+
+	// Now returns the time certificates are valid from. It defaults to
+	// the environment's Now.
+	Now func() time.Time
+}
+
+// Deterministic returns options whose random values come from a source
+// seeded with seed and whose clock always returns now, so the same
+// templates rendered in the same order produce the same output.
+//
+// RSA and ECDSA keys from genPrivateKey are generated by the Go crypto
+// library, which ignores the random source, and bcrypt hashes from
+// htpasswd are always salted from crypto/rand; neither is reproducible.
+func Deterministic(seed int64, now time.Time) Options {
+	return Options{
+		Rand: rand.New(rand.NewSource(seed)),
+		Now:  func() time.Time { return now },
+	}
+}
+
+// Register adds the filters to env, along with the uuidv4 function,
+// which takes no input and is registered as a global. Filters and
+// globals with the same names already registered on env are replaced.
+func Register(env *luma.Environment, opts Options) error {
+	f := newFuncs(env, opts)
+	for name, fn := range f.filters() {
+		if err := env.AddFilter(name, fn); err != nil {
+			return err
+		}
+	}
+	env.AddGlobal("uuidv4", f.uuidv4)
+	return nil
+}
+
+// funcs holds the state shared by the filters of one Register call
+type funcs struct {
+	rand io.Reader
+	now  func() time.Time
+}
+
+func newFuncs(env *luma.Environment, opts Options) *funcs {
+	f := &funcs{rand: opts.Rand, now: opts.Now}
+	switch f.rand {
+	case nil:
+		f.rand = env.Random()
+	case crand.Reader:
+	default:
+		f.rand = &lockedReader{r: f.rand}
+	}
+	if f.now == nil {
+		f.now = env.Now
+	}
+	return f
+}
+
+// filters returns the filter functions by name
+func (f *funcs) filters() map[string]interface{} {
+	return map[string]interface{}{
+		// Encoding and hashing
+		"b64enc":    b64enc,
+		"b64dec":    b64dec,
+		"sha256sum": sha256sum,
+		"toYaml":    toYaml,
+		"fromYaml":  fromYaml,
+		"toJson":    toJSON,
+		"fromJson":  fromJSON,
+
+		// Strings
+		"required":        required,
+		"regexReplaceAll": regexReplaceAll,
+		"trunc":           trunc,
+		"quote":           quote,
+		"squote":          squote,
+		"semverCompare":   semverCompare,
+
+		// Random values
+		"randAlphaNum": f.randAlphaNum,
+
+		// Credentials and certificates
+		"htpasswd":          f.htpasswd,
+		"genPrivateKey":     f.genPrivateKey,
+		"genCA":             f.genCA,
+		"genSelfSignedCert": f.genSelfSignedCert,
+		"genSignedCert":     f.genSignedCert,
+	}
+}
+
+// lockedReader serializes reads from a reader that is not safe for
+// concurrent use, such as a seeded math/rand source
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return io.ReadFull(l.r, p)
+}
@@ -0,0 +1,279 @@
+package infra_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	luma "github.com/santosr2/luma/bindings/go"
+	"github.com/santosr2/luma/bindings/go/filters/infra"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var epoch = time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+
+func newEnv(t *testing.T, opts infra.Options) *luma.Environment {
+	t.Helper()
+	env := luma.NewEnvironment(luma.Options{Autoescape: luma.EscapeNone})
+	if err := infra.Register(env, opts); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return env
+}
+
+func TestFilters(t *testing.T) {
+	env := newEnv(t, infra.Options{})
+	context := map[string]interface{}{
+		"config": map[string]interface{}{
+			"name":  "web",
+			"ports": []int{80, 443},
+		},
+		"empty": "",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"b64enc", "${'hello' | b64enc}", "aGVsbG8="},
+		{"b64dec", "${'aGVsbG8=' | b64dec}", "hello"},
+		{"sha256sum", "${'hello' | sha256sum}", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"toYaml", "${config | toYaml}", "name: web\nports:\n  - 80\n  - 443"},
+		{"fromYaml", "${('a: 1\\nb: [x, y]' | fromYaml).b[2]}", "y"},
+		{"toJson", "${config | toJson}", `{"name":"web","ports":[80,443]}`},
+		{"fromJson", "${('{\"a\": {\"b\": 2}}' | fromJson).a.b}", "2"},
+		{"required present", "${config.name | required('name is required')}", "web"},
+		{"regexReplaceAll", "${'v1.2.3' | regexReplaceAll('^v(\\\\d+).*', '$1')}", "1"},
+		{"trunc", "${'kubernetes' | trunc(4)}", "kube"},
+		{"trunc from end", "${'kubernetes' | trunc(-4)}", "etes"},
+		{"quote", `${'say "hi"' | quote}`, `"say \"hi\""`},
+		{"quote number", "${8080 | quote}", `"8080"`},
+		{"squote", "${'x' | squote}", "'x'"},
+		{"squote quotes", `${"it's" | squote}`, `'it'\''s'`},
+		{"semverCompare", "${'>=1.20.0 <2.0.0' | semverCompare('1.27.3')}", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := env.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequired(t *testing.T) {
+	env := newEnv(t, infra.Options{})
+
+	for _, template := range []string{
+		"${missing | required('image.tag is required')}",
+		"${'' | required('image.tag is required')}",
+	} {
+		_, err := env.Render(template, nil)
+		if err == nil || !strings.Contains(err.Error(), "image.tag is required") {
+			t.Errorf("Render(%q) error = %v, want the required message", template, err)
+		}
+	}
+}
+
+func TestEscapedOutput(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	if err := infra.Register(env, infra.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := env.Render("${v | toJson} ${'<a>' | quote} ${v | squote} ${m | toYaml}", map[string]interface{}{
+		"v": "<b>",
+		"m": map[string]interface{}{"k": "<i>"},
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := `&quot;&lt;b&gt;&quot; &quot;&lt;a&gt;&quot; &#x27;&lt;b&gt;&#x27; k: &lt;i&gt;`; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	got, err = env.Render("${m | toYaml | safe}", map[string]interface{}{"m": map[string]interface{}{"k": "<i>"}})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "k: <i>"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	env := newEnv(t, infra.Options{})
+
+	tests := []struct {
+		constraint string
+		version    string
+		want       string
+	}{
+		{"1.2.3", "1.2.3", "true"},
+		{"=1.2", "1.2.9", "true"},
+		{"!=1.2.3", "1.2.3", "false"},
+		{"> 1.2", "1.2.9", "false"},
+		{">1.2", "1.3.0", "true"},
+		{"<=1.2", "1.2.9", "true"},
+		{"<1.2.0", "v1.1.9", "true"},
+		{"~1.2.3", "1.2.9", "true"},
+		{"~1.2.3", "1.3.0", "false"},
+		{"^1.2.3", "1.9.0", "true"},
+		{"^1.2.3", "2.0.0", "false"},
+		{"^0.2.3", "0.3.0", "false"},
+		{"1.x", "1.8.2", "true"},
+		{"1.2 - 1.4", "1.4.7", "true"},
+		{">=1.0, <1.5 || >=2.0", "2.1.0", "true"},
+		{">=1.20.0", "1.28.0-rc.1", "false"},
+		{">=1.28.0-rc.0", "1.28.0-rc.1", "true"},
+		{"<1.28.0-rc.2", "1.28.0-rc.10", "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.version, func(t *testing.T) {
+			got, err := env.Render("${c | semverCompare(v)}", map[string]interface{}{
+				"c": tt.constraint,
+				"v": tt.version,
+			})
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("semverCompare(%q, %q) = %s, want %s", tt.constraint, tt.version, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := env.Render("${'>=' | semverCompare('1.0.0')}", nil); err == nil {
+		t.Error("Render() with an invalid constraint succeeded")
+	}
+}
+
+func TestRandomValues(t *testing.T) {
+	env := newEnv(t, infra.Options{})
+
+	got, err := env.Render("${uuidv4()}|${24 | randAlphaNum}", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	uuid, pass, _ := strings.Cut(got, "|")
+	if len(uuid) != 36 || uuid[14] != '4' || !strings.ContainsRune("89ab", rune(uuid[19])) {
+		t.Errorf("uuidv4() = %q, not a version 4 UUID", uuid)
+	}
+	if len(pass) != 24 || strings.Trim(pass, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+		t.Errorf("randAlphaNum(24) = %q", pass)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	template := `${uuidv4()} ${16 | randAlphaNum}
+@let ca = "ca" | genCA(365)
+@let cert = "web" | genSignedCert(["10.0.0.1"], ["web.local"], 30, ca)
+${ca.Cert}${ca.Key}${cert.Cert}`
+
+	render := func(seed int64) string {
+		env := newEnv(t, infra.Deterministic(seed, epoch))
+		got, err := env.Render(template, nil)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		return got
+	}
+
+	first := render(1)
+	if second := render(1); second != first {
+		t.Errorf("renders with the same seed differ:\n%s\n---\n%s", first, second)
+	}
+	if other := render(2); other == first {
+		t.Error("renders with different seeds are identical")
+	}
+}
+
+func TestEnvironmentSources(t *testing.T) {
+	render := func() string {
+		env := luma.NewEnvironment(luma.Options{
+			Autoescape: luma.EscapeNone,
+			Clock:      luma.FixedClock(epoch),
+			Rand:       rand.NewSource(3),
+		})
+		if err := infra.Register(env, infra.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := env.Render(`${uuidv4()} ${("ca" | genCA(1)).Cert}`, nil)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		return got
+	}
+
+	first := render()
+	if second := render(); second != first {
+		t.Errorf("renders with the environment's sources differ:\n%s\n---\n%s", first, second)
+	}
+}
+
+func TestCertificates(t *testing.T) {
+	env := newEnv(t, infra.Deterministic(7, epoch))
+
+	got, err := env.Render(`@let ca = "luma-ca" | genCA(365)
+@let cert = "web" | genSignedCert(["10.0.0.1"], ["web.default.svc"], 30, ca)
+${ca.Cert}${cert.Cert}`, nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	caBlock, rest := pem.Decode([]byte(got))
+	certBlock, _ := pem.Decode(rest)
+	if caBlock == nil || certBlock == nil {
+		t.Fatalf("Render() = %q, want two PEM certificates", got)
+	}
+	ca, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ca.IsCA || ca.Subject.CommonName != "luma-ca" {
+		t.Errorf("CA = %v (IsCA %v), want a CA named luma-ca", ca.Subject, ca.IsCA)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate not signed by the CA: %v", err)
+	}
+	if err := cert.VerifyHostname("web.default.svc"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.VerifyHostname("10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if want := epoch.Add(30 * 24 * time.Hour); !cert.NotBefore.Equal(epoch) || !cert.NotAfter.Equal(want) {
+		t.Errorf("validity = %v - %v, want %v - %v", cert.NotBefore, cert.NotAfter, epoch, want)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	env := newEnv(t, infra.Options{})
+
+	got, err := env.Render("${'admin' | htpasswd('s3cret')}", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	user, hash, _ := strings.Cut(got, ":")
+	if user != "admin" {
+		t.Errorf("user = %q, want admin", user)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret")); err != nil {
+		t.Errorf("hash %q does not match the password: %v", hash, err)
+	}
+}
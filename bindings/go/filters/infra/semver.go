@@ -0,0 +1,245 @@
+package infra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a parsed semantic version. Missing minor and patch numbers
+// are recorded so constraints like "1.2" and "1.x" can match ranges.
+type version struct {
+	parts      [3]int
+	given      int // number of numeric parts present, 1 to 3
+	prerelease []string
+}
+
+// parseVersion parses a version such as "1.2.3", "v1.2.3-rc.1+build" or,
+// when wildcards is set, "1.2.x"
+func parseVersion(s string, wildcards bool) (version, error) {
+	var v version
+	text := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(text, '+'); i >= 0 {
+		text = text[:i]
+	}
+	if i := strings.IndexByte(text, '-'); i >= 0 {
+		v.prerelease = strings.Split(text[i+1:], ".")
+		text = text[:i]
+	}
+
+	fields := strings.Split(text, ".")
+	if len(fields) > 3 || text == "" {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, field := range fields {
+		if wildcards && (field == "x" || field == "X" || field == "*") {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v.parts[i] = n
+		v.given = i + 1
+	}
+	if v.given == 0 && !wildcards {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	return v, nil
+}
+
+// compare orders versions by precedence, returning -1, 0 or 1
+func (v version) compare(o version) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			return sign(v.parts[i] - o.parts[i])
+		}
+	}
+	return comparePrerelease(v.prerelease, o.prerelease)
+}
+
+// comparePrerelease orders pre-release identifiers: a release sorts after
+// any pre-release, numeric identifiers sort numerically and before
+// alphanumeric ones
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		an, aerr := strconv.Atoi(a[i])
+		bn, berr := strconv.Atoi(b[i])
+		switch {
+		case aerr == nil && berr == nil:
+			return sign(an - bn)
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return sign(len(a) - len(b))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// bump returns the smallest version above every version matching the
+// first n parts of v
+func (v version) bump(n int) version {
+	next := version{given: 3}
+	copy(next.parts[:], v.parts[:n])
+	next.parts[n-1]++
+	return next
+}
+
+// floor returns v with missing parts zeroed and no pre-release
+func (v version) floor() version {
+	return version{parts: v.parts, given: 3}
+}
+
+// semverCompare reports whether a version satisfies a constraint.
+// Constraints use the syntax of Helm charts: comparisons (=, !=, >, >=,
+// <, <=), tilde and caret ranges (~1.2, ^1.2.3), wildcards (1.2.x),
+// hyphen ranges (1.2 - 1.4), conditions joined by spaces or commas, and
+// alternatives separated by ||. As in Helm, pre-release versions only
+// match constraints that mention a pre-release.
+func semverCompare(constraint, ver string) (bool, error) {
+	v, err := parseVersion(ver, false)
+	if err != nil {
+		return false, err
+	}
+	for _, alternative := range strings.Split(constraint, "||") {
+		ok, err := matchAll(alternative, v)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchAll reports whether v satisfies every condition in a group
+func matchAll(group string, v version) (bool, error) {
+	fields := strings.Fields(strings.ReplaceAll(group, ",", " "))
+	if len(fields) == 0 {
+		return false, fmt.Errorf("empty version constraint")
+	}
+
+	prereleaseAllowed := len(v.prerelease) == 0
+	matched := true
+	for i := 0; i < len(fields); i++ {
+		cond := fields[i]
+		// Hyphen range: "1.2 - 1.4"
+		if i+2 < len(fields) && fields[i+1] == "-" {
+			cond = ">=" + fields[i] + " <=" + fields[i+2]
+			i += 2
+		}
+		for _, c := range strings.Fields(cond) {
+			// Operators may be separated from their version by a space
+			if strings.Trim(c, "=!<>~^") == "" && i+1 < len(fields) {
+				i++
+				c += fields[i]
+			}
+			op, target, err := parseCondition(c)
+			if err != nil {
+				return false, err
+			}
+			if len(target.prerelease) > 0 && target.parts == v.parts {
+				prereleaseAllowed = true
+			}
+			if !op(v, target) {
+				matched = false
+			}
+		}
+	}
+	return matched && prereleaseAllowed, nil
+}
+
+// parseCondition splits a condition into its operator and version
+func parseCondition(c string) (func(v, t version) bool, version, error) {
+	opEnd := strings.IndexFunc(c, func(r rune) bool { return !strings.ContainsRune("=!<>~^", r) })
+	if opEnd < 0 {
+		return nil, version{}, fmt.Errorf("invalid version constraint %q", c)
+	}
+	op, text := c[:opEnd], c[opEnd:]
+	t, err := parseVersion(text, true)
+	if err != nil {
+		return nil, t, err
+	}
+
+	switch op {
+	case "", "=", "==":
+		return matchEqual, t, nil
+	case "!=":
+		return func(v, t version) bool { return !matchEqual(v, t) }, t, nil
+	case ">":
+		return func(v, t version) bool {
+			if t.given < 3 {
+				return v.compare(t.bump(t.given)) >= 0
+			}
+			return v.compare(t) > 0
+		}, t, nil
+	case ">=":
+		return func(v, t version) bool { return v.compare(t) >= 0 }, t, nil
+	case "<":
+		return func(v, t version) bool { return v.compare(t) < 0 }, t, nil
+	case "<=":
+		return func(v, t version) bool {
+			if t.given < 3 {
+				return v.compare(t.bump(t.given)) < 0
+			}
+			return v.compare(t) <= 0
+		}, t, nil
+	case "~", "~>":
+		return func(v, t version) bool {
+			n := 2
+			if t.given < 2 {
+				n = 1
+			}
+			return v.compare(t) >= 0 && v.compare(t.bump(n)) < 0
+		}, t, nil
+	case "^":
+		return func(v, t version) bool {
+			// The first non-zero part may not change
+			n := 1
+			switch {
+			case t.parts[0] == 0 && t.given >= 2 && t.parts[1] == 0 && t.given == 3:
+				n = 3
+			case t.parts[0] == 0 && t.given >= 2:
+				n = 2
+			}
+			return v.compare(t) >= 0 && v.compare(t.bump(n)) < 0
+		}, t, nil
+	}
+	return nil, t, fmt.Errorf("invalid version constraint %q", c)
+}
+
+// matchEqual matches v against t, treating missing parts of t as
+// wildcards
+func matchEqual(v, t version) bool {
+	if t.given == 0 {
+		return true
+	}
+	if t.given < 3 {
+		return v.compare(t.floor()) >= 0 && v.compare(t.bump(t.given)) < 0
+	}
+	return v.compare(t) == 0
+}
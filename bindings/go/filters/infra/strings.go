@@ -0,0 +1,76 @@
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// required returns the value, or fails the render with message if the
+// value is missing or an empty string
+func required(v interface{}, message string) (interface{}, error) {
+	if s, ok := v.(string); v == nil || ok && s == "" {
+		if message == "" {
+			message = "required value is missing"
+		}
+		return nil, errors.New(message)
+	}
+	return v, nil
+}
+
+// regexReplaceAll replaces every match of pattern in s. The replacement
+// may refer to submatches as $1 or ${name}.
+func regexReplaceAll(s, pattern, replacement string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// trunc truncates s to n characters. A negative n keeps the last -n
+// characters instead.
+func trunc(s string, n int) string {
+	runes := []rune(s)
+	switch {
+	case n < 0 && -n < len(runes):
+		return string(runes[len(runes)+n:])
+	case n >= 0 && n < len(runes):
+		return string(runes[:n])
+	}
+	return s
+}
+
+// quote wraps a value in double quotes, escaping as a Go string literal.
+// A missing value quotes as "". The result is still autoescaped.
+func quote(v interface{}) string {
+	return strconv.Quote(toString(v))
+}
+
+// squote wraps a value in single quotes the way a POSIX shell reads
+// them. Each single quote in the value closes the quotes, is written
+// backslash-escaped and reopens them. The result is still autoescaped.
+func squote(v interface{}) string {
+	return "'" + strings.ReplaceAll(toString(v), "'", `'\''`) + "'"
+}
+
+// toString formats a filter argument the way templates print it
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprint(v)
+}
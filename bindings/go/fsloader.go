@@ -0,0 +1,221 @@
+package luma
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReloadingLoader is a Loader whose templates can change while the
+// program runs. Before each render the environment asks it what changed
+// and recompiles those templates along with every cached template that
+// includes, imports or extends them.
+type ReloadingLoader interface {
+	Loader
+
+	// Changes returns the names of the templates that changed after the
+	// change numbered since, and the number of the latest change. Passing
+	// the returned number on the next call yields only newer changes.
+	Changes(since uint64) (names []string, latest uint64)
+}
+
+// maxChanges bounds the change log kept by a FileSystemLoader
+const maxChanges = 1024
+
+// FileSystemLoader loads templates from a directory tree and notices
+// when they change. It records the modification time, size and content
+// hash of every template it loads; a file counts as changed only when
+// its content does.
+//
+// By default files are checked for changes before each render. After
+// Watch, the loader is notified of changes instead (with inotify on
+// Linux) and does not touch the file system for templates it has
+// already loaded.
+//
+// Template names are slash-separated paths relative to the root and
+// cannot refer to files outside it.
+type FileSystemLoader struct {
+	root string
+
+	mu       sync.Mutex
+	files    map[string]*fileState
+	changes  []fileChange // oldest first
+	latest   uint64
+	watching bool
+	watcher  interface{ Close() error }
+}
+
+// fileState is what a FileSystemLoader knows about a loaded template
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+	source  string
+}
+
+// fileChange records that a template changed
+type fileChange struct {
+	seq  uint64
+	name string
+}
+
+// NewFileSystemLoader returns a loader for the templates under root.
+func NewFileSystemLoader(root string) *FileSystemLoader {
+	return &FileSystemLoader{
+		root:  root,
+		files: make(map[string]*fileState),
+	}
+}
+
+// Load implements Loader.
+func (l *FileSystemLoader) Load(name string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if st := l.files[name]; st != nil && l.watching {
+		return st.source, nil
+	}
+	if err := l.refresh(name); err != nil {
+		return "", err
+	}
+	st := l.files[name]
+	if st == nil {
+		return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	}
+	return st.source, nil
+}
+
+// Changes implements ReloadingLoader. Unless the loader is watching, it
+// first checks every loaded template for changes. If since is older
+// than the retained change log, every loaded template is reported.
+func (l *FileSystemLoader) Changes(since uint64) ([]string, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.watching {
+		for name := range l.files {
+			// Errors other than a missing file keep the last good source
+			_ = l.refresh(name)
+		}
+	}
+
+	if since >= l.latest {
+		return nil, l.latest
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	if len(l.changes) > 0 && since+1 < l.changes[0].seq {
+		for name := range l.files {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, c := range l.changes {
+		if c.seq > since && !seen[c.name] {
+			seen[c.name] = true
+			names = append(names, c.name)
+		}
+	}
+	return names, l.latest
+}
+
+// Close stops watching for changes.
+func (l *FileSystemLoader) Close() error {
+	l.mu.Lock()
+	w := l.watcher
+	l.watcher = nil
+	l.watching = false
+	l.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+	return w.Close()
+}
+
+// path returns the file path of a template, confined to the root
+func (l *FileSystemLoader) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// name returns the template name of a file path under the root
+func (l *FileSystemLoader) name(file string) (string, bool) {
+	rel, err := filepath.Rel(l.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// refresh rereads a template if its file changed and records a change
+// if its content differs from the loaded version. l.mu must be held.
+func (l *FileSystemLoader) refresh(name string) error {
+	file := l.path(name)
+	st := l.files[name]
+
+	info, err := os.Stat(file)
+	if err == nil && info.IsDir() {
+		err = fs.ErrNotExist
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		if st != nil {
+			delete(l.files, name)
+			l.recordChange(name)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st != nil && info.ModTime().Equal(st.modTime) && info.Size() == st.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	next := &fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(data),
+		source:  string(data),
+	}
+	l.files[name] = next
+	if st != nil && st.hash != next.hash {
+		l.recordChange(name)
+	}
+	return nil
+}
+
+// recordChange appends to the change log. l.mu must be held.
+func (l *FileSystemLoader) recordChange(name string) {
+	l.latest++
+	l.changes = append(l.changes, fileChange{seq: l.latest, name: name})
+	if len(l.changes) > maxChanges {
+		l.changes = append(l.changes[:0:0], l.changes[len(l.changes)-maxChanges:]...)
+	}
+}
+
+// fileChanged is called by the watcher when a file under the root may
+// have changed
+func (l *FileSystemLoader) fileChanged(file string) {
+	name, ok := l.name(file)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, loaded := l.files[name]; loaded {
+		_ = l.refresh(name)
+	}
+}
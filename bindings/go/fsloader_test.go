@@ -0,0 +1,178 @@
+package luma_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+// writeTemplate writes a template file and moves its modification time
+// forward, so rewrites within the file system's timestamp resolution
+// are still noticed
+func writeTemplate(t *testing.T, dir, name, source string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	} else {
+		modTime = time.Now()
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystemLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "page.luma", "@include \"partials/footer.luma\"\n")
+	writeTemplate(t, dir, "partials/footer.luma", "footer v1")
+	writeTemplate(t, dir, "base.luma", "base v1\n@block body\n@end")
+	writeTemplate(t, dir, "child.luma", "@extends \"base.luma\"\n@block body\nchild\n@end\n")
+
+	env := luma.NewEnvironment(luma.Options{
+		Loader:     luma.NewFileSystemLoader(dir),
+		Autoescape: luma.EscapeNone,
+	})
+	render := func(source string) string {
+		t.Helper()
+		got, err := env.Render(source, nil)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		return got
+	}
+
+	page, err := env.GetTemplate("page.luma")
+	if err != nil {
+		t.Fatalf("GetTemplate() error = %v", err)
+	}
+	execute := func() string {
+		t.Helper()
+		got, err := page.Execute(nil)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return got
+	}
+
+	if got := execute(); got != "footer v1" {
+		t.Errorf("Execute() = %q, want footer v1", got)
+	}
+	if got := render(`@include "child.luma"`); got != "base v1\nchild\n" {
+		t.Errorf("Render() = %q, want the child in base v1", got)
+	}
+
+	writeTemplate(t, dir, "partials/footer.luma", "footer v2")
+	if got := execute(); got != "footer v2" {
+		t.Errorf("after changing the include, Execute() = %q, want footer v2", got)
+	}
+
+	writeTemplate(t, dir, "page.luma", "page v2 @include \"partials/footer.luma\"")
+	if got := execute(); got != "page v2 footer v2" {
+		t.Errorf("after changing the template, Execute() = %q, want page v2 footer v2", got)
+	}
+
+	writeTemplate(t, dir, "base.luma", "base v2\n@block body\n@end")
+	if got := render(`@include "child.luma"`); got != "base v2\nchild\n" {
+		t.Errorf("after changing the parent, Render() = %q, want the child in base v2", got)
+	}
+}
+
+func TestFileSystemLoaderChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "a.luma", "a")
+	writeTemplate(t, dir, "b.luma", "b")
+
+	loader := luma.NewFileSystemLoader(dir)
+	for _, name := range []string{"a.luma", "b.luma"} {
+		if _, err := loader.Load(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, latest := loader.Changes(0)
+	if len(names) != 0 {
+		t.Errorf("Changes() = %v before any change", names)
+	}
+
+	// Touching a file without changing its content is not a change
+	writeTemplate(t, dir, "a.luma", "a")
+	if names, _ := loader.Changes(latest); len(names) != 0 {
+		t.Errorf("Changes() = %v after touching a file", names)
+	}
+
+	writeTemplate(t, dir, "b.luma", "b2")
+	names, latest = loader.Changes(latest)
+	if len(names) != 1 || names[0] != "b.luma" {
+		t.Errorf("Changes() = %v, want [b.luma]", names)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.luma")); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = loader.Changes(latest)
+	if len(names) != 1 || names[0] != "a.luma" {
+		t.Errorf("Changes() = %v, want [a.luma] after removing it", names)
+	}
+	if _, err := loader.Load("a.luma"); !errors.Is(err, luma.ErrTemplateNotFound) {
+		t.Errorf("Load() of a removed template error = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestFileSystemLoaderConfinesNames(t *testing.T) {
+	root := t.TempDir()
+	writeTemplate(t, root, "secret.txt", "secret")
+	dir := filepath.Join(root, "templates")
+	writeTemplate(t, dir, "page.luma", "page")
+
+	loader := luma.NewFileSystemLoader(dir)
+	for _, name := range []string{"../secret.txt", "/../secret.txt", "partials/../../secret.txt"} {
+		if _, err := loader.Load(name); !errors.Is(err, luma.ErrTemplateNotFound) {
+			t.Errorf("Load(%q) error = %v, want ErrTemplateNotFound", name, err)
+		}
+	}
+}
+
+func TestFileSystemLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "partials/footer.luma", "v1")
+
+	loader := luma.NewFileSystemLoader(dir)
+	if err := loader.Watch(); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+
+	env := luma.NewEnvironment(luma.Options{Loader: loader})
+	if got, err := env.Render(`@include "partials/footer.luma"`, nil); err != nil || got != "v1" {
+		t.Fatalf("Render() = %q, %v, want v1", got, err)
+	}
+
+	writeTemplate(t, dir, "partials/footer.luma", "v2")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := env.Render(`@include "partials/footer.luma"`, nil)
+		if err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+		if got == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Render() = %q, change not picked up", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,125 @@
+package luma_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#x27;",
+)
+
+// FuzzRenderValue checks that context strings reach the template
+// unchanged apart from HTML escaping, whatever bytes they contain.
+func FuzzRenderValue(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"plain",
+		`"quoted" and 'single'`,
+		`\" .. os.exit() .. \"`,
+		"]]..error('x')..[[",
+		"line\nbreak\r\n\ttab",
+		"nul\x00byte",
+		"invalid \xff\xfe utf-8",
+		"${nested} @if x",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		got, err := luma.Render("${value}", map[string]interface{}{"value": value})
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", value, err)
+		}
+		if want := htmlEscaper.Replace(value); got != want {
+			t.Errorf("Render(%q) = %q, want %q", value, got, want)
+		}
+	})
+}
+
+// FuzzRenderText checks that template text without any Luma syntax is
+// rendered byte for byte.
+func FuzzRenderText(f *testing.F) {
+	for _, seed := range []string{
+		"plain text",
+		`"quoted" %q \n \\`,
+		"]]..error('x')..[[",
+		"nul\x00byte",
+		"invalid \xff\xfe utf-8",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		if strings.ContainsAny(source, "$@{}%#\r\n") {
+			t.Skip("contains template syntax")
+		}
+		if strings.TrimSpace(source) == "" {
+			t.Skip("blank lines are trimmed")
+		}
+		got, err := luma.Render(source, nil)
+		if err != nil {
+			t.Fatalf("Render(%q) error = %v", source, err)
+		}
+		if got != source {
+			t.Errorf("Render(%q) = %q", source, got)
+		}
+	})
+}
+
+// fuzzContext is the context FuzzRenderSource renders templates with
+var fuzzContext = map[string]interface{}{
+	"name":  "Ada",
+	"items": []interface{}{"a", "b"},
+	"user":  map[string]interface{}{"name": "Ada", "email": "ada@example.com", "is_admin": true},
+	"n":     3,
+}
+
+// FuzzRenderSource renders arbitrary template sources, seeded with the
+// example templates, and checks that the lexer, parser and code
+// generator fail, if at all, with a *luma.Error and never panic.
+func FuzzRenderSource(f *testing.F) {
+	examples, err := filepath.Glob("../../examples/*.luma")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range examples {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(source))
+	}
+	for _, seed := range []string{
+		"plain text\r\nwith lines\n",
+		"Hello, $name!\n@if user.is_admin\n  admin\n@elif n > 2\n  many\n@else\n  none\n@end\n",
+		"@for item in items\n  ${loop.index}. ${item | upper}\n@else\n  empty\n@end",
+		"@macro greet(who=\"you\")\nHi ${who}\n@end\n${greet(name)}",
+		"{% for item in items %}{{ item ~ '!' }}{% endfor %}{# comment #}",
+		"{% set x = [1, 2, 3] %}{{ x | join(\", \") }} {{ {'a': n}['a'] * 2 }}",
+		"@set total = n * (n + 1) / 2\n${total} ${\"%\"} $$ @@",
+		"${unclosed\n@if\n@end @end",
+		"{% if %}{{ }}{% endfor %}",
+		"]]..error('x')..[[ \" .. os.exit() .. \"",
+		"nul\x00byte and invalid \xff\xfe utf-8",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		_, err := luma.Render(source, fuzzContext)
+		var lumaErr *luma.Error
+		if err != nil && !errors.As(err, &lumaErr) {
+			t.Errorf("Render(%q) error = %v (%T), want a *luma.Error", source, err, err)
+		}
+	})
+}
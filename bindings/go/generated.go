@@ -0,0 +1,90 @@
+package luma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// GeneratedSource returns the Lua code the template compiles to, for
+// debugging. Runtime errors refer to template lines, but the generated
+// code shows how each directive was translated.
+func (t *Template) GeneratedSource() (string, error) {
+	source, err := t.currentSource()
+	if err != nil {
+		return "", err
+	}
+	v, err := t.env.acquireVM(vmPlain)
+	if err != nil {
+		return "", err
+	}
+	defer t.env.releaseVM(v)
+
+	compiled, err := v.call(v.compile, lua.LString(source), renderOptions(v.L, t.name))
+	if err != nil {
+		return "", fmt.Errorf("compilation error: %w", err)
+	}
+	tbl, ok := compiled.(*lua.LTable)
+	if !ok {
+		return "", fmt.Errorf("compilation error: unexpected %s", compiled.Type())
+	}
+	return lua.LVAsString(tbl.RawGetString("source")), nil
+}
+
+// installCodeDump writes the generated code of every template compiled in
+// L to Options.DumpGeneratedTo
+func (e *Environment) installCodeDump(L *lua.LState) error {
+	dir := e.opts.DumpGeneratedTo
+	if dir == "" {
+		return nil
+	}
+	compiler, err := requireModule(L, "luma.compiler")
+	if err != nil {
+		return err
+	}
+	dump := L.NewFunction(func(L *lua.LState) int {
+		if err := writeGenerated(dir, L.OptString(1, ""), L.CheckString(2)); err != nil {
+			L.RaiseError("failed to dump generated code: %v", err)
+		}
+		return 0
+	})
+	return L.CallByParam(lua.P{Fn: L.GetField(compiler, "set_code_dump"), NRet: 0, Protect: true}, dump)
+}
+
+// writeGenerated writes the generated code of a template below dir, at
+// the template's name with .lua appended. Templates rendered from a
+// string are named after a hash of their code.
+func writeGenerated(dir, name, code string) error {
+	if name == "" {
+		sum := sha256.Sum256([]byte(code))
+		name = "string-" + hex.EncodeToString(sum[:8])
+	}
+	// Keep names that climb out of the directory inside it
+	file := filepath.Join(dir, filepath.FromSlash(path.Clean("/" + name)[1:])+".lua")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// Write through a temporary file, since several states may dump the
+	// same template at once
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(code)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
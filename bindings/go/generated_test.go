@@ -0,0 +1,102 @@
+package luma_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestGeneratedSource(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{"page.luma": "Hello, $name!"}})
+	tmpl, err := env.GetTemplate("page.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := tmpl.GeneratedSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"local __render = function(", `"Hello, "`, `__ctx["name"]`} {
+		if !strings.Contains(code, want) {
+			t.Errorf("GeneratedSource() lacks %q:\n%s", want, code)
+		}
+	}
+}
+
+func TestDumpGeneratedTo(t *testing.T) {
+	dir := t.TempDir()
+	env := luma.NewEnvironment(luma.Options{
+		Loader: luma.MapLoader{
+			"pages/index.luma":  "@include \"partials/nav.luma\"\nindex",
+			"partials/nav.luma": "nav",
+			"../escape.luma":    "outside",
+		},
+		DumpGeneratedTo: dir,
+	})
+	index, err := env.GetTemplate("pages/index.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, index, nil)
+
+	for _, name := range []string{"pages/index.luma.lua", "partials/nav.luma.lua"} {
+		code, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("no generated code dumped for %s: %v", name, err)
+		} else if !strings.Contains(string(code), "local __render = function(") {
+			t.Errorf("%s holds %q", name, code)
+		}
+	}
+	want, err := index.GeneratedSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "pages", "index.luma.lua")); string(got) != want {
+		t.Error("dumped code differs from GeneratedSource()")
+	}
+
+	escape, err := env.GetTemplate("../escape.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, escape, nil)
+	if _, err := os.Stat(filepath.Join(dir, "escape.luma.lua")); err != nil {
+		t.Errorf("a name outside the directory was not dumped inside it: %v", err)
+	}
+
+	if _, err := env.Render("unnamed", nil); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "string-*.lua"))
+	if len(matches) != 1 {
+		t.Errorf("dumped %d string templates, want 1", len(matches))
+	}
+}
+
+func TestRuntimeErrorTemplateLine(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"base.luma":  "top\n@block body\n@end\n${ {} .. 1 }",
+		"child.luma": "@extends \"base.luma\"\n@block body\nx\n@end",
+		"math.luma":  "first\n\n${ 1 + {} }",
+	}})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"math.luma", "math.luma:3: RuntimeError"},
+		{"child.luma", "base.luma:4: RuntimeError"},
+	}
+	for _, tt := range tests {
+		tmpl, err := env.GetTemplate(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tmpl.Execute(nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Execute() error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
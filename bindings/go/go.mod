@@ -2,4 +2,8 @@ module github.com/santosr2/luma/bindings/go
 
 go 1.21
 
-require github.com/yuin/gopher-lua v1.1.1
+require (
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
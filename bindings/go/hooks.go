@@ -0,0 +1,162 @@
+package luma
+
+import (
+	"errors"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Hooks receives instrumentation events from an Environment configured
+// with Options.Hooks. Methods are called on the goroutine doing the work,
+// possibly by several goroutines at once, and should return quickly.
+// Embed NoopHooks to implement only some of them.
+type Hooks interface {
+	// OnCompile is called after a template is compiled. Event.Size is
+	// the size of the generated code.
+	OnCompile(Event)
+	// OnRenderStart is called before a render starts. Event.Duration
+	// and Event.Size are zero.
+	OnRenderStart(Event)
+	// OnRenderEnd is called after a render. Event.Size is the size of
+	// the output.
+	OnRenderEnd(Event)
+	// OnInclude is called after a template is included or imported.
+	// Event.Size is the size of the included output.
+	OnInclude(Event)
+	// OnFilter is called after each filter call. Event.Size is the size
+	// of the filter's result when it is a string.
+	OnFilter(Event)
+}
+
+// Event describes an instrumented compile, render, include or filter
+// call.
+type Event struct {
+	// Name is the template or filter name. Templates rendered from a
+	// string have no name.
+	Name string
+	// Stack lists the templates being rendered when the event occurred,
+	// outermost first. It is empty for top-level renders.
+	Stack []string
+	// Duration is the wall time the call took.
+	Duration time.Duration
+	// Self is Duration less the time spent in nested instrumented calls.
+	Self time.Duration
+	// Size is the size in bytes of what the call produced.
+	Size int
+	// Err is the error the call failed with, if any.
+	Err error
+}
+
+// NoopHooks implements Hooks with methods that do nothing.
+type NoopHooks struct{}
+
+func (NoopHooks) OnCompile(Event)     {}
+func (NoopHooks) OnRenderStart(Event) {}
+func (NoopHooks) OnRenderEnd(Event)   {}
+func (NoopHooks) OnInclude(Event)     {}
+func (NoopHooks) OnFilter(Event)      {}
+
+// Kinds of instrumented calls, as reported by the Lua runtime
+const (
+	hookRender  = "render"
+	hookCompile = "compile"
+	hookInclude = "include"
+	hookFilter  = "filter"
+)
+
+// hookState tracks the instrumented calls in progress in one vm
+type hookState struct {
+	hooks  Hooks
+	frames []hookFrame
+}
+
+// hookFrame is an instrumented call in progress
+type hookFrame struct {
+	kind     string
+	name     string
+	start    time.Time
+	children time.Duration
+}
+
+// start records the start of a call
+func (h *hookState) start(kind, name string) {
+	if kind == hookRender {
+		h.hooks.OnRenderStart(Event{Name: name, Stack: h.stack()})
+	}
+	h.frames = append(h.frames, hookFrame{kind: kind, name: name, start: time.Now()})
+}
+
+// finish records the end of the innermost call and reports it
+func (h *hookState) finish(size int, err error) {
+	if len(h.frames) == 0 {
+		return
+	}
+	f := h.frames[len(h.frames)-1]
+	h.frames = h.frames[:len(h.frames)-1]
+
+	elapsed := time.Since(f.start)
+	if len(h.frames) > 0 {
+		h.frames[len(h.frames)-1].children += elapsed
+	}
+	event := Event{
+		Name:     f.name,
+		Stack:    h.stack(),
+		Duration: elapsed,
+		Self:     elapsed - f.children,
+		Size:     size,
+		Err:      err,
+	}
+
+	switch f.kind {
+	case hookRender:
+		h.hooks.OnRenderEnd(event)
+	case hookCompile:
+		h.hooks.OnCompile(event)
+	case hookInclude:
+		h.hooks.OnInclude(event)
+	case hookFilter:
+		h.hooks.OnFilter(event)
+	}
+}
+
+// stack returns the names of the templates being rendered
+func (h *hookState) stack() []string {
+	var names []string
+	for _, f := range h.frames {
+		if f.kind == hookRender || f.kind == hookInclude {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// installHooks reports the Lua runtime's compiles, includes and filter
+// calls to Options.Hooks
+func (e *Environment) installHooks(L *lua.LState) (*hookState, error) {
+	if e.opts.Hooks == nil {
+		return nil, nil
+	}
+	runtime, err := requireModule(L, "luma.runtime")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hookState{hooks: e.opts.Hooks}
+	tbl := L.NewTable()
+	L.SetField(tbl, "start", L.NewFunction(func(L *lua.LState) int {
+		h.start(L.CheckString(1), L.OptString(2, ""))
+		return 0
+	}))
+	L.SetField(tbl, "finish", L.NewFunction(func(L *lua.LState) int {
+		var err error
+		if msg, ok := L.Get(4).(lua.LString); ok {
+			err = errors.New(string(msg))
+		}
+		h.finish(L.OptInt(3, 0), err)
+		return 0
+	}))
+
+	err = L.CallByParam(lua.P{Fn: L.GetField(runtime, "set_hooks"), NRet: 0, Protect: true}, tbl)
+	return h, err
+}
@@ -0,0 +1,123 @@
+package luma
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// AddCatalog registers the translations templates use when rendered in
+// locale. A render in a regional locale such as de_AT or pt-BR falls
+// back to the catalog of its language when it has none of its own;
+// renders without a catalog are not translated.
+//
+// Translatable text is written in @trans blocks, {% trans %} in Jinja
+// syntax, or passed to _(), gettext() and ngettext():
+//
+//	@trans count=len(items)
+//	You have one item.
+//	@pluralize
+//	You have $count items.
+//	@end
+//	${_("Hello %(name)s", name=user.name)}
+//
+// Example:
+//
+//	for _, locale := range []string{"de", "fr", "pt_BR"} {
+//	    catalog, err := luma.LoadCatalog("locale/" + locale + "/messages.mo")
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	    env.AddCatalog(locale, catalog)
+//	}
+//	out, err := tmpl.Execute(luma.WithLocale(ctx, user.Locale))
+func (e *Environment) AddCatalog(locale string, c *Catalog) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.catalogs[locale] = c
+	e.generation++
+	e.clearResults()
+}
+
+// localizedContext is a render context with the locale to render it in
+type localizedContext struct {
+	value  interface{}
+	locale string
+}
+
+// WithLocale wraps a render context so that the render is translated to
+// locale, overriding Options.Locale. Pass the result to Execute, Render
+// or ExecuteBatch in place of the context.
+func WithLocale(context interface{}, locale string) interface{} {
+	return &localizedContext{value: context, locale: locale}
+}
+
+// locale returns the locale a render context is translated to
+func (e *Environment) locale(context interface{}) string {
+	if valid, ok := context.(*validContext); ok {
+		context = valid.value
+	}
+	for {
+		switch c := context.(type) {
+		case *localizedContext:
+			return c.locale
+		case *TrackedContext:
+			context = c.value
+		default:
+			return e.opts.Locale
+		}
+	}
+}
+
+// catalog returns the catalog of a locale, or of its language, or nil
+func (e *Environment) catalog(locale string) *Catalog {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if c, ok := e.catalogs[locale]; ok {
+		return c
+	}
+	if i := strings.IndexAny(locale, "_-"); i > 0 {
+		return e.catalogs[locale[:i]]
+	}
+	return nil
+}
+
+// installTranslations returns runtime.set_translator when the
+// environment has catalogs, and nil otherwise
+func (e *Environment) installTranslations(L *lua.LState) (lua.LValue, error) {
+	e.mu.RLock()
+	n := len(e.catalogs)
+	e.mu.RUnlock()
+	if n == 0 {
+		return nil, nil
+	}
+
+	runtime, err := requireModule(L, "luma.runtime")
+	if err != nil {
+		return nil, err
+	}
+	return L.GetField(runtime, "set_translator"), nil
+}
+
+// translate makes the vm's renders translate with c, or not translate
+// when c is nil
+func (v *vm) translate(c *Catalog) error {
+	translator := lua.LValue(lua.LNil)
+	if c != nil {
+		tbl := v.L.NewTable()
+		tbl.RawSetString("gettext", v.L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LString(c.Gettext(L.CheckString(1))))
+			return 1
+		}))
+		tbl.RawSetString("ngettext", v.L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LString(c.Ngettext(L.CheckString(1), L.CheckString(2), L.CheckInt(3))))
+			return 1
+		}))
+		translator = tbl
+	}
+	if err := v.L.CallByParam(lua.P{Fn: v.setTranslator, NRet: 0, Protect: true}, translator); err != nil {
+		return fmt.Errorf("failed to set translations: %w", err)
+	}
+	return nil
+}
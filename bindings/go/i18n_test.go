@@ -0,0 +1,101 @@
+package luma_test
+
+import (
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+const germanCatalog = `{"messages": {
+	"Hello %(name)s!": "Hallo %(name)s!",
+	"You have one message.": ["Sie haben eine Nachricht.", "Sie haben %(count)s Nachrichten."],
+	"Settings": "Einstellungen",
+	"%(num)s day": ["%(num)s Tag", "%(num)s Tage"]
+}}`
+
+// germanEnv returns an environment with a German catalog
+func germanEnv(t *testing.T, opts luma.Options) *luma.Environment {
+	t.Helper()
+	c, err := luma.ParseJSONCatalog([]byte(germanCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := luma.NewEnvironment(opts)
+	env.AddCatalog("de", c)
+	return env
+}
+
+func TestTransBlock(t *testing.T) {
+	env := germanEnv(t, luma.Options{Autoescape: luma.EscapeHTML})
+	tmpl, err := env.Compile("@trans name=user\nHello $name!\n@end\n" +
+		"@trans count=n\nYou have one message.\n@pluralize\nYou have $count messages.\n@end\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		context interface{}
+		want    string
+	}{
+		{map[string]interface{}{"user": "<Ada>", "n": 1}, "Hello &lt;Ada&gt;!\n\nYou have one message.\n\n"},
+		{map[string]interface{}{"user": "Ada", "n": 3}, "Hello Ada!\n\nYou have 3 messages.\n\n"},
+		{luma.WithLocale(map[string]interface{}{"user": "<Ada>", "n": 1}, "de"), "Hallo &lt;Ada&gt;!\n\nSie haben eine Nachricht.\n\n"},
+		{luma.WithLocale(map[string]interface{}{"user": "Ada", "n": 3}, "de_AT"), "Hallo Ada!\n\nSie haben 3 Nachrichten.\n\n"},
+		{luma.WithLocale(map[string]interface{}{"user": "Ada", "n": 1}, "fr"), "Hello Ada!\n\nYou have one message.\n\n"},
+	} {
+		if got := mustExecute(t, tmpl, tc.context); got != tc.want {
+			t.Errorf("Execute() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestTranslationFunctions(t *testing.T) {
+	env := germanEnv(t, luma.Options{Locale: "de"})
+	source := `{{ _("Settings") }} | {{ gettext("Hello %(name)s!", name=who) }} | {{ ngettext("%(num)s day", "%(num)s days", days) }}`
+	out, err := env.Render(source, map[string]interface{}{"who": "Bo", "days": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Einstellungen | Hallo Bo! | 2 Tage"; out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+
+	out, err = env.Render(source, luma.WithLocale(map[string]interface{}{"who": "Bo", "days": 1}, "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Settings | Hello Bo! | 1 day"; out != want {
+		t.Errorf("Render() in English = %q, want %q", out, want)
+	}
+}
+
+func TestLocaleResultCache(t *testing.T) {
+	env := germanEnv(t, luma.Options{ResultCache: &luma.ResultCacheOptions{}})
+	tmpl, err := env.Compile(`${_("Settings")}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := map[string]interface{}{}
+	if got := mustExecute(t, tmpl, ctx); got != "Settings" {
+		t.Errorf("Execute() = %q, want Settings", got)
+	}
+	if got := mustExecute(t, tmpl, luma.WithLocale(ctx, "de")); got != "Einstellungen" {
+		t.Errorf("Execute() in German = %q, want Einstellungen", got)
+	}
+}
+
+func TestLocaleTrackAccess(t *testing.T) {
+	env := germanEnv(t, luma.Options{})
+	tmpl, err := env.Compile("@trans\nHello $name!\n@end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracked := luma.TrackAccess(map[string]interface{}{"name": "Ada", "unused": 1})
+	if got := mustExecute(t, tmpl, luma.WithLocale(tracked, "de")); got != "Hallo Ada!\n" {
+		t.Errorf("Execute() = %q", got)
+	}
+	report := tracked.Report()
+	if len(report.Unused) != 1 || report.Unused[0] != "unused" {
+		t.Errorf("Unused = %v, want [unused]", report.Unused)
+	}
+}
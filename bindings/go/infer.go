@@ -0,0 +1,138 @@
+package luma
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// InferSchema describes the context a template expects as a JSON Schema,
+// found by static analysis of the template, its parents and the
+// templates it includes with context. Every path the template reads
+// becomes a property; paths only read behind an is defined test or a
+// default filter are optional, the others required. Values looped over
+// with one variable are arrays, with two variables objects. The literal
+// a default filter supplies becomes the property's default, and its type
+// the property's type. Names set with AddGlobal and values that are
+// only called are left out.
+//
+// The schema can be passed to Options.Schema or Template.SetSchema to
+// validate contexts, although the types of values used only as text
+// are not known.
+//
+// Example:
+//
+//	schema, err := luma.InferSchema(tmpl)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	out, _ := json.MarshalIndent(schema, "", "  ")
+func InferSchema(tmpl *Template) (*Schema, error) {
+	refs, err := tmpl.references()
+	if err != nil {
+		return nil, err
+	}
+
+	root := newInferNode()
+	for _, ref := range refs {
+		if ref.call || tmpl.env.hasGlobal(ref.path[0]) {
+			continue
+		}
+		root.add(ref)
+	}
+
+	s := root.schema()
+	s.SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = tmpl.name
+	s.Type = []string{"object"}
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// inferNode gathers what the references tell about one context path
+type inferNode struct {
+	props    map[string]*inferNode
+	required map[string]bool
+	// element describes the list elements or map values
+	element *inferNode
+	// iterate is "list" or "pairs" when a loop iterates over the path
+	iterate  string
+	fallback interface{}
+}
+
+func newInferNode() *inferNode {
+	return &inferNode{
+		props:    make(map[string]*inferNode),
+		required: make(map[string]bool),
+	}
+}
+
+// add records a reference below the node
+func (n *inferNode) add(ref reference) {
+	cur := n
+	for _, segment := range ref.path {
+		if segment == elementSegment {
+			if cur.element == nil {
+				cur.element = newInferNode()
+			}
+			cur = cur.element
+			continue
+		}
+		next := cur.props[segment]
+		if next == nil {
+			next = newInferNode()
+			cur.props[segment] = next
+		}
+		if !ref.optional {
+			cur.required[segment] = true
+		}
+		cur = next
+	}
+	if ref.iterate == "list" || (ref.iterate == "pairs" && cur.iterate == "") {
+		cur.iterate = ref.iterate
+	}
+	if ref.fallback != nil && cur.fallback == nil {
+		cur.fallback = ref.fallback
+	}
+}
+
+// known reports whether the node tells more about its values than that
+// they exist
+func (n *inferNode) known() bool {
+	return n != nil && (len(n.props) > 0 || n.iterate != "" || n.fallback != nil)
+}
+
+// schema returns the schema of the values the node describes
+func (n *inferNode) schema() *Schema {
+	s := new(Schema)
+	switch {
+	case n.iterate == "list":
+		s.Type = []string{"array"}
+		if n.element.known() {
+			s.Items = n.element.schema()
+		}
+	case len(n.props) > 0 || n.iterate == "pairs":
+		s.Type = []string{"object"}
+		if len(n.props) > 0 {
+			s.Properties = make(map[string]*Schema, len(n.props))
+			for name, prop := range n.props {
+				s.Properties[name] = prop.schema()
+				if n.required[name] {
+					s.Required = append(s.Required, name)
+				}
+			}
+			sort.Strings(s.Required)
+		}
+		if n.element.known() && n.iterate == "pairs" {
+			s.AdditionalProperties = n.element.schema()
+		}
+	}
+	if n.fallback != nil {
+		s.Default, _ = json.Marshal(n.fallback)
+		if len(s.Type) == 0 {
+			s.Type = []string{instanceType(n.fallback)}
+		}
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package luma_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestInferSchema(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deploy.yaml": strings.Join([]string{
+			"name: ${app.name}",
+			"replicas: ${replicas | default(2)}",
+			"@for c in containers",
+			"@include \"container.yaml\"",
+			"@end",
+			"@for k, v in labels",
+			"  $k: ${v}",
+			"@end",
+			"@if tls is defined",
+			"cert: ${tls.cert}",
+			"@end",
+			"site: ${site} ${ helper() }",
+		}, "\n"),
+		"container.yaml": "- image: ${c.image}:${c.tag | default(\"latest\")}",
+	}})
+	env.AddGlobal("site", "example.com")
+	tmpl, err := env.GetTemplate("deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := luma.InferSchema(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","$schema":"https://json-schema.org/draft/2020-12/schema","title":"deploy.yaml",` +
+		`"properties":{` +
+		`"app":{"type":"object","properties":{"name":{}},"required":["name"]},` +
+		`"containers":{"type":"array","items":{"type":"object","properties":{"image":{},"tag":{"type":"string","default":"latest"}},"required":["image"]}},` +
+		`"labels":{"type":"object"},` +
+		`"replicas":{"type":"integer","default":2},` +
+		`"tls":{"type":"object","properties":{"cert":{}}}},` +
+		`"required":["app","containers","labels"]}`
+	if string(got) != want {
+		t.Errorf("InferSchema() =\n%s\nwant\n%s", got, want)
+	}
+
+	// The inferred schema validates contexts
+	if err := tmpl.SetSchema(schema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Execute(map[string]interface{}{"app": map[string]interface{}{}}); err == nil ||
+		!strings.Contains(err.Error(), `missing required property "containers"`) {
+		t.Errorf("Execute() error = %v, want missing containers", err)
+	}
+}
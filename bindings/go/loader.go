@@ -0,0 +1,97 @@
+package luma
+
+import (
+	"errors"
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ErrTemplateNotFound is returned by a Loader that has no template with
+// the requested name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Loader provides template sources by name for include, import and
+// extends.
+type Loader interface {
+	// Load returns the source of the named template. It returns an
+	// error wrapping ErrTemplateNotFound if there is no such template.
+	Load(name string) (string, error)
+}
+
+// MapLoader loads templates from an in-memory map of names to sources.
+type MapLoader map[string]string
+
+// Load implements Loader.
+func (m MapLoader) Load(name string) (string, error) {
+	if source, ok := m[name]; ok {
+		return source, nil
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+}
+
+// GetTemplate loads the named template through Options.Loader and
+// compiles it. The name selects the autoescape mode and identifies the
+// template in errors.
+func (e *Environment) GetTemplate(name string) (*Template, error) {
+	if e.opts.Loader == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	}
+	source, err := e.opts.Loader.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	return e.compile(name, source)
+}
+
+// reloadChanged drops templates the loader reports as changed from the
+// vm's template cache, along with the templates that depend on them
+func (e *Environment) reloadChanged(v *vm) error {
+	loader, ok := e.opts.Loader.(ReloadingLoader)
+	if !ok {
+		return nil
+	}
+	names, latest := loader.Changes(v.changes)
+	for _, name := range names {
+		if _, err := v.call(v.invalidate, lua.LString(name)); err != nil {
+			e.releaseVM(v)
+			return fmt.Errorf("failed to reload %s: %w", name, err)
+		}
+	}
+	v.changes = latest
+	return nil
+}
+
+// installLoader connects the Lua runtime's template loading to the
+// environment's Loader and sandbox policy.
+func (e *Environment) installLoader(L *lua.LState) error {
+	runtime, err := requireModule(L, "luma.runtime")
+	if err != nil {
+		return err
+	}
+
+	err = L.CallByParam(lua.P{Fn: L.GetField(runtime, "set_file_loading"), NRet: 0, Protect: true},
+		lua.LBool(e.opts.Sandbox.AllowFileLoading))
+	if err != nil {
+		return err
+	}
+
+	loader := e.opts.Loader
+	if loader == nil {
+		return nil
+	}
+	load := L.NewFunction(func(L *lua.LState) int {
+		source, err := loader.Load(L.CheckString(1))
+		if errors.Is(err, ErrTemplateNotFound) {
+			L.Push(lua.LNil)
+			return 1
+		}
+		if err != nil {
+			L.RaiseError("%s", err)
+			return 0
+		}
+		L.Push(lua.LString(source))
+		return 1
+	})
+	return L.CallByParam(lua.P{Fn: L.GetField(runtime, "set_loader"), NRet: 0, Protect: true}, load)
+}
@@ -13,6 +13,7 @@ local function create_context()
 	return {
 		indent = 0,
 		lines = {},
+		source_lines = {}, -- Lua line to { template, line }
 		var_counter = 0,
 		in_macro = false,
 		macros = {},
@@ -26,9 +27,14 @@ local function gen_var(ctx, prefix)
 end
 
 --- Add a line of code
+-- The line is attributed to the template line being generated, see
+-- codegen.line_map.
 local function emit(ctx, code)
 	local indent = string.rep("  ", ctx.indent)
 	table.insert(ctx.lines, indent .. code)
+	if ctx.source_line then
+		ctx.source_lines[#ctx.lines] = { ctx.source_template, ctx.source_line }
+	end
 end
 
 --- Add code without indentation
@@ -46,6 +52,90 @@ local function dedent(ctx)
 	ctx.indent = ctx.indent - 1
 end
 
+--- Add a coverage probe counting how often the code emitted next runs
+-- Probes are only emitted when compiling with the coverage option. Each
+-- is described by { kind, template, line, x, y, name }:
+--   "line": lines line to x ran
+--   "branch": branch y of the if or for at line, column x, was taken
+--     (for if: 0 then, 1 else; for for: 0 body, 1 empty); name is
+--     "if" or "for"
+--   "macro": the macro name defined at line, column x, was called
+-- @param ctx table Context
+-- @param node table AST node the probe belongs to
+-- @param kind string Probe kind
+-- @param x number|nil Kind-specific value
+-- @param y number|nil Kind-specific value
+-- @param name string|nil Macro name, or the statement of a branch
+local function probe(ctx, node, kind, x, y, name)
+	if not ctx.probes or not node.line then
+		return
+	end
+	local n = #ctx.probes + 1
+	ctx.probes[n] = { kind, node.template or ctx.template_name, node.line, x or 0, y or 0, name or "" }
+	emit(ctx, "__cov[" .. n .. "] = __cov[" .. n .. "] + 1")
+end
+
+--- Add a probe for the lines a statement node spans
+-- @param ctx table Context
+-- @param node table AST node
+local function line_probe(ctx, node)
+	local last = node.line
+	if last and node.type == N.TEXT and type(node.value) == "string" then
+		local _, newlines = node.value:gsub("\n", "")
+		if node.value:sub(-1) == "\n" then
+			newlines = newlines - 1
+		end
+		last = last + math.max(newlines, 0)
+	end
+	probe(ctx, node, "line", last)
+end
+
+--- Record where the output emitted next comes from
+-- Marks are only emitted when compiling with the source_map option; see
+-- runtime.source_mark.
+-- @param ctx table Context
+-- @param node table AST node
+local function source_mark(ctx, node)
+	if not ctx.locations or not node.line then
+		return
+	end
+	local n = #ctx.locations + 1
+	ctx.locations[n] = { node.template or ctx.template_name, node.line, node.column or 1, node.type == N.TEXT }
+	emit(ctx, "__runtime.source_mark(__out, __sm_locations[" .. n .. "])")
+end
+
+--- Get the code joining an output buffer
+-- With source maps, the runtime joins it and records where each part of
+-- the result came from.
+-- @param ctx table Context
+-- @param out string Name of the buffer
+-- @return string Lua expression
+local function concat_code(ctx, out)
+	if ctx.locations then
+		return "__runtime.source_map_output(" .. out .. ")"
+	end
+	return "table.concat(" .. out .. ")"
+end
+
+--- Get the code of an access mode, telling the access tracker how a
+-- value read is used
+-- Reads are only tracked when compiling with the track_access option; see
+-- runtime.access_name and runtime.access_member.
+-- @param mode string|nil "nav" when the value is only looked into,
+--   "iter" when a loop iterates over it, nil when it is used whole
+-- @return string Lua expression
+local function access_mode_code(mode)
+	return mode and string.format("%q", mode) or "nil"
+end
+
+--- Translation functions templates can call, and the runtime functions
+-- implementing them
+local I18N_BUILTINS = {
+	["_"] = "gettext",
+	gettext = "gettext",
+	ngettext = "ngettext",
+}
+
 --- Escape a Lua string
 local function escape_lua_string(s)
 	return (
@@ -53,6 +143,33 @@ local function escape_lua_string(s)
 	)
 end
 
+--- Get the code of the width of an nindent filter given no width
+-- The value is indented two spaces deeper than the output line it is
+-- written on, which is only known while rendering.
+-- @param name string Filter name
+-- @param args table Positional argument nodes
+-- @param named_args table|nil Named argument nodes
+-- @return string|nil Lua expression, nil when a width is given
+local function nindent_width_code(name, args, named_args)
+	if name == "nindent" and #args == 0 and not (named_args and named_args.width) then
+		return "__runtime.current_indent(__out) + 2"
+	end
+end
+
+--- Check whether a filter chain ends up in an nindent filter, whose output
+-- is already indented
+-- @param node table Expression node
+-- @return boolean
+local function has_nindent(node)
+	while node and node.type == N.FILTER do
+		if node.filter_name == "nindent" then
+			return true
+		end
+		node = node.expression
+	end
+	return false
+end
+
 --- Generate code for an expression
 -- @param node table AST node
 -- @param ctx table Context
@@ -63,6 +180,9 @@ function codegen.gen_expression(node, ctx)
 	end
 
 	local t = node.type
+	-- How the value of an access is used, for the access tracker
+	local access_mode = ctx.access_mode
+	ctx.access_mode = nil
 
 	if t == N.LITERAL then
 		if node.literal_type == "string" then
@@ -77,6 +197,10 @@ function codegen.gen_expression(node, ctx)
 	end
 
 	if t == N.IDENTIFIER then
+		-- Output of an include that has filters applied to it
+		if node.include_output then
+			return "__included"
+		end
 		-- Special handling for super() function in template inheritance
 		if node.name == "super" then
 			-- Check if user defined a variable named 'super' first
@@ -86,15 +210,48 @@ function codegen.gen_expression(node, ctx)
 		if node.name == "namespace" then
 			return "__runtime.namespace"
 		end
+		-- Translation functions, unless the context provides them
+		if I18N_BUILTINS[node.name] then
+			return string.format(
+				'(__ctx["%s"] ~= nil and __ctx["%s"] or __runtime.%s)',
+				node.name,
+				node.name,
+				I18N_BUILTINS[node.name]
+			)
+		end
+		if ctx.track_access and node.name ~= "loop" and node.name ~= "caller" then
+			return string.format(
+				'__runtime.access_name("%s", __ctx["%s"], %s)',
+				node.name,
+				node.name,
+				access_mode_code(access_mode)
+			)
+		end
 		return '__ctx["' .. node.name .. '"]'
 	end
 
 	if t == N.MEMBER_ACCESS then
+		if ctx.track_access then
+			ctx.access_mode = "nav"
+			local obj = codegen.gen_expression(node.object, ctx)
+			return string.format(
+				'__runtime.access_member(%s, "%s", %s)',
+				obj,
+				escape_lua_string(node.member),
+				access_mode_code(access_mode)
+			)
+		end
 		local obj = codegen.gen_expression(node.object, ctx)
 		return "(" .. obj .. " and " .. obj .. '["' .. node.member .. '"])'
 	end
 
 	if t == N.INDEX_ACCESS then
+		if ctx.track_access then
+			ctx.access_mode = "nav"
+			local obj = codegen.gen_expression(node.object, ctx)
+			local idx = codegen.gen_expression(node.index, ctx)
+			return string.format("__runtime.access_member(%s, %s, %s)", obj, idx, access_mode_code(access_mode))
+		end
 		local obj = codegen.gen_expression(node.object, ctx)
 		local idx = codegen.gen_expression(node.index, ctx)
 		return "(" .. obj .. " and " .. obj .. "[" .. idx .. "])"
@@ -111,6 +268,9 @@ function codegen.gen_expression(node, ctx)
 		end
 
 		local callee = codegen.gen_expression(node.callee, ctx)
+		if node.text_call then
+			return "__runtime.text_call(" .. callee .. ")"
+		end
 		local args = {}
 
 		-- Add positional arguments
@@ -139,6 +299,10 @@ function codegen.gen_expression(node, ctx)
 		for _, arg in ipairs(node.args) do
 			table.insert(args, codegen.gen_expression(arg, ctx))
 		end
+		local width = nindent_width_code(node.filter_name, node.args, node.named_args)
+		if width then
+			table.insert(args, width)
+		end
 
 		-- If there are named arguments, add them as a table
 		if node.named_args then
@@ -290,6 +454,16 @@ function codegen.gen_node(node, ctx)
 	end
 
 	local t = node.type
+	if node.line then
+		ctx.source_line = node.line
+		if node.template ~= nil then
+			ctx.source_template = node.template
+		end
+	end
+	if t ~= N.TEMPLATE then
+		line_probe(ctx, node)
+		source_mark(ctx, node)
+	end
 
 	if t == N.TEMPLATE then
 		for _, child in ipairs(node.body) do
@@ -314,12 +488,14 @@ function codegen.gen_node(node, ctx)
 		ctx.indent = ctx.indent + 1
 		emit(ctx, "local __old_autoescape = __autoescape")
 
-		-- Set new autoescape mode
+		-- Set new autoescape mode; "off" disables escaping like false
 		if type(node.enabled) == "boolean" then
 			emit(ctx, "__autoescape = " .. tostring(node.enabled))
+		elseif node.enabled == "off" then
+			emit(ctx, "__autoescape = false")
 		elseif type(node.enabled) == "string" then
-			-- Format name (e.g., "html", "xml") - treat as enabled
-			emit(ctx, "__autoescape = true")
+			-- Format name (e.g., "html", "xml")
+			emit(ctx, "__autoescape = " .. string.format("%q", node.enabled))
 		else
 			emit(ctx, "__autoescape = true")
 		end
@@ -378,7 +554,7 @@ function codegen.gen_node(node, ctx)
 		end
 
 		-- Capture the output
-		emit(ctx, "local __filtered_content = table.concat(__out)")
+		emit(ctx, "local __filtered_content = " .. concat_code(ctx, "__out"))
 		emit(ctx, "__out = __old_out")
 
 		-- Apply the filter
@@ -386,6 +562,10 @@ function codegen.gen_node(node, ctx)
 		for _, arg in ipairs(node.args) do
 			table.insert(filter_args, codegen.gen_expression(arg, ctx))
 		end
+		local width = nindent_width_code(node.filter_name, node.args, node.named_args)
+		if width then
+			table.insert(filter_args, width)
+		end
 
 		-- Add named arguments if present
 		if node.named_args then
@@ -401,12 +581,81 @@ function codegen.gen_node(node, ctx)
 			ctx,
 			'local __filter_result = __filters["' .. node.filter_name .. '"](' .. table.concat(filter_args, ", ") .. ")"
 		)
-		emit(ctx, "-- Extract value from safe wrapper if present")
-		emit(ctx, "if type(__filter_result) == 'table' and __filter_result.__luma_safe then")
-		emit(ctx, "  __out[#__out + 1] = __filter_result.value")
-		emit(ctx, "else")
-		emit(ctx, "  __out[#__out + 1] = __filter_result")
+		emit(ctx, "-- Unwrap safe results")
+		emit(ctx, "__out[#__out + 1] = __runtime.output(__filter_result)")
+
+		ctx.indent = ctx.indent - 1
+		emit(ctx, "end")
+		return
+	end
+
+	if t == N.TRANS then
+		-- Translate the message and substitute its variables
+		emit(ctx, "do")
+		ctx.indent = ctx.indent + 1
+		local names = {}
+		for name in pairs(node.variables) do
+			names[#names + 1] = name
+		end
+		table.sort(names)
+		local var_parts = {}
+		for _, name in ipairs(names) do
+			local value_code = codegen.gen_expression(node.variables[name], ctx)
+			table.insert(var_parts, '["' .. name .. '"]=' .. value_code)
+		end
+		emit(ctx, "local __trans_vars = {" .. table.concat(var_parts, ",") .. "}")
+
+		local plural_code = node.plural and ('"' .. escape_lua_string(node.plural) .. '"') or "nil"
+		local count_code = node.count and ('__trans_vars["' .. node.count .. '"]') or "nil"
+		emit(
+			ctx,
+			string.format(
+				'__out[#__out + 1] = "%s" .. __runtime.translate("%s", %s, %s, __trans_vars, __esc) .. "%s"',
+				escape_lua_string(node.prefix or ""),
+				escape_lua_string(node.singular),
+				plural_code,
+				count_code,
+				escape_lua_string(node.suffix or "")
+			)
+		)
+
+		ctx.indent = ctx.indent - 1
 		emit(ctx, "end")
+		return
+	end
+
+	if t == N.EXTENSION then
+		-- Capture the body, if any, and hand it to the extension
+		emit(ctx, "do")
+		ctx.indent = ctx.indent + 1
+		local body_code = "nil"
+		if node.body then
+			emit(ctx, "local __old_out = __out")
+			emit(ctx, "__out = {}")
+			for _, child in ipairs(node.body) do
+				codegen.gen_node(child, ctx)
+			end
+			emit(ctx, "local __extension_body = " .. concat_code(ctx, "__out"))
+			emit(ctx, "__out = __old_out")
+			body_code = "__extension_body"
+		end
+
+		local named_code = "nil"
+		if node.named_args then
+			local named_parts = {}
+			for name, value_node in pairs(node.named_args) do
+				local value_code = codegen.gen_expression(value_node, ctx)
+				table.insert(named_parts, '["' .. name .. '"]=' .. value_code)
+			end
+			named_code = "{" .. table.concat(named_parts, ",") .. "}"
+		end
+
+		local call_args = { string.format("%q", node.name), body_code, named_code }
+		for _, arg in ipairs(node.args) do
+			table.insert(call_args, codegen.gen_expression(arg, ctx))
+		end
+		emit(ctx, "local __extension_result = __runtime.extension(" .. table.concat(call_args, ", ") .. ")")
+		emit(ctx, "__out[#__out + 1] = __runtime.output(__extension_result)")
 
 		ctx.indent = ctx.indent - 1
 		emit(ctx, "end")
@@ -460,8 +709,10 @@ function codegen.gen_node(node, ctx)
 	if t == N.INTERPOLATION then
 		local expr = codegen.gen_expression(node.expression, ctx)
 		-- Don't apply indentation for string literals (they may contain intentional \n)
+		-- nor for nindent output, which is already indented
 		local col = (node.expression and node.expression.type == N.LITERAL and node.expression.literal_type == "string")
 				and 1
+			or has_nindent(node.expression) and 1
 			or (node.column or 1)
 		emit(ctx, "__out[#__out + 1] = __esc(" .. expr .. ", " .. col .. ")")
 		return
@@ -492,7 +743,7 @@ function codegen.gen_node(node, ctx)
 			end
 
 			-- Capture the output and assign to variable
-			emit(ctx, '__ctx["' .. node.name .. '"] = table.concat(__out)')
+			emit(ctx, '__ctx["' .. node.name .. '"] = ' .. concat_code(ctx, "__out"))
 			emit(ctx, "__out = __old_out")
 			ctx.indent = ctx.indent - 1
 			emit(ctx, "end")
@@ -600,7 +851,7 @@ function codegen.gen_node(node, ctx)
 					codegen.gen_node(child, ctx)
 				end
 
-				emit(ctx, "return table.concat(__out)")
+				emit(ctx, "return " .. concat_code(ctx, "__out"))
 				dedent(ctx)
 				emit(ctx, "end")
 			end
@@ -615,7 +866,7 @@ function codegen.gen_node(node, ctx)
 				emit(ctx, "__super = __parent_prev_super")
 			end
 
-			emit(ctx, "return table.concat(__out)")
+			emit(ctx, "return " .. concat_code(ctx, "__out"))
 			dedent(ctx)
 			emit(ctx, "end")
 		end
@@ -653,6 +904,7 @@ function codegen.gen_if(node, ctx)
 	local cond = codegen.gen_expression(node.condition, ctx)
 	emit(ctx, "if " .. cond .. " then")
 	indent(ctx)
+	probe(ctx, node, "branch", node.column, 0, "if")
 
 	for _, child in ipairs(node.then_body) do
 		codegen.gen_node(child, ctx)
@@ -665,16 +917,23 @@ function codegen.gen_if(node, ctx)
 			-- elif chain
 			emit(ctx, "else")
 			indent(ctx)
+			probe(ctx, node, "branch", node.column, 1, "if")
 			codegen.gen_if(node.else_body, ctx)
 			dedent(ctx)
 		else
 			emit(ctx, "else")
 			indent(ctx)
+			probe(ctx, node, "branch", node.column, 1, "if")
 			for _, child in ipairs(node.else_body) do
 				codegen.gen_node(child, ctx)
 			end
 			dedent(ctx)
 		end
+	elseif ctx.probes then
+		emit(ctx, "else")
+		indent(ctx)
+		probe(ctx, node, "branch", node.column, 1, "if")
+		dedent(ctx)
 	end
 
 	emit(ctx, "end")
@@ -721,9 +980,11 @@ function codegen.gen_for(node, ctx)
 			local fn_name = callee.name
 			if fn_name == "ipairs" and node.iterable.args and #node.iterable.args >= 1 then
 				-- Extract the first argument (the table to iterate)
+				ctx.access_mode = "iter"
 				iterable = codegen.gen_expression(node.iterable.args[1], ctx)
 			elseif fn_name == "pairs" and node.iterable.args and #node.iterable.args >= 1 then
 				-- Extract the first argument (the table to iterate)
+				ctx.access_mode = "iter"
 				iterable = codegen.gen_expression(node.iterable.args[1], ctx)
 			end
 		end
@@ -731,6 +992,7 @@ function codegen.gen_for(node, ctx)
 
 	-- If not ipairs/pairs, generate the iterable expression normally
 	if not iterable then
+		ctx.access_mode = "iter"
 		iterable = codegen.gen_expression(node.iterable, ctx)
 	end
 
@@ -762,6 +1024,7 @@ function codegen.gen_for(node, ctx)
 	end
 	emit(ctx, "if " .. empty_check .. " then")
 	indent(ctx)
+	probe(ctx, node, "branch", node.column, 1, "for")
 	if node.else_body then
 		for _, child in ipairs(node.else_body) do
 			codegen.gen_node(child, ctx)
@@ -832,6 +1095,7 @@ function codegen.gen_for(node, ctx)
 	end
 
 	-- Loop body
+	probe(ctx, node, "branch", node.column, 0, "for")
 	for _, child in ipairs(node.body) do
 		codegen.gen_node(child, ctx)
 	end
@@ -864,6 +1128,7 @@ function codegen.gen_macro_def(node, ctx)
 
 	emit(ctx, '__macros["' .. macro_name .. '"] = function(' .. table.concat(params, ", ") .. ")")
 	indent(ctx)
+	probe(ctx, node, "macro", node.column, 0, macro_name)
 	emit(ctx, "local __macro_out = {}")
 	emit(ctx, "local __old_out = __out")
 	emit(ctx, "__out = __macro_out")
@@ -889,7 +1154,7 @@ function codegen.gen_macro_def(node, ctx)
 
 	emit(ctx, "__ctx = __old_ctx")
 	emit(ctx, "__out = __old_out")
-	emit(ctx, "return table.concat(__macro_out)")
+	emit(ctx, "return " .. concat_code(ctx, "__macro_out"))
 	dedent(ctx)
 	emit(ctx, "end")
 end
@@ -945,7 +1210,7 @@ function codegen.gen_macro_call(node, ctx)
 		emit(ctx, "__ctx = __old_ctx")
 		emit(ctx, "__out = __old_out")
 		-- Mark caller output as safe to prevent double-escaping
-		emit(ctx, "return __runtime.safe(table.concat(__caller_out))")
+		emit(ctx, "return __runtime.safe(" .. concat_code(ctx, "__caller_out") .. ")")
 		dedent(ctx)
 		emit(ctx, "end")
 
@@ -984,6 +1249,19 @@ function codegen.gen_include(node, ctx)
 		context_arg = "{}" -- empty context
 	end
 
+	-- Apply filters and indentation to the included output
+	local function emit_output(result)
+		if node.filters then
+			emit(ctx, "local __included = " .. result)
+			result = "__runtime.output(" .. codegen.gen_expression(node.filters, ctx) .. ")"
+		end
+		if node.indent then
+			local width = node.indent == true and "nil" or tostring(node.indent)
+			result = "__runtime.indent_output(" .. result .. ", " .. width .. ", __out, " .. (node.column or 1) .. ")"
+		end
+		emit(ctx, "__out[#__out + 1] = " .. result)
+	end
+
 	-- Handle ignore_missing flag
 	if node.ignore_missing then
 		emit(ctx, "do")
@@ -991,14 +1269,20 @@ function codegen.gen_include(node, ctx)
 		emit(ctx, "local ok, result = pcall(__runtime.include, " .. path .. ", " .. context_arg .. ")")
 		emit(ctx, "if ok then")
 		ctx.indent = ctx.indent + 1
-		emit(ctx, "__out[#__out + 1] = result")
+		emit_output("result")
 		ctx.indent = ctx.indent - 1
 		emit(ctx, "end")
 		emit(ctx, "-- Silently ignore if template is missing")
 		ctx.indent = ctx.indent - 1
 		emit(ctx, "end")
+	elseif node.filters then
+		emit(ctx, "do")
+		ctx.indent = ctx.indent + 1
+		emit_output("__runtime.include(" .. path .. ", " .. context_arg .. ")")
+		ctx.indent = ctx.indent - 1
+		emit(ctx, "end")
 	else
-		emit(ctx, "__out[#__out + 1] = __runtime.include(" .. path .. ", " .. context_arg .. ")")
+		emit_output("__runtime.include(" .. path .. ", " .. context_arg .. ")")
 	end
 end
 
@@ -1047,19 +1331,82 @@ function codegen.gen_import(node, ctx)
 	end
 end
 
+--- Describe which template line each line of the generated code comes from
+-- The map is a Lua table constructor: a flat list of triples (Lua line,
+-- template line, template index), one for each Lua line where the
+-- template line changes, and a templates list, where index 0 stands for
+-- the compiled template itself.
+-- @param ctx table Context
+-- @param name string|nil Name of the compiled template
+-- @return string Lua code
+function codegen.line_map(ctx, name)
+	local templates, indexes = {}, {}
+	local entries = {}
+	local last_line, last_index
+	for i = 1, #ctx.lines do
+		local source = ctx.source_lines[i]
+		if source then
+			local template, line = source[1], source[2]
+			local index = 0
+			if template and template ~= name then
+				index = indexes[template]
+				if not index then
+					templates[#templates + 1] = string.format("%q", template)
+					index = #templates
+					indexes[template] = index
+				end
+			end
+			if line ~= last_line or index ~= last_index then
+				entries[#entries + 1] = i .. ", " .. line .. ", " .. index
+				last_line, last_index = line, index
+			end
+		end
+	end
+	local parts = { "templates = {" .. table.concat(templates, ", ") .. "}" }
+	for _, entry in ipairs(entries) do
+		parts[#parts + 1] = entry
+	end
+	return "{ " .. table.concat(parts, ", ") .. " }"
+end
+
 --- Generate the complete template function
 -- @param template_ast table Template AST
 -- @param options table|nil Options
 -- @return string Generated Lua code
 function codegen.generate(template_ast, options)
-	options = options or {} -- luacheck: ignore options
+	options = options or {}
 	local ctx = create_context()
+	if options.coverage then
+		ctx.probes = {}
+	end
+	if options.source_map then
+		ctx.locations = {}
+	end
+	ctx.track_access = options.track_access
+	ctx.template_name = options.name or false
+	ctx.source_template = ctx.template_name
+
+	local autoescape = options.autoescape
+	if autoescape == nil then
+		autoescape = "true"
+	elseif autoescape == "off" then
+		autoescape = "false"
+	elseif type(autoescape) == "string" then
+		autoescape = string.format("%q", autoescape)
+	else
+		autoescape = tostring(autoescape)
+	end
 
 	-- Function header - receives globals as upvalues from the loader
 	emit_raw(ctx, "local tostring, ipairs, pairs, setmetatable, type = tostring, ipairs, pairs, setmetatable, type")
 	emit_raw(ctx, "local table, string, math, pcall = table, string, math, pcall")
-	emit_raw(ctx, "return function(__ctx, __filters, __runtime, __macros, __tests)")
+	local header_line = #ctx.lines + 1
+	emit_raw(ctx, "")
+	emit_raw(ctx, "local __render = function(__ctx, __filters, __runtime, __macros, __tests)")
 	indent(ctx)
+	if ctx.probes then
+		emit(ctx, "__cov = __cov or __runtime.coverage_counters(__cov_probes)")
+	end
 
 	emit(ctx, "__ctx = __ctx or {}")
 	emit(ctx, "__filters = __filters or {}")
@@ -1079,15 +1426,15 @@ function codegen.generate(template_ast, options)
 	emit(ctx, "")
 	emit(ctx, "local __out = {}")
 	emit(ctx, "local __super = nil  -- Parent block content for super() calls")
-	emit(ctx, "local __autoescape = true  -- Autoescape enabled by default")
+	emit(ctx, "local __autoescape = " .. autoescape .. "  -- Autoescape mode (true is HTML)")
 	emit(ctx, "")
 
 	-- Escape function - handles safe wrapper tables and indentation
 	emit(ctx, "local function __esc(v, col)")
 	indent(ctx)
-	emit(ctx, 'if v == nil then return "" end')
+	emit(ctx, 'if v == nil or type(v) == "function" then return "" end')
 	emit(ctx, "if not __autoescape then return tostring(v) end")
-	emit(ctx, "return __runtime.escape(v, col)")
+	emit(ctx, "return __runtime.escape(v, col, __autoescape)")
 	dedent(ctx)
 	emit(ctx, "end")
 	emit(ctx, "")
@@ -1096,11 +1443,35 @@ function codegen.generate(template_ast, options)
 	codegen.gen_node(template_ast, ctx)
 
 	emit(ctx, "")
-	emit(ctx, "return table.concat(__out)")
+	emit(ctx, "return " .. concat_code(ctx, "__out"))
 
 	dedent(ctx)
 	emit_raw(ctx, "end")
 
+	-- Describe the probes and source locations now that the body has
+	-- been generated, on a single line to keep the line numbers
+	local header = {}
+	if ctx.probes then
+		local probes = {}
+		for i, p in ipairs(ctx.probes) do
+			local template = p[2] and string.format("%q", p[2]) or "false"
+			probes[i] = string.format("{%q, %s, %d, %d, %d, %q}", p[1], template, p[3], p[4], p[5], p[6])
+		end
+		header[#header + 1] = "local __cov_probes, __cov = {" .. table.concat(probes, ", ") .. "}, nil"
+	end
+	if ctx.locations then
+		local locations = {}
+		for i, l in ipairs(ctx.locations) do
+			local template = l[1] and string.format("%q", l[1]) or "false"
+			locations[i] = string.format("{%s, %d, %d, %s}", template, l[2], l[3], tostring(l[4]))
+		end
+		header[#header + 1] = "local __sm_locations = {" .. table.concat(locations, ", ") .. "}"
+	end
+	ctx.lines[header_line] = table.concat(header, " ")
+
+	-- Return the render function along with the line map
+	emit_raw(ctx, "return __render, " .. codegen.line_map(ctx, options.name))
+
 	return table.concat(ctx.lines, "\n")
 end
 
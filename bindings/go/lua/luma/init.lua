@@ -163,6 +163,13 @@ function luma.clear_cache()
 	runtime.clear_cache()
 end
 
+--- Drop a changed template from the cache, along with the cached
+-- templates that include, import or extend it
+-- @param name string Template name
+function luma.invalidate(name)
+	runtime.invalidate(name)
+end
+
 --- Parse a template to AST (for advanced usage)
 -- @param template string Template source code
 -- @param options table|nil Parser options
@@ -171,6 +178,25 @@ function luma.parse(template, options)
 	return parser.parse(template, options)
 end
 
+--- Parse a template, collecting every syntax error instead of stopping
+-- at the first one (for editors and linters)
+-- @param template string Template source code
+-- @param options table|nil Parser options
+-- @return table|nil AST root node, nil when the lexer failed
+-- @return table Error objects, in source order
+function luma.parse_all(template, options)
+	return parser.parse_all(template, options)
+end
+
+--- Find the context paths a template reads, without rendering it
+-- (see luma.compiler.analysis)
+-- @param template string Template source code
+-- @param options table|nil Compilation options
+-- @return table References to context paths
+function luma.references(template, options)
+	return require("luma.compiler.analysis").references(template, options)
+end
+
 --- Tokenize a template (for advanced usage)
 -- @param template string Template source code
 -- @param options table|nil Lexer options
@@ -20,12 +20,106 @@ lexer.SYNTAX_NATIVE = "native"
 lexer.SYNTAX_JINJA = "jinja"
 lexer.SYNTAX_AUTO = "auto"
 
+--- Syntax options and their types, see lexer.set_syntax
+local SYNTAX_OPTIONS = {
+	variable_start_string = "string",
+	variable_end_string = "string",
+	block_start_string = "string",
+	block_end_string = "string",
+	comment_start_string = "string",
+	comment_end_string = "string",
+	directive_sigil = "string",
+	interpolation_sigil = "string",
+	inline_detection = "boolean",
+}
+
+--- Syntax options for templates tokenized without them
+local syntax_defaults = {}
+
+--- Check the syntax options of a table
+-- @param options table Options
+-- @return boolean|nil true if valid
+-- @return string|nil Error message if not
+local function check_syntax(options)
+	for key, kind in pairs(SYNTAX_OPTIONS) do
+		local value = options[key]
+		if value ~= nil and type(value) ~= kind then
+			return nil, string.format("%s must be a %s, got %s", key, kind, type(value))
+		end
+		if kind == "string" and value == "" then
+			return nil, key .. " must not be empty"
+		end
+		if value and key:match("_string$") and value:match("%s") then
+			return nil, key .. " must not contain whitespace"
+		end
+	end
+	for _, key in ipairs({ "directive_sigil", "interpolation_sigil" }) do
+		local sigil = options[key]
+		if sigil and (#sigil ~= 1 or sigil:match("[%w%s_%-{}\"'\\]")) then
+			return nil, string.format("%s must be a single punctuation character other than - { } and quotes", key)
+		end
+	end
+	local directive = options.directive_sigil or "@"
+	if directive == (options.interpolation_sigil or "$") then
+		return nil, "directive_sigil and interpolation_sigil must differ"
+	end
+	local starts = {}
+	for _, key in ipairs({ "variable_start_string", "block_start_string", "comment_start_string" }) do
+		local start = options[key] or jinja.DELIMITERS[key:gsub("_string$", "")]
+		if starts[start] then
+			return nil, string.format("%s and %s must differ", starts[start], key)
+		end
+		starts[start] = key
+	end
+	return true
+end
+
+--- Set the syntax options of templates tokenized without them
+-- Options are the Jinja delimiters variable_start_string ("{{"),
+-- variable_end_string ("}}"), block_start_string ("{%"),
+-- block_end_string ("%}"), comment_start_string ("{#") and
+-- comment_end_string ("#}"); the native directive_sigil ("@") and
+-- interpolation_sigil ("$"); and inline_detection (true), which can be
+-- set to false to treat every native directive as a block directive.
+-- Compiled templates are cached with their options, so templates
+-- compiled before are not affected.
+-- @param options table|nil Syntax options, nil for the defaults
+function lexer.set_syntax(options)
+	options = options or {}
+	local ok, err = check_syntax(options)
+	if not ok then
+		error("invalid syntax options: " .. err, 2)
+	end
+	syntax_defaults = {}
+	for key in pairs(SYNTAX_OPTIONS) do
+		syntax_defaults[key] = options[key]
+	end
+end
+
+--- Get the syntax options set with lexer.set_syntax
+-- @return table Syntax options
+function lexer.syntax_options()
+	return syntax_defaults
+end
+
+--- Get a syntax option, falling back to the one set with lexer.set_syntax
+local function syntax_option(options, key)
+	local value = options[key]
+	if value == nil then
+		value = syntax_defaults[key]
+	end
+	return value
+end
+
 --- Detect syntax mode from source content
 -- @param source string Template source
+-- @param options table Options table
 -- @return string Detected syntax mode ("native" or "jinja")
-local function detect_syntax(source)
+local function detect_syntax(source, options)
 	-- Look for Jinja patterns first
-	if source:match("{{") or source:match("{%%") then
+	local variable_start = syntax_option(options, "variable_start_string") or jinja.DELIMITERS.variable_start
+	local block_start = syntax_option(options, "block_start_string") or jinja.DELIMITERS.block_start
+	if source:find(variable_start, 1, true) or source:find(block_start, 1, true) then
 		return lexer.SYNTAX_JINJA
 	end
 	-- Default to native
@@ -34,7 +128,8 @@ end
 
 --- Create a new lexer
 -- @param source string The template source code
--- @param options table|nil Options table
+-- @param options table|nil Options table, with the syntax options of
+--   lexer.set_syntax
 -- @return table Lexer instance
 function lexer.new(source, options)
 	options = options or {}
@@ -45,7 +140,7 @@ function lexer.new(source, options)
 
 	-- Auto-detect syntax if needed
 	if syntax == lexer.SYNTAX_AUTO then
-		syntax = detect_syntax(source)
+		syntax = detect_syntax(source, options)
 		was_auto_detected = true
 	end
 
@@ -54,12 +149,23 @@ function lexer.new(source, options)
 		warnings.jinja_syntax(options)
 	end
 
+	local sigils = {
+		directive = syntax_option(options, "directive_sigil"),
+		interpolation = syntax_option(options, "interpolation_sigil"),
+	}
+
 	-- Create appropriate lexer
 	if syntax == lexer.SYNTAX_JINJA then
-		return jinja.new(source, source_name)
+		sigils.variable_start = syntax_option(options, "variable_start_string")
+		sigils.variable_end = syntax_option(options, "variable_end_string")
+		sigils.block_start = syntax_option(options, "block_start_string")
+		sigils.block_end = syntax_option(options, "block_end_string")
+		sigils.comment_start = syntax_option(options, "comment_start_string")
+		sigils.comment_end = syntax_option(options, "comment_end_string")
+		return jinja.new(source, source_name, sigils)
 	end
 
-	return native.new(source, source_name)
+	return native.new(source, source_name, sigils)
 end
 
 --- Tokenize a template string
@@ -75,8 +181,10 @@ function lexer.tokenize(source, options)
 	if options.syntax ~= lexer.SYNTAX_JINJA then
 		-- Apply trim processing (dash trimming)
 		token_list = trim_processor.process(token_list)
-		-- Apply inline detection
-		token_list = inline_detector.detect_inline(token_list)
+		-- Apply inline detection, unless disabled
+		if syntax_option(options, "inline_detection") ~= false then
+			token_list = inline_detector.detect_inline(token_list)
+		end
 	end
 
 	return token_list
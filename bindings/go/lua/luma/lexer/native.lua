@@ -4,9 +4,17 @@
 
 local tokens = require("luma.lexer.tokens")
 local errors = require("luma.utils.errors")
+local extensions = require("luma.extensions")
 
 local T = tokens.types
 
+--- Directives whose arguments are optional
+local OPTIONAL_ARGUMENTS = {
+	[T.DIR_EXTENSION] = true,
+	[T.DIR_TRANS] = true,
+	[T.DIR_PLURALIZE] = true,
+}
+
 local native = {}
 
 --- Character classification helpers
@@ -29,11 +37,16 @@ end
 --- Create a new native lexer
 -- @param source string The template source code
 -- @param source_name string|nil Name for error messages
+-- @param sigils table|nil Characters starting directives and
+--   interpolations: { directive = "@", interpolation = "$" }
 -- @return table Lexer instance
-function native.new(source, source_name)
+function native.new(source, source_name, sigils)
+	sigils = sigils or {}
 	local self = {
 		source = source,
 		source_name = source_name or "template",
+		directive = sigils.directive or "@",
+		interpolation = sigils.interpolation or "$",
 		pos = 1,
 		line = 1,
 		column = 1,
@@ -47,6 +60,7 @@ function native.new(source, source_name)
 		directive_first_newline = false, -- Track if we've seen the first newline in directive
 		directive_has_content = false, -- Track if directive has any content beyond keyword
 		last_token_type = nil, -- Track last emitted token type (for hyphen handling)
+		paren_depth = nil, -- Parenthesis depth of inline extension arguments
 	}
 	setmetatable(self, { __index = native })
 	return self
@@ -189,17 +203,27 @@ end
 function native:read_simple_path()
 	local parts = {}
 
+	-- Read an identifier, keeping a trailing "()" for zero-argument calls
+	-- such as $user.FullName()
+	local function read_segment()
+		local ident = self:read_identifier()
+		if self:peek() == "(" and self:peek(1) == ")" then
+			self:advance() -- skip (
+			self:advance() -- skip )
+			ident = ident .. "()"
+		end
+		return ident
+	end
+
 	-- First identifier
-	local ident = self:read_identifier()
-	table.insert(parts, ident)
+	table.insert(parts, read_segment())
 
 	-- Read any .member accesses
 	while self:peek() == "." do
 		local next_char = self:peek(1)
 		if next_char and is_alpha(next_char) then
 			self:advance() -- skip .
-			local member = self:read_identifier()
-			table.insert(parts, member)
+			table.insert(parts, read_segment())
 		else
 			break
 		end
@@ -245,7 +269,7 @@ function native:scan_expression_token()
 			local token = self:make_token(T.INTERP_END, nil, start_line, start_col)
 			-- Check for trailing dash: }- but NOT if followed by $ (another interpolation)
 			-- This prevents consuming hyphens in patterns like ${a}-${b}
-			if self:peek() == "-" and self:peek(1) ~= "$" then
+			if self:peek() == "-" and self:peek(1) ~= self.interpolation then
 				self:advance() -- skip -
 				token.trim_next = true
 			end
@@ -309,6 +333,7 @@ function native:scan_expression_token()
 		else
 			-- No continuation, end directive
 			self.in_directive = false
+			self.paren_depth = nil
 			self.directive_first_newline = false
 			self.directive_has_content = false
 			return self:make_token(T.NEWLINE, nil, start_line, start_col)
@@ -326,7 +351,7 @@ function native:scan_expression_token()
 
 	-- @ character in directive mode means we've hit another directive
 	-- End the current directive and let the @ be scanned as text/directive next
-	if c == "@" and self.in_directive then
+	if c == self.directive and self.in_directive then
 		self.in_directive = false
 		self.directive_first_newline = false
 		self.directive_has_content = false
@@ -336,7 +361,7 @@ function native:scan_expression_token()
 
 	-- $ character in directive mode likely means we've hit an interpolation
 	-- End the current directive and let the $ be scanned next
-	if c == "$" and self.in_directive then
+	if c == self.interpolation and self.in_directive then
 		self.in_directive = false
 		self.directive_first_newline = false
 		self.directive_has_content = false
@@ -428,7 +453,7 @@ function native:scan_expression_token()
 	-- Check for dash-trim pattern (-$ or -@) in directive mode before consuming
 	if c == "-" and self.in_directive then
 		local next_char = self:peek(1)
-		if next_char == "$" or next_char == "@" then
+		if next_char == self.interpolation or next_char == self.directive then
 			-- End directive before the dash-trim marker
 			self.in_directive = false
 			self.directive_first_newline = false
@@ -459,9 +484,20 @@ function native:scan_expression_token()
 		return self:make_token(T.RBRACKET, nil, start_line, start_col)
 	end
 	if c == "(" then
+		if self.paren_depth then
+			self.paren_depth = self.paren_depth + 1
+		end
 		return self:make_token(T.LPAREN, nil, start_line, start_col)
 	end
 	if c == ")" then
+		if self.paren_depth then
+			self.paren_depth = self.paren_depth - 1
+			if self.paren_depth == 0 then
+				-- The closing parenthesis of inline extension arguments
+				self.paren_depth = nil
+				self.in_directive = false
+			end
+		end
 		return self:make_token(T.RPAREN, nil, start_line, start_col)
 	end
 	if c == "{" then
@@ -504,8 +540,9 @@ function native:scan_expression_token()
 	errors.raise(errors.lexer("Unexpected character in expression: " .. c, start_line, start_col, self.source_name))
 end
 
---- Scan a directive at line start
-function native:scan_directive()
+--- Scan a directive
+-- @param inline boolean|nil True when the directive follows text on its line
+function native:scan_directive(inline)
 	local start_line = self.line
 	local start_col = self.column
 
@@ -527,8 +564,44 @@ function native:scan_directive()
 	local keyword = self:read_identifier()
 	local dir_type = tokens.directives[keyword]
 
+	if not dir_type and extensions.get(keyword) then
+		dir_type = T.DIR_EXTENSION
+	end
+
+	-- Directives with optional arguments end with their line when they
+	-- have none, so that the next line is not read as arguments
+	if OPTIONAL_ARGUMENTS[dir_type] then
+		local blank = self.source:match("^[ \t\r]*\n?", self.pos)
+		if blank:sub(-1) == "\n" or self.pos + #blank > self.length then
+			for _ = 1, #blank do
+				self:advance()
+			end
+			local token = self:make_token(dir_type, keyword, start_line, start_col)
+			token.bare = true
+			return token
+		end
+	end
+
+	-- Inline extensions without a body take arguments only in parentheses,
+	-- so that the text after them is not read as arguments
+	local extension = dir_type == T.DIR_EXTENSION and extensions.get(keyword)
+	if inline and extension and not extension.block then
+		local token = self:make_token(dir_type, keyword, start_line, start_col)
+		if self:peek() ~= "(" then
+			token.bare = true
+			return token
+		end
+		token.parenthesized = true
+		self.in_directive = true
+		self.directive_first_newline = false
+		self.directive_has_content = false
+		self.paren_depth = 0
+		return token
+	end
+
 	if not dir_type then
-		errors.raise(errors.lexer("Unknown directive: @" .. keyword, start_line, start_col, self.source_name))
+		local message = "Unknown directive: " .. self.directive .. keyword
+		errors.raise(errors.lexer(message, start_line, start_col, self.source_name))
 	end
 
 	-- For directives that don't need expressions, return immediately
@@ -580,12 +653,12 @@ function native:scan_text()
 
 			-- Check for -$ (dash trim before interpolation)
 			-- This is a trim directive if we have any accumulated content
-			if next_c == "$" and has_content then
+			if next_c == self.interpolation and has_content then
 				is_trim_directive = true
 			end
 
 			-- Check for -@ (dash trim before directive)
-			if not is_trim_directive and next_c == "@" and next_next_c and is_alpha(next_next_c) then
+			if not is_trim_directive and next_c == self.directive and next_next_c and is_alpha(next_next_c) then
 				if self.at_line_start or has_content then
 					is_trim_directive = true
 				end
@@ -604,9 +677,9 @@ function native:scan_text()
 			table.insert(parts, c)
 			self:advance()
 		-- Check for $ (interpolation)
-		elseif c == "$" then
+		elseif c == self.interpolation then
 			local next_c = self:peek(1)
-			if next_c == "$" then
+			if next_c == self.interpolation then
 				-- Escaped $$ -> literal $
 				self:advance()
 				self:advance()
@@ -616,7 +689,7 @@ function native:scan_text()
 				end
 				line_whitespace = {}
 				on_line_start = false
-				table.insert(parts, "$")
+				table.insert(parts, self.interpolation)
 			elseif next_c == "{" or (next_c and is_alpha(next_c)) then
 				-- Start of interpolation - keep the line whitespace as content
 				for _, ws in ipairs(line_whitespace) do
@@ -634,7 +707,7 @@ function native:scan_text()
 				self:advance()
 			end
 		-- Check for @ (directive) - at line start OR after space/dash (inline mode)
-		elseif c == "@" then
+		elseif c == self.directive then
 			if self.at_line_start then
 				-- Block mode: directive at line start
 				-- Don't include the leading whitespace - it belongs to the directive line
@@ -720,7 +793,7 @@ function native:next_token()
 	local start_col = self.column
 
 	-- Check for dash trimming before directive: -@
-	if c == "-" and self:peek(1) == "@" then
+	if c == "-" and self:peek(1) == self.directive then
 		local next_next = self:peek(2)
 		-- Make sure it's -@ followed by directive keyword
 		if next_next and is_alpha(next_next) then
@@ -740,7 +813,7 @@ function native:next_token()
 				then
 					-- Preceded by space - this is an inline dash-directive
 					self:advance() -- skip -
-					local token = self:scan_directive()
+					local token = self:scan_directive(true)
 					token.trim_prev = true
 					return token
 				end
@@ -749,7 +822,7 @@ function native:next_token()
 	end
 
 	-- Check for directive at line start OR preceded by space/dash (inline mode)
-	if c == "@" then
+	if c == self.directive then
 		if self.at_line_start then
 			-- Block mode: directive at line start
 			return self:scan_directive()
@@ -760,13 +833,13 @@ function native:next_token()
 				local prev_char = self.source:sub(prev_pos, prev_pos)
 				if prev_char == " " or prev_char == "\t" then
 					-- Preceded by space - this is an inline directive
-					return self:scan_directive()
+					return self:scan_directive(true)
 				elseif prev_char == "-" then
 					-- Preceded by dash - check if this is a directive (@ followed by keyword)
 					local next_c = self:peek(1)
 					if next_c and is_alpha(next_c) then
 						-- This is a directive after dash-trim marker
-						return self:scan_directive()
+						return self:scan_directive(true)
 					end
 				end
 			end
@@ -777,7 +850,7 @@ function native:next_token()
 	-- Check for dash trimming before interpolation: -$
 	-- This handles trim directives like "text -$var" -> trim space before var
 	-- BUT NOT when the hyphen is literal text between interpolations like ${a}-${b}
-	if c == "-" and self:peek(1) == "$" then
+	if c == "-" and self:peek(1) == self.interpolation then
 		-- Don't treat as trim directive if we just finished an interpolation
 		-- In that case, the hyphen is literal text: ${a}-${b}
 		if self.last_token_type == T.INTERP_END or self.last_token_type == T.INTERP_SIMPLE then
@@ -789,7 +862,7 @@ function native:next_token()
 		c = self:peek() -- now at $
 		local next_c = self:peek(1)
 
-		if next_c == "$" then
+		if next_c == self.interpolation then
 			-- Escaped $$ - handled in scan_text
 			return self:scan_text()
 		elseif next_c == "{" then
@@ -808,7 +881,7 @@ function native:next_token()
 			local token = self:make_token(T.INTERP_SIMPLE, path, start_line, start_col)
 			token.trim_prev = true
 			-- Check for trailing dash: -$var-
-			if self:peek() == "-" and self:peek(1) ~= "$" then
+			if self:peek() == "-" and self:peek(1) ~= self.interpolation then
 				self:advance() -- skip -
 				token.trim_next = true
 			end
@@ -817,10 +890,10 @@ function native:next_token()
 	end
 
 	-- Check for interpolation
-	if c == "$" then
+	if c == self.interpolation then
 		local next_c = self:peek(1)
 
-		if next_c == "$" then
+		if next_c == self.interpolation then
 			-- Escaped $$ - handled in scan_text
 			return self:scan_text()
 		elseif next_c == "{" then
@@ -837,7 +910,7 @@ function native:next_token()
 		local token = self:make_token(T.INTERP_SIMPLE, path, start_line, start_col)
 		-- Check for trailing dash: $var- but NOT if followed by $ (another interpolation)
 		-- This prevents consuming hyphens in patterns like $a-$b
-		if self:peek() == "-" and self:peek(1) ~= "$" then
+		if self:peek() == "-" and self:peek(1) ~= self.interpolation then
 			self:advance() -- skip -
 			token.trim_next = true
 		end
@@ -44,6 +44,8 @@ ast.types = {
 	WITH = "WITH", -- With block (scoped variables)
 	FILTER_BLOCK = "FILTER_BLOCK", -- Filter block (apply filter to content)
 	DO = "DO", -- Do statement (execute without output)
+	EXTENSION = "EXTENSION", -- Directive registered with luma.extensions
+	TRANS = "TRANS", -- Translatable block
 	COMMENT = "COMMENT", -- Comment (not rendered)
 
 	-- Loop control
@@ -458,6 +460,42 @@ function ast.filter_block(filter_name, args, named_args, body, line, column)
 	return node
 end
 
+--- Create an extension directive node
+-- @param name string Extension name
+-- @param args table Positional arguments
+-- @param named_args table|nil Named arguments
+-- @param body table|nil Array of body nodes, nil without a block
+-- @param line number|nil Line number
+-- @param column number|nil Column number
+-- @return table Extension node
+function ast.extension(name, args, named_args, body, line, column)
+	local node = make_node(N.EXTENSION, line, column)
+	node.name = name
+	node.args = args or {}
+	node.named_args = named_args
+	node.body = body
+	return node
+end
+
+--- Create a translatable block node
+-- Messages are gettext message ids, with %(name)s standing for the
+-- variable name and %% for a percent sign.
+-- @param singular string Message
+-- @param plural string|nil Plural message
+-- @param variables table Variable name -> value expression
+-- @param count string|nil Name of the variable choosing the plural form
+-- @param line number|nil Line number
+-- @param column number|nil Column number
+-- @return table Trans node
+function ast.trans(singular, plural, variables, count, line, column)
+	local node = make_node(N.TRANS, line, column)
+	node.singular = singular
+	node.plural = plural
+	node.variables = variables or {}
+	node.count = count
+	return node
+end
+
 --- Create a do statement node
 -- @param expression table Expression to execute
 -- @param line number|nil Line number
@@ -3,7 +3,9 @@
 -- @module luma.runtime
 
 local sandbox = require("luma.runtime.sandbox")
+local escapers = require("luma.runtime.escapers")
 local context = require("luma.runtime.context")
+local extensions = require("luma.extensions")
 
 local runtime = {}
 
@@ -203,11 +205,38 @@ local HTML_ESCAPES = {
 	["/"] = "&#x2F;",
 }
 
---- Escape HTML special characters and preserve indentation
+--- XML escape sequences
+local XML_ESCAPES = {
+	["&"] = "&amp;",
+	["<"] = "&lt;",
+	[">"] = "&gt;",
+	['"'] = "&quot;",
+	["'"] = "&apos;",
+}
+
+--- Escape functions by autoescape mode
+-- Each takes the value's string form and the original value and returns
+-- the escaped string.
+runtime.escapers = {
+	html = function(str)
+		-- Note: Forward slashes don't need escaping in HTML (only in JS contexts)
+		return (str:gsub("[&<>\"']", HTML_ESCAPES))
+	end,
+	xml = function(str)
+		return (str:gsub("[&<>\"']", XML_ESCAPES))
+	end,
+	yaml = escapers.yaml,
+	json = escapers.json,
+	shell = escapers.shell,
+	hcl = escapers.hcl,
+}
+
+--- Escape special characters and preserve indentation
 -- @param str string String to escape
 -- @param col number|nil Column position for indentation (1-indexed)
+-- @param mode string|boolean|nil Autoescape mode (defaults to "html")
 -- @return string Escaped string with preserved indentation
-function runtime.escape(str, col)
+function runtime.escape(str, col, mode)
 	if str == nil then
 		return ""
 	end
@@ -215,9 +244,14 @@ function runtime.escape(str, col)
 	if type(str) == "table" and str.__luma_safe then
 		str = tostring(str.value or "")
 	else
-		str = tostring(str)
-		-- Note: Forward slashes don't need escaping in HTML (only in JS contexts)
-		str = str:gsub("[&<>\"']", HTML_ESCAPES)
+		if mode == nil or mode == true then
+			mode = "html"
+		end
+		local escaper = runtime.escapers[mode]
+		if not escaper then
+			error("Unknown autoescape mode: " .. tostring(mode))
+		end
+		str = escaper(tostring(str), str)
 	end
 	-- Apply indentation to multiline content if column is provided
 	if col and col > 1 and str:find("\n") then
@@ -227,6 +261,251 @@ function runtime.escape(str, col)
 	return str
 end
 
+--- Get the indentation of the line currently being written
+-- @param out table|nil Output buffer
+-- @return number Number of leading spaces on the current line
+-- @return boolean True if the current line holds only spaces so far
+function runtime.current_indent(out)
+	local parts = {}
+	for i = #(out or {}), 1, -1 do
+		local s = tostring(out[i])
+		local last_newline = s:match(".*()\n")
+		if last_newline then
+			table.insert(parts, 1, s:sub(last_newline + 1))
+			break
+		end
+		table.insert(parts, 1, s)
+	end
+	local line = table.concat(parts)
+	local spaces = line:match("^ *")
+	return #spaces, #spaces == #line
+end
+
+--- Indent every non-blank line of a string
+-- @param str string Text to indent
+-- @param width number Spaces to add to every line after the first
+-- @param first_width number|nil Spaces to add to the first line (defaults to width)
+-- @return string Indented text
+local function indent_lines(str, width, first_width)
+	local prefix = string.rep(" ", width)
+	local i = 0
+	return (str:gsub("([^\n]*)(\n?)", function(line, newline)
+		i = i + 1
+		if line == "" or line:match("^%s*$") then
+			return line .. newline
+		end
+		if i == 1 then
+			return string.rep(" ", first_width or width) .. line .. newline
+		end
+		return prefix .. line .. newline
+	end))
+end
+
+--- Source map collection, see runtime.set_source_maps
+local source_maps_enabled = false
+local source_marks = {} -- output buffer to its marks
+local source_segments = {} -- joined output to the segments it is made of
+
+--- Shift the segments of included output by the indentation added to it
+-- Segments are split by line, leaving the indentation unmapped, and the
+-- locations of template text follow its lines.
+-- @param str string Output before indenting
+-- @param result string Output after indenting
+-- @param width number Indentation of every line but the first
+-- @param first_width number Indentation of the first line
+local function indent_segments(str, result, width, first_width)
+	local segments = source_segments[str]
+	if not segments or result == str then
+		return
+	end
+
+	-- Offsets of the line starts and the indentation added up to them
+	local starts, added = {}, {}
+	local total, i, pos = 0, 0, 0
+	for line, newline in str:gmatch("([^\n]*)(\n?)") do
+		i = i + 1
+		if line ~= "" and not line:match("^%s*$") then
+			total = total + (i == 1 and first_width or width)
+		end
+		starts[i], added[i] = pos, total
+		pos = pos + #line + #newline
+		if newline == "" then
+			break
+		end
+	end
+	starts[#starts + 1] = #str
+
+	local shifted = {}
+	for _, seg in ipairs(segments) do
+		local n = 1
+		while starts[n + 1] <= seg.start and n < #added do
+			n = n + 1
+		end
+		local location, start = seg.location, seg.start
+		while start < seg.stop do
+			local stop = math.min(seg.stop, starts[n + 1])
+			shifted[#shifted + 1] =
+				{ start = start + added[n], stop = stop + added[n], location = location, chain = seg.chain }
+			if location[4] and str:sub(stop, stop) == "\n" then
+				location = { location[1], location[2] + 1, 1, true }
+			end
+			start, n = stop, n + 1
+		end
+	end
+	source_segments[result] = shifted
+end
+
+--- Indent included output to a given width
+-- If the current output line holds only spaces, the first line is padded
+-- up to the width; otherwise it continues the current line unchanged.
+-- @param str string Included output
+-- @param width number|nil Width in spaces; nil uses the directive's own indentation
+-- @param out table Output buffer
+-- @param column number|nil Column of the include directive
+-- @return string Indented output
+function runtime.indent_output(str, width, out, column)
+	local current, blank = runtime.current_indent(out)
+	if not blank then
+		current = nil
+	end
+	if width == nil then
+		width = math.max(current or 0, (column or 1) - 1)
+	end
+	local first_width = current and math.max(width - current, 0) or 0
+	str = tostring(str)
+	local result = indent_lines(str, width, first_width)
+	if source_maps_enabled then
+		indent_segments(str, result, width, first_width)
+	end
+	return result
+end
+
+--- Call a value interpolated as $name(), or render it followed by the
+-- text "()" when it is not callable, as in shell and JavaScript text
+-- @param value any Interpolated value
+-- @return any The call's result, or the value's text and "()"
+function runtime.text_call(value)
+	local mt = type(value) == "table" and getmetatable(value)
+	if type(value) == "function" or (mt and mt.__call) then
+		return value()
+	end
+	return runtime.to_string(value) .. "()"
+end
+
+--- Convert a filter result to output text without escaping
+-- Used for filtered blocks and includes, whose content is already rendered.
+-- @param value any Filter result
+-- @return string Output text
+function runtime.output(value)
+	return runtime.to_string(value)
+end
+
+--- Render an extension directive
+-- @param name string Extension name
+-- @param body string|nil Rendered body, nil without a block
+-- @param named table|nil Named arguments
+-- @param ... any Positional arguments
+-- @return any Extension output
+function runtime.extension(name, body, named, ...)
+	local extension = extensions.get(name)
+	if not extension then
+		error("Unknown extension: " .. name, 0)
+	end
+	local args = { n = select("#", ...), ... }
+	return extension.render(args, named, body)
+end
+
+-- Translator of the current render, see runtime.set_translator
+local translator = nil
+
+--- Set the translator @trans blocks and the translation functions use
+-- Without one, messages are not translated and the plural message is
+-- used for counts other than 1.
+-- @param t table|nil Translator:
+--   gettext: function(message) returning the translation
+--   ngettext: function(singular, plural, n) returning the translation
+function runtime.set_translator(t)
+	translator = t
+end
+
+--- Translate a message
+-- @param singular string Message
+-- @param plural string|nil Plural message
+-- @param n any Count choosing between the forms
+-- @return string Translation
+local function translate_message(singular, plural, n)
+	if plural then
+		n = tonumber(n) or 0
+		if translator and translator.ngettext then
+			return tostring(translator.ngettext(singular, plural, n))
+		end
+		return n == 1 and singular or plural
+	end
+	if translator and translator.gettext then
+		return tostring(translator.gettext(singular))
+	end
+	return singular
+end
+
+--- Substitute the variables of a translated message
+-- @param message string Message with %(name)s placeholders and %% for %
+-- @param vars table|nil Variable values
+-- @param convert function Converts a value to text
+-- @return string Formatted message
+local function format_message(message, vars, convert)
+	vars = vars or {}
+	message = message:gsub("%%%%", "\1")
+	message = message:gsub("%%%(([%w_]+)%)s", function(name)
+		return convert(vars[name])
+	end)
+	return (message:gsub("\1", "%%"))
+end
+
+--- Convert a variable of a translation function to text
+local function message_value(value)
+	if value == nil then
+		return ""
+	end
+	return runtime.to_string(value)
+end
+
+--- Translate a message, like gettext
+-- Available to templates as _() and gettext().
+-- @param message string Message
+-- @param vars table|nil Named arguments, substituted for %(name)s
+-- @return string Translation
+function runtime.gettext(message, vars)
+	return format_message(translate_message(tostring(message)), vars, message_value)
+end
+
+--- Translate a message with a plural form, like ngettext
+-- Available to templates as ngettext(). n is also substituted for
+-- %(num)s.
+-- @param singular string Message
+-- @param plural string Plural message
+-- @param n number Count choosing between the forms
+-- @param vars table|nil Named arguments, substituted for %(name)s
+-- @return string Translation
+function runtime.ngettext(singular, plural, n, vars)
+	local all = { num = n }
+	for name, value in pairs(vars or {}) do
+		all[name] = value
+	end
+	return format_message(translate_message(tostring(singular), tostring(plural), n), all, message_value)
+end
+
+--- Translate the message of a @trans block
+-- The translation is trusted; only the variables are escaped.
+-- @param singular string Message
+-- @param plural string|nil Plural message
+-- @param n any Count choosing between the forms
+-- @param vars table Variable values
+-- @param escape function Escapes a value for output
+-- @return string Output text
+function runtime.translate(singular, plural, n, vars, escape)
+	return format_message(translate_message(singular, plural, n), vars, escape)
+end
+
 --- Mark a string as safe (no escaping)
 -- @param str string String to mark as safe
 -- @return table Safe string wrapper
@@ -306,9 +585,28 @@ end
 --- Template cache for includes
 local template_cache = {}
 
+--- Templates that depend on each template, by name
+-- dependents[name][other] is true when other includes, imports or extends name
+local dependents = {}
+
+--- Names of the included or imported templates being rendered, innermost last
+local rendering = {}
+
 --- Loader configuration
 local loader_paths = { "." }
 local custom_loader = nil
+local file_loading = true
+
+--- Autoescape configuration
+local autoescape_setting = true
+
+--- Instrumentation hooks, see runtime.set_hooks
+local hooks = nil
+
+--- Coverage collection, see runtime.set_coverage
+local coverage_enabled = false
+local coverage_counters = {} -- probe set key to { probes, counts, reported }
+local coverage_sources = {} -- template name to source, "" for unnamed
 
 --- Add a path to search for templates
 -- @param path string Directory path
@@ -328,6 +626,34 @@ function runtime.set_loader(loader)
 	custom_loader = loader
 end
 
+--- Set the autoescape mode for templates compiled without one
+-- @param setting boolean|string|function true or "html", "xml", another
+--   escaper name, false or "off", or a function(name) returning one of these
+function runtime.set_autoescape(setting)
+	autoescape_setting = setting
+end
+
+--- Get the autoescape mode for a template
+-- @param name string|nil Template name
+-- @return boolean|string false when disabled, true for HTML, or a mode name
+function runtime.autoescape_mode(name)
+	local mode = autoescape_setting
+	if type(mode) == "function" then
+		mode = mode(name)
+	end
+	if not mode or mode == "off" then
+		return false
+	end
+	return mode
+end
+
+--- Enable or disable reading templates from the file system
+-- When disabled, only the custom loader can provide templates.
+-- @param enabled boolean Whether templates may be read from disk
+function runtime.set_file_loading(enabled)
+	file_loading = enabled
+end
+
 --- Load a template source by name
 -- @param name string Template name
 -- @return string|nil Template source or nil if not found
@@ -341,6 +667,10 @@ function runtime.load_source(name)
 		end
 	end
 
+	if not file_loading or not io then
+		return nil, "Template not found: " .. name
+	end
+
 	-- If name is an absolute path, try it directly first
 	if name:sub(1, 1) == "/" or name:match("^[A-Za-z]:") then
 		local file = io.open(name, "r")
@@ -365,11 +695,39 @@ function runtime.load_source(name)
 	return nil, "Template not found: " .. name
 end
 
+--- Record that one template includes, imports or extends another
+-- @param name string Name of the template depended on
+-- @param dependent string|nil Name of the template depending on it
+function runtime.add_dependency(name, dependent)
+	if not dependent or dependent == name then
+		return
+	end
+	dependents[name] = dependents[name] or {}
+	dependents[name][dependent] = true
+end
+
+--- Render a compiled template as the named template, so the templates
+-- it includes and imports are recorded as its dependencies
+-- @param name string Template name
+-- @param compiled table Compiled template
+-- @param ctx table Context
+-- @param filters table Filters
+-- @param macros table|nil Table receiving the template's macros
+-- @return string Rendered output
+local function render_as(name, compiled, ctx, filters, macros)
+	rendering[#rendering + 1] = name
+	local ok, result = pcall(compiled.render, compiled, ctx, filters, runtime, macros)
+	rendering[#rendering] = nil
+	if not ok then
+		error(result, 0)
+	end
+	return result
+end
+
 --- Include another template
--- @param name string Template name to include
--- @param ctx table Context to pass
--- @return string Rendered template
-function runtime.include(name, ctx)
+local function include(name, ctx)
+	runtime.add_dependency(name, rendering[#rendering])
+
 	-- Check cache
 	local compiled = template_cache[name]
 
@@ -387,13 +745,21 @@ function runtime.include(name, ctx)
 
 	-- Render with context
 	local filters = require("luma.filters")
-	return compiled:render(ctx, filters.get_all(), runtime)
+	return render_as(name, compiled, ctx, filters.get_all())
+end
+
+--- Include another template
+-- @param name string Template name to include
+-- @param ctx table Context to pass
+-- @return string Rendered template
+function runtime.include(name, ctx)
+	return runtime.instrumented("include", name, include, name, ctx)
 end
 
 --- Import macros from another template
--- @param name string Template name to import
--- @return table Table with __macros containing the macros from the template
-function runtime.import(name)
+local function import(name)
+	runtime.add_dependency(name, rendering[#rendering])
+
 	-- Check cache for imported macros
 	local cache_key = "__import_" .. name
 	local cached = template_cache[cache_key]
@@ -419,7 +785,7 @@ function runtime.import(name)
 	local filters = require("luma.filters")
 
 	-- Render the template (output is not needed, we just want the macros and variables)
-	local _ = compiled:render(ctx, filters.get_all(), runtime, macros_table)
+	local _ = render_as(name, compiled, ctx, filters.get_all(), macros_table)
 
 	-- The result needs to have both direct macro access and __macros
 	local result = {
@@ -445,6 +811,13 @@ function runtime.import(name)
 	return result
 end
 
+--- Import macros from another template
+-- @param name string Template name to import
+-- @return table Table with __macros containing the macros from the template
+function runtime.import(name)
+	return runtime.instrumented("include", name, import, name)
+end
+
 --- Import all macros from another template into target
 -- @param name string Template name to import
 -- @param target table Target macros table
@@ -458,6 +831,399 @@ end
 --- Clear the template cache
 function runtime.clear_cache()
 	template_cache = {}
+	dependents = {}
+end
+
+--- Drop a template from the cache, along with every cached template
+-- that includes, imports or extends it, directly or indirectly
+-- @param name string Name of the changed template
+function runtime.invalidate(name)
+	local seen = {}
+	local function drop(n)
+		if seen[n] then
+			return
+		end
+		seen[n] = true
+		template_cache[n] = nil
+		template_cache["__import_" .. n] = nil
+		for dependent in pairs(dependents[n] or {}) do
+			drop(dependent)
+		end
+	end
+	drop(name)
+end
+
+--- Enable or disable coverage collection
+-- Templates compiled while coverage is enabled count how often their
+-- lines, if and for branches and macros run; see runtime.take_coverage.
+-- Templates compiled before are not instrumented, so clear the cache
+-- after enabling coverage.
+-- @param enabled boolean Whether to collect coverage
+function runtime.set_coverage(enabled)
+	coverage_enabled = enabled and true or false
+end
+
+--- Check whether coverage collection is enabled
+-- @return boolean True when templates are compiled with coverage probes
+function runtime.coverage_enabled()
+	return coverage_enabled
+end
+
+--- Record the source of a template compiled with coverage probes
+-- @param name string|nil Template name, nil for unnamed templates
+-- @param source string|nil Template source
+function runtime.coverage_source(name, source)
+	if source then
+		coverage_sources[name or ""] = source
+	end
+end
+
+--- Get the counters for a set of coverage probes
+-- Called by instrumented templates; templates with identical probes
+-- share their counters.
+-- @param probes table Probe descriptions generated by the compiler
+-- @return table Counters, one per probe
+function runtime.coverage_counters(probes)
+	local parts = {}
+	for i, p in ipairs(probes) do
+		parts[i] = table.concat({ p[1], tostring(p[2]), p[3], p[4], p[5], p[6] }, "\1")
+	end
+	local key = table.concat(parts, "\2")
+
+	local entry = coverage_counters[key]
+	if not entry then
+		local counts = {}
+		for i = 1, #probes do
+			counts[i] = 0
+		end
+		entry = { probes = probes, counts = counts }
+		coverage_counters[key] = entry
+	end
+	return entry.counts
+end
+
+--- Take the coverage collected since the last call
+-- Returns the probe sets that were hit or are new since the last call,
+-- with their counts, and resets the counts. Each probe is described by
+-- { kind, template, line, x, y, name } (see the compiler's codegen).
+-- @return table Array of { probes = ..., counts = ... }
+-- @return table Sources of the instrumented templates, by name
+function runtime.take_coverage()
+	local taken = {}
+	for _, entry in pairs(coverage_counters) do
+		local counts = {}
+		local hit = false
+		for i, n in ipairs(entry.counts) do
+			counts[i] = n
+			if n > 0 then
+				hit = true
+				entry.counts[i] = 0
+			end
+		end
+		if hit or not entry.reported then
+			entry.reported = true
+			taken[#taken + 1] = { probes = entry.probes, counts = counts }
+		end
+	end
+	local sources = coverage_sources
+	coverage_sources = {}
+	return taken, sources
+end
+
+--- Enable or disable source maps
+-- Templates compiled while source maps are enabled record where each part
+-- of their output comes from; see runtime.take_source_map. Templates
+-- compiled before do not, so clear the cache after enabling source maps.
+-- @param enabled boolean Whether to record source maps
+function runtime.set_source_maps(enabled)
+	source_maps_enabled = enabled and true or false
+	source_marks = {}
+	source_segments = {}
+end
+
+--- Check whether source maps are enabled
+-- @return boolean True when templates are compiled with source marks
+function runtime.source_maps_enabled()
+	return source_maps_enabled
+end
+
+--- Record that the output appended next to a buffer comes from a location
+-- Called by templates compiled with source maps.
+-- @param out table Output buffer
+-- @param location table { template, line, column, literal }
+function runtime.source_mark(out, location)
+	if not source_maps_enabled then
+		return
+	end
+	local marks = source_marks[out]
+	if not marks then
+		marks = {}
+		source_marks[out] = marks
+	end
+	marks[#marks + 1] = { #out, location }
+end
+
+--- Join an output buffer and record the segments the result is made of
+-- Parts that are themselves joined output, such as included templates and
+-- macro calls, contribute their own segments, with the location of the
+-- part added to their chain.
+-- @param out table Output buffer
+-- @return string Joined output
+function runtime.source_map_output(out)
+	local result = table.concat(out)
+	if not source_maps_enabled then
+		return result
+	end
+	local marks = source_marks[out] or {}
+	source_marks[out] = nil
+
+	local segments = {}
+	local function add(start, stop, location, chain)
+		local last = segments[#segments]
+		if last and last.stop == start and last.location == location and last.chain == chain then
+			last.stop = stop
+		else
+			segments[#segments + 1] = { start = start, stop = stop, location = location, chain = chain }
+		end
+	end
+
+	local offset, m, location = 0, 1, nil
+	for i, part in ipairs(out) do
+		while marks[m] and marks[m][1] < i do
+			location = marks[m][2]
+			m = m + 1
+		end
+		part = tostring(part)
+		local nested = part ~= "" and source_segments[part]
+		if nested and location then
+			for _, seg in ipairs(nested) do
+				local chain = { location }
+				for _, l in ipairs(seg.chain or {}) do
+					chain[#chain + 1] = l
+				end
+				segments[#segments + 1] =
+					{ start = offset + seg.start, stop = offset + seg.stop, location = seg.location, chain = chain }
+			end
+		elseif nested then
+			for _, seg in ipairs(nested) do
+				add(offset + seg.start, offset + seg.stop, seg.location, seg.chain)
+			end
+		elseif location and #part > 0 then
+			add(offset, offset + #part, location, nil)
+		end
+		offset = offset + #part
+	end
+
+	if result ~= "" then
+		source_segments[result] = segments
+	end
+	return result
+end
+
+--- Take the source map of a render's output
+-- Returns the segments of output: byte ranges, zero-based and exclusive
+-- at the end, each with the location it came from and the chain of
+-- include and macro call sites leading to it, outermost first. Locations
+-- are { template, line, column, literal }, where template is false for
+-- unnamed templates and literal is true for template text, whose later
+-- lines follow the location's line. Everything recorded so far is
+-- discarded, so call this after each render.
+-- @param output string Rendered output
+-- @return table|nil Array of { start, stop, location, chain }
+function runtime.take_source_map(output)
+	local segments = source_segments[output]
+	source_marks = {}
+	source_segments = {}
+	return segments
+end
+
+--- Access tracking, see runtime.set_access_tracking
+local access_tracking = false
+local access = nil -- reads of the current tracked render
+
+--- Enable or disable access tracking
+-- Templates compiled while access tracking is enabled report the context
+-- values they read; see runtime.begin_access. Templates compiled before
+-- do not, so clear the cache after enabling it.
+-- @param enabled boolean Whether to compile templates with tracking
+function runtime.set_access_tracking(enabled)
+	access_tracking = enabled and true or false
+	access = nil
+end
+
+--- Check whether access tracking is enabled
+-- @return boolean True when templates are compiled with tracking
+function runtime.access_tracking_enabled()
+	return access_tracking
+end
+
+--- Start recording the context values a render reads
+-- @param roots table Set of the names the context itself provides, as
+--   opposed to globals and template variables
+function runtime.begin_access(roots)
+	access = {
+		roots = roots,
+		paths = setmetatable({}, { __mode = "k" }), -- table to its path
+		expanded = setmetatable({}, { __mode = "k" }), -- tables whose children have paths
+		reads = {},
+	}
+end
+
+--- Take the reads recorded since runtime.begin_access
+-- Paths are like a.b[0].c, with zero-based list indexes; reads of other
+-- numeric keys are left out. Each read has:
+--   found: true if the value exists
+--   whole: true if the value was used as a whole, rather than looked into
+--   iterated: true if a loop iterated over the value
+-- @return table Map of path to read
+function runtime.take_access()
+	local reads = access and access.reads or {}
+	access = nil
+	return reads
+end
+
+--- The path of a value under a path
+-- @return string|nil The path, nil for numeric keys that are not list
+--   indexes, which no context value has
+local function access_child(path, key)
+	if type(key) == "number" then
+		if key < 1 or key % 1 ~= 0 then
+			return nil
+		end
+		return path .. "[" .. (key - 1) .. "]"
+	end
+	return path .. "." .. tostring(key)
+end
+
+--- Record a read of the value at a path
+-- Tables read get their path, and so do the tables in them, so that
+-- reads through loop variables have paths too.
+local function access_record(path, value, mode)
+	local read = access.reads[path]
+	if not read then
+		read = { found = false, whole = false, iterated = false }
+		access.reads[path] = read
+	end
+	if value ~= nil then
+		read.found = true
+	end
+	if mode == "iter" then
+		read.iterated = true
+	elseif mode == nil then
+		read.whole = true
+	end
+
+	if type(value) == "table" then
+		access.paths[value] = path
+		if not access.expanded[value] then
+			access.expanded[value] = true
+			for k, v in pairs(value) do
+				if type(v) == "table" and access.paths[v] == nil then
+					access.paths[v] = access_child(path, k)
+				end
+			end
+		end
+	end
+end
+
+--- Read a name from a template context, recording context reads
+-- Called by templates compiled with access tracking.
+-- @param name string Name read
+-- @param value any Its value
+-- @param mode string|nil How the value is used: "nav" when looked into,
+--   "iter" when iterated over, nil when used whole
+-- @return any The value
+function runtime.access_name(name, value, mode)
+	if access and (access.roots[name] or value == nil) then
+		access_record(name, value, mode)
+	end
+	return value
+end
+
+--- Read a member of a value, recording it if the value came from the
+-- context
+-- Called by templates compiled with access tracking.
+-- @param obj any Value read from
+-- @param key any Member name or index
+-- @param mode string|nil How the member is used, as for access_name
+-- @return any The member, or obj if it is nil or false
+function runtime.access_member(obj, key, mode)
+	if not obj then
+		return obj
+	end
+	local value = obj[key]
+	local path = access and type(obj) == "table" and access.paths[obj]
+	path = path and access_child(path, key)
+	if path then
+		access_record(path, value, mode)
+	end
+	return value
+end
+
+--- Set the instrumentation hooks
+-- hooks.start(kind, name) is called before and hooks.finish(kind, name,
+-- size, err) after each compile, include, import and filter call; kind
+-- is "compile", "include" or "filter". size is the length of the output,
+-- or of the generated code for compiles, and err the error message of a
+-- failed call. Pass nil to remove the hooks.
+-- @param h table|nil Hooks
+function runtime.set_hooks(h)
+	hooks = h
+end
+
+--- Report the end of an instrumented call to the hooks and pass on its
+-- results or error
+local function finish_hook(h, kind, name, ok, ...)
+	if not ok then
+		local err = ...
+		h.finish(kind, name, 0, tostring(err))
+		error(err, 0)
+	end
+	local result = ...
+	local size = 0
+	if type(result) == "string" then
+		size = #result
+	elseif type(result) == "table" and type(result.source) == "string" then
+		size = #result.source
+	end
+	h.finish(kind, name, size, nil)
+	return ...
+end
+
+--- Call fn(...), reporting the call to the instrumentation hooks
+-- @param kind string Kind of call
+-- @param name string|nil Template or filter name, nil for unnamed templates
+-- @param fn function Function to call
+-- @return any Results of fn
+function runtime.instrumented(kind, name, fn, ...)
+	local h = hooks
+	if not h then
+		return fn(...)
+	end
+	h.start(kind, name)
+	return finish_hook(h, kind, name, pcall(fn, ...))
+end
+
+--- Wrap a filter table so filter calls are reported to the hooks
+-- @param filters table Filter functions
+-- @return table The filters, instrumented when hooks are set
+function runtime.instrument_filters(filters)
+	if not hooks then
+		return filters
+	end
+	return setmetatable({}, {
+		__index = function(proxy, name)
+			local fn = filters[name]
+			if type(fn) ~= "function" then
+				return fn
+			end
+			local wrapped = function(...)
+				return runtime.instrumented("filter", name, fn, ...)
+			end
+			rawset(proxy, name, wrapped)
+			return wrapped
+		end,
+	})
 end
 
 --- Create a default set of built-in tests
@@ -641,13 +1407,13 @@ function runtime.default_filters()
 
 		-- Default value
 		default = function(v, default_val)
-			if v == nil or v == "" then
+			if v == nil or v == "" or type(v) == "function" then
 				return default_val
 			end
 			return v
 		end,
 		d = function(v, default_val)
-			if v == nil or v == "" then
+			if v == nil or v == "" or type(v) == "function" then
 				return default_val
 			end
 			return v
@@ -853,6 +1619,17 @@ function runtime.default_filters()
 			-- Remove trailing newline we added
 			return table.concat(lines, "\n")
 		end,
+		nindent = function(s, ...)
+			-- Newline followed by the value indented by width spaces. Without a
+			-- width, generated code passes two spaces deeper than the current
+			-- output line.
+			local pos, named = extract_filter_args({ ... }, 1)
+			local result = "\n" .. indent_lines(runtime.to_string(s), named.width or pos[1] or 2)
+			if runtime.is_safe(s) then
+				return runtime.safe(result)
+			end
+			return result
+		end,
 		truncate = function(s, ...)
 			-- Support both positional and named arguments
 			-- Positional: truncate(s, length, killwords, end_str)
@@ -1054,6 +1831,21 @@ function runtime.default_filters()
 			return result
 		end,
 
+		-- Output format quoting filters
+		-- Results are marked safe so autoescaping does not quote them again
+		json = function(v)
+			return runtime.safe(escapers.encode_json(v, { html_safe = true }))
+		end,
+		yaml_quote = function(v)
+			return runtime.safe(escapers.yaml_quote(runtime.to_string(v)))
+		end,
+		shell_quote = function(v)
+			return runtime.safe(escapers.shell_quote(runtime.to_string(v)))
+		end,
+		hcl_quote = function(v)
+			return runtime.safe(escapers.hcl_quote(runtime.to_string(v)))
+		end,
+
 		-- Utility filters
 		tojson = function(v, indent_val)
 			local function encode(val, level)
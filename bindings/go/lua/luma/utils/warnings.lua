@@ -7,6 +7,16 @@ local warnings = {}
 -- Track which warnings have been shown (per process)
 local shown_warnings = {}
 
+--- Read an environment variable, if the os library is available
+-- @param name string Variable name
+-- @return string|nil Variable value
+local function getenv(name)
+	if os and os.getenv then
+		return os.getenv(name)
+	end
+	return nil
+end
+
 --- Check if warning should be suppressed
 -- @param key string Warning key
 -- @param options table|nil User options
@@ -19,12 +29,12 @@ local function is_suppressed(key, options)
 
 	-- Check environment variable
 	local env_var = "LUMA_NO_" .. key:upper() .. "_WARNING"
-	if os.getenv(env_var) == "1" then
+	if getenv(env_var) == "1" then
 		return true
 	end
 
 	-- Check global suppression
-	if os.getenv("LUMA_NO_WARNINGS") == "1" then
+	if getenv("LUMA_NO_WARNINGS") == "1" then
 		return true
 	end
 
@@ -53,7 +63,10 @@ local function emit(key, message, options)
 	-- Mark as shown
 	shown_warnings[key] = true
 
-	-- Output to stderr
+	-- Output to stderr, if the io library is available
+	if not io then
+		return
+	end
 	io.stderr:write("\n")
 	io.stderr:write(message)
 	io.stderr:write("\n\n")
@@ -16,7 +16,6 @@ package luma
 
 import (
 	_ "embed"
-	"fmt"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -30,6 +29,9 @@ var lumaCompilerInit string
 //go:embed lua/luma/compiler/codegen.lua
 var lumaCompilerCodegen string
 
+//go:embed lua/luma/compiler/analysis.lua
+var lumaCompilerAnalysis string
+
 //go:embed lua/luma/lexer/init.lua
 var lumaLexerInit string
 
@@ -66,9 +68,15 @@ var lumaRuntimeContext string
 //go:embed lua/luma/runtime/sandbox.lua
 var lumaRuntimeSandbox string
 
+//go:embed lua/luma/runtime/escapers.lua
+var lumaRuntimeEscapers string
+
 //go:embed lua/luma/filters/init.lua
 var lumaFiltersInit string
 
+//go:embed lua/luma/extensions/init.lua
+var lumaExtensionsInit string
+
 //go:embed lua/luma/utils/init.lua
 var lumaUtilsInit string
 
@@ -87,32 +95,7 @@ var lumaVersion string
 // Render renders a template string with the given context.
 // This is the simplest way to render a template.
 func Render(template string, context interface{}) (string, error) {
-	L := lua.NewState()
-	defer L.Close()
-
-	if err := loadLumaModules(L); err != nil {
-		return "", fmt.Errorf("failed to load Luma modules: %w", err)
-	}
-
-	// Convert context to Lua table
-	ctxTable := goToLua(L, context)
-	L.SetGlobal("__go_context", ctxTable)
-
-	// Call luma.render(template, context)
-	luaCode := fmt.Sprintf(`
-		local luma = require("luma")
-		local template = %q
-		local context = __go_context
-		return luma.render(template, context)
-	`, template)
-
-	if err := L.DoString(luaCode); err != nil {
-		return "", fmt.Errorf("render error: %w", err)
-	}
-
-	result := L.ToString(-1)
-	L.Pop(1)
-	return result, nil
+	return defaultEnvironment.Render(template, context)
 }
 
 // loadLumaModules loads all Luma Lua modules into the Lua state
@@ -122,6 +105,7 @@ func loadLumaModules(L *lua.LState) error {
 		"luma.version":                 lumaVersion,
 		"luma.compiler.init":           lumaCompilerInit,
 		"luma.compiler.codegen":        lumaCompilerCodegen,
+		"luma.compiler.analysis":       lumaCompilerAnalysis,
 		"luma.lexer.init":              lumaLexerInit,
 		"luma.lexer.native":            lumaLexerNative,
 		"luma.lexer.jinja":             lumaLexerJinja,
@@ -134,7 +118,9 @@ func loadLumaModules(L *lua.LState) error {
 		"luma.runtime.init":            lumaRuntimeInit,
 		"luma.runtime.context":         lumaRuntimeContext,
 		"luma.runtime.sandbox":         lumaRuntimeSandbox,
+		"luma.runtime.escapers":        lumaRuntimeEscapers,
 		"luma.filters.init":            lumaFiltersInit,
+		"luma.extensions.init":         lumaExtensionsInit,
 		"luma.utils.init":              lumaUtilsInit,
 		"luma.utils.errors":            lumaUtilsErrors,
 		"luma.utils.compat":            lumaUtilsCompat,
@@ -165,38 +151,3 @@ func loadLumaModules(L *lua.LState) error {
 
 	return nil
 }
-
-// goToLua converts a Go value to a Lua value
-func goToLua(L *lua.LState, val interface{}) lua.LValue {
-	if val == nil {
-		return lua.LNil
-	}
-
-	switch v := val.(type) {
-	case bool:
-		return lua.LBool(v)
-	case int:
-		return lua.LNumber(v)
-	case int64:
-		return lua.LNumber(v)
-	case float64:
-		return lua.LNumber(v)
-	case string:
-		return lua.LString(v)
-	case []interface{}:
-		tbl := L.NewTable()
-		for i, item := range v {
-			tbl.RawSetInt(i+1, goToLua(L, item))
-		}
-		return tbl
-	case map[string]interface{}:
-		tbl := L.NewTable()
-		for key, item := range v {
-			tbl.RawSetString(key, goToLua(L, item))
-		}
-		return tbl
-	default:
-		// Try to handle as generic map or slice using reflection
-		return lua.LString(fmt.Sprintf("%v", v))
-	}
-}
@@ -0,0 +1,368 @@
+package luma
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Profiler is a Hooks implementation that aggregates the time spent in
+// each template, include and filter. Install it with Options.Hooks, run
+// the renders to measure, then print a Report or write a pprof profile.
+// A Profiler is safe for concurrent use.
+//
+// Example:
+//
+//	prof := luma.NewProfiler()
+//	env := luma.NewEnvironment(luma.Options{Loader: loader, Hooks: prof})
+//	env.RenderAll(names, values)
+//	prof.Report(os.Stdout)
+type Profiler struct {
+	mu      sync.Mutex
+	start   time.Time
+	stats   map[string]map[string]*ProfileStat // by kind and name
+	samples map[string]*profileSample          // by stack
+}
+
+// ProfileStat aggregates the calls to one template, include or filter.
+type ProfileStat struct {
+	Name   string
+	Calls  int
+	Errors int
+	// Total is the time spent in the calls, Self the part of it not
+	// spent in nested includes and filters.
+	Total time.Duration
+	Self  time.Duration
+	Max   time.Duration
+	// Bytes is the total size of what the calls produced.
+	Bytes int64
+}
+
+// Mean returns the average duration of a call.
+func (s ProfileStat) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// ProfileStats holds a Profiler's statistics, each list sorted by total
+// time, longest first.
+type ProfileStats struct {
+	Templates []ProfileStat // top-level renders
+	Compiles  []ProfileStat
+	Includes  []ProfileStat // includes and imports
+	Filters   []ProfileStat
+}
+
+// profileSample accumulates the events with the same stack
+type profileSample struct {
+	frames []string // outermost first
+	count  int64
+	nanos  int64
+}
+
+// NewProfiler returns an empty Profiler.
+func NewProfiler() *Profiler {
+	p := &Profiler{}
+	p.Reset()
+	return p
+}
+
+// Reset discards everything recorded so far.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = time.Now()
+	p.stats = make(map[string]map[string]*ProfileStat)
+	p.samples = make(map[string]*profileSample)
+}
+
+// OnCompile implements Hooks.
+func (p *Profiler) OnCompile(e Event) {
+	p.record(hookCompile, "compile "+templateLabel(e.Name), e)
+}
+
+// OnRenderStart implements Hooks.
+func (p *Profiler) OnRenderStart(Event) {}
+
+// OnRenderEnd implements Hooks.
+func (p *Profiler) OnRenderEnd(e Event) {
+	p.record(hookRender, templateLabel(e.Name), e)
+}
+
+// OnInclude implements Hooks.
+func (p *Profiler) OnInclude(e Event) {
+	p.record(hookInclude, templateLabel(e.Name), e)
+}
+
+// OnFilter implements Hooks.
+func (p *Profiler) OnFilter(e Event) {
+	p.record(hookFilter, "filter "+e.Name, e)
+}
+
+// templateLabel names a template in reports
+func templateLabel(name string) string {
+	if name == "" {
+		return "<string>"
+	}
+	return name
+}
+
+// record adds an event to the statistics of its kind and to the samples
+// of its stack, labelled leaf
+func (p *Profiler) record(kind, leaf string, e Event) {
+	frames := make([]string, 0, len(e.Stack)+1)
+	for _, name := range e.Stack {
+		frames = append(frames, templateLabel(name))
+	}
+	frames = append(frames, leaf)
+	key := strings.Join(frames, "\x00")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byName := p.stats[kind]
+	if byName == nil {
+		byName = make(map[string]*ProfileStat)
+		p.stats[kind] = byName
+	}
+	name := templateLabel(e.Name)
+	stat := byName[name]
+	if stat == nil {
+		stat = &ProfileStat{Name: name}
+		byName[name] = stat
+	}
+	stat.Calls++
+	if e.Err != nil {
+		stat.Errors++
+	}
+	stat.Total += e.Duration
+	stat.Self += e.Self
+	if e.Duration > stat.Max {
+		stat.Max = e.Duration
+	}
+	stat.Bytes += int64(e.Size)
+
+	sample := p.samples[key]
+	if sample == nil {
+		sample = &profileSample{frames: frames}
+		p.samples[key] = sample
+	}
+	sample.count++
+	sample.nanos += int64(e.Self)
+}
+
+// Stats returns the statistics recorded so far.
+func (p *Profiler) Stats() ProfileStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ProfileStats{
+		Templates: p.sorted(hookRender),
+		Compiles:  p.sorted(hookCompile),
+		Includes:  p.sorted(hookInclude),
+		Filters:   p.sorted(hookFilter),
+	}
+}
+
+// sorted returns the statistics of a kind, longest total first.
+// p.mu must be held.
+func (p *Profiler) sorted(kind string) []ProfileStat {
+	stats := make([]ProfileStat, 0, len(p.stats[kind]))
+	for _, s := range p.stats[kind] {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Report writes the statistics as tables, one per kind of call.
+func (p *Profiler) Report(w io.Writer) error {
+	stats := p.Stats()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	sections := []struct {
+		title string
+		stats []ProfileStat
+	}{
+		{"Templates", stats.Templates},
+		{"Compiles", stats.Compiles},
+		{"Includes", stats.Includes},
+		{"Filters", stats.Filters},
+	}
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s\t\n", section.title)
+		fmt.Fprintln(tw, "calls\ttotal\tself\tmean\tmax\tbytes\terrors\tname\t")
+		for _, s := range section.stats {
+			fmt.Fprintf(tw, "%d\t%v\t%v\t%v\t%v\t%d\t%d\t%s\t\n",
+				s.Calls, roundDuration(s.Total), roundDuration(s.Self), roundDuration(s.Mean()),
+				roundDuration(s.Max), s.Bytes, s.Errors, s.Name)
+		}
+	}
+	return tw.Flush()
+}
+
+// roundDuration trims durations to a readable precision
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	default:
+		return d
+	}
+}
+
+// WriteProfile writes the recorded calls as a gzipped pprof profile, so
+// they can be explored with go tool pprof. Each sample is a stack of
+// templates ending in a template, include, compile or filter, valued by
+// the number of calls and their self time.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	p.mu.Lock()
+	start := p.start
+	samples := make([]profileSample, 0, len(p.samples))
+	for _, s := range p.samples {
+		samples = append(samples, *s)
+	}
+	p.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].frames, "\x00") < strings.Join(samples[j].frames, "\x00")
+	})
+
+	var b profileEncoder
+	b.init()
+	calls, count := b.str("calls"), b.str("count")
+	wall, nanos := b.str("wall"), b.str("nanoseconds")
+	b.message(1, func(b *profileEncoder) { b.int(1, calls); b.int(2, count) })
+	b.message(1, func(b *profileEncoder) { b.int(1, wall); b.int(2, nanos) })
+
+	// One function and location per distinct frame label
+	ids := make(map[string]uint64)
+	var labels []string
+	for _, s := range samples {
+		for _, f := range s.frames {
+			if ids[f] == 0 {
+				labels = append(labels, f)
+				ids[f] = uint64(len(labels))
+			}
+		}
+	}
+
+	for _, s := range samples {
+		b.message(2, func(b *profileEncoder) {
+			locations := make([]uint64, len(s.frames))
+			for i, f := range s.frames {
+				// pprof stacks start at the leaf
+				locations[len(s.frames)-1-i] = ids[f]
+			}
+			b.packed(1, locations)
+			b.packed(2, []uint64{uint64(s.count), uint64(s.nanos)})
+		})
+	}
+	for i, label := range labels {
+		id := uint64(i + 1)
+		b.message(4, func(b *profileEncoder) {
+			b.int(1, id)
+			b.message(4, func(b *profileEncoder) { b.int(1, id) })
+		})
+		name := b.str(label)
+		b.message(5, func(b *profileEncoder) {
+			b.int(1, id)
+			b.int(2, name)
+			b.int(3, name)
+		})
+	}
+
+	b.stringTable()
+	b.int(9, uint64(start.UnixNano()))
+	b.int(10, uint64(time.Since(start)))
+	b.message(11, func(b *profileEncoder) { b.int(1, wall); b.int(2, nanos) })
+	b.int(12, 1)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// profileEncoder writes the protocol buffer encoding of a pprof profile
+type profileEncoder struct {
+	buf     []byte
+	table   []string
+	indexes map[string]uint64
+}
+
+func (b *profileEncoder) init() {
+	b.table = []string{""}
+	b.indexes = map[string]uint64{"": 0}
+}
+
+// str returns the string table index of s
+func (b *profileEncoder) str(s string) uint64 {
+	if i, ok := b.indexes[s]; ok {
+		return i
+	}
+	i := uint64(len(b.table))
+	b.table = append(b.table, s)
+	b.indexes[s] = i
+	return i
+}
+
+func (b *profileEncoder) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+// int writes a varint field
+func (b *profileEncoder) int(tag int, x uint64) {
+	b.varint(uint64(tag) << 3)
+	b.varint(x)
+}
+
+// bytes writes a length-delimited field
+func (b *profileEncoder) bytes(tag int, data []byte) {
+	b.varint(uint64(tag)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+// message writes an embedded message field
+func (b *profileEncoder) message(tag int, fill func(*profileEncoder)) {
+	inner := profileEncoder{table: b.table, indexes: b.indexes}
+	fill(&inner)
+	b.table = inner.table
+	b.bytes(tag, inner.buf)
+}
+
+// packed writes a packed repeated varint field
+func (b *profileEncoder) packed(tag int, xs []uint64) {
+	inner := profileEncoder{}
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.bytes(tag, inner.buf)
+}
+
+// stringTable writes the string table
+func (b *profileEncoder) stringTable() {
+	for _, s := range b.table {
+		b.bytes(6, []byte(s))
+	}
+}
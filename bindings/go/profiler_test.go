@@ -0,0 +1,155 @@
+package luma_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+// recordingHooks records the events it receives
+type recordingHooks struct {
+	luma.NoopHooks
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHooks) add(kind string, e luma.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	event := kind + " " + e.Name + " [" + strings.Join(e.Stack, ",") + "]"
+	if e.Err != nil {
+		event += " error"
+	}
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHooks) OnCompile(e luma.Event)     { h.add("compile", e) }
+func (h *recordingHooks) OnRenderStart(e luma.Event) { h.add("start", e) }
+func (h *recordingHooks) OnRenderEnd(e luma.Event)   { h.add("end", e) }
+func (h *recordingHooks) OnInclude(e luma.Event)     { h.add("include", e) }
+func (h *recordingHooks) OnFilter(e luma.Event)      { h.add("filter", e) }
+
+var profiledTemplates = luma.MapLoader{
+	"page.luma":   "@include \"header.luma\"\n${body | upper}",
+	"header.luma": "${title | lower}",
+	"broken.luma": "@include \"missing.luma\"",
+}
+
+func TestHooks(t *testing.T) {
+	hooks := &recordingHooks{}
+	env := luma.NewEnvironment(luma.Options{Loader: profiledTemplates, Hooks: hooks})
+	page, err := env.GetTemplate("page.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.events = nil
+
+	got := mustExecute(t, page, map[string]interface{}{"title": "Hi", "body": "text"})
+	if got != "hiTEXT" {
+		t.Fatalf("Execute() = %q", got)
+	}
+	want := []string{
+		"start page.luma []",
+		"compile page.luma [page.luma]",
+		"compile header.luma [page.luma,header.luma]",
+		"filter lower [page.luma,header.luma]",
+		"include header.luma [page.luma]",
+		"filter upper [page.luma]",
+		"end page.luma []",
+	}
+	if strings.Join(hooks.events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(hooks.events, "\n"), strings.Join(want, "\n"))
+	}
+
+	hooks.events = nil
+	broken, err := env.GetTemplate("broken.luma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := broken.Execute(nil); err == nil {
+		t.Fatal("Execute() succeeded including a missing template")
+	}
+	last := hooks.events[len(hooks.events)-2:]
+	if last[0] != "include missing.luma [broken.luma] error" || last[1] != "end broken.luma [] error" {
+		t.Errorf("events end with %q, want the failed include and render", last)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	prof := luma.NewProfiler()
+	env := luma.NewEnvironment(luma.Options{Loader: profiledTemplates, Hooks: prof})
+	results := env.RenderAll([]string{"page.luma", "broken.luma"}, map[string]interface{}{"title": "Hi", "body": "text"})
+	if results["page.luma"].Err != nil {
+		t.Fatal(results["page.luma"].Err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := env.Render("${x | upper}", map[string]interface{}{"x": "y"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := prof.Stats()
+	find := func(list []luma.ProfileStat, name string) luma.ProfileStat {
+		for _, s := range list {
+			if s.Name == name {
+				return s
+			}
+		}
+		t.Fatalf("no statistics for %s", name)
+		return luma.ProfileStat{}
+	}
+	if s := find(stats.Templates, "page.luma"); s.Calls != 1 || s.Bytes != int64(len("hiTEXT")) || s.Total < s.Self {
+		t.Errorf("page.luma = %+v", s)
+	}
+	if s := find(stats.Templates, "broken.luma"); s.Errors != 1 {
+		t.Errorf("broken.luma = %+v, want 1 error", s)
+	}
+	if s := find(stats.Templates, "<string>"); s.Calls != 2 {
+		t.Errorf("<string> = %+v, want 2 calls", s)
+	}
+	if s := find(stats.Includes, "header.luma"); s.Calls != 1 || s.Bytes != 2 {
+		t.Errorf("header.luma = %+v", s)
+	}
+	if s := find(stats.Filters, "upper"); s.Calls != 3 {
+		t.Errorf("upper = %+v, want 3 calls", s)
+	}
+	find(stats.Compiles, "header.luma")
+
+	var report bytes.Buffer
+	if err := prof.Report(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Templates", "Filters", "page.luma", "header.luma", "upper"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, report.String())
+		}
+	}
+
+	var profile bytes.Buffer
+	if err := prof.WriteProfile(&profile); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"nanoseconds", "filter upper", "compile header.luma"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("profile lacks %q", want)
+		}
+	}
+
+	prof.Reset()
+	if stats := prof.Stats(); len(stats.Templates) != 0 {
+		t.Errorf("Stats() after Reset = %+v", stats)
+	}
+}
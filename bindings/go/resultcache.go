@@ -0,0 +1,491 @@
+package luma
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ResultCacheOptions configures the render result cache enabled by
+// Options.ResultCache.
+type ResultCacheOptions struct {
+	// TTL is how long a rendered result is reused. Zero keeps results
+	// until they are evicted.
+	TTL time.Duration
+
+	// MaxEntries bounds the number of cached results. It defaults to 1024.
+	MaxEntries int
+
+	// MaxBytes bounds the total size of the cached output. It defaults to
+	// 16 MiB.
+	MaxBytes int64
+}
+
+// ResultCacheStats reports how the render result cache has performed.
+type ResultCacheStats struct {
+	// Hits counts executions answered from the cache.
+	Hits uint64
+	// Misses counts executions that rendered and stored their result.
+	Misses uint64
+	// Uncacheable counts executions that bypassed the cache: their
+	// context could not be hashed, the render read the clock or the
+	// random source, or the template opted out.
+	Uncacheable uint64
+	// Evictions counts results dropped to respect the size limits.
+	Evictions uint64
+
+	// Entries and Bytes describe the results currently cached.
+	Entries int
+	Bytes   int64
+}
+
+// HitRate returns the fraction of cacheable executions that were
+// answered from the cache.
+func (s ResultCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+const (
+	defaultResultCacheEntries = 1024
+	defaultResultCacheBytes   = 16 << 20
+
+	// maxContextDepth bounds the nesting of hashed contexts
+	maxContextDepth = 64
+)
+
+// resultCache memoizes template output by template identity and context
+// hash. Results are least recently used first out.
+type resultCache struct {
+	opts ResultCacheOptions
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     list.List // of *resultEntry, most recently used first
+	bytes   int64
+	stats   ResultCacheStats
+	changes uint64 // latest loader change seen
+}
+
+// resultEntry is a cached render result
+type resultEntry struct {
+	key     [sha256.Size]byte
+	output  string
+	expires time.Time
+}
+
+func newResultCache(opts ResultCacheOptions) *resultCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultResultCacheEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultResultCacheBytes
+	}
+	return &resultCache{
+		opts:    opts,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// ResultCacheStats returns the statistics of the render result cache, or
+// zero stats when Options.ResultCache is not set.
+func (e *Environment) ResultCacheStats() ResultCacheStats {
+	c := e.results
+	if c == nil {
+		return ResultCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// renderCached renders a template through the result cache. Contexts
+// that cannot be hashed, and renders that read the clock or the random
+// source, are rendered but not stored.
+func (e *Environment) renderCached(name, source string, context interface{}) (string, error) {
+	c := e.results
+	key, ok := e.resultKey(name, source, context)
+	if !ok {
+		c.count(&c.stats.Uncacheable)
+		return e.render(name, source, context)
+	}
+
+	e.checkLoaderChanges()
+	now := e.opts.Clock.Now()
+	if output, ok := c.get(key, now); ok {
+		return output, nil
+	}
+
+	volatile := e.volatile.Load()
+	output, err := e.render(name, source, context)
+	if err != nil {
+		c.count(&c.stats.Misses)
+		return "", err
+	}
+	if e.volatile.Load() != volatile {
+		c.count(&c.stats.Uncacheable)
+		return output, nil
+	}
+	c.put(key, output, now)
+	return output, nil
+}
+
+// checkLoaderChanges empties the result cache when a reloading loader
+// reports changed templates, since any result may have included them
+func (e *Environment) checkLoaderChanges() {
+	loader, ok := e.opts.Loader.(ReloadingLoader)
+	if !ok {
+		return
+	}
+	c := e.results
+	c.mu.Lock()
+	since := c.changes
+	c.mu.Unlock()
+
+	names, latest := loader.Changes(since)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if latest > c.changes {
+		c.changes = latest
+		if len(names) > 0 {
+			c.clearLocked()
+		}
+	}
+}
+
+// count increments a statistic
+func (c *resultCache) count(stat *uint64) {
+	c.mu.Lock()
+	*stat++
+	c.mu.Unlock()
+}
+
+// get returns an unexpired cached result
+func (c *resultCache) get(key [sha256.Size]byte, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*resultEntry)
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		c.removeLocked(el)
+		return "", false
+	}
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return entry.output, true
+}
+
+// put records a miss and stores its result, evicting the least recently
+// used ones to stay within the limits
+func (c *resultCache) put(key [sha256.Size]byte, output string, now time.Time) {
+	entry := &resultEntry{key: key, output: output}
+	if c.opts.TTL > 0 {
+		entry.expires = now.Add(c.opts.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Misses++
+	size := int64(len(output))
+	if size > c.opts.MaxBytes {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += size
+	for len(c.entries) > c.opts.MaxEntries || c.bytes > c.opts.MaxBytes {
+		c.removeLocked(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// clear drops every cached result
+func (c *resultCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clearLocked()
+}
+
+func (c *resultCache) clearLocked() {
+	c.entries = make(map[[sha256.Size]byte]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+func (c *resultCache) removeLocked(el *list.Element) {
+	entry := c.lru.Remove(el).(*resultEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.output))
+}
+
+// resultKey hashes the template identity, the render's locale and a
+// canonical encoding of the context. It reports false for contexts that
+// cannot be encoded.
+func (e *Environment) resultKey(name, source string, context interface{}) ([sha256.Size]byte, bool) {
+	if valid, ok := context.(*validContext); ok {
+		// Defaults follow from the context
+		context = valid.value
+	}
+	enc := contextEncoder{env: e, buf: new(bytes.Buffer), visiting: make(map[seenKey]bool)}
+	enc.string(name)
+	enc.string(source)
+	enc.string(e.locale(context))
+	if !enc.value(reflect.ValueOf(contextValue(context)), 0) {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(enc.buf.Bytes()), true
+}
+
+// contextEncoder writes a deterministic encoding of a Go value that
+// mirrors how the bridge converts it: map entries are sorted, structs
+// contribute their exported fields, and values converted through
+// marshaling interfaces contribute their marshaled form. Functions and
+// channels cannot be encoded, since their results are unknown.
+type contextEncoder struct {
+	env      *Environment
+	buf      *bytes.Buffer
+	visiting map[seenKey]bool
+}
+
+func (c *contextEncoder) tag(t byte) {
+	c.buf.WriteByte(t)
+}
+
+func (c *contextEncoder) uint(n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	c.buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+func (c *contextEncoder) string(s string) {
+	c.uint(uint64(len(s)))
+	c.buf.WriteString(s)
+}
+
+func (c *contextEncoder) converts(conv Conversion) bool {
+	return c.env.opts.DisabledConversions&conv == 0
+}
+
+// value encodes rv and reports whether it could
+func (c *contextEncoder) value(rv reflect.Value, depth int) bool {
+	if depth > maxContextDepth {
+		return false
+	}
+	if !rv.IsValid() {
+		c.tag('0')
+		return true
+	}
+	if done, ok := c.special(rv); done {
+		return ok
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		c.tag('b')
+		if rv.Bool() {
+			c.uint(1)
+		} else {
+			c.uint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.tag('n')
+		c.uint(math.Float64bits(float64(rv.Int())))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c.tag('n')
+		c.uint(math.Float64bits(float64(rv.Uint())))
+	case reflect.Float32, reflect.Float64:
+		c.tag('n')
+		c.uint(math.Float64bits(rv.Float()))
+	case reflect.String:
+		c.tag('s')
+		c.string(rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			c.tag('0')
+			return true
+		}
+		c.tag('l')
+		c.uint(uint64(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			if !c.value(rv.Index(i), depth+1) {
+				return false
+			}
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			c.tag('0')
+			return true
+		}
+		return c.mapValue(rv, depth)
+	case reflect.Struct:
+		c.tag('t')
+		c.string(rv.Type().PkgPath() + "." + rv.Type().Name())
+		for _, f := range reflect.VisibleFields(rv.Type()) {
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			fv, err := rv.FieldByIndexErr(f.Index)
+			if err != nil {
+				continue
+			}
+			c.string(name)
+			if !c.value(fv, depth+1) {
+				return false
+			}
+		}
+	case reflect.Ptr:
+		if rv.IsNil() {
+			c.tag('0')
+			return true
+		}
+		// Cyclic values cannot be encoded
+		key := seenKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if c.visiting[key] {
+			return false
+		}
+		c.visiting[key] = true
+		defer delete(c.visiting, key)
+		return c.value(rv.Elem(), depth+1)
+	case reflect.Interface:
+		if rv.IsNil() {
+			c.tag('0')
+			return true
+		}
+		return c.value(rv.Elem(), depth+1)
+	default:
+		// Functions, channels and unsafe pointers
+		return false
+	}
+	return true
+}
+
+// special encodes the values the bridge converts specially. done
+// reports whether rv was one of them.
+func (c *contextEncoder) special(rv reflect.Value) (done, ok bool) {
+	if !rv.CanInterface() {
+		return false, false
+	}
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Type().Elem() == timeType {
+		rv = rv.Elem()
+	}
+
+	switch rv.Type() {
+	case timeType:
+		t := rv.Interface().(time.Time)
+		c.tag('T')
+		c.string(t.Format(time.RFC3339Nano) + " " + t.Location().String())
+		return true, true
+	case durationType:
+		c.tag('D')
+		c.uint(uint64(rv.Int()))
+		return true, true
+	case safeStringType, templateHTMLType:
+		c.tag('H')
+		c.string(rv.String())
+		return true, true
+	}
+
+	if c.converts(ConvertJSONMarshaler) {
+		if m, ok := asInterface(rv, jsonMarshalerType); ok {
+			data, err := m.(json.Marshaler).MarshalJSON()
+			if err != nil {
+				return true, false
+			}
+			c.tag('J')
+			c.string(string(data))
+			return true, true
+		}
+	}
+	if c.converts(ConvertTextMarshaler) {
+		if m, ok := asInterface(rv, textMarshalerType); ok {
+			text, err := m.(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return true, false
+			}
+			c.tag('X')
+			c.string(string(text))
+			return true, true
+		}
+	}
+	if c.converts(ConvertStringer) && indirectType(rv.Type()).Kind() != reflect.Struct {
+		if s, ok := asInterface(rv, stringerType); ok {
+			c.tag('S')
+			c.string(s.(fmt.Stringer).String())
+			return true, true
+		}
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		c.tag('s')
+		c.string(string(rv.Bytes()))
+		return true, true
+	}
+	return false, false
+}
+
+// mapValue encodes a map with its entries sorted by encoded key
+func (c *contextEncoder) mapValue(rv reflect.Value, depth int) bool {
+	type entry struct{ key, value []byte }
+	entries := make([]entry, 0, rv.Len())
+
+	outer := c.buf
+	defer func() { c.buf = outer }()
+
+	iter := rv.MapRange()
+	for iter.Next() {
+		// Keys are encoded by their Lua form, as in keyToLua
+		c.buf = new(bytes.Buffer)
+		switch k := iter.Key(); k.Kind() {
+		case reflect.String:
+			c.tag('s')
+			c.string(k.String())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			c.value(k, depth+1)
+		default:
+			c.tag('s')
+			c.string(fmt.Sprint(k.Interface()))
+		}
+		key := c.buf.Bytes()
+
+		c.buf = new(bytes.Buffer)
+		if !c.value(iter.Value(), depth+1) {
+			return false
+		}
+		entries = append(entries, entry{key, c.buf.Bytes()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	c.buf = outer
+	c.tag('m')
+	c.uint(uint64(len(entries)))
+	for _, e := range entries {
+		c.buf.Write(e.key)
+		c.buf.Write(e.value)
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package luma_test
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+// countingEnv returns an environment with a result cache and a calls()
+// global that counts how often templates are actually rendered
+func countingEnv(t *testing.T, opts luma.ResultCacheOptions, clock luma.Clock) (*luma.Environment, *atomic.Int64) {
+	t.Helper()
+	env := luma.NewEnvironment(luma.Options{ResultCache: &opts, Clock: clock})
+	calls := new(atomic.Int64)
+	env.AddGlobal("calls", func() int64 { return calls.Add(1) })
+	return env, calls
+}
+
+func mustExecute(t *testing.T, tmpl *luma.Template, context interface{}) string {
+	t.Helper()
+	got, err := tmpl.Execute(context)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	return got
+}
+
+func TestResultCache(t *testing.T) {
+	env, calls := countingEnv(t, luma.ResultCacheOptions{}, nil)
+	tmpl, err := env.Compile("${calls()} $name ${tags[1]}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := mustExecute(t, tmpl, map[string]interface{}{"name": "a", "tags": []string{"x"}, "n": map[int]int{1: 1, 2: 2}})
+	again := mustExecute(t, tmpl, map[string]interface{}{"n": map[int]int{2: 2, 1: 1}, "tags": []string{"x"}, "name": "a"})
+	if first != "1 a x" || again != first {
+		t.Errorf("Execute() = %q then %q, want the cached output", first, again)
+	}
+	if got := mustExecute(t, tmpl, map[string]interface{}{"name": "b", "tags": []string{"x"}}); got != "2 b x" {
+		t.Errorf("Execute() with another context = %q", got)
+	}
+
+	stats := env.ResultCacheStats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("stats = %+v, want 1 hit, 2 misses and 2 entries", stats)
+	}
+	if rate := stats.HitRate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("HitRate() = %v, want 1/3", rate)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("rendered %d times, want 2", calls.Load())
+	}
+}
+
+func TestResultCacheStructContext(t *testing.T) {
+	type Service struct {
+		Name  string
+		Ports []int
+		Port  *int
+	}
+	env, calls := countingEnv(t, luma.ResultCacheOptions{}, nil)
+	tmpl, err := env.Compile("${calls()} $Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := 80
+	mustExecute(t, tmpl, Service{Name: "web", Ports: []int{80}, Port: &port})
+	other := 80
+	mustExecute(t, tmpl, &Service{Name: "web", Ports: []int{80}, Port: &other})
+	if calls.Load() != 1 {
+		t.Errorf("equal structs rendered %d times, want 1", calls.Load())
+	}
+
+	mustExecute(t, tmpl, Service{Name: "web", Ports: []int{443}, Port: &port})
+	if calls.Load() != 2 {
+		t.Errorf("different structs rendered %d times, want 2", calls.Load())
+	}
+}
+
+func TestResultCacheUncacheable(t *testing.T) {
+	clock := luma.FixedClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name    string
+		source  string
+		context map[string]interface{}
+	}{
+		{"function in context", "${calls()} ${f()}", map[string]interface{}{"f": func() int { return 1 }}},
+		{"clock", "${calls()} ${now() | date('%Y')}", nil},
+		{"random", "${calls()} ${math.random(10)}", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, calls := countingEnv(t, luma.ResultCacheOptions{}, clock)
+			tmpl, err := env.Compile(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustExecute(t, tmpl, tt.context)
+			mustExecute(t, tmpl, tt.context)
+			if calls.Load() != 2 {
+				t.Errorf("rendered %d times, want 2", calls.Load())
+			}
+			if stats := env.ResultCacheStats(); stats.Uncacheable != 2 || stats.Entries != 0 {
+				t.Errorf("stats = %+v, want 2 uncacheable executions", stats)
+			}
+		})
+	}
+}
+
+func TestResultCacheDisable(t *testing.T) {
+	env, calls := countingEnv(t, luma.ResultCacheOptions{}, nil)
+	tmpl, err := env.Compile("${calls()}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.DisableResultCache()
+	if a, b := mustExecute(t, tmpl, nil), mustExecute(t, tmpl, nil); a == b {
+		t.Errorf("Execute() = %q twice, want fresh renders", a)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("rendered %d times, want 2", calls.Load())
+	}
+}
+
+func TestResultCacheTTL(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := luma.ClockFunc(func() time.Time { return now })
+	env, calls := countingEnv(t, luma.ResultCacheOptions{TTL: time.Minute}, clock)
+	tmpl, err := env.Compile("${calls()}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExecute(t, tmpl, nil)
+	now = now.Add(59 * time.Second)
+	mustExecute(t, tmpl, nil)
+	if calls.Load() != 1 {
+		t.Fatalf("rendered %d times within the TTL, want 1", calls.Load())
+	}
+	now = now.Add(time.Second)
+	if got := mustExecute(t, tmpl, nil); got != "2" {
+		t.Errorf("Execute() after the TTL = %q, want a fresh render", got)
+	}
+}
+
+func TestResultCacheLimits(t *testing.T) {
+	env, calls := countingEnv(t, luma.ResultCacheOptions{MaxEntries: 2}, nil)
+	tmpl, err := env.Compile("${calls()} $n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, 1, 3, 1, 2} {
+		mustExecute(t, tmpl, map[string]interface{}{"n": n})
+	}
+	// 1 stays recently used, so only 2 is evicted and rendered again
+	if calls.Load() != 4 {
+		t.Errorf("rendered %d times, want 4", calls.Load())
+	}
+	if stats := env.ResultCacheStats(); stats.Entries != 2 || stats.Evictions != 2 {
+		t.Errorf("stats = %+v, want 2 entries and 2 evictions", stats)
+	}
+
+	small, _ := countingEnv(t, luma.ResultCacheOptions{MaxBytes: 8}, nil)
+	tmpl, err = small.Compile("${calls()} " + strings.Repeat("x", 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tmpl, nil)
+	if stats := small.ResultCacheStats(); stats.Entries != 0 {
+		t.Errorf("stats = %+v, want output larger than MaxBytes left uncached", stats)
+	}
+}
+
+func TestResultCacheInvalidation(t *testing.T) {
+	env, _ := countingEnv(t, luma.ResultCacheOptions{}, nil)
+	tmpl, err := env.Compile("${calls()} ${greeting}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.AddGlobal("greeting", "hello")
+	mustExecute(t, tmpl, nil)
+	env.AddGlobal("greeting", "hi")
+	if got := mustExecute(t, tmpl, nil); got != "2 hi" {
+		t.Errorf("Execute() after AddGlobal = %q, want a fresh render", got)
+	}
+}
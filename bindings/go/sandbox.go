@@ -0,0 +1,112 @@
+package luma
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Library selects optional Lua standard libraries for a SandboxPolicy.
+// The base, package, table, string and math libraries are always opened
+// because Luma itself needs them.
+type Library uint
+
+const (
+	// LibOS opens the os library, including os.execute and os.remove.
+	LibOS Library = 1 << iota
+	// LibIO opens the io library.
+	LibIO
+	// LibDebug opens the debug library.
+	LibDebug
+	// LibCoroutine opens the coroutine library.
+	LibCoroutine
+	// LibChannel opens gopher-lua's channel library.
+	LibChannel
+
+	// AllLibraries opens every optional library.
+	AllLibraries = LibOS | LibIO | LibDebug | LibCoroutine | LibChannel
+)
+
+// SandboxPolicy controls what the Lua states behind an Environment can
+// reach on the host.
+type SandboxPolicy struct {
+	// Libraries lists the optional Lua libraries to open.
+	Libraries Library
+
+	// AllowFileLoading lets include, import and extends read templates
+	// from disk when Options.Loader does not provide them. When false,
+	// only the Loader can supply templates, and dofile, loadfile and
+	// file-based require are removed.
+	AllowFileLoading bool
+
+	// AllowEnv keeps os.getenv and os.setenv working when LibOS is
+	// opened. When false, os.getenv always returns nil.
+	AllowEnv bool
+}
+
+// DefaultSandbox returns the policy used when Options.Sandbox is nil:
+// all libraries, file loading and environment access are allowed.
+func DefaultSandbox() *SandboxPolicy {
+	return &SandboxPolicy{
+		Libraries:        AllLibraries,
+		AllowFileLoading: true,
+		AllowEnv:         true,
+	}
+}
+
+// StrictSandbox returns a policy for rendering untrusted templates. No
+// optional libraries are opened, templates can only come from
+// Options.Loader and environment variables are not visible.
+//
+// Combine it with Options.RestrictMethods to also limit the Go methods
+// templates may call.
+func StrictSandbox() *SandboxPolicy {
+	return &SandboxPolicy{}
+}
+
+// newState creates a Lua state with the libraries allowed by p
+func (p *SandboxPolicy) newState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+
+	libs := []struct {
+		lib  Library
+		name string
+		open lua.LGFunction
+	}{
+		{0, lua.LoadLibName, lua.OpenPackage},
+		{0, lua.BaseLibName, lua.OpenBase},
+		{0, lua.TabLibName, lua.OpenTable},
+		{0, lua.StringLibName, lua.OpenString},
+		{0, lua.MathLibName, lua.OpenMath},
+		{LibOS, lua.OsLibName, lua.OpenOs},
+		{LibIO, lua.IoLibName, lua.OpenIo},
+		{LibDebug, lua.DebugLibName, lua.OpenDebug},
+		{LibCoroutine, lua.CoroutineLibName, lua.OpenCoroutine},
+		{LibChannel, lua.ChannelLibName, lua.OpenChannel},
+	}
+	for _, lib := range libs {
+		if lib.lib != 0 && p.Libraries&lib.lib == 0 {
+			continue
+		}
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	if !p.AllowFileLoading {
+		L.SetGlobal("dofile", lua.LNil)
+		L.SetGlobal("loadfile", lua.LNil)
+		if pkg, ok := L.GetGlobal("package").(*lua.LTable); ok {
+			pkg.RawSetString("path", lua.LString(""))
+			pkg.RawSetString("cpath", lua.LString(""))
+		}
+	}
+
+	if os, ok := L.GetGlobal("os").(*lua.LTable); ok && !p.AllowEnv {
+		os.RawSetString("getenv", L.NewFunction(func(L *lua.LState) int {
+			L.Push(lua.LNil)
+			return 1
+		}))
+		os.RawSetString("setenv", lua.LNil)
+	}
+
+	return L
+}
@@ -0,0 +1,47 @@
+package luma
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestSandboxPolicyState(t *testing.T) {
+	t.Setenv("LUMA_SANDBOX_SECRET", "hunter2")
+
+	tests := []struct {
+		name   string
+		policy *SandboxPolicy
+		chunk  string
+		want   string
+	}{
+		{"default opens os", DefaultSandbox(), `return type(os)`, "table"},
+		{"default reads env", DefaultSandbox(), `return os.getenv("LUMA_SANDBOX_SECRET")`, "hunter2"},
+		{"strict closes os", StrictSandbox(), `return type(os)`, "nil"},
+		{"strict closes io", StrictSandbox(), `return type(io)`, "nil"},
+		{"strict closes debug", StrictSandbox(), `return type(debug)`, "nil"},
+		{"strict removes dofile", StrictSandbox(), `return type(dofile)`, "nil"},
+		{"strict removes loadfile", StrictSandbox(), `return type(loadfile)`, "nil"},
+		{"strict clears package.path", StrictSandbox(), `return package.path`, ""},
+		{
+			"env hidden with os opened",
+			&SandboxPolicy{Libraries: LibOS},
+			`return tostring(os.getenv("LUMA_SANDBOX_SECRET"))`,
+			"nil",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			L := tt.policy.newState()
+			defer L.Close()
+
+			if err := L.DoString(tt.chunk); err != nil {
+				t.Fatalf("DoString() error = %v", err)
+			}
+			if got := lua.LVAsString(L.Get(-1)); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.chunk, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package luma_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestStrictSandboxFiles(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Sandbox: luma.StrictSandbox()})
+
+	templates := []string{
+		`{% include "/etc/passwd" %}`,
+		`@include "/etc/passwd"`,
+		`{% include "../../../../../../../../etc/passwd" %}`,
+		`{% extends "/etc/passwd" %}`,
+		`{% import "/etc/passwd" as passwd %}`,
+	}
+
+	for _, template := range templates {
+		t.Run(template, func(t *testing.T) {
+			got, err := env.Render(template, nil)
+			if err == nil {
+				t.Fatalf("Render() = %q, want error", got)
+			}
+			if strings.Contains(got+err.Error(), "root:") {
+				t.Errorf("template read /etc/passwd: %v", err)
+			}
+			if !strings.Contains(err.Error(), "Template not found") {
+				t.Errorf("Render() error = %v, want template not found", err)
+			}
+		})
+	}
+}
+
+func TestStrictSandboxEnv(t *testing.T) {
+	t.Setenv("LUMA_SANDBOX_SECRET", "hunter2")
+	env := luma.NewEnvironment(luma.Options{Sandbox: luma.StrictSandbox()})
+
+	templates := []string{
+		`${os.getenv("LUMA_SANDBOX_SECRET")}`,
+		`{{ os.getenv("LUMA_SANDBOX_SECRET") }}`,
+		`$LUMA_SANDBOX_SECRET`,
+		`${env.LUMA_SANDBOX_SECRET}`,
+	}
+
+	for _, template := range templates {
+		t.Run(template, func(t *testing.T) {
+			got, err := env.Render(template, nil)
+			if strings.Contains(got, "hunter2") || (err != nil && strings.Contains(err.Error(), "hunter2")) {
+				t.Errorf("template read environment variable: %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSandboxLoader(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{
+		Sandbox: luma.StrictSandbox(),
+		Loader: luma.MapLoader{
+			"header.luma": "Hello, $name!",
+		},
+	})
+
+	got, err := env.Render(`{% include "header.luma" %}`, map[string]interface{}{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "Hello, Ada!" {
+		t.Errorf("Render() = %q, want %q", got, "Hello, Ada!")
+	}
+
+	_, err = env.Render(`{% include "missing.luma" %}`, nil)
+	if err == nil || !strings.Contains(err.Error(), "Template not found: missing.luma") {
+		t.Errorf("Render() error = %v, want template not found", err)
+	}
+}
+
+func TestDefaultSandboxFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.luma")
+	if err := os.WriteFile(path, []byte("from disk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := luma.Render(`{% include "`+filepath.ToSlash(path)+`" %}`, nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if got != "from disk" {
+		t.Errorf("Render() = %q, want %q", got, "from disk")
+	}
+}
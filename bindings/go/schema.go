@@ -0,0 +1,362 @@
+package luma
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Schema is a JSON Schema (draft 2020-12) describing template contexts.
+// Parse one with ParseSchema; boolean schemas decode to a Schema with
+// Bool set. A Schema must not be modified once it has been used.
+//
+// Validation supports the type, enum, const, numeric, string, array and
+// object keywords and the allOf, anyOf, oneOf, not and if/then/else
+// applicators. "format" and the unevaluated keywords are not checked,
+// and "pattern" uses Go regular expressions.
+type Schema struct {
+	SchemaURI   string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+
+	// Type lists the allowed types; "type" may be a string or an array.
+	Type []string `json:"-"`
+
+	Enum  []json.RawMessage `json:"enum,omitempty"`
+	Const json.RawMessage   `json:"const,omitempty"`
+
+	MultipleOf       *float64 `json:"multipleOf,omitempty"`
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Format    string `json:"format,omitempty"`
+
+	Properties           map[string]*Schema  `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema  `json:"patternProperties,omitempty"`
+	AdditionalProperties *Schema             `json:"additionalProperties,omitempty"`
+	PropertyNames        *Schema             `json:"propertyNames,omitempty"`
+	Required             []string            `json:"required,omitempty"`
+	DependentRequired    map[string][]string `json:"dependentRequired,omitempty"`
+	MinProperties        *int                `json:"minProperties,omitempty"`
+	MaxProperties        *int                `json:"maxProperties,omitempty"`
+
+	Items       *Schema   `json:"items,omitempty"`
+	PrefixItems []*Schema `json:"prefixItems,omitempty"`
+	Contains    *Schema   `json:"contains,omitempty"`
+	MinContains *int      `json:"minContains,omitempty"`
+	MaxContains *int      `json:"maxContains,omitempty"`
+	MinItems    *int      `json:"minItems,omitempty"`
+	MaxItems    *int      `json:"maxItems,omitempty"`
+	UniqueItems bool      `json:"uniqueItems,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+	Else  *Schema   `json:"else,omitempty"`
+
+	// Default is the value a missing property gets when the schema is
+	// the property's schema in "properties".
+	Default json.RawMessage `json:"default,omitempty"`
+
+	// Bool is set for the boolean schemas true, which allows any value,
+	// and false, which allows none.
+	Bool *bool `json:"-"`
+
+	// resolved is the schema Ref points to
+	resolved *Schema
+	// patterns holds the compiled PatternProperties
+	patterns map[string]*regexp.Regexp
+	// pattern is the compiled Pattern
+	pattern *regexp.Regexp
+	// enum and constant hold Enum and Const decoded
+	enum     []interface{}
+	constant interface{}
+	// prepareOnce guards resolving a root schema, which prepareErr
+	// records the outcome of
+	prepareOnce sync.Once
+	prepareErr  error
+}
+
+// schemaFields has the fields of Schema without its methods
+type schemaFields Schema
+
+// ParseSchema parses a JSON Schema and resolves its references, which
+// must point into the schema itself ("#", "#/$defs/name" or another
+// JSON pointer).
+func ParseSchema(data []byte) (*Schema, error) {
+	s := new(Schema)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// prepare resolves a root schema once and returns the error it found,
+// so that schemas shared by concurrent renders are only read
+func (s *Schema) prepare() error {
+	s.prepareOnce.Do(func() {
+		if err := s.resolve(s); err != nil {
+			s.prepareErr = fmt.Errorf("invalid schema: %w", err)
+		}
+	})
+	return s.prepareErr
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if json.Unmarshal(data, &b) == nil {
+		*s = Schema{Bool: &b}
+		return nil
+	}
+	var fields struct {
+		*schemaFields
+		Type json.RawMessage `json:"type"`
+	}
+	fields.schemaFields = (*schemaFields)(s)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields.Type) > 0 {
+		var one string
+		if json.Unmarshal(fields.Type, &one) == nil {
+			s.Type = []string{one}
+		} else if err := json.Unmarshal(fields.Type, &s.Type); err != nil {
+			return fmt.Errorf("type must be a string or an array of strings")
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.Bool != nil {
+		return json.Marshal(*s.Bool)
+	}
+	var typ interface{}
+	switch len(s.Type) {
+	case 0:
+	case 1:
+		typ = s.Type[0]
+	default:
+		typ = s.Type
+	}
+	return json.Marshal(struct {
+		Type interface{} `json:"type,omitempty"`
+		*schemaFields
+	}{typ, (*schemaFields)(s)})
+}
+
+// resolve resolves the references of s and the schemas it contains
+// against root, and compiles their patterns
+func (s *Schema) resolve(root *Schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		target, err := root.pointer(s.Ref)
+		if err != nil {
+			return err
+		}
+		s.resolved = target
+	}
+	if len(s.PatternProperties) > 0 {
+		s.patterns = make(map[string]*regexp.Regexp, len(s.PatternProperties))
+		for pattern := range s.PatternProperties {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("patternProperties: %w", err)
+			}
+			s.patterns[pattern] = re
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		s.pattern = re
+	}
+	s.enum = make([]interface{}, len(s.Enum))
+	for i, raw := range s.Enum {
+		if err := json.Unmarshal(raw, &s.enum[i]); err != nil {
+			return fmt.Errorf("enum: %w", err)
+		}
+	}
+	if s.Const != nil {
+		if err := json.Unmarshal(s.Const, &s.constant); err != nil {
+			return fmt.Errorf("const: %w", err)
+		}
+	}
+	if s.Default != nil && !json.Valid(s.Default) {
+		return fmt.Errorf("default is not valid JSON")
+	}
+	for _, sub := range s.subschemas() {
+		if err := sub.resolve(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subschemas returns the schemas s contains
+func (s *Schema) subschemas() []*Schema {
+	var subs []*Schema
+	for _, m := range []map[string]*Schema{s.Defs, s.Definitions, s.Properties, s.PatternProperties} {
+		for _, sub := range m {
+			subs = append(subs, sub)
+		}
+	}
+	subs = append(subs, s.AdditionalProperties, s.PropertyNames, s.Items, s.Contains, s.Not, s.If, s.Then, s.Else)
+	subs = append(subs, s.PrefixItems...)
+	subs = append(subs, s.AllOf...)
+	subs = append(subs, s.AnyOf...)
+	subs = append(subs, s.OneOf...)
+	return subs
+}
+
+// pointer finds the schema a local reference points to
+func (s *Schema) pointer(ref string) (*Schema, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q: only references within the schema are supported", ref)
+	}
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	tokens := strings.Split(ref, "/")[1:]
+	target := s
+	for len(tokens) > 0 && target != nil {
+		keyword := unescape.Replace(tokens[0])
+		tokens = tokens[1:]
+		switch keyword {
+		case "additionalProperties":
+			target = target.AdditionalProperties
+			continue
+		case "items":
+			target = target.Items
+			continue
+		case "propertyNames":
+			target = target.PropertyNames
+			continue
+		case "contains":
+			target = target.Contains
+			continue
+		case "not":
+			target = target.Not
+			continue
+		case "if":
+			target = target.If
+			continue
+		case "then":
+			target = target.Then
+			continue
+		case "else":
+			target = target.Else
+			continue
+		}
+		if len(tokens) == 0 {
+			target = nil
+			break
+		}
+		arg := unescape.Replace(tokens[0])
+		tokens = tokens[1:]
+		switch keyword {
+		case "$defs":
+			target = target.Defs[arg]
+		case "definitions":
+			target = target.Definitions[arg]
+		case "properties":
+			target = target.Properties[arg]
+		case "patternProperties":
+			target = target.PatternProperties[arg]
+		case "prefixItems":
+			target = schemaAt(target.PrefixItems, arg)
+		case "allOf":
+			target = schemaAt(target.AllOf, arg)
+		case "anyOf":
+			target = schemaAt(target.AnyOf, arg)
+		case "oneOf":
+			target = schemaAt(target.OneOf, arg)
+		default:
+			target = nil
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("$ref %q points to no schema", ref)
+	}
+	return target, nil
+}
+
+// schemaAt returns the schema at a decimal index of list, nil if there
+// is none
+func schemaAt(list []*Schema, index string) *Schema {
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 || n >= len(list) {
+		return nil
+	}
+	return list[n]
+}
+
+// allows reports whether the schema allows values of a JSON type. A
+// schema without a type allows all types; "integer" counts as "number".
+func (s *Schema) allows(typ string) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	for _, t := range s.Type {
+		if t == typ || (typ == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// branches returns the schemas a value must or may also match besides
+// s itself: the target of its reference and its allOf, anyOf and oneOf
+// subschemas, recursively
+func (s *Schema) branches() []*Schema {
+	var out []*Schema
+	var walk func(*Schema, int)
+	walk = func(s *Schema, depth int) {
+		if s == nil || depth > 32 {
+			return
+		}
+		out = append(out, s)
+		walk(s.resolved, depth+1)
+		for _, list := range [][]*Schema{s.AllOf, s.AnyOf, s.OneOf} {
+			for _, sub := range list {
+				walk(sub, depth+1)
+			}
+		}
+	}
+	walk(s, 0)
+	return out
+}
+
+// declaresMembers reports whether the schema restricts the properties
+// of objects
+func (s *Schema) declaresMembers() bool {
+	return len(s.Properties) > 0 || len(s.PatternProperties) > 0 || s.AdditionalProperties != nil
+}
+
+// combines reports whether the schema refers to or combines other
+// schemas
+func (s *Schema) combines() bool {
+	return s.Ref != "" || len(s.AllOf) > 0 || len(s.AnyOf) > 0 || len(s.OneOf) > 0
+}
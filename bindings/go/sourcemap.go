@@ -0,0 +1,297 @@
+package luma
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SourceMap maps the output of a render back to the template lines that
+// produced it. Get one with Template.ExecuteWithSourceMap.
+type SourceMap struct {
+	// Mappings cover the output in order. Each lies on a single output
+	// line; output produced by no template, such as whitespace removed
+	// around directives, has no mapping.
+	Mappings []Mapping
+
+	output     string
+	lineStarts []int
+}
+
+// Mapping maps a range of one output line to the template location that
+// produced it.
+type Mapping struct {
+	// Offset and End delimit the range in bytes, End excluded.
+	Offset, End int
+	// Line is the 1-based output line, Column and EndColumn the 1-based
+	// columns, in characters, the range starts and ends at, EndColumn
+	// excluded.
+	Line, Column, EndColumn int
+	// Source is where the range comes from.
+	Source SourceLocation
+	// Chain lists the include directives and macro calls that led to
+	// Source, outermost first.
+	Chain []SourceLocation
+	// Literal reports whether the range is template text, so that its
+	// columns line up with the template's.
+	Literal bool
+}
+
+// SourceLocation is a position in a template.
+type SourceLocation struct {
+	// Template is the template name, empty for templates rendered from
+	// a string.
+	Template string
+	Line     int
+	Column   int
+}
+
+// String formats the location as name:line:column.
+func (l SourceLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", templateLabel(l.Template), l.Line, l.Column)
+}
+
+// ExecuteWithSourceMap renders the template like Execute and returns a
+// source map of the output. Rendering with a source map is slower, and
+// never served from the result cache.
+//
+// Example:
+//
+//	out, sm, err := tmpl.ExecuteWithSourceMap(values)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := validate(out); err != nil {
+//	    log.Fatal(sm.Annotate(err)) // deploy.yaml:12:3: yaml: line 40: ...
+//	}
+func (t *Template) ExecuteWithSourceMap(context interface{}) (string, *SourceMap, error) {
+	source, err := t.currentSource()
+	if err != nil {
+		return "", nil, err
+	}
+	context, err = t.env.validate(t.env.schema(t.schema.Load()), context)
+	if err != nil {
+		return "", nil, err
+	}
+	return t.env.renderMapped(t.name, source, context, true)
+}
+
+// Lookup returns the mapping of an output position, with its source
+// column adjusted to the position for template text. Lines and columns
+// are 1-based; a column of 0 or less finds the first mapping of the line
+// that is not blank.
+func (m *SourceMap) Lookup(line, column int) (Mapping, bool) {
+	i := sort.Search(len(m.Mappings), func(i int) bool { return m.Mappings[i].Line >= line })
+	var blank *Mapping
+	for ; i < len(m.Mappings) && m.Mappings[i].Line == line; i++ {
+		mapping := m.Mappings[i]
+		if column <= 0 {
+			if strings.TrimSpace(m.output[mapping.Offset:mapping.End]) != "" {
+				return mapping, true
+			}
+			if blank == nil {
+				blank = &m.Mappings[i]
+			}
+			continue
+		}
+		if column >= mapping.Column && column < mapping.EndColumn {
+			if mapping.Literal {
+				mapping.Source.Column += column - mapping.Column
+			}
+			return mapping, true
+		}
+	}
+	if blank != nil {
+		return *blank, true
+	}
+	return Mapping{}, false
+}
+
+// LookupOffset returns the mapping of the output byte at offset.
+func (m *SourceMap) LookupOffset(offset int) (Mapping, bool) {
+	if offset < 0 || offset >= len(m.output) {
+		return Mapping{}, false
+	}
+	line, column := m.position(offset)
+	return m.Lookup(line, column)
+}
+
+// Annotate prefixes an error found in the rendered output with the
+// template location that produced it. It understands encoding/json
+// syntax and type errors, which carry a byte offset, and errors whose
+// message gives a line and optionally a column, such as YAML parser and
+// kubectl validation errors ("line 12: ..." or "line 12, column 3").
+// Other errors are returned unchanged.
+func (m *SourceMap) Annotate(err error) error {
+	if err == nil || m == nil {
+		return err
+	}
+
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var mapping Mapping
+	var ok bool
+	switch {
+	case errors.As(err, &syntax):
+		// The offset is just past the byte that failed
+		mapping, ok = m.LookupOffset(int(syntax.Offset) - 1)
+	case errors.As(err, &typeErr):
+		mapping, ok = m.LookupOffset(int(typeErr.Offset) - 1)
+	default:
+		match := errorLinePattern.FindStringSubmatch(err.Error())
+		if match == nil {
+			return err
+		}
+		line, _ := strconv.Atoi(match[1])
+		column, _ := strconv.Atoi(match[2])
+		mapping, ok = m.Lookup(line, column)
+	}
+	if !ok {
+		return err
+	}
+	return &SourceError{Err: err, Mapping: mapping}
+}
+
+// errorLinePattern finds the output position in a validation error
+var errorLinePattern = regexp.MustCompile(`\bline (\d+)(?:,? column (\d+))?`)
+
+// SourceError is an error in rendered output annotated with the template
+// location that produced the output.
+type SourceError struct {
+	Err     error
+	Mapping Mapping
+}
+
+func (e *SourceError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Mapping.Source.String())
+	if len(e.Mapping.Chain) > 0 {
+		b.WriteString(" (from ")
+		for i, l := range e.Mapping.Chain {
+			if i > 0 {
+				b.WriteString(" > ")
+			}
+			b.WriteString(l.String())
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// position returns the 1-based line and column of a byte offset
+func (m *SourceMap) position(offset int) (line, column int) {
+	i := sort.Search(len(m.lineStarts), func(i int) bool { return m.lineStarts[i] > offset }) - 1
+	return i + 1, utf8.RuneCountInString(m.output[m.lineStarts[i]:offset]) + 1
+}
+
+// enableSourceMaps makes the vm record source maps
+func (v *vm) enableSourceMaps() error {
+	runtime, err := requireModule(v.L, "luma.runtime")
+	if err != nil {
+		return err
+	}
+	err = v.L.CallByParam(lua.P{Fn: v.L.GetField(runtime, "set_source_maps"), NRet: 0, Protect: true}, lua.LTrue)
+	if err != nil {
+		return err
+	}
+	v.takeSourceMap = v.L.GetField(runtime, "take_source_map")
+	return nil
+}
+
+// sourceMap takes the source map of a render's output from the Lua
+// runtime
+func (v *vm) sourceMap(output string) (*SourceMap, error) {
+	segments, err := v.call(v.takeSourceMap, lua.LString(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build source map: %w", err)
+	}
+
+	m := &SourceMap{output: output, lineStarts: []int{0}}
+	for i := 0; i < len(output); i++ {
+		if output[i] == '\n' {
+			m.lineStarts = append(m.lineStarts, i+1)
+		}
+	}
+	tbl, ok := segments.(*lua.LTable)
+	if !ok {
+		return m, nil
+	}
+	for i := 1; i <= tbl.Len(); i++ {
+		seg, ok := tbl.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			continue
+		}
+		start := int(lua.LVAsNumber(seg.RawGetString("start")))
+		stop := int(lua.LVAsNumber(seg.RawGetString("stop")))
+		if start < 0 || stop > len(output) || start >= stop {
+			continue
+		}
+		source, literal := sourceLocation(seg.RawGetString("location"))
+		var chain []SourceLocation
+		if links, ok := seg.RawGetString("chain").(*lua.LTable); ok {
+			for j := 1; j <= links.Len(); j++ {
+				l, _ := sourceLocation(links.RawGetInt(j))
+				chain = append(chain, l)
+			}
+		}
+		m.add(start, stop, source, chain, literal)
+	}
+	return m, nil
+}
+
+// sourceLocation converts a location recorded by the Lua runtime, see
+// runtime.take_source_map
+func sourceLocation(value lua.LValue) (SourceLocation, bool) {
+	tbl, ok := value.(*lua.LTable)
+	if !ok {
+		return SourceLocation{}, false
+	}
+	l := SourceLocation{
+		Line:   int(lua.LVAsNumber(tbl.RawGetInt(2))),
+		Column: int(lua.LVAsNumber(tbl.RawGetInt(3))),
+	}
+	if name, ok := tbl.RawGetInt(1).(lua.LString); ok {
+		l.Template = string(name)
+	}
+	return l, lua.LVAsBool(tbl.RawGetInt(4))
+}
+
+// add maps the output from start to stop, splitting it into lines. The
+// lines of template text follow the lines of the template.
+func (m *SourceMap) add(start, stop int, source SourceLocation, chain []SourceLocation, literal bool) {
+	for start < stop {
+		end := stop
+		if nl := strings.IndexByte(m.output[start:stop], '\n'); nl >= 0 {
+			end = start + nl + 1
+		}
+		line, column := m.position(start)
+		m.Mappings = append(m.Mappings, Mapping{
+			Offset:    start,
+			End:       end,
+			Line:      line,
+			Column:    column,
+			EndColumn: column + utf8.RuneCountInString(m.output[start:end]),
+			Source:    source,
+			Chain:     chain,
+			Literal:   literal,
+		})
+		if literal && end < stop {
+			source.Line++
+			source.Column = 1
+		}
+		start = end
+	}
+}
@@ -0,0 +1,104 @@
+package luma_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+	"gopkg.in/yaml.v3"
+)
+
+var mappedTemplates = luma.MapLoader{
+	"deploy.yaml":     "kind: Deployment\nspec:\n  @include \"containers.yaml\" indent\nreplicas: $replicas\n",
+	"containers.yaml": "containers:\n- name: app\n  image: $image\n",
+	"config.json":     "{\n  \"name\": \"$name\",\n  \"port\": $port\n}\n",
+}
+
+func TestExecuteWithSourceMap(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: mappedTemplates, Autoescape: luma.EscapeNone})
+	tmpl, err := env.GetTemplate("deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{"image": "nginx", "replicas": 3}
+	out, sm, err := tmpl.ExecuteWithSourceMap(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := mustExecute(t, tmpl, values)
+	if out != plain {
+		t.Errorf("output = %q, want the output of Execute %q", out, plain)
+	}
+
+	tests := []struct {
+		line, column int
+		want         string
+		chain        string
+	}{
+		{1, 1, "deploy.yaml:1:1", ""},
+		{4, 0, "containers.yaml:2:1", "deploy.yaml:3:3"},
+		{5, 5, "containers.yaml:3:3", "deploy.yaml:3:3"},
+		{5, 12, "containers.yaml:3:10", "deploy.yaml:3:3"},
+		{6, 11, "deploy.yaml:4:11", ""},
+	}
+	for _, tt := range tests {
+		m, ok := sm.Lookup(tt.line, tt.column)
+		if !ok {
+			t.Errorf("Lookup(%d, %d) found nothing in\n%s", tt.line, tt.column, out)
+			continue
+		}
+		var chain []string
+		for _, l := range m.Chain {
+			chain = append(chain, l.String())
+		}
+		if m.Source.String() != tt.want || strings.Join(chain, " > ") != tt.chain {
+			t.Errorf("Lookup(%d, %d) = %s from %v, want %s from %q", tt.line, tt.column, m.Source, chain, tt.want, tt.chain)
+		}
+	}
+}
+
+func TestSourceMapAnnotate(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: mappedTemplates, Autoescape: luma.EscapeNone})
+	tmpl, err := env.GetTemplate("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing port leaves invalid JSON
+	out, sm, err := tmpl.ExecuteWithSourceMap(map[string]interface{}{"name": "app", "port": "}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	err = sm.Annotate(json.Unmarshal([]byte(out), &v))
+	var srcErr *luma.SourceError
+	if !errors.As(err, &srcErr) {
+		t.Fatalf("Annotate() = %v, want a SourceError", err)
+	}
+	if srcErr.Mapping.Source.Template != "config.json" || srcErr.Mapping.Source.Line != 3 {
+		t.Errorf("Annotate() located the error at %s, want config.json line 3", srcErr.Mapping.Source)
+	}
+	var syntax *json.SyntaxError
+	if !errors.As(err, &syntax) {
+		t.Error("Annotate() does not wrap the original error")
+	}
+
+	deploy, err := env.GetTemplate("deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, sm, err = deploy.ExecuteWithSourceMap(map[string]interface{}{"image": "a: b: c", "replicas": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.Annotate(yaml.Unmarshal([]byte(out), &v))
+	if err == nil || !strings.HasPrefix(err.Error(), "containers.yaml:3:") || !strings.Contains(err.Error(), "(from deploy.yaml:3:3)") {
+		t.Errorf("Annotate() = %v, want it located in containers.yaml line 3", err)
+	}
+
+	if err := sm.Annotate(errors.New("no position")); err.Error() != "no position" {
+		t.Errorf("Annotate() changed an error without a position to %q", err)
+	}
+}
@@ -0,0 +1,159 @@
+package luma
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Syntax changes the markup templates are written in, for files that
+// already use the default markup for something else. Empty fields keep
+// their defaults.
+//
+// Example:
+//
+//	// Ansible-adjacent files: {{ }} belongs to Ansible, $ to the shell
+//	env := luma.NewEnvironment(luma.Options{Syntax: &luma.Syntax{
+//	    VariableStart:      "[[",
+//	    VariableEnd:        "]]",
+//	    InterpolationSigil: "%",
+//	}})
+type Syntax struct {
+	// VariableStart and VariableEnd enclose Jinja expressions. They
+	// default to "{{" and "}}".
+	VariableStart, VariableEnd string
+
+	// BlockStart and BlockEnd enclose Jinja statements. They default to
+	// "{%" and "%}".
+	BlockStart, BlockEnd string
+
+	// CommentStart and CommentEnd enclose Jinja comments. They default
+	// to "{#" and "#}".
+	CommentStart, CommentEnd string
+
+	// DirectiveSigil starts native directives such as @if. It defaults
+	// to "@" and must be a single punctuation character other than
+	// - { } and quotes.
+	DirectiveSigil string
+
+	// InterpolationSigil starts native interpolations such as $name and
+	// ${expr}, and is escaped by doubling it. It defaults to "$", with
+	// the same restrictions as DirectiveSigil.
+	InterpolationSigil string
+
+	// DisableInlineDetection treats every native directive as a block
+	// directive on its own line, even with text before or after it on
+	// the line.
+	DisableInlineDetection bool
+}
+
+// check applies the rules luma.lexer.set_syntax enforces, reporting
+// them with the field names
+func (s *Syntax) check() error {
+	for _, d := range []struct{ name, value string }{
+		{"VariableStart", s.VariableStart}, {"VariableEnd", s.VariableEnd},
+		{"BlockStart", s.BlockStart}, {"BlockEnd", s.BlockEnd},
+		{"CommentStart", s.CommentStart}, {"CommentEnd", s.CommentEnd},
+	} {
+		if strings.ContainsAny(d.value, " \t\n\r\v\f") {
+			return fmt.Errorf("%s must not contain whitespace", d.name)
+		}
+	}
+
+	directive, interpolation := s.DirectiveSigil, s.InterpolationSigil
+	for _, sigil := range []struct{ name, value string }{
+		{"DirectiveSigil", directive}, {"InterpolationSigil", interpolation},
+	} {
+		if sigil.value != "" && !validSigil(sigil.value) {
+			return fmt.Errorf("%s must be a single punctuation character other than - { } and quotes", sigil.name)
+		}
+	}
+	if directive == "" {
+		directive = "@"
+	}
+	if interpolation == "" {
+		interpolation = "$"
+	}
+	if directive == interpolation {
+		return errors.New("DirectiveSigil and InterpolationSigil must differ")
+	}
+
+	starts := make(map[string]string)
+	for _, d := range []struct{ name, value, fallback string }{
+		{"VariableStart", s.VariableStart, "{{"},
+		{"BlockStart", s.BlockStart, "{%"},
+		{"CommentStart", s.CommentStart, "{#"},
+	} {
+		start := d.value
+		if start == "" {
+			start = d.fallback
+		}
+		if other, ok := starts[start]; ok {
+			return fmt.Errorf("%s and %s must differ", other, d.name)
+		}
+		starts[start] = d.name
+	}
+	return nil
+}
+
+// validSigil reports whether s is a single punctuation character other
+// than - { } _ and quotes
+func validSigil(s string) bool {
+	if len(s) != 1 {
+		return false
+	}
+	c := s[0]
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return false
+	case c <= ' ' || c >= 0x7f:
+		return false
+	}
+	return !strings.ContainsRune(`-_{}"'\`, rune(c))
+}
+
+// installSyntax makes the lexer use Options.Syntax for every template
+func (e *Environment) installSyntax(L *lua.LState) error {
+	s := e.opts.Syntax
+	if s == nil {
+		return nil
+	}
+	if err := s.check(); err != nil {
+		return fmt.Errorf("invalid syntax: %w", err)
+	}
+
+	options := L.NewTable()
+	for key, value := range map[string]string{
+		"variable_start_string": s.VariableStart,
+		"variable_end_string":   s.VariableEnd,
+		"block_start_string":    s.BlockStart,
+		"block_end_string":      s.BlockEnd,
+		"comment_start_string":  s.CommentStart,
+		"comment_end_string":    s.CommentEnd,
+		"directive_sigil":       s.DirectiveSigil,
+		"interpolation_sigil":   s.InterpolationSigil,
+	} {
+		if value != "" {
+			options.RawSetString(key, lua.LString(value))
+		}
+	}
+	if s.DisableInlineDetection {
+		options.RawSetString("inline_detection", lua.LFalse)
+	}
+
+	lexer, err := requireModule(L, "luma.lexer")
+	if err != nil {
+		return err
+	}
+	err = L.CallByParam(lua.P{Fn: L.GetField(lexer, "set_syntax"), NRet: 0, Protect: true}, options)
+	if err != nil {
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			err = errors.New(luaChunkPosition.ReplaceAllString(apiErr.Object.String(), ""))
+		}
+		return fmt.Errorf("invalid syntax: %w", err)
+	}
+	return nil
+}
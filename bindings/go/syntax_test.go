@@ -0,0 +1,62 @@
+package luma_test
+
+import (
+	"testing"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+func TestSyntaxJinjaDelimiters(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Syntax: &luma.Syntax{
+		VariableStart: "[[",
+		VariableEnd:   "]]",
+		BlockStart:    "[%",
+		BlockEnd:      "%]",
+		CommentStart:  "[#",
+		CommentEnd:    "#]",
+	}})
+	source := "- name: [[ task ]]\n  debug: msg={{ item }}\n[% for h in hosts -%]\n  [# host #]- [[ h ]]\n[% endfor %]"
+	out, err := env.Render(source, map[string]interface{}{"task": "ping", "hosts": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "- name: ping\n  debug: msg={{ item }}\n- a\n- b\n"
+	if out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+}
+
+func TestSyntaxSigils(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Syntax: &luma.Syntax{
+		DirectiveSigil:     "%",
+		InterpolationSigil: "~",
+	}})
+	source := "echo \"$HOME\" ~{ user | upper }\n%if admin\nsudo ~cmd @once ~~\n%end"
+	out, err := env.Render(source, map[string]interface{}{"user": "ada", "admin": true, "cmd": "ls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "echo \"$HOME\" ADA\nsudo ls @once ~\n"
+	if out != want {
+		t.Errorf("Render() = %q, want %q", out, want)
+	}
+}
+
+func TestSyntaxInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		syntax luma.Syntax
+		want   string
+	}{
+		{luma.Syntax{DirectiveSigil: "@@"}, "DirectiveSigil must be a single punctuation character other than - { } and quotes"},
+		{luma.Syntax{InterpolationSigil: "a"}, "InterpolationSigil must be a single punctuation character other than - { } and quotes"},
+		{luma.Syntax{DirectiveSigil: "$"}, "DirectiveSigil and InterpolationSigil must differ"},
+		{luma.Syntax{BlockStart: "{{"}, "VariableStart and BlockStart must differ"},
+		{luma.Syntax{VariableEnd: "} }"}, "VariableEnd must not contain whitespace"},
+	} {
+		env := luma.NewEnvironment(luma.Options{Syntax: &tc.syntax})
+		_, err := env.Render("x", nil)
+		if want := "invalid syntax: " + tc.want; err == nil || err.Error() != want {
+			t.Errorf("Render() with %+v error = %v, want %q", tc.syntax, err, want)
+		}
+	}
+}
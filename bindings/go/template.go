@@ -1,17 +1,22 @@
 package luma
 
 import (
-	"fmt"
 	"sync"
-
-	lua "github.com/yuin/gopher-lua"
+	"sync/atomic"
 )
 
 // Template represents a compiled Luma template.
 // Templates are safe for concurrent use after compilation.
 type Template struct {
+	name   string
 	source string
+	env    *Environment
 	mu     sync.RWMutex
+
+	// uncached opts the template out of the result cache
+	uncached atomic.Bool
+	// schema overrides Options.Schema for the template
+	schema atomic.Pointer[Schema]
 }
 
 // Compile compiles a template string for later execution.
@@ -25,50 +30,84 @@ type Template struct {
 //	}
 //	result, err := tmpl.Execute(map[string]interface{}{"name": "Alice"})
 func Compile(source string) (*Template, error) {
-	// Validate the template by attempting to parse it
-	// We use a simple Render call with empty context to validate syntax
-	L := lua.NewState()
-	defer L.Close()
+	return defaultEnvironment.Compile(source)
+}
 
-	if err := loadLumaModules(L); err != nil {
-		return nil, fmt.Errorf("failed to load Luma modules: %w", err)
+// Execute renders the compiled template with the given context.
+// The context can be a map[string]interface{} or any Go value that
+// can be converted to a Lua table.
+//
+// Templates loaded with GetTemplate from a ReloadingLoader pick up
+// changes to their source before each execution. When the environment
+// has a result cache, executing with a context equal to an earlier one
+// may return the earlier output. With a schema, the context is validated
+// first; see Options.Schema. A context wrapped with TrackAccess records
+// the paths the template reads, and one wrapped with WithLocale is
+// rendered in that locale.
+func (t *Template) Execute(context interface{}) (string, error) {
+	source, err := t.currentSource()
+	if err != nil {
+		return "", err
+	}
+	context, err = t.env.validate(t.env.schema(t.schema.Load()), context)
+	if err != nil {
+		return "", err
 	}
+	if c := t.env.results; c != nil && trackedContext(context) == nil {
+		if t.uncached.Load() {
+			c.count(&c.stats.Uncacheable)
+		} else {
+			return t.env.renderCached(t.name, source, context)
+		}
+	}
+	return t.env.render(t.name, source, context)
+}
 
-	// Validate template syntax by attempting to parse/compile it
-	luaCode := fmt.Sprintf(`
-		local luma = require("luma")
-		local source = %q
-		
-		-- Try to parse the template to validate syntax
-		local ast, parse_err = luma.parse(source)
-		if parse_err then
-			error("Parse error: " .. tostring(parse_err))
-		end
-		
-		return true
-	`, source)
+// DisableResultCache makes every execution of the template render, even
+// when the environment has a result cache. Use it for templates whose
+// output depends on more than their context, such as ones calling
+// globals that read external state.
+func (t *Template) DisableResultCache() {
+	t.uncached.Store(true)
+}
 
-	if err := L.DoString(luaCode); err != nil {
-		return nil, fmt.Errorf("compilation error: %w", err)
+// SetSchema makes the template validate its contexts against s instead
+// of Options.Schema. It fails if s has references it cannot resolve.
+func (t *Template) SetSchema(s *Schema) error {
+	if s != nil {
+		if err := s.prepare(); err != nil {
+			return err
+		}
 	}
-
-	// Store the source for later execution
-	// A full implementation would cache the compiled Lua function
-	return &Template{
-		source: source,
-	}, nil
+	t.schema.Store(s)
+	t.env.clearResults()
+	return nil
 }
 
-// Execute renders the compiled template with the given context.
-// The context can be a map[string]interface{} or any Go value that
-// can be converted to a Lua table.
-func (t *Template) Execute(context interface{}) (string, error) {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
+// currentSource returns the template source, reloading it first if it
+// came from a ReloadingLoader
+func (t *Template) currentSource() (string, error) {
+	loader, ok := t.env.opts.Loader.(ReloadingLoader)
+	if !ok || t.name == "" {
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		return t.source, nil
+	}
+
+	source, err := loader.Load(t.name)
+	if err != nil {
+		return "", err
+	}
+	t.mu.Lock()
+	t.source = source
+	t.mu.Unlock()
+	return source, nil
+}
 
-	// For now, just use Render since we're storing source
-	// A full implementation would use the compiled template
-	return Render(t.source, context)
+// Name returns the name the template was loaded by, or "" for templates
+// compiled from a string.
+func (t *Template) Name() string {
+	return t.name
 }
 
 // Source returns the original template source code.
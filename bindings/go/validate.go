@@ -0,0 +1,676 @@
+package luma
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ValidationError is a value of a render context that does not match
+// its schema.
+type ValidationError struct {
+	// Path is the JSON pointer of the value, "" for the context itself
+	Path string
+	// Keyword is the schema keyword the value fails, such as "required"
+	Keyword string
+	Message string
+}
+
+// Error formats the error as "path: message".
+func (e *ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + e.Message
+}
+
+// ValidationErrors lists every problem schema validation found, in
+// path order.
+type ValidationErrors []*ValidationError
+
+// Error joins the messages of the errors, one per line.
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As.
+func (errs ValidationErrors) Unwrap() []error {
+	out := make([]error, len(errs))
+	for i, e := range errs {
+		out[i] = e
+	}
+	return out
+}
+
+// Validate checks a Go value against the schema, converting it as it
+// would be for a template: structs become objects with their exported
+// fields, times become RFC 3339 strings and nil values are left out of
+// objects. The error, if any, is a ValidationErrors. Defaults are not
+// applied; see Options.Schema.
+func (s *Schema) Validate(value interface{}) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	inst := instanceEncoder{visiting: make(map[seenKey]bool)}
+	var v validator
+	v.validate(s, inst.value(reflect.ValueOf(value), 0), nil)
+	return v.result()
+}
+
+// schemaDefault is a default a schema supplied for a missing property
+type schemaDefault struct {
+	// path leads to the property: strings for properties and ints for
+	// array indexes
+	path  []interface{}
+	value interface{}
+}
+
+// validContext is a render context that passed schema validation, with
+// the defaults for its missing properties
+type validContext struct {
+	value    interface{}
+	defaults []schemaDefault
+}
+
+// validate checks a render context against a schema, if there is one,
+// and returns the context to render
+func (e *Environment) validate(s *Schema, context interface{}) (interface{}, error) {
+	if s == nil {
+		return context, nil
+	}
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	inst := instanceEncoder{
+		disabled: e.opts.DisabledConversions,
+		visiting: make(map[seenKey]bool),
+	}
+	value := inst.value(reflect.ValueOf(contextValue(context)), 0)
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+
+	var v validator
+	v.applyDefaults(s, value, nil, false)
+	v.validate(s, value, nil)
+	if err := v.result(); err != nil {
+		return nil, fmt.Errorf("invalid context: %w", err)
+	}
+	if len(v.defaults) == 0 {
+		return context, nil
+	}
+	return &validContext{value: context, defaults: v.defaults}, nil
+}
+
+// applyDefaults sets the defaults of the values the schema supplies
+// them for in a converted context
+func (c *validContext) applyDefaults(b *bridge, ctx *lua.LTable) {
+	for _, d := range c.defaults {
+		tbl := ctx
+		last := len(d.path) - 1
+		for _, segment := range d.path[:last] {
+			if tbl = luaChild(tbl, segment); tbl == nil {
+				break
+			}
+		}
+		if tbl == nil {
+			continue
+		}
+		if name, ok := d.path[last].(string); ok {
+			tbl.RawSetString(name, b.toLua(d.value))
+		}
+	}
+}
+
+// luaChild returns the table under a path segment, nil if there is none
+func luaChild(tbl *lua.LTable, segment interface{}) *lua.LTable {
+	var child lua.LValue
+	switch key := segment.(type) {
+	case string:
+		child = tbl.RawGetString(key)
+	case int:
+		child = tbl.RawGetInt(key + 1)
+	}
+	t, _ := child.(*lua.LTable)
+	return t
+}
+
+// instanceEncoder converts Go values to the JSON values schemas
+// describe, mirroring how the bridge converts them
+type instanceEncoder struct {
+	disabled Conversion
+	visiting map[seenKey]bool
+}
+
+func (c *instanceEncoder) converts(conv Conversion) bool {
+	return c.disabled&conv == 0
+}
+
+// value converts rv to nil, bool, float64, string, []interface{} or
+// map[string]interface{}. Functions, channels and cyclic values convert
+// to nil.
+func (c *instanceEncoder) value(rv reflect.Value, depth int) interface{} {
+	if !rv.IsValid() || depth > maxContextDepth {
+		return nil
+	}
+	if v, ok := c.special(rv); ok {
+		return v
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = c.value(rv.Index(i), depth+1)
+		}
+		return list
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		obj := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			if v := c.value(iter.Value(), depth+1); v != nil {
+				obj[fmt.Sprint(iter.Key().Interface())] = v
+			}
+		}
+		return obj
+	case reflect.Struct:
+		obj := make(map[string]interface{})
+		for _, f := range reflect.VisibleFields(rv.Type()) {
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			fv, err := rv.FieldByIndexErr(f.Index)
+			if err != nil {
+				continue
+			}
+			if v := c.value(fv, depth+1); v != nil {
+				obj[name] = v
+			}
+		}
+		return obj
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		key := seenKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if c.visiting[key] {
+			return nil
+		}
+		c.visiting[key] = true
+		defer delete(c.visiting, key)
+		return c.value(rv.Elem(), depth+1)
+	case reflect.Interface:
+		return c.value(rv.Elem(), depth+1)
+	}
+	return nil
+}
+
+// special converts the values the bridge converts specially
+func (c *instanceEncoder) special(rv reflect.Value) (interface{}, bool) {
+	if !rv.CanInterface() {
+		return nil, false
+	}
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Type().Elem() == timeType {
+		rv = rv.Elem()
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return rv.Interface().(time.Time).Format(time.RFC3339Nano), true
+	case durationType:
+		return time.Duration(rv.Int()).String(), true
+	case safeStringType, templateHTMLType:
+		return rv.String(), true
+	}
+
+	if c.converts(ConvertJSONMarshaler) {
+		if m, ok := asInterface(rv, jsonMarshalerType); ok {
+			data, err := m.(json.Marshaler).MarshalJSON()
+			var decoded interface{}
+			if err == nil && json.Unmarshal(data, &decoded) == nil {
+				return decoded, true
+			}
+		}
+	}
+	if c.converts(ConvertTextMarshaler) {
+		if m, ok := asInterface(rv, textMarshalerType); ok {
+			if text, err := m.(encoding.TextMarshaler).MarshalText(); err == nil {
+				return string(text), true
+			}
+		}
+	}
+	if c.converts(ConvertStringer) && indirectType(rv.Type()).Kind() != reflect.Struct {
+		if s, ok := asInterface(rv, stringerType); ok {
+			return s.(fmt.Stringer).String(), true
+		}
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return string(rv.Bytes()), true
+	}
+	return nil, false
+}
+
+// validator collects the problems found validating an instance
+type validator struct {
+	errs     ValidationErrors
+	defaults []schemaDefault
+}
+
+// result returns the problems found as a ValidationErrors, or nil
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].Path < v.errs[j].Path
+	})
+	return v.errs
+}
+
+// report adds a problem with the value at path
+func (v *validator) report(path []interface{}, keyword, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Path:    jsonPointer(path),
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// matches reports whether a value matches a schema, without reporting
+func matches(s *Schema, value interface{}) bool {
+	var sub validator
+	sub.validate(s, value, nil)
+	return len(sub.errs) == 0
+}
+
+// jsonPointer formats a path as a JSON pointer
+func jsonPointer(path []interface{}) string {
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteByte('/')
+		switch s := segment.(type) {
+		case string:
+			b.WriteString(escape.Replace(s))
+		case int:
+			b.WriteString(strconv.Itoa(s))
+		}
+	}
+	return b.String()
+}
+
+// child returns path extended by a segment, leaving path alone
+func child(path []interface{}, segment interface{}) []interface{} {
+	out := make([]interface{}, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, segment)
+}
+
+// appliedSchemas returns the schemas a value must match along with s,
+// whose properties supply defaults: s, the target of its reference and
+// its allOf subschemas, recursively
+func (s *Schema) appliedSchemas() []*Schema {
+	var out []*Schema
+	var walk func(*Schema, int)
+	walk = func(s *Schema, depth int) {
+		if s == nil || s.Bool != nil || depth > 32 {
+			return
+		}
+		out = append(out, s)
+		walk(s.resolved, depth+1)
+		for _, sub := range s.AllOf {
+			walk(sub, depth+1)
+		}
+	}
+	walk(s, 0)
+	return out
+}
+
+// applyDefaults fills missing properties of objects in value with the
+// defaults of their schemas. Defaults inside values that are themselves
+// defaults are not recorded separately.
+func (v *validator) applyDefaults(s *Schema, value interface{}, path []interface{}, inDefault bool) {
+	schemas := s.appliedSchemas()
+	switch val := value.(type) {
+	case map[string]interface{}:
+		filled := make(map[string]bool)
+		for _, s := range schemas {
+			names := make([]string, 0, len(s.Properties))
+			for name := range s.Properties {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				p := s.Properties[name]
+				if _, ok := val[name]; ok || p == nil || p.Default == nil {
+					continue
+				}
+				var def interface{}
+				if json.Unmarshal(p.Default, &def) != nil || def == nil {
+					continue
+				}
+				val[name] = def
+				filled[name] = true
+				if !inDefault {
+					v.defaults = append(v.defaults, schemaDefault{path: child(path, name), value: def})
+				}
+			}
+		}
+		for _, s := range schemas {
+			for name, p := range s.Properties {
+				if item, ok := val[name]; ok && p != nil {
+					v.applyDefaults(p, item, child(path, name), inDefault || filled[name])
+				}
+			}
+		}
+	case []interface{}:
+		for _, s := range schemas {
+			for i, item := range val {
+				if i < len(s.PrefixItems) {
+					v.applyDefaults(s.PrefixItems[i], item, child(path, i), inDefault)
+				} else if s.Items != nil {
+					v.applyDefaults(s.Items, item, child(path, i), inDefault)
+				}
+			}
+		}
+	}
+}
+
+// instanceType returns the JSON type of a converted value
+func instanceType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// hasType reports whether a value is of one of the types
+func hasType(value interface{}, types []string) bool {
+	actual := instanceType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonText formats a value as JSON for messages
+func jsonText(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// validate checks a value against a schema, reporting every problem
+func (v *validator) validate(s *Schema, value interface{}, path []interface{}) {
+	if s == nil {
+		return
+	}
+	if s.Bool != nil {
+		if !*s.Bool {
+			v.report(path, "false", "no value is allowed here")
+		}
+		return
+	}
+	if s.resolved != nil {
+		v.validate(s.resolved, value, path)
+	}
+
+	if len(s.Type) > 0 && !hasType(value, s.Type) {
+		v.report(path, "type", "expected %s, got %s", strings.Join(s.Type, " or "), instanceType(value))
+		return
+	}
+	if s.Enum != nil {
+		found := false
+		for _, option := range s.enum {
+			if reflect.DeepEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.report(path, "enum", "%s is not one of %s", jsonText(value), jsonText(s.enum))
+		}
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.constant, value) {
+		v.report(path, "const", "%s is not %s", jsonText(value), jsonText(s.constant))
+	}
+
+	switch val := value.(type) {
+	case float64:
+		v.number(s, val, path)
+	case string:
+		v.string(s, val, path)
+	case []interface{}:
+		v.array(s, val, path)
+	case map[string]interface{}:
+		v.object(s, val, path)
+	}
+
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, path)
+	}
+	if len(s.AnyOf) > 0 {
+		found := false
+		for _, sub := range s.AnyOf {
+			if matches(sub, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.report(path, "anyOf", "value matches none of the anyOf schemas")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		count := 0
+		for _, sub := range s.OneOf {
+			if matches(sub, value) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.report(path, "oneOf", "value matches %d of the oneOf schemas, want exactly one", count)
+		}
+	}
+	if s.Not != nil && matches(s.Not, value) {
+		v.report(path, "not", "value must not match the schema in not")
+	}
+	if s.If != nil {
+		if matches(s.If, value) {
+			v.validate(s.Then, value, path)
+		} else {
+			v.validate(s.Else, value, path)
+		}
+	}
+}
+
+// number checks the numeric keywords
+func (v *validator) number(s *Schema, n float64, path []interface{}) {
+	if s.Minimum != nil && n < *s.Minimum {
+		v.report(path, "minimum", "%v is less than the minimum %v", n, *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		v.report(path, "maximum", "%v is greater than the maximum %v", n, *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		v.report(path, "exclusiveMinimum", "%v is not greater than %v", n, *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		v.report(path, "exclusiveMaximum", "%v is not less than %v", n, *s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		q := n / *s.MultipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.report(path, "multipleOf", "%v is not a multiple of %v", n, *s.MultipleOf)
+		}
+	}
+}
+
+// string checks the string keywords
+func (v *validator) string(s *Schema, str string, path []interface{}) {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.report(path, "minLength", "string is shorter than %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.report(path, "maxLength", "string is longer than %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		v.report(path, "pattern", "%q does not match %q", str, s.Pattern)
+	}
+}
+
+// array checks the array keywords and the items
+func (v *validator) array(s *Schema, list []interface{}, path []interface{}) {
+	if s.MinItems != nil && len(list) < *s.MinItems {
+		v.report(path, "minItems", "array has fewer than %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(list) > *s.MaxItems {
+		v.report(path, "maxItems", "array has more than %d items", *s.MaxItems)
+	}
+	if s.UniqueItems {
+	unique:
+		for i := range list {
+			for j := i + 1; j < len(list); j++ {
+				if reflect.DeepEqual(list[i], list[j]) {
+					v.report(path, "uniqueItems", "items %d and %d are equal", i, j)
+					break unique
+				}
+			}
+		}
+	}
+	for i, item := range list {
+		if i < len(s.PrefixItems) {
+			v.validate(s.PrefixItems[i], item, child(path, i))
+		} else {
+			v.validate(s.Items, item, child(path, i))
+		}
+	}
+	if s.Contains != nil {
+		count := 0
+		for _, item := range list {
+			if matches(s.Contains, item) {
+				count++
+			}
+		}
+		min := 1
+		if s.MinContains != nil {
+			min = *s.MinContains
+		}
+		if count < min {
+			v.report(path, "contains", "array has %d items matching contains, want at least %d", count, min)
+		}
+		if s.MaxContains != nil && count > *s.MaxContains {
+			v.report(path, "maxContains", "array has %d items matching contains, want at most %d", count, *s.MaxContains)
+		}
+	}
+}
+
+// object checks the object keywords and the properties
+func (v *validator) object(s *Schema, obj map[string]interface{}, path []interface{}) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.report(path, "required", "missing required property %q", name)
+		}
+	}
+	if s.MinProperties != nil && len(obj) < *s.MinProperties {
+		v.report(path, "minProperties", "object has fewer than %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(obj) > *s.MaxProperties {
+		v.report(path, "maxProperties", "object has more than %d properties", *s.MaxProperties)
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := obj[name]
+		for _, dep := range s.DependentRequired[name] {
+			if _, ok := obj[dep]; !ok {
+				v.report(path, "dependentRequired", "property %q requires property %q", name, dep)
+			}
+		}
+		if s.PropertyNames != nil && !matches(s.PropertyNames, name) {
+			v.report(path, "propertyNames", "property name %q does not match propertyNames", name)
+		}
+
+		evaluated := false
+		if p, ok := s.Properties[name]; ok {
+			v.property(p, name, value, path)
+			evaluated = true
+		}
+		for pattern, re := range s.patterns {
+			if re.MatchString(name) {
+				v.property(s.PatternProperties[pattern], name, value, path)
+				evaluated = true
+			}
+		}
+		if !evaluated && s.AdditionalProperties != nil {
+			v.property(s.AdditionalProperties, name, value, path)
+		}
+	}
+}
+
+// property checks the value of a property, reporting properties a false
+// schema forbids at the object
+func (v *validator) property(s *Schema, name string, value interface{}, path []interface{}) {
+	if s != nil && s.Bool != nil && !*s.Bool {
+		v.report(path, "additionalProperties", "property %q is not allowed", name)
+		return
+	}
+	v.validate(s, value, child(path, name))
+}
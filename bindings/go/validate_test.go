@@ -0,0 +1,195 @@
+package luma_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+const deploySchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "image"],
+	"properties": {
+		"name": {"type": "string", "pattern": "^[a-z][a-z0-9-]*$"},
+		"image": {"$ref": "#/$defs/image"},
+		"replicas": {"type": "integer", "minimum": 1, "default": 2},
+		"env": {"enum": ["dev", "prod"], "default": "dev"},
+		"ports": {"type": "array", "items": {"type": "integer"}, "uniqueItems": true},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"image": {
+			"type": "object",
+			"required": ["repository"],
+			"properties": {
+				"repository": {"type": "string", "minLength": 1},
+				"tag": {"type": "string", "default": "latest"}
+			}
+		}
+	}
+}`
+
+type deployImage struct {
+	Repository string `luma:"repository"`
+}
+
+type deployValues struct {
+	Name  string       `luma:"name"`
+	Image *deployImage `luma:"image"`
+	Ports []int        `luma:"ports"`
+}
+
+func mustSchema(t *testing.T, text string) *luma.Schema {
+	t.Helper()
+	s, err := luma.ParseSchema([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchemaAppliesDefaults(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Schema: mustSchema(t, deploySchema)})
+	out, err := env.Render("$name $image.repository:$image.tag x$replicas $env", map[string]interface{}{
+		"name":  "web",
+		"image": map[string]interface{}{"repository": "nginx"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "web nginx:latest x2 dev" {
+		t.Errorf("Render() = %q", out)
+	}
+}
+
+func TestSchemaDefaultsForStructs(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Loader: luma.MapLoader{
+		"deploy.yaml": "${image.repository}:${image.tag} ${ports | length}",
+	}})
+	tmpl, err := env.GetTemplate("deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.SetSchema(mustSchema(t, deploySchema)); err != nil {
+		t.Fatal(err)
+	}
+
+	values := deployValues{Name: "web", Image: &deployImage{Repository: "nginx"}, Ports: []int{80}}
+	out, err := tmpl.Execute(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "nginx:latest 1" {
+		t.Errorf("Execute() = %q", out)
+	}
+}
+
+func TestSchemaReportsAllErrors(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Schema: mustSchema(t, deploySchema)})
+	_, err := env.Render("$name", map[string]interface{}{
+		"name":     "Web",
+		"image":    map[string]interface{}{"repository": ""},
+		"replicas": 0,
+		"env":      "staging",
+		"ports":    []int{80, 80},
+		"labels":   map[string]interface{}{"app": 1},
+		"extra":    true,
+	})
+
+	var errs luma.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Render() error = %v, want luma.ValidationErrors", err)
+	}
+	want := []string{
+		`/: property "extra" is not allowed`,
+		`/env: "staging" is not one of ["dev","prod"]`,
+		`/image/repository: string is shorter than 1 characters`,
+		`/labels/app: expected string, got integer`,
+		`/name: "Web" does not match "^[a-z][a-z0-9-]*$"`,
+		`/ports: items 0 and 1 are equal`,
+		`/replicas: 0 is less than the minimum 1`,
+	}
+	if got := errs.Error(); got != strings.Join(want, "\n") {
+		t.Errorf("errors =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	var first *luma.ValidationError
+	if !errors.As(err, &first) || first.Keyword != "additionalProperties" || first.Path != "" {
+		t.Errorf("first error = %+v", first)
+	}
+}
+
+func TestSchemaRequired(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{Schema: mustSchema(t, deploySchema)})
+	_, err := env.Render("$name", deployValues{Name: "web"})
+	if err == nil || !strings.Contains(err.Error(), `/: missing required property "image"`) {
+		t.Errorf("Render() error = %v, want a missing image", err)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := mustSchema(t, `{
+		"type": "object",
+		"properties": {
+			"when": {"type": "string", "pattern": "^2024-"},
+			"timeout": {"type": "string"},
+			"mode": {"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 0}]},
+			"kind": {"not": {"const": "legacy"}},
+			"tls": {"type": "object"}
+		},
+		"if": {"properties": {"tls": {"const": true}}, "required": ["tls"]},
+		"then": {"required": ["cert"]}
+	}`)
+
+	ok := map[string]interface{}{
+		"when":    time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"timeout": 3 * time.Second,
+		"mode":    1.5,
+	}
+	if err := s.Validate(ok); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	bad := map[string]interface{}{"mode": 3, "kind": "legacy"}
+	err := s.Validate(bad)
+	want := "/kind: value must not match the schema in not\n/mode: value matches 2 of the oneOf schemas, want exactly one"
+	if err == nil || err.Error() != want {
+		t.Errorf("Validate() = %v, want %q", err, want)
+	}
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	if _, err := luma.ParseSchema([]byte(`{"properties": {"a": {"$ref": "#/$defs/missing"}}}`)); err == nil {
+		t.Error("ParseSchema() with a dangling $ref = nil, want an error")
+	}
+	if _, err := luma.ParseSchema([]byte(`{"pattern": "("}`)); err == nil {
+		t.Error("ParseSchema() with a bad pattern = nil, want an error")
+	}
+}
+
+func TestSchemaInvalidConcurrentRenders(t *testing.T) {
+	schema := &luma.Schema{
+		Enum:       []json.RawMessage{json.RawMessage(`{"name": "x"}`)},
+		Properties: map[string]*luma.Schema{"name": {Ref: "#/$defs/missing"}},
+	}
+	env := luma.NewEnvironment(luma.Options{Schema: schema})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.Render("$name", map[string]interface{}{"name": "x"})
+			if err == nil || !strings.Contains(err.Error(), "invalid schema") {
+				t.Errorf("Render() error = %v, want an invalid schema", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,442 @@
+package luma
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Conversion identifies an interface that Go values are converted
+// through when passed to templates.
+type Conversion uint
+
+const (
+	// ConvertJSONMarshaler renders json.Marshaler values as the value
+	// their JSON encoding decodes to.
+	ConvertJSONMarshaler Conversion = 1 << iota
+
+	// ConvertTextMarshaler renders encoding.TextMarshaler values as
+	// their text form.
+	ConvertTextMarshaler
+
+	// ConvertStringer renders fmt.Stringer values through String.
+	// Structs keep their fields and only print through String.
+	ConvertStringer
+)
+
+// Lua type names of the rich value metatables
+const (
+	timeTypeName     = "luma.time"
+	durationTypeName = "luma.duration"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// timeLayouts are tried in order when a string is used as a time
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// converts reports whether the environment converts values through c
+func (b *bridge) converts(c Conversion) bool {
+	return b.env == nil || b.env.opts.DisabledConversions&c == 0
+}
+
+// specialToLua converts values with a dedicated representation: times,
+// durations, byte slices and types implementing the enabled marshaling
+// interfaces. It reports false for values that convert by kind.
+func (b *bridge) specialToLua(rv reflect.Value) (lua.LValue, bool) {
+	if !rv.CanInterface() {
+		return nil, false
+	}
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Type().Elem() == timeType {
+		rv = rv.Elem()
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return b.timeToLua(rv.Interface().(time.Time)), true
+	case durationType:
+		return b.durationToLua(time.Duration(rv.Int())), true
+	case safeStringType, templateHTMLType:
+		return b.safeToLua(rv.String()), true
+	}
+
+	if b.converts(ConvertJSONMarshaler) {
+		if m, ok := asInterface(rv, jsonMarshalerType); ok {
+			data, err := m.(json.Marshaler).MarshalJSON()
+			var decoded interface{}
+			if err == nil && json.Unmarshal(data, &decoded) == nil {
+				return b.toLua(decoded), true
+			}
+		}
+	}
+
+	if b.converts(ConvertTextMarshaler) {
+		if m, ok := asInterface(rv, textMarshalerType); ok {
+			if text, err := m.(encoding.TextMarshaler).MarshalText(); err == nil {
+				return lua.LString(text), true
+			}
+		}
+	}
+
+	if b.converts(ConvertStringer) && indirectType(rv.Type()).Kind() != reflect.Struct {
+		if s, ok := asInterface(rv, stringerType); ok {
+			return lua.LString(s.(fmt.Stringer).String()), true
+		}
+	}
+
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return lua.LString(rv.Bytes()), true
+	}
+
+	return nil, false
+}
+
+// asInterface returns rv as iface if it, or a pointer to it, implements
+// the interface.
+func asInterface(rv reflect.Value, iface reflect.Type) (interface{}, bool) {
+	if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+		return nil, false
+	}
+	if rv.Type().Implements(iface) {
+		return rv.Interface(), true
+	}
+	if rv.CanAddr() && reflect.PointerTo(rv.Type()).Implements(iface) {
+		return rv.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// stringerMetamethod returns a __tostring function for structs that
+// implement fmt.Stringer, or nil.
+func (b *bridge) stringerMetamethod(recv reflect.Value) *lua.LFunction {
+	if !b.converts(ConvertStringer) {
+		return nil
+	}
+	s, ok := asInterface(recv, stringerType)
+	if !ok {
+		return nil
+	}
+	return b.L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(s.(fmt.Stringer).String()))
+		return 1
+	})
+}
+
+// timeToLua wraps a time.Time in a userdata that formats, compares and
+// supports arithmetic with durations.
+func (b *bridge) timeToLua(t time.Time) *lua.LUserData {
+	ud := b.L.NewUserData()
+	ud.Value = t
+	b.L.SetMetatable(ud, b.timeMetatable())
+	return ud
+}
+
+// durationToLua wraps a time.Duration in a userdata
+func (b *bridge) durationToLua(d time.Duration) *lua.LUserData {
+	ud := b.L.NewUserData()
+	ud.Value = d
+	b.L.SetMetatable(ud, b.durationMetatable())
+	return ud
+}
+
+func (b *bridge) timeMetatable() lua.LValue {
+	if mt := b.L.GetTypeMetatable(timeTypeName); mt != lua.LNil {
+		return mt
+	}
+
+	layout := time.RFC3339
+	if b.env != nil && b.env.opts.TimeFormat != "" {
+		layout = b.env.opts.TimeFormat
+	}
+
+	mt := b.L.NewTypeMetatable(timeTypeName)
+	b.L.SetFuncs(mt, map[string]lua.LGFunction{
+		"__tostring": func(L *lua.LState) int {
+			L.Push(lua.LString(checkTime(L, 1).Format(layout)))
+			return 1
+		},
+		"__eq": func(L *lua.LState) int {
+			L.Push(lua.LBool(checkTime(L, 1).Equal(checkTime(L, 2))))
+			return 1
+		},
+		"__lt": func(L *lua.LState) int {
+			L.Push(lua.LBool(checkTime(L, 1).Before(checkTime(L, 2))))
+			return 1
+		},
+		"__le": func(L *lua.LState) int {
+			L.Push(lua.LBool(!checkTime(L, 1).After(checkTime(L, 2))))
+			return 1
+		},
+		"__add": func(L *lua.LState) int {
+			// time + duration or duration + time
+			t, d := L.Get(1), L.Get(2)
+			if _, ok := timeValue(d); ok {
+				t, d = d, t
+			}
+			L.Push(b.timeToLua(checkTimeValue(L, t).Add(checkDurationValue(L, d))))
+			return 1
+		},
+		"__sub": func(L *lua.LState) int {
+			t := checkTime(L, 1)
+			if other, ok := timeValue(L.Get(2)); ok {
+				L.Push(b.durationToLua(t.Sub(other)))
+				return 1
+			}
+			L.Push(b.timeToLua(t.Add(-checkDurationValue(L, L.Get(2)))))
+			return 1
+		},
+	})
+	mt.RawSetString("__index", b.userDataMethods())
+	return mt
+}
+
+func (b *bridge) durationMetatable() lua.LValue {
+	if mt := b.L.GetTypeMetatable(durationTypeName); mt != lua.LNil {
+		return mt
+	}
+
+	mt := b.L.NewTypeMetatable(durationTypeName)
+	b.L.SetFuncs(mt, map[string]lua.LGFunction{
+		"__tostring": func(L *lua.LState) int {
+			L.Push(lua.LString(checkDurationValue(L, L.Get(1)).String()))
+			return 1
+		},
+		"__eq": func(L *lua.LState) int {
+			L.Push(lua.LBool(checkDurationValue(L, L.Get(1)) == checkDurationValue(L, L.Get(2))))
+			return 1
+		},
+		"__lt": func(L *lua.LState) int {
+			L.Push(lua.LBool(checkDurationValue(L, L.Get(1)) < checkDurationValue(L, L.Get(2))))
+			return 1
+		},
+		"__le": func(L *lua.LState) int {
+			L.Push(lua.LBool(checkDurationValue(L, L.Get(1)) <= checkDurationValue(L, L.Get(2))))
+			return 1
+		},
+		"__add": func(L *lua.LState) int {
+			if _, ok := timeValue(L.Get(2)); ok {
+				// duration + time
+				L.Push(b.timeToLua(checkTimeValue(L, L.Get(2)).Add(checkDurationValue(L, L.Get(1)))))
+				return 1
+			}
+			L.Push(b.durationToLua(checkDurationValue(L, L.Get(1)) + checkDurationValue(L, L.Get(2))))
+			return 1
+		},
+		"__sub": func(L *lua.LState) int {
+			L.Push(b.durationToLua(checkDurationValue(L, L.Get(1)) - checkDurationValue(L, L.Get(2))))
+			return 1
+		},
+		"__unm": func(L *lua.LState) int {
+			L.Push(b.durationToLua(-checkDurationValue(L, L.Get(1))))
+			return 1
+		},
+		"__mul": func(L *lua.LState) int {
+			d, n := L.Get(1), L.Get(2)
+			if _, ok := d.(lua.LNumber); ok {
+				d, n = n, d
+			}
+			factor, ok := n.(lua.LNumber)
+			if !ok {
+				L.RaiseError("a duration can only be multiplied by a number")
+			}
+			L.Push(b.durationToLua(time.Duration(float64(checkDurationValue(L, d)) * float64(factor))))
+			return 1
+		},
+		"__div": func(L *lua.LState) int {
+			d := checkDurationValue(L, L.Get(1))
+			if other, ok := durationValue(L.Get(2)); ok {
+				// duration / duration is a plain ratio
+				L.Push(lua.LNumber(float64(d) / float64(other)))
+				return 1
+			}
+			L.Push(b.durationToLua(time.Duration(float64(d) / float64(L.CheckNumber(2)))))
+			return 1
+		},
+	})
+	mt.RawSetString("__index", b.userDataMethods())
+	return mt
+}
+
+// userDataMethods returns an __index function exposing the exported
+// methods of a userdata's Go value, such as $created.Year().
+func (b *bridge) userDataMethods() *lua.LFunction {
+	return b.L.NewFunction(func(L *lua.LState) int {
+		ud := L.CheckUserData(1)
+		name := L.CheckString(2)
+		recv := reflect.ValueOf(ud.Value)
+		method := recv.MethodByName(name)
+		if !method.IsValid() || !b.methodAllowed(recv.Type(), name) {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(b.funcToLua(recv.Type().Name()+"."+name, method))
+		return 1
+	})
+}
+
+func timeValue(lv lua.LValue) (time.Time, bool) {
+	if ud, ok := lv.(*lua.LUserData); ok {
+		t, ok := ud.Value.(time.Time)
+		return t, ok
+	}
+	return time.Time{}, false
+}
+
+func durationValue(lv lua.LValue) (time.Duration, bool) {
+	if ud, ok := lv.(*lua.LUserData); ok {
+		d, ok := ud.Value.(time.Duration)
+		return d, ok
+	}
+	return 0, false
+}
+
+func checkTime(L *lua.LState, n int) time.Time {
+	return checkTimeValue(L, L.Get(n))
+}
+
+func checkTimeValue(L *lua.LState, lv lua.LValue) time.Time {
+	t, err := toTime(lv)
+	if err != nil {
+		L.RaiseError("%s", err.Error())
+	}
+	return t
+}
+
+// checkDurationValue accepts durations and duration strings like "90m"
+func checkDurationValue(L *lua.LState, lv lua.LValue) time.Duration {
+	if d, ok := durationValue(lv); ok {
+		return d
+	}
+	if s, ok := lv.(lua.LString); ok {
+		d, err := time.ParseDuration(string(s))
+		if err == nil {
+			return d
+		}
+	}
+	L.RaiseError("expected a duration, got %s", lv.Type())
+	return 0
+}
+
+// toTime converts times, time strings and Unix timestamps to a time
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case *lua.LUserData:
+		return toTime(v.Value)
+	case lua.LString:
+		return toTime(string(v))
+	case lua.LNumber:
+		return toTime(float64(v))
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a time", v)
+	case float64:
+		sec := int64(v)
+		return time.Unix(sec, int64((v-float64(sec))*1e9)).UTC(), nil
+	case int:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("expected a time, got %T", v)
+}
+
+// dateFilter formats a time. The format may be a Go layout
+// ("2006-01-02") or a strftime pattern ("%Y-%m-%d").
+func dateFilter(value interface{}, format string) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		return t.Format(time.RFC3339), nil
+	}
+	if strings.Contains(format, "%") {
+		return strftime(t, format), nil
+	}
+	return t.Format(format), nil
+}
+
+// isoformatFilter formats a time as ISO 8601
+func isoformatFilter(value interface{}) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// strftimeLayouts maps strftime directives to Go layout fragments
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'Z': "MST",
+	'z': "-0700",
+	'j': "002",
+}
+
+// strftime formats t with a C strftime-style pattern
+func strftime(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch d := format[i]; d {
+		case '%':
+			sb.WriteByte('%')
+		case 'f':
+			fmt.Fprintf(&sb, "%06d", t.Nanosecond()/1000)
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		default:
+			if layout, ok := strftimeLayouts[d]; ok {
+				sb.WriteString(t.Format(layout))
+			} else {
+				sb.WriteByte('%')
+				sb.WriteByte(d)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package luma_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/santosr2/luma/bindings/go"
+)
+
+type level int
+
+func (l level) String() string {
+	return [...]string{"debug", "info", "warn"}[l]
+}
+
+type release struct {
+	Name     string
+	Released time.Time
+	Window   time.Duration
+	Checksum []byte
+	Address  net.IP
+	Level    level
+}
+
+func (r release) String() string {
+	return "release " + r.Name
+}
+
+type money int64
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"cents": int64(m), "currency": "EUR"})
+}
+
+func TestRichValues(t *testing.T) {
+	released := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	context := map[string]interface{}{
+		"release": release{
+			Name:     "v1",
+			Released: released,
+			Window:   90 * time.Minute,
+			Checksum: []byte("abc123"),
+			Address:  net.ParseIP("10.0.0.1"),
+			Level:    2,
+		},
+		"deadline": released.Add(48 * time.Hour),
+		"price":    money(1999),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"time renders as RFC 3339", "$release.Released", "2026-10-17T09:30:00Z"},
+		{"date filter with strftime", "${release.Released | date('%Y-%m-%d %H:%M')}", "2026-10-17 09:30"},
+		{"date filter with Go layout", "${release.Released | date('Jan 2, 2006')}", "Oct 17, 2026"},
+		{"date filter parses strings", "${'2026-01-02' | date('%d/%m/%Y')}", "02/01/2026"},
+		{"isoformat filter", "${release.Released | isoformat}", "2026-10-17T09:30:00Z"},
+		{"time methods", "${release.Released.Year()}", "2026"},
+		{"time comparison", "${release.Released < deadline}", "true"},
+		{"time equality", "${release.Released == deadline}", "false"},
+		{"time minus time", "${deadline - release.Released}", "48h0m0s"},
+		{"time plus duration", "${release.Released + release.Window}", "2026-10-17T11:00:00Z"},
+		{"time plus duration string", "${release.Released + '24h'}", "2026-10-18T09:30:00Z"},
+		{"duration", "$release.Window", "1h30m0s"},
+		{"duration scaling", "${release.Window * 2}", "3h0m0s"},
+		{"byte slice as string", "$release.Checksum", "abc123"},
+		{"text marshaler", "$release.Address", "10.0.0.1"},
+		{"stringer", "$release.Level", "warn"},
+		{"stringer struct keeps fields", "$release ($release.Name)", "release v1 (v1)"},
+		{"json marshaler", "$price.cents $price.currency", "1999 EUR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := luma.Render(tt.template, context)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionOptions(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{
+		DisabledConversions: luma.ConvertStringer,
+		TimeFormat:          "2006-01-02",
+	})
+	context := map[string]interface{}{
+		"level": level(1),
+		"day":   time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC),
+	}
+
+	got, err := env.Render("$level $day", context)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "1 2026-10-17"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestTimeArguments(t *testing.T) {
+	env := luma.NewEnvironment(luma.Options{})
+	env.AddGlobal("weekday", func(t time.Time) string { return t.Weekday().String() })
+	env.AddGlobal("minutes", func(d time.Duration) float64 { return d.Minutes() })
+
+	got, err := env.Render("${weekday('2026-10-17')} ${minutes('2h')}", nil)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "Saturday 120"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
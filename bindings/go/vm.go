@@ -0,0 +1,152 @@
+package luma
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// vm is a Lua state with the Luma modules loaded. The Luma entry points
+// are looked up once and called with Lua values, so templates never
+// pass through generated Lua source.
+type vm struct {
+	L      *lua.LState
+	bridge *bridge
+
+	// generation of the environment configuration this vm was built from
+	generation uint64
+
+	render     lua.LValue // luma.render(template, context, options)
+	parse      lua.LValue // luma.parse(template, options)
+	parseAll   lua.LValue // luma.parse_all(template, options)
+	compile    lua.LValue // luma.compile(template, options)
+	invalidate lua.LValue // luma.invalidate(name)
+
+	// changes is the last loader change applied to the template cache
+	changes uint64
+
+	// hooks tracks instrumented calls when Options.Hooks is set
+	hooks *hookState
+
+	// takeCoverage is runtime.take_coverage when Options.Coverage is set
+	takeCoverage lua.LValue
+	// kind tells what the vm's templates record
+	kind vmKind
+	// takeSourceMap is runtime.take_source_map in vms that record
+	// source maps
+	takeSourceMap lua.LValue
+	// beginAccess and takeAccess are runtime.begin_access and
+	// runtime.take_access in vms that track access
+	beginAccess, takeAccess lua.LValue
+	// setTranslator is runtime.set_translator when the environment has
+	// catalogs
+	setTranslator lua.LValue
+}
+
+// newVM creates a Lua state configured for env
+func newVM(env *Environment, generation uint64) (*vm, error) {
+	L := env.opts.Sandbox.newState()
+	env.installRandom(L)
+	env.installClock(L)
+
+	if err := loadLumaModules(L); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to load Luma modules: %w", err)
+	}
+
+	mod, err := requireModule(L, "luma")
+	if err != nil {
+		L.Close()
+		return nil, err
+	}
+
+	v := &vm{
+		L:          L,
+		bridge:     newBridge(L, env),
+		generation: generation,
+		render:     L.GetField(mod, "render"),
+		parse:      L.GetField(mod, "parse"),
+		parseAll:   L.GetField(mod, "parse_all"),
+		compile:    L.GetField(mod, "compile"),
+		invalidate: L.GetField(mod, "invalidate"),
+	}
+
+	if err := env.installLoader(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.installAutoescape(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.installSyntax(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.installCodeCache(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.installCodeDump(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if v.hooks, err = env.installHooks(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if v.takeCoverage, err = env.installCoverage(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.registerFilters(L, v.bridge); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if err := env.registerExtensions(L, v.bridge); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if v.setTranslator, err = env.installTranslations(L); err != nil {
+		L.Close()
+		return nil, err
+	}
+	return v, nil
+}
+
+// enable makes the vm's templates record what kind asks for. It is done
+// before any template is compiled, so every template the vm caches
+// records it.
+func (v *vm) enable(kind vmKind) error {
+	v.kind = kind
+	if kind&vmSourceMaps != 0 {
+		if err := v.enableSourceMaps(); err != nil {
+			return err
+		}
+	}
+	if kind&vmTrackAccess != 0 {
+		if err := v.enableAccessTracking(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call calls a Lua function in protected mode and returns its result
+func (v *vm) call(fn lua.LValue, args ...lua.LValue) (lua.LValue, error) {
+	if err := v.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		return lua.LNil, err
+	}
+	ret := v.L.Get(-1)
+	v.L.Pop(1)
+	return ret, nil
+}
+
+// reset clears per-render state before the vm is reused
+func (v *vm) reset() {
+	v.bridge.seen = make(map[seenKey]*lua.LTable)
+	v.L.SetTop(0)
+	if v.hooks != nil {
+		v.hooks.frames = v.hooks.frames[:0]
+	}
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package luma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// inotifyMask selects the events that may change a template
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Watch starts watching the loader's directory tree with inotify, so
+// changes are picked up as they happen instead of by checking files
+// before each render. Call Close to stop watching.
+func (l *FileSystemLoader) Watch() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("watching templates: %w", err)
+	}
+	w := &inotifyWatcher{
+		file: os.NewFile(uintptr(fd), "inotify"),
+		fd:   fd,
+		dirs: make(map[int32]string),
+	}
+	if err := w.addTree(l.root); err != nil {
+		w.Close()
+		return fmt.Errorf("watching templates: %w", err)
+	}
+
+	l.mu.Lock()
+	old := l.watcher
+	l.watcher = w
+	l.watching = true
+	l.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	go w.run(l)
+	return nil
+}
+
+// inotifyWatcher watches a directory tree with inotify
+type inotifyWatcher struct {
+	file *os.File
+	fd   int
+
+	mu   sync.Mutex
+	dirs map[int32]string // watch descriptor to directory
+}
+
+// addTree watches dir and every directory below it
+func (w *inotifyWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.dirs[int32(wd)] = path
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// run reads events until the watcher is closed
+func (w *inotifyWatcher) run(l *FileSystemLoader) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[start:start+size], "\x00"))
+			off = start + size
+
+			w.mu.Lock()
+			dir, ok := w.dirs[wd]
+			if mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, wd)
+			}
+			w.mu.Unlock()
+			if !ok || name == "" {
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			if mask&syscall.IN_ISDIR != 0 {
+				if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					// Errors leave the new directory unwatched
+					_ = w.addTree(path)
+				}
+				continue
+			}
+			l.fileChanged(path)
+		}
+	}
+}
+
+// Close stops the watcher
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
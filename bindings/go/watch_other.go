@@ -0,0 +1,15 @@
+//go:build !linux
+
+package luma
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Watch reports errors.ErrUnsupported: watching is only implemented on
+// Linux. Elsewhere the loader checks files for changes before each
+// render.
+func (l *FileSystemLoader) Watch() error {
+	return fmt.Errorf("watching templates: %w", errors.ErrUnsupported)
+}
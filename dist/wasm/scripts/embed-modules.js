@@ -42,6 +42,9 @@ const MODULES = {
   // Filters
   'luma.filters': 'luma/filters/init.lua',
   
+  // Extensions
+  'luma.extensions': 'luma/extensions/init.lua',
+  
   // Utils
   'luma.utils': 'luma/utils/init.lua',
   'luma.utils.compat': 'luma/utils/compat.lua',
@@ -103,9 +103,13 @@ func LoadChart(chartPath string) (*Chart, error) {
 	return chart, nil
 }
 
-// RenderTemplates renders all templates in a chart
+// RenderTemplates renders all templates in a chart. A failing template
+// does not stop the others: the errors of every failing template,
+// including all syntax errors of each, are returned together as
+// luma.Errors.
 func RenderTemplates(chart *Chart, context map[string]interface{}, showOnly []string) (map[string]string, error) {
 	results := make(map[string]string)
+	var errs luma.Errors
 
 	for _, tmpl := range chart.Templates {
 		// Filter by showOnly if specified
@@ -122,10 +126,16 @@ func RenderTemplates(chart *Chart, context map[string]interface{}, showOnly []st
 			}
 		}
 
-		// Render template
-		rendered, err := luma.Render(tmpl.Content, context)
+		// Render template, compiling it first to report all its syntax errors
+		compiled, err := luma.Compile(tmpl.Content)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render %s: %w", tmpl.Name, err)
+			errs = errs.Append(tmpl.Name, err)
+			continue
+		}
+		rendered, err := compiled.Execute(context)
+		if err != nil {
+			errs = errs.Append(tmpl.Name, err)
+			continue
 		}
 
 		// Skip empty templates
@@ -136,5 +146,8 @@ func RenderTemplates(chart *Chart, context map[string]interface{}, showOnly []st
 		results[tmpl.Name] = rendered
 	}
 
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
@@ -1,12 +1,14 @@
 package chart_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/santosr2/helm-luma/internal/chart"
+	luma "github.com/santosr2/luma-go"
 )
 
 func TestLoadChart(t *testing.T) {
@@ -257,3 +259,29 @@ kind: Ingress
 		}
 	}
 }
+
+func TestRenderTemplatesReportsAllErrors(t *testing.T) {
+	c := &chart.Chart{
+		Templates: []chart.Template{
+			{Name: "templates/bad.yaml", Content: "name: ${ 1 + }\nkind: Service\nport: ${ ) }"},
+			{Name: "templates/good.yaml", Content: "kind: ConfigMap"},
+			{Name: "templates/fails.yaml", Content: "kind: Secret\ndata: ${ 1 + {} }"},
+		},
+	}
+
+	_, err := chart.RenderTemplates(c, map[string]interface{}{}, nil)
+	var errs luma.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("RenderTemplates() error = %v, want luma.Errors", err)
+	}
+
+	want := []string{"templates/bad.yaml:1", "templates/bad.yaml:3", "templates/fails.yaml:2"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(errs[i].Error(), w+":") {
+			t.Errorf("error %d = %v, want it at %s", i, errs[i], w)
+		}
+	}
+}
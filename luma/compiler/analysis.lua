@@ -0,0 +1,621 @@
+--- Static analysis of templates
+-- Finds the context paths a template reads without rendering it. Loop
+-- variables and assignments of paths stand for the path they were
+-- assigned, so `@for c in containers` followed by `$c.image` reads
+-- containers[].image. Includes with context are followed through the
+-- runtime loader.
+-- @module luma.compiler.analysis
+
+local ast = require("luma.parser.ast")
+
+local analysis = {}
+
+local N = ast.types
+
+--- Path segment standing for any element of a list or value of a mapping
+analysis.ELEMENT = "[]"
+
+--- Names the runtime provides rather than the context
+local BUILTINS = {
+	loop = true,
+	super = true,
+	namespace = true,
+	caller = true,
+	_ = true,
+	gettext = true,
+	ngettext = true,
+}
+
+--- Filters whose output holds the same elements as their input, so
+-- that looping over the output loops over the input path
+local PRESERVING_FILTERS = {
+	default = true,
+	d = true,
+	sort = true,
+	reverse = true,
+	unique = true,
+	list = true,
+	selectattr = true,
+	rejectattr = true,
+}
+
+--- Filters that supply a value for an undefined input
+local DEFAULT_FILTERS = {
+	default = true,
+	d = true,
+}
+
+--- Tests that check whether a value is defined
+local DEFINED_TESTS = {
+	defined = true,
+	undefined = true,
+	none = true,
+}
+
+local Walker = {}
+Walker.__index = Walker
+
+--- Create a scope inheriting the bindings of parent
+-- Bindings map local names to the path they stand for, or to false for
+-- values that are not context paths.
+local function child_scope(parent)
+	return setmetatable({}, { __index = parent })
+end
+
+--- Copy a path, so that extending the copy leaves the path alone
+local function copy_path(path)
+	local copy = { segments = {}, positions = {} }
+	for i, segment in ipairs(path.segments) do
+		copy.segments[i] = segment
+		copy.positions[i] = path.positions[i]
+	end
+	return copy
+end
+
+--- Key identifying the first n segments of a path
+local function path_key(segments, n)
+	return table.concat(segments, "\0", 1, n)
+end
+
+--- Whether a path or one of its prefixes is tested to be defined by an
+-- enclosing if
+function Walker:guarded(path)
+	for n = 1, #path.segments do
+		if (self.guards[path_key(path.segments, n)] or 0) > 0 then
+			return true
+		end
+	end
+	return false
+end
+
+--- Position of a node, as { template, line, column }
+function Walker:position(node)
+	local template = node.template
+	if template == nil then
+		template = self.name
+	end
+	return { template or false, node.line or 0, node.column or 0 }
+end
+
+--- Record a reference to a context path
+-- @param path table Path from Walker:path
+-- @param node table Node the path is used at
+-- @param fields table|nil Extra fields: iterate, call
+function Walker:record(path, node, fields)
+	local ref = {
+		path = path.segments,
+		positions = path.positions,
+		position = self:position(node),
+	}
+	for k, v in pairs(fields or {}) do
+		ref[k] = v
+	end
+	if self:guarded(path) then
+		ref.optional = true
+	end
+	self.refs[#self.refs + 1] = ref
+end
+
+--- Resolve an identifier, member or index chain to the context path it
+-- reads, visiting the expressions it contains
+-- @return table|nil { segments, positions }, nil if not a context path
+function Walker:path(node, scope)
+	local t = node.type
+	if t == N.IDENTIFIER or t == "IDENT" then
+		if node.include_output then
+			return nil
+		end
+		local binding = scope[node.name]
+		if binding ~= nil then
+			if not binding then
+				return nil
+			end
+			return copy_path(binding)
+		end
+		if BUILTINS[node.name] then
+			return nil
+		end
+		return { segments = { node.name }, positions = { self:position(node) } }
+	end
+
+	local segment
+	if t == N.MEMBER_ACCESS then
+		segment = node.member
+	elseif t == N.INDEX_ACCESS then
+		if node.index.type == N.LITERAL and node.index.literal_type == "string" then
+			segment = node.index.value
+		else
+			self:expression(node.index, scope)
+			segment = analysis.ELEMENT
+		end
+	else
+		self:expression(node, scope)
+		return nil
+	end
+
+	local base = self:path(node.object, scope)
+	if not base then
+		return nil
+	end
+	table.insert(base.segments, segment)
+	table.insert(base.positions, self:position(node))
+	return base
+end
+
+--- Visit a list of expressions and the values of named arguments
+function Walker:arguments(args, named_args, scope)
+	for _, arg in ipairs(args or {}) do
+		self:expression(arg, scope)
+	end
+	for _, arg in pairs(named_args or {}) do
+		self:expression(arg, scope)
+	end
+end
+
+--- Visit an expression, recording the context paths it reads
+-- @return table|nil The path the expression's value comes from
+function Walker:expression(node, scope)
+	if type(node) ~= "table" then
+		return nil
+	end
+	local t = node.type
+
+	if t == N.IDENTIFIER or t == "IDENT" or t == N.MEMBER_ACCESS or t == N.INDEX_ACCESS then
+		local path = self:path(node, scope)
+		if path then
+			self:record(path, node)
+		end
+		return path
+	end
+
+	if t == N.FUNCTION_CALL then
+		local callee = node.callee
+		if callee.type == N.IDENTIFIER or callee.type == "IDENT" or callee.type == N.MEMBER_ACCESS then
+			local path = self:path(callee, scope)
+			if path then
+				self:record(path, callee, { call = not node.text_call or nil })
+			end
+		else
+			self:expression(callee, scope)
+		end
+		self:arguments(node.args, node.named_args, scope)
+		return nil
+	end
+
+	if t == N.FILTER and DEFAULT_FILTERS[node.filter_name] then
+		local path = self:path(node.expression, scope)
+		local fallback = node.args[1]
+		self:arguments(node.args, node.named_args, scope)
+		if path then
+			local fields = { optional = true }
+			if fallback and fallback.type == N.LITERAL and fallback.value ~= nil then
+				fields.default = fallback.value
+			end
+			self:record(path, node.expression, fields)
+		end
+		return path
+	end
+
+	if t == N.FILTER then
+		local input = self:expression(node.expression, scope)
+		self:arguments(node.args, node.named_args, scope)
+		if PRESERVING_FILTERS[node.filter_name] then
+			return input
+		end
+		return nil
+	end
+
+	if t == N.PIPELINE then
+		self:expression(node.expression, scope)
+		local call = node.filter_call
+		if call.type == N.FUNCTION_CALL then
+			self:arguments(call.args, call.named_args, scope)
+		end
+		return nil
+	end
+
+	if t == N.BINARY_OP then
+		self:expression(node.left, scope)
+		self:expression(node.right, scope)
+	elseif t == N.UNARY_OP then
+		self:expression(node.operand, scope)
+	elseif t == N.TERNARY then
+		self:expression(node.condition, scope)
+		self:expression(node.value, scope)
+		self:expression(node.alternative, scope)
+	elseif t == N.TEST then
+		local path = DEFINED_TESTS[node.test_name] and self:path(node.expression, scope)
+		if path then
+			self:record(path, node.expression, { optional = true })
+		else
+			self:expression(node.expression, scope)
+		end
+		self:arguments(node.args, nil, scope)
+	elseif t == N.TABLE then
+		for _, entry in ipairs(node.entries) do
+			self:expression(entry.key, scope)
+			self:expression(entry.value, scope)
+		end
+	end
+	return nil
+end
+
+--- Resolve a path without visiting or recording anything
+-- @return table|nil Path segments
+function Walker:resolve(node, scope)
+	local t = node.type
+	if t == N.IDENTIFIER or t == "IDENT" then
+		local binding = scope[node.name]
+		if binding ~= nil then
+			return binding and copy_path(binding).segments or nil
+		end
+		return { node.name }
+	end
+	local segment
+	if t == N.MEMBER_ACCESS then
+		segment = node.member
+	elseif t == N.INDEX_ACCESS and node.index.type == N.LITERAL and node.index.literal_type == "string" then
+		segment = node.index.value
+	else
+		return nil
+	end
+	local base = self:resolve(node.object, scope)
+	if base then
+		table.insert(base, segment)
+	end
+	return base
+end
+
+--- Collect the paths a condition tests to be defined when it is true
+-- (positive) and when it is false (negative)
+function Walker:defined_paths(node, scope, positive, negative)
+	local t = node.type
+	if t == N.TEST and (node.test_name == "defined" or node.test_name == "undefined") then
+		local segments = self:resolve(node.expression, scope)
+		if segments then
+			local when_true = (node.test_name == "defined") ~= node.negated
+			table.insert(when_true and positive or negative, path_key(segments, #segments))
+		end
+	elseif t == N.UNARY_OP and node.operator == "not" then
+		self:defined_paths(node.operand, scope, negative, positive)
+	elseif t == N.BINARY_OP and node.operator == "and" then
+		self:defined_paths(node.left, scope, positive, {})
+		self:defined_paths(node.right, scope, positive, {})
+	end
+end
+
+--- Visit a list of nodes with paths guarded as tested to be defined
+function Walker:guarded_nodes(list, scope, keys)
+	for _, key in ipairs(keys) do
+		self.guards[key] = (self.guards[key] or 0) + 1
+	end
+	self:nodes(list, scope)
+	for _, key in ipairs(keys) do
+		self.guards[key] = self.guards[key] - 1
+	end
+end
+
+--- Visit the iterable of a for loop, recording that it is iterated
+-- @return table|nil The path iterated over
+function Walker:iterable(node, scope, pairs_loop)
+	local iterable = node.iterable
+	if iterable and iterable.type == N.FUNCTION_CALL then
+		local callee = iterable.callee
+		if (callee.type == N.IDENTIFIER or callee.type == "IDENT") and (callee.name == "ipairs" or callee.name == "pairs") then
+			iterable = iterable.args[1]
+		elseif callee.type == N.MEMBER_ACCESS and callee.member == "items" and #iterable.args == 0 then
+			-- Python style mapping.items()
+			iterable = callee.object
+			pairs_loop = true
+		end
+	end
+
+	local path = self:expression(iterable, scope)
+	if path then
+		local iterate = pairs_loop and "pairs" or "list"
+		local last = self.refs[#self.refs]
+		if last and last.path == path.segments then
+			-- The iterable itself was just recorded as read
+			last.iterate = iterate
+			last.position = self:position(node)
+		else
+			self:record(path, node, { iterate = iterate })
+		end
+	end
+	return path
+end
+
+--- Bind a local name to the path of an expression, or to false
+local function bind(scope, name, path)
+	if path then
+		scope[name] = path
+	else
+		scope[name] = false
+	end
+end
+
+--- The path of the elements of a path
+local function element_of(path)
+	if not path then
+		return nil
+	end
+	local element = copy_path(path)
+	table.insert(element.segments, analysis.ELEMENT)
+	table.insert(element.positions, path.positions[#path.positions])
+	return element
+end
+
+--- Visit a list of nodes
+function Walker:nodes(list, scope)
+	if type(list) ~= "table" then
+		return
+	end
+	if list.type then
+		-- An elif chain is a single IF node
+		self:node(list, scope)
+		return
+	end
+	for _, node in ipairs(list) do
+		self:node(node, scope)
+	end
+end
+
+--- Visit a node, recording the context paths it reads
+function Walker:node(node, scope)
+	local t = node.type
+
+	if t == N.TEMPLATE or t == N.AUTOESCAPE then
+		self:nodes(node.body, scope)
+	elseif t == N.INTERPOLATION then
+		self:expression(node.expression, scope)
+	elseif t == N.IF then
+		self:expression(node.condition, scope)
+		local positive, negative = {}, {}
+		self:defined_paths(node.condition, scope, positive, negative)
+		self:guarded_nodes(node.then_body, scope, positive)
+		self:guarded_nodes(node.else_body, scope, negative)
+	elseif t == N.FOR then
+		local var_names = node.var_names or { node.var_name }
+		local path = self:iterable(node, scope, #var_names > 1)
+		local body_scope = child_scope(scope)
+		if #var_names > 1 then
+			bind(body_scope, var_names[1], nil)
+			for i = 2, #var_names do
+				bind(body_scope, var_names[i], i == 2 and element_of(path) or nil)
+			end
+		else
+			bind(body_scope, var_names[1], element_of(path))
+		end
+		self:nodes(node.body, body_scope)
+		self:nodes(node.else_body, scope)
+	elseif t == N.LET then
+		if node.is_block then
+			self:nodes(node.value, scope)
+			bind(scope, node.name, nil)
+		elseif node.is_member_assignment then
+			self:expression(node.value, scope)
+		else
+			bind(scope, node.name, self:expression(node.value, scope))
+		end
+	elseif t == N.WITH then
+		local body_scope = child_scope(scope)
+		for _, var in ipairs(node.variables) do
+			bind(body_scope, var.name, self:expression(var.value, scope))
+		end
+		self:nodes(node.body, body_scope)
+	elseif t == N.MACRO_DEF then
+		local body_scope = child_scope(scope)
+		for _, param in ipairs(node.params) do
+			bind(body_scope, param, nil)
+			if node.defaults and node.defaults[param] then
+				self:expression(node.defaults[param], scope)
+			end
+		end
+		self:nodes(node.body, body_scope)
+	elseif t == N.MACRO_CALL then
+		self:arguments(node.args, nil, scope)
+		if node.caller_body then
+			local body_scope = child_scope(scope)
+			for _, param in ipairs(node.caller_params or {}) do
+				bind(body_scope, param, nil)
+			end
+			self:nodes(node.caller_body, body_scope)
+		end
+	elseif t == N.INCLUDE then
+		if type(node.path) == "string" then
+			if node.with_context then
+				self:include(node.path, scope)
+			end
+		else
+			self:expression(node.path, scope)
+		end
+		self:expression(node.filters, scope)
+	elseif t == N.IMPORT then
+		if type(node.path) ~= "string" then
+			self:expression(node.path, scope)
+		end
+		if node.names then
+			for _, spec in ipairs(node.names) do
+				bind(scope, spec.alias or spec.name, nil)
+			end
+		elseif node.alias then
+			bind(scope, node.alias, nil)
+		end
+	elseif t == N.FILTER_BLOCK then
+		self:arguments(node.args, node.named_args, scope)
+		self:nodes(node.body, scope)
+	elseif t == N.TRANS then
+		self:arguments(nil, node.variables, scope)
+	elseif t == N.EXTENSION then
+		self:arguments(node.args, node.named_args, scope)
+		if node.body then
+			self:nodes(node.body, scope)
+		end
+	elseif t == N.DO then
+		if node.is_assignment then
+			self:expression(node.value, scope)
+		else
+			self:expression(node.expression, scope)
+		end
+	elseif t == N.BLOCK then
+		local body_scope = node.scoped and child_scope(scope) or scope
+		local parent = node.parent_block
+		while parent do
+			self:nodes(parent.body, body_scope)
+			parent = parent.parent_block
+		end
+		self:nodes(node.body, body_scope)
+	end
+end
+
+--- Visit a template included with context
+function Walker:include(name, scope)
+	if self.visiting[name] then
+		return
+	end
+	local runtime = require("luma.runtime")
+	local source = runtime.load_source(name)
+	if not source then
+		return
+	end
+
+	local compiler = require("luma.compiler")
+	local ok, template_ast = pcall(compiler.parse, source, { name = name })
+	if not ok then
+		return
+	end
+	self.visiting[name] = true
+	self:nodes(template_ast.body, scope)
+	self.visiting[name] = nil
+end
+
+--- Find the context paths a template reads
+-- Each reference has:
+--   path: the path segments, analysis.ELEMENT for list elements and
+--     mapping values
+--   positions: for each segment, where it is read as
+--     { template, line, column }, template being false for unnamed templates
+--   position: where the whole path is used
+--   iterate: "list" or "pairs" if a for loop iterates over the path
+--   call: true if the path is called as a function
+--   optional: true if the path is read behind an is defined test or a
+--     default filter, so the template works without it
+--   default: the literal a default filter supplies for the path
+-- @param source string Template source code
+-- @param options table|nil Compilation options; name names the template
+-- @return table References, in template order
+function analysis.references(source, options)
+	options = options or {}
+	local compiler = require("luma.compiler")
+	local template_ast = compiler.parse(source, options)
+
+	local walker = setmetatable({
+		name = options.name or false,
+		refs = {},
+		visiting = {},
+		guards = {},
+	}, Walker)
+	if options.name then
+		walker.visiting[options.name] = true
+	end
+	walker:node(template_ast, {})
+	return walker.refs
+end
+
+--- Translation functions whose literal arguments are messages, and the
+-- number of messages they take
+local MESSAGE_FUNCTIONS = {
+	_ = 1,
+	gettext = 1,
+	ngettext = 2,
+}
+
+--- Collect the translatable messages below a node
+local function collect_messages(node, name, messages, seen)
+	if seen[node] then
+		return
+	end
+	seen[node] = true
+
+	local message
+	local at = node
+	if node.type == N.TRANS then
+		message = { id = node.singular, plural = node.plural }
+	elseif node.type == N.FUNCTION_CALL then
+		local callee = node.callee
+		local count = (callee.type == N.IDENTIFIER or callee.type == "IDENT") and MESSAGE_FUNCTIONS[callee.name]
+		local args = node.args or {}
+		local literal = true
+		for i = 1, count or 0 do
+			if not args[i] or args[i].type ~= N.LITERAL or args[i].literal_type ~= "string" then
+				literal = false
+			end
+		end
+		if count and literal then
+			message = { id = args[1].value, plural = count == 2 and args[2].value or nil }
+			at = callee
+		end
+	end
+	if message then
+		local template = node.template
+		if template == nil then
+			template = name
+		end
+		message.position = { template or false, at.line or node.line or 0, at.column or node.column or 0 }
+		messages[#messages + 1] = message
+	end
+
+	for _, child in pairs(node) do
+		if type(child) == "table" then
+			collect_messages(child, name, messages, seen)
+		end
+	end
+end
+
+--- Find the translatable messages of a template
+-- These are the messages of @trans blocks and the string literals passed
+-- to _(), gettext() and ngettext(). Parents and included templates are
+-- not followed. Each message has:
+--   id: the message id
+--   plural: the plural message id, nil without a plural form
+--   position: where the message is, as { template, line, column }
+-- @param source string Template source code
+-- @param options table|nil Parse options; name names the template
+-- @return table Messages, ordered by position
+function analysis.messages(source, options)
+	options = options or {}
+	local parser = require("luma.parser")
+	local template_ast = parser.parse(source, options)
+
+	local messages = {}
+	collect_messages(template_ast, options.name or false, messages, {})
+	table.sort(messages, function(a, b)
+		if a.position[2] ~= b.position[2] then
+			return a.position[2] < b.position[2]
+		end
+		return a.position[3] < b.position[3]
+	end)
+	return messages
+end
+
+return analysis
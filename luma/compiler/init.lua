@@ -22,18 +22,63 @@ CompiledTemplate.__index = CompiledTemplate
 -- @param fn function The compiled render function
 -- @param source string The generated Lua source code
 -- @param name string Template name
+-- @param line_map table|nil Template lines of the generated code (see codegen.line_map)
+-- @param template_source string|nil Template source, shown in errors
 -- @return table Compiled template object
-local function create_compiled(fn, source, name)
+local function create_compiled(fn, source, name, line_map, template_source)
 	local self = {
 		_fn = fn,
 		source = source,
 		name = name or "template",
 		dependencies = {},
+		line_map = line_map,
+		template_source = template_source,
 	}
 	setmetatable(self, CompiledTemplate)
 	return self
 end
 
+--- Find the template line a line of the generated code comes from
+-- @param lua_line number Line of the generated code
+-- @return string|nil Template name
+-- @return number|nil Template line
+function CompiledTemplate:template_line(lua_line)
+	local map = self.line_map
+	if not map then
+		return nil
+	end
+	local line, index
+	for i = 1, #map, 3 do
+		if map[i] > lua_line then
+			break
+		end
+		line, index = map[i + 1], map[i + 2]
+	end
+	if not line then
+		return nil
+	end
+	return map.templates[index] or self.name, line
+end
+
+--- Convert an error raised by the generated code into a runtime error
+-- located at the template line, rather than the generated code line
+-- @param message string Error message
+-- @return table Runtime error
+-- @return string|nil Template source to show around the line
+function CompiledTemplate:runtime_error(message)
+	local pattern = self.name:gsub("%p", "%%%0") .. ":(%d+): "
+	local first, last, lua_line = message:find(pattern)
+	local name, line
+	if first then
+		name, line = self:template_line(tonumber(lua_line))
+	end
+	if not line then
+		return errors.runtime(message)
+	end
+	message = message:sub(1, first - 1) .. message:sub(last + 1)
+	return errors.runtime(message, line, nil, name), name == self.name and self.template_source or nil
+end
+
 --- Render the template with given context
 -- @param context table Variable context
 -- @param filters table|nil Filter functions
@@ -47,10 +92,13 @@ function CompiledTemplate:render(context, filters, runtime, macros, tests)
 	runtime = runtime or require("luma.runtime")
 	macros = macros or {}
 	tests = tests or runtime.default_tests()
+	if runtime.instrument_filters then
+		filters = runtime.instrument_filters(filters)
+	end
 
 	local ok, result = pcall(self._fn, context, filters, runtime, macros, tests)
 	if not ok then
-		errors.raise(errors.runtime(tostring(result)))
+		errors.raise(self:runtime_error(tostring(result)))
 	end
 	return result
 end
@@ -99,6 +147,139 @@ local function replace_blocks(body, child_blocks)
 	return result
 end
 
+--- Cache for generated template code, set with compiler.set_code_cache
+local code_cache = nil
+
+--- Parent templates loaded by the compilation in progress, by name
+local loaded_parents = nil
+
+--- Set a cache for generated template code
+-- Compiling a template whose code is cached skips parsing and code
+-- generation. The cache is a table of functions:
+--   fingerprint(data) -> string: a collision-resistant hash of data
+--   get(key) -> code, parents: cached code and the fingerprints of the
+--     parent templates it was generated with, by name, or nil
+--   put(key, code, parents): store code with its parents' fingerprints
+-- Cached code is only used while every parent template is unchanged.
+-- @param cache table|nil Cache, or nil to disable caching
+function compiler.set_code_cache(cache)
+	code_cache = cache
+end
+
+--- Function receiving generated template code, set with compiler.set_code_dump
+local code_dump = nil
+
+--- Set a function called with the generated code of every compiled template
+-- Use it to inspect what the code generator produced. The function is
+-- called as dump(name, code), where name is nil for unnamed templates,
+-- including when the code comes from the code cache.
+-- @param dump function|nil Function, or nil to stop dumping
+function compiler.set_code_dump(dump)
+	code_dump = dump
+end
+
+--- Build the cache key for a template
+-- The key covers the Luma version, the source and every scalar option.
+-- @param source string Template source
+-- @param options table Compilation options
+-- @return string Cache key
+local function cache_key(source, options)
+	local version = require("luma.version")
+	local keys = {}
+	for k, v in pairs(options) do
+		local t = type(v)
+		if type(k) == "string" and (t == "string" or t == "number" or t == "boolean") then
+			keys[#keys + 1] = k
+		end
+	end
+	table.sort(keys)
+
+	local parts = { version.string }
+	for _, k in ipairs(keys) do
+		parts[#parts + 1] = k .. "=" .. tostring(options[k])
+	end
+	parts[#parts + 1] = source
+	return code_cache.fingerprint(table.concat(parts, "\0"))
+end
+
+--- Record the template every node of an AST came from, so errors,
+-- coverage and source maps of inherited blocks point to the right template
+-- @param node table AST node
+-- @param name string|nil Template name
+local function tag_template(node, name)
+	if node.type and node.template == nil then
+		node.template = name or false
+	end
+	for _, child in pairs(node) do
+		if type(child) == "table" and child ~= node.parent_block then
+			tag_template(child, name)
+		end
+	end
+end
+
+--- Get cached code for a template if its parent templates are unchanged
+-- @param key string Cache key
+-- @param options table Compilation options
+-- @return string|nil Cached Lua code
+local function cached_code(key, options)
+	local code, parents = code_cache.get(key)
+	if not code then
+		return nil
+	end
+	local runtime = require("luma.runtime")
+	for name, fingerprint in pairs(parents or {}) do
+		local source = runtime.load_source(name)
+		if not source or code_cache.fingerprint(source) ~= fingerprint then
+			return nil
+		end
+	end
+	for name in pairs(parents or {}) do
+		runtime.add_dependency(name, options.name)
+		if options.coverage then
+			runtime.coverage_source(name, runtime.load_source(name))
+		end
+	end
+	return code
+end
+
+--- Generate Lua code for a template, storing it in the code cache
+-- @param source string Template source
+-- @param options table Compilation options
+-- @param key string|nil Cache key
+-- @return string Lua code
+local function generate_code(source, options, key)
+	local outer = loaded_parents
+	loaded_parents = {}
+	local ok, result = pcall(function()
+		return codegen.generate(compiler.parse(source, options), options)
+	end)
+	local parents = loaded_parents
+	loaded_parents = outer
+	if not ok then
+		error(result, 0)
+	end
+
+	if key then
+		local fingerprints = {}
+		for name, parent_source in pairs(parents) do
+			fingerprints[name] = code_cache.fingerprint(parent_source)
+		end
+		code_cache.put(key, result, fingerprints)
+	end
+	return result
+end
+
+--- Parse a template and resolve its inheritance
+-- Every node records the template it came from in its template field.
+-- @param source string Template source code
+-- @param options table Compilation options
+-- @return table Resolved AST
+function compiler.parse(source, options)
+	local template_ast = parser.parse(source, options)
+	tag_template(template_ast, options.name)
+	return compiler.resolve_inheritance(template_ast, options)
+end
+
 --- Resolve template inheritance
 -- @param template_ast table Template AST
 -- @param options table Compilation options
@@ -114,6 +295,7 @@ function compiler.resolve_inheritance(template_ast, options)
 	-- Load the parent template
 	local runtime = require("luma.runtime")
 	local parent_path = extends_node.path
+	runtime.add_dependency(parent_path, options.name)
 	local parent_source, err = runtime.load_source(parent_path)
 
 	if not parent_source then
@@ -121,9 +303,16 @@ function compiler.resolve_inheritance(template_ast, options)
 			errors.compile("Failed to load parent template '" .. tostring(parent_path) .. "': " .. tostring(err))
 		)
 	end
+	if loaded_parents then
+		loaded_parents[parent_path] = parent_source
+	end
 
 	-- Parse the parent template
 	local parent_ast = parser.parse(parent_source, options)
+	if options.coverage then
+		runtime.coverage_source(parent_path, parent_source)
+	end
+	tag_template(parent_ast, parent_path)
 
 	-- Recursively resolve parent inheritance
 	parent_ast = compiler.resolve_inheritance(parent_ast, options)
@@ -137,22 +326,60 @@ function compiler.resolve_inheritance(template_ast, options)
 	return parent_ast
 end
 
---- Compile a template from source string
--- @param source string Template source code
--- @param options table|nil Compilation options
--- @return table Compiled template object
-function compiler.compile(source, options)
+--- Parse a template and load its generated code
+local function compile(source, options)
 	options = options or {}
 	local name = options.name or options.source_name or "template"
 
-	-- Parse source to AST
-	local template_ast = parser.parse(source, options)
-
-	-- Resolve template inheritance
-	template_ast = compiler.resolve_inheritance(template_ast, options)
+	-- Use the runtime's autoescape, coverage, source map and access
+	-- tracking settings, the lexer's syntax options and the registered
+	-- extensions unless the caller chose them, so that they are part of
+	-- the cache key
+	local runtime = require("luma.runtime")
+	local collect_coverage = options.coverage == nil and runtime.coverage_enabled()
+	local map_sources = options.source_map == nil and runtime.source_maps_enabled()
+	local track_access = options.track_access == nil and runtime.access_tracking_enabled()
+	local syntax = require("luma.lexer").syntax_options()
+	local extension_signature = require("luma.extensions").signature()
+	if
+		options.autoescape == nil
+		or collect_coverage
+		or map_sources
+		or track_access
+		or next(syntax)
+		or extension_signature ~= ""
+	then
+		local resolved = {}
+		for k, v in pairs(syntax) do
+			resolved[k] = v
+		end
+		for k, v in pairs(options) do
+			resolved[k] = v
+		end
+		if resolved.autoescape == nil then
+			resolved.autoescape = runtime.autoescape_mode(options.name or options.source_name)
+		end
+		if collect_coverage then
+			resolved.coverage = true
+		end
+		if map_sources then
+			resolved.source_map = true
+		end
+		if track_access then
+			resolved.track_access = true
+		end
+		if extension_signature ~= "" then
+			resolved.extensions = extension_signature
+		end
+		options = resolved
+	end
+	if options.coverage then
+		runtime.coverage_source(options.name, source)
+	end
 
-	-- Generate Lua code
-	local lua_code = codegen.generate(template_ast, options)
+	-- Parse, resolve inheritance and generate Lua code, unless cached
+	local key = code_cache and cache_key(source, options)
+	local lua_code = key and cached_code(key, options) or generate_code(source, options, key)
 
 	-- Create a safe environment with basic Lua functions
 	local safe_env = {
@@ -180,12 +407,26 @@ function compiler.compile(source, options)
 	end
 
 	-- Execute to get the template function
-	local ok, template_fn = pcall(fn)
+	local ok, template_fn, line_map = pcall(fn)
 	if not ok then
 		errors.raise(errors.compile("Failed to initialize template: " .. tostring(template_fn)))
 	end
 
-	return create_compiled(template_fn, lua_code, name)
+	local compiled = create_compiled(template_fn, lua_code, name, line_map, source)
+	if code_dump then
+		code_dump(options.name, lua_code)
+	end
+	return compiled
+end
+
+--- Compile a template from source string
+-- @param source string Template source code
+-- @param options table|nil Compilation options
+-- @return table Compiled template object
+function compiler.compile(source, options)
+	local runtime = require("luma.runtime")
+	local name = options and (options.name or options.source_name)
+	return runtime.instrumented("compile", name, compile, source, options)
 end
 
 --- Compile a template from AST
@@ -225,12 +466,12 @@ function compiler.compile_ast(template_ast, options)
 	end
 
 	-- Execute to get the template function
-	local ok, template_fn = pcall(fn)
+	local ok, template_fn, line_map = pcall(fn)
 	if not ok then
 		errors.raise(errors.compile("Failed to initialize template: " .. tostring(template_fn)))
 	end
 
-	return create_compiled(template_fn, lua_code, name)
+	return create_compiled(template_fn, lua_code, name, line_map)
 end
 
 return compiler
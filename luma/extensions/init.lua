@@ -0,0 +1,96 @@
+--- Extension registry for Luma
+-- Manages custom directives, written @name args ... @end in native syntax
+-- and {% name args %}...{% endname %} in Jinja syntax
+-- @module luma.extensions
+
+local tokens = require("luma.lexer.tokens")
+
+local extensions = {}
+
+-- Internal registry
+local _registry = {}
+
+--- Check that an extension can be registered
+-- @param name string Directive name
+-- @param extension table Extension, as for register
+-- @return string|nil Error message, nil if the extension is valid
+function extensions.check(name, extension)
+	if type(name) ~= "string" or not name:match("^[%a_][%w_]*$") then
+		return "Extension name must be an identifier"
+	end
+	if tokens.directives[name] or tokens.keywords[name] then
+		return "Extension name is reserved: " .. name
+	end
+	if type(extension) ~= "table" or type(extension.render) ~= "function" then
+		return "Extension must be a table with a render function"
+	end
+	return nil
+end
+
+--- Register an extension directive
+-- The directive's arguments are comma-separated expressions. Templates
+-- compiled before an extension is registered or changed keep the syntax
+-- they were compiled with.
+-- @param name string Directive name
+-- @param extension table Extension:
+--   block: true if the directive encloses a body ended by @end
+--   render: function(args, named, body) returning the directive's output,
+--     with the array of argument values (its n field holds their count),
+--     the table of named arguments (nil without any) and the rendered body
+--     (nil without a block). The output is not escaped.
+function extensions.register(name, extension)
+	local err = extensions.check(name, extension)
+	if err then
+		error(err, 2)
+	end
+	_registry[name] = extension
+end
+
+--- Remove an extension
+-- @param name string Directive name
+function extensions.unregister(name)
+	_registry[name] = nil
+end
+
+--- Get an extension by name
+-- @param name string Directive name
+-- @return table|nil Extension or nil if not found
+function extensions.get(name)
+	return _registry[name]
+end
+
+--- Get the extension a Jinja end tag closes
+-- @param keyword string Statement keyword, like endcache
+-- @return table|nil Block extension or nil if the keyword closes none
+function extensions.closed_by(keyword)
+	local name = keyword:match("^end(.+)$")
+	local extension = name and _registry[name]
+	if extension and extension.block then
+		return extension
+	end
+	return nil
+end
+
+--- List all extension names
+-- @return table Sorted array of names
+function extensions.list()
+	local names = {}
+	for name in pairs(_registry) do
+		names[#names + 1] = name
+	end
+	table.sort(names)
+	return names
+end
+
+--- Describe the registered extensions, for compiled code cache keys
+-- @return string Sorted name:block or name:inline pairs, empty without
+--   extensions
+function extensions.signature()
+	local parts = {}
+	for _, name in ipairs(extensions.list()) do
+		parts[#parts + 1] = name .. (_registry[name].block and ":block" or ":inline")
+	end
+	return table.concat(parts, ",")
+end
+
+return extensions
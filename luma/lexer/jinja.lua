@@ -4,6 +4,7 @@
 
 local tokens = require("luma.lexer.tokens")
 local errors = require("luma.utils.errors")
+local extensions = require("luma.extensions")
 
 local T = tokens.types
 
@@ -56,16 +57,40 @@ local NATIVE_DIRECTIVES = {
 	["block"] = T.DIR_BLOCK,
 	["endblock"] = T.DIR_ENDBLOCK,
 	["endset"] = T.DIR_ENDSET,
+	["trans"] = T.DIR_TRANS,
+	["pluralize"] = T.DIR_PLURALIZE,
+}
+
+--- Default delimiters
+jinja.DELIMITERS = {
+	variable_start = "{{",
+	variable_end = "}}",
+	block_start = "{%",
+	block_end = "%}",
+	comment_start = "{#",
+	comment_end = "#}",
 }
 
 --- Create a new Jinja lexer
 -- @param source string The template source code
 -- @param source_name string|nil Name for error messages
+-- @param delimiters table|nil Delimiters replacing those of
+--   jinja.DELIMITERS, plus the directive and interpolation sigils of
+--   mixed native syntax
 -- @return table Lexer instance
-function jinja.new(source, source_name)
+function jinja.new(source, source_name, delimiters)
+	delimiters = delimiters or {}
 	local self = {
 		source = source,
 		source_name = source_name or "template",
+		variable_start = delimiters.variable_start or jinja.DELIMITERS.variable_start,
+		variable_end = delimiters.variable_end or jinja.DELIMITERS.variable_end,
+		block_start = delimiters.block_start or jinja.DELIMITERS.block_start,
+		block_end = delimiters.block_end or jinja.DELIMITERS.block_end,
+		comment_start = delimiters.comment_start or jinja.DELIMITERS.comment_start,
+		comment_end = delimiters.comment_end or jinja.DELIMITERS.comment_end,
+		directive = delimiters.directive or "@",
+		interpolation = delimiters.interpolation or "$",
 		pos = 1,
 		line = 1,
 		column = 1,
@@ -81,6 +106,19 @@ function jinja.new(source, source_name)
 		in_native_directive = false, -- Inside @directive (vs {% %})
 		native_paren_depth = 0, -- Track parentheses depth in native directives
 	}
+	-- Opening delimiters, longest first so that one can start with another
+	self.starts = {
+		{ "variable", self.variable_start },
+		{ "block", self.block_start },
+		{ "comment", self.comment_start },
+	}
+	table.sort(self.starts, function(a, b)
+		return #a[2] > #b[2]
+	end)
+	self.start_chars = {}
+	for _, start in ipairs(self.starts) do
+		self.start_chars[start[2]:sub(1, 1)] = true
+	end
 	setmetatable(self, { __index = jinja })
 	return self
 end
@@ -121,13 +159,42 @@ function jinja:is_eof()
 	return self.pos > self.length
 end
 
---- Match a string at current position
-function jinja:match(str)
+--- Match a string at current position, or offset characters after it
+function jinja:match(str, offset)
+	local pos = self.pos + (offset or 0)
 	local len = #str
-	if self.pos + len - 1 > self.length then
+	if pos + len - 1 > self.length then
 		return false
 	end
-	return self.source:sub(self.pos, self.pos + len - 1) == str
+	return self.source:sub(pos, pos + len - 1) == str
+end
+
+--- Advance past a string matched at the current position
+function jinja:skip(str)
+	for _ = 1, #str do
+		self:advance()
+	end
+end
+
+--- Match a closing delimiter, with or without a whitespace control dash
+-- @param delimiter string Closing delimiter
+-- @return boolean|nil true if matched, with the dash when the second
+--   result is true
+function jinja:match_end(delimiter)
+	if self:match("-" .. delimiter) then
+		return true, true
+	end
+	return self:match(delimiter), false
+end
+
+--- Skip a closing delimiter matched by match_end, setting trim_next for
+-- a whitespace control dash
+function jinja:skip_end(delimiter, trim)
+	if trim then
+		self:advance()
+		self.trim_next = true
+	end
+	self:skip(delimiter)
 end
 
 --- Skip whitespace (not newlines unless in expression)
@@ -256,16 +323,9 @@ function jinja:scan_expression_token()
 
 	-- Check for end of variable block: }} or -}}
 	if self.in_var then
-		if self:match("-}}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.in_var = false
-			self.trim_next = true
-			return self:make_token(T.INTERP_END, nil, start_line, start_col)
-		elseif self:match("}}") then
-			self:advance()
-			self:advance()
+		local matched, trim = self:match_end(self.variable_end)
+		if matched then
+			self:skip_end(self.variable_end, trim)
 			self.in_var = false
 			return self:make_token(T.INTERP_END, nil, start_line, start_col)
 		end
@@ -274,22 +334,14 @@ function jinja:scan_expression_token()
 	-- Check for end of statement block: %} or -%} or ; (for inline native directives)
 	if self.in_stmt then
 		-- Check for semicolon (inline native directive delimiter)
+		local matched, trim = self:match_end(self.block_end)
 		if c == ";" then
 			self:advance()
 			self.in_stmt = false
 			-- Return NEWLINE to end directive mode
 			return self:make_token(T.NEWLINE, nil, start_line, start_col)
-		elseif self:match("-%}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.in_stmt = false
-			self.trim_next = true
-			-- Return NEWLINE to end directive mode
-			return self:make_token(T.NEWLINE, nil, start_line, start_col)
-		elseif self:match("%}") then
-			self:advance()
-			self:advance()
+		elseif matched then
+			self:skip_end(self.block_end, trim)
 			self.in_stmt = false
 			-- Return NEWLINE to end directive mode
 			return self:make_token(T.NEWLINE, nil, start_line, start_col)
@@ -444,14 +496,24 @@ function jinja:scan_expression_token()
 	errors.raise(errors.lexer("Unexpected character in expression: " .. c, start_line, start_col, self.source_name))
 end
 
+--- Skip the closing delimiter of a statement without arguments
+function jinja:skip_end_of_statement()
+	self:skip_whitespace(true)
+	local matched, trim = self:match_end(self.block_end)
+	if not matched then
+		local message = string.format("Expected '%s' to close statement", self.block_end)
+		errors.raise(errors.lexer(message, self.line, self.column, self.source_name))
+	end
+	self:skip_end(self.block_end, trim)
+end
+
 --- Scan a statement block {% ... %}
 function jinja:scan_statement()
 	local start_line = self.line
 	local start_col = self.column
 
 	-- Skip {%
-	self:advance()
-	self:advance()
+	self:skip(self.block_start)
 
 	-- Check for whitespace control: {%-
 	local trim_prev = false
@@ -467,6 +529,11 @@ function jinja:scan_statement()
 
 	-- Map Jinja keywords to our directive tokens
 	local dir_type = tokens.directives[keyword]
+	if not dir_type and extensions.get(keyword) then
+		dir_type = T.DIR_EXTENSION
+	elseif not dir_type and extensions.closed_by(keyword) then
+		dir_type = T.DIR_END
+	end
 
 	if not dir_type then
 		errors.raise(errors.lexer("Unknown statement: " .. keyword, start_line, start_col, self.source_name))
@@ -474,52 +541,19 @@ function jinja:scan_statement()
 
 	-- For end-type statements, we need to scan past the %}
 	if dir_type == T.DIR_END or dir_type == T.DIR_ENDRAW or dir_type == T.DIR_ENDBLOCK then
-		self:skip_whitespace(true)
-		if self:match("-%}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.trim_next = true
-		elseif self:match("%}") then
-			self:advance()
-			self:advance()
-		else
-			errors.raise(errors.lexer("Expected '%}' to close statement", self.line, self.column, self.source_name))
-		end
+		self:skip_end_of_statement()
 		return self:make_token(dir_type, keyword, start_line, start_col), trim_prev
 	end
 
 	-- For else-type statements
 	if dir_type == T.DIR_ELSE then
-		self:skip_whitespace(true)
-		if self:match("-%}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.trim_next = true
-		elseif self:match("%}") then
-			self:advance()
-			self:advance()
-		else
-			errors.raise(errors.lexer("Expected '%}' to close statement", self.line, self.column, self.source_name))
-		end
+		self:skip_end_of_statement()
 		return self:make_token(dir_type, keyword, start_line, start_col), trim_prev
 	end
 
 	-- For break/continue
 	if dir_type == T.DIR_BREAK or dir_type == T.DIR_CONTINUE then
-		self:skip_whitespace(true)
-		if self:match("-%}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.trim_next = true
-		elseif self:match("%}") then
-			self:advance()
-			self:advance()
-		else
-			errors.raise(errors.lexer("Expected '%}' to close statement", self.line, self.column, self.source_name))
-		end
+		self:skip_end_of_statement()
 		return self:make_token(dir_type, keyword, start_line, start_col), trim_prev
 	end
 
@@ -535,8 +569,7 @@ function jinja:scan_comment()
 	local start_col = self.column
 
 	-- Skip {#
-	self:advance()
-	self:advance()
+	self:skip(self.comment_start)
 
 	local trim_prev = false
 	if self:peek() == "-" then
@@ -546,15 +579,9 @@ function jinja:scan_comment()
 
 	local parts = {}
 	while not self:is_eof() do
-		if self:match("-#}") then
-			self:advance()
-			self:advance()
-			self:advance()
-			self.trim_next = true
-			break
-		elseif self:match("#}") then
-			self:advance()
-			self:advance()
+		local matched, trim = self:match_end(self.comment_end)
+		if matched then
+			self:skip_end(self.comment_end, trim)
 			break
 		else
 			table.insert(parts, self:peek())
@@ -565,6 +592,17 @@ function jinja:scan_comment()
 	return self:make_token(T.DIR_COMMENT, table.concat(parts), start_line, start_col), trim_prev
 end
 
+--- Find the Jinja block opening at the current position
+-- @return string|nil "variable", "block" or "comment"
+function jinja:block_at()
+	for _, start in ipairs(self.starts) do
+		if self:match(start[2]) then
+			return start[1]
+		end
+	end
+	return nil
+end
+
 --- Scan text content until we hit a special block
 function jinja:scan_text()
 	local start_line = self.line
@@ -575,15 +613,12 @@ function jinja:scan_text()
 		local c = self:peek()
 
 		-- Check for Jinja blocks
-		if c == "{" then
-			local next_c = self:peek(1)
-			if next_c == "{" or next_c == "%" or next_c == "#" then
-				break
-			end
+		if self.start_chars[c] and self:block_at() then
+			break
 		end
 
 		-- Check for Luma native directives at line start or after whitespace (for mixed syntax support)
-		if c == "@" then
+		if c == self.directive then
 			if self.at_line_start then
 				-- At line start, always check for directive
 				local next_c = self:peek(1)
@@ -600,14 +635,13 @@ function jinja:scan_text()
 		end
 
 		-- Check for Luma interpolation (for mixed syntax support)
-		if c == "$" then
+		if c == self.interpolation then
 			local next_c = self:peek(1)
-			local next_next_c = self:peek(2)
 			-- Only treat as interpolation if followed by identifier or single {
 			-- Don't break on ${{ (literal $ + Jinja2 {{)
 			if next_c and next_c:match("[a-zA-Z_]") then
 				break
-			elseif next_c == "{" and next_next_c ~= "{" then
+			elseif next_c == "{" and not self:match(self.variable_start, 1) then
 				break
 			end
 		end
@@ -648,12 +682,15 @@ function jinja:next_token()
 
 	-- Check for Luma native directives (mixed syntax support)
 	-- Can appear at line start or after whitespace (inline)
-	if c == "@" then
+	if c == self.directive then
 		local next_c = self:peek(1)
 		if next_c and next_c:match("[a-zA-Z_]") then
 			self:advance() -- skip @
 			local keyword = self:read_identifier()
 			local dir_type = NATIVE_DIRECTIVES[keyword]
+			if not dir_type and extensions.get(keyword) then
+				dir_type = T.DIR_EXTENSION
+			end
 			if dir_type then
 				-- Enter statement mode for directive arguments
 				self.in_stmt = true
@@ -669,12 +706,11 @@ function jinja:next_token()
 	end
 
 	-- Check for Luma interpolation (mixed syntax support)
-	if c == "$" then
+	if c == self.interpolation then
 		local next_c = self:peek(1)
-		local next_next_c = self:peek(2)
 
 		-- Don't treat ${{ as interpolation (it's literal $ + Jinja2 {{)
-		if next_c == "{" and next_next_c == "{" then -- luacheck: ignore (empty branch intentional)
+		if next_c == "{" and self:match(self.variable_start, 1) then -- luacheck: ignore (empty branch intentional)
 		-- Let it fall through to scan_text
 		elseif next_c and next_c:match("[a-zA-Z_]") then
 			-- Simple variable: $var
@@ -691,13 +727,11 @@ function jinja:next_token()
 	end
 
 	-- Check for Jinja blocks
-	if c == "{" then
-		local next_c = self:peek(1)
-
-		if next_c == "{" then
+	local block = self:block_at()
+	if block then
+		if block == "variable" then
 			-- Variable block {{ ... }}
-			self:advance()
-			self:advance()
+			self:skip(self.variable_start)
 			-- Check for whitespace control: {{-
 			local trim_prev = false
 			if self:peek() == "-" then
@@ -708,14 +742,14 @@ function jinja:next_token()
 			local token = self:make_token(T.INTERP_START, nil, start_line, start_col)
 			token.trim_prev = trim_prev
 			return token
-		elseif next_c == "%" then
+		elseif block == "block" then
 			-- Statement block {% ... %}
 			local token, trim_prev = self:scan_statement()
 			if trim_prev then
 				token.trim_prev = true
 			end
 			return token
-		elseif next_c == "#" then
+		else
 			-- Comment block {# ... #}
 			local token, trim_prev = self:scan_comment()
 			if trim_prev then
@@ -50,6 +50,9 @@ tokens.types = {
 	DIR_EXTENDS = "DIR_EXTENDS", -- @extends "base.html"
 	DIR_BLOCK = "DIR_BLOCK", -- @block name
 	DIR_ENDBLOCK = "DIR_ENDBLOCK", -- @endblock (alias for @end)
+	DIR_EXTENSION = "DIR_EXTENSION", -- @name args, registered with luma.extensions
+	DIR_TRANS = "DIR_TRANS", -- @trans name=value (translatable block)
+	DIR_PLURALIZE = "DIR_PLURALIZE", -- @pluralize count (plural form of @trans)
 
 	-- Expression tokens (used inside ${} and directives)
 	IDENT = "IDENT", -- identifier
@@ -162,6 +165,9 @@ tokens.directives = {
 	["extends"] = tokens.types.DIR_EXTENDS,
 	["block"] = tokens.types.DIR_BLOCK,
 	["endblock"] = tokens.types.DIR_ENDBLOCK,
+	["trans"] = tokens.types.DIR_TRANS,
+	["pluralize"] = tokens.types.DIR_PLURALIZE,
+	["endtrans"] = tokens.types.DIR_END, -- Jinja compat
 }
 
 --- Create a new token
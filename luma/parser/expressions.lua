@@ -529,7 +529,9 @@ function expressions.parse(stream)
 end
 
 --- Parse a simple path expression from a token value (e.g., "foo.bar.baz")
--- Used for $var.path interpolation
+-- Used for $var.path interpolation. Segments ending in "()" become
+-- zero-argument calls (e.g., "user.FullName()"); a trailing one falls
+-- back to the text "()" when the value is not callable, as in "$fn() {".
 -- @param path string Path string like "foo.bar.baz"
 -- @param line number Line number
 -- @param column number Column number
@@ -544,10 +546,24 @@ function expressions.parse_path(path, line, column)
 		errors.raise(errors.parse("Empty path", line, column))
 	end
 
-	local result = ast.identifier(parts[1], line, column)
+	-- Members are placed at their dot, as in full expressions
+	local result
+	local offset = column + 1
+	for i, part in ipairs(parts) do
+		local name, call = part:match("^(.-)(%(%))$")
+		name = name or part
 
-	for i = 2, #parts do
-		result = ast.member_access(result, parts[i], line, column)
+		if i == 1 then
+			result = ast.identifier(name, line, column)
+		else
+			result = ast.member_access(result, name, line, offset - 1)
+		end
+
+		if call then
+			result = ast.function_call(result, {}, nil, line, column)
+			result.text_call = i == #parts
+		end
+		offset = offset + #part + 1
 	end
 
 	return result
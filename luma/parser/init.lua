@@ -7,8 +7,10 @@ local expressions = require("luma.parser.expressions")
 local lexer = require("luma.lexer")
 local tokens = require("luma.lexer.tokens")
 local errors = require("luma.utils.errors")
+local extensions = require("luma.extensions")
 
 local T = tokens.types
+local N = ast.types
 local parser = {}
 
 -- Re-export AST module
@@ -26,6 +28,79 @@ function parser.parse(source, options)
 	return parser.parse_template(stream)
 end
 
+--- Errors collected while parsing with parser.parse_all
+local recovered = nil
+
+--- Parse a template, recovering from syntax errors
+-- Instead of stopping at the first syntax error, the parser skips to the
+-- next line or directive and goes on, collecting every error. Errors
+-- found by the lexer cannot be recovered from and end parsing.
+-- @param source string Template source code
+-- @param options table|nil Parser options
+-- @return table|nil AST root node, nil when the lexer failed
+-- @return table Error objects (see luma.utils.errors), in source order
+function parser.parse_all(source, options)
+	options = options or {}
+	local ok, token_list = errors.capture(lexer.tokenize, source, options)
+	if not ok then
+		return nil, { token_list }
+	end
+
+	local outer = recovered
+	recovered = {}
+	local parsed, result = errors.capture(parser.parse_template, lexer.stream(token_list))
+	local found = recovered
+	recovered = outer
+	if not parsed then
+		found[#found + 1] = result
+		result = nil
+	end
+
+	-- Parse errors are raised without the template name
+	local name = options.source_name or options.name
+	for _, err in ipairs(found) do
+		if name and err.source_name == "template" then
+			err.source_name = name
+		end
+	end
+
+	table.sort(found, function(a, b)
+		if (a.line or math.huge) ~= (b.line or math.huge) then
+			return (a.line or math.huge) < (b.line or math.huge)
+		end
+		return (a.column or 0) < (b.column or 0)
+	end)
+	return result, found
+end
+
+--- Token types parsing can resume at after a syntax error
+local RESUME_TOKENS = {
+	[T.TEXT] = true,
+	[T.INTERP_START] = true,
+	[T.INTERP_SIMPLE] = true,
+}
+
+--- Skip the tokens of a node that failed to parse, up to the end of its
+-- line or the next text, interpolation or directive
+-- @param stream table Token stream
+-- @param start number Stream position where the node started
+local function skip_failed_node(stream, start)
+	if stream:save() == start then
+		stream:advance()
+	end
+	while not stream:is_eof() do
+		local token = stream:peek()
+		if token.type == T.NEWLINE then
+			stream:advance()
+			return
+		end
+		if RESUME_TOKENS[token.type] or token.type:match("^DIR_") then
+			return
+		end
+		stream:advance()
+	end
+end
+
 --- Parse a template from token stream
 -- @param stream table Token stream
 -- @return table Template AST node
@@ -52,7 +127,19 @@ function parser.parse_body(stream, end_tokens)
 			end
 		end
 
-		local node = parser.parse_node(stream)
+		local node
+		if recovered then
+			local start = stream:save()
+			local ok, result = errors.capture(parser.parse_node, stream)
+			if ok then
+				node = result
+			else
+				table.insert(recovered, result)
+				skip_failed_node(stream, start)
+			end
+		else
+			node = parser.parse_node(stream)
+		end
 		if node then
 			table.insert(body, node)
 		end
@@ -150,6 +237,14 @@ function parser.parse_node(stream)
 		return parser.parse_do(stream)
 	end
 
+	if token.type == T.DIR_EXTENSION then
+		return parser.parse_extension(stream)
+	end
+
+	if token.type == T.DIR_TRANS then
+		return parser.parse_trans(stream)
+	end
+
 	if token.type == T.DIR_COMMENT then
 		stream:advance()
 		return ast.comment(token.value, token.line, token.column)
@@ -477,6 +572,8 @@ end
 --         {% include "file.html" with context %}
 --         {% include "file.html" without context %}
 --         {% include "file.html" ignore missing %}
+--         {% include "file.html" indent 8 %}
+--         {% include "file.html" | indent(8) %}
 -- @param stream table Token stream
 -- @return table Include AST node
 function parser.parse_include(stream)
@@ -493,6 +590,7 @@ function parser.parse_include(stream)
 
 	local with_context = true -- default
 	local ignore_missing = false -- default
+	local indent = nil -- width, or true to use the directive's own indentation
 
 	-- Parse optional modifiers (context-sensitive keywords)
 	while true do
@@ -532,6 +630,14 @@ function parser.parse_include(stream)
 				else
 					errors.raise(errors.parse("Expected 'missing' after 'ignore' in include", token.line, token.column))
 				end
+			elseif token.value == "indent" then
+				stream:advance()
+				-- Optional width
+				if stream:check(T.NUMBER) then
+					indent = tonumber(stream:advance().value)
+				else
+					indent = true
+				end
 			else
 				break -- Not a recognized modifier
 			end
@@ -540,10 +646,21 @@ function parser.parse_include(stream)
 		end
 	end
 
+	-- Optional filters applied to the included output
+	local filters = nil
+	if stream:check(T.PIPE) or stream:check(T.PIPE_ARROW) then
+		local output = ast.identifier("__included", start.line, start.column)
+		output.include_output = true
+		filters = expressions.parse_filters(stream, output)
+	end
+
 	-- Skip newline
 	stream:match(T.NEWLINE)
 
-	return ast.include(path, with_context, ignore_missing, start.line, start.column)
+	local node = ast.include(path, with_context, ignore_missing, start.line, start.column)
+	node.indent = indent
+	node.filters = filters
+	return node
 end
 
 --- Parse @import directive
@@ -807,6 +924,166 @@ function parser.parse_filter_block(stream)
 	return ast.filter_block(filter_name.value, positional_args, named_args, body, start.line, start.column)
 end
 
+--- Parse a directive registered with luma.extensions
+-- Syntax: @name arg, key=value ... @end, with a body only for block
+-- extensions. Inline, extensions without a body take their arguments in
+-- parentheses: text @name(arg, key=value) text
+-- @param stream table Token stream
+-- @return table Extension AST node
+function parser.parse_extension(stream)
+	local start = stream:advance() -- skip DIR_EXTENSION
+
+	-- Parse optional arguments
+	local positional_args = {}
+	local named_args = nil
+	if start.parenthesized then
+		stream:expect(T.LPAREN, "Expected ( after @" .. start.value)
+		positional_args, named_args = expressions.parse_args(stream)
+		stream:expect(T.RPAREN, "Expected ) to close @" .. start.value .. " arguments")
+		return ast.extension(start.value, positional_args, named_args, nil, start.line, start.column)
+	elseif not start.bare and not stream:check(T.NEWLINE) and not stream:is_eof() then
+		positional_args, named_args = expressions.parse_args(stream)
+	end
+
+	-- Skip newline
+	stream:match(T.NEWLINE)
+
+	-- Parse body until @end
+	local body = nil
+	local extension = extensions.get(start.value)
+	if extension and extension.block then
+		body = parser.parse_body(stream, { T.DIR_END })
+		stream:expect(T.DIR_END, "Expected @end to close @" .. start.value)
+		stream:match(T.NEWLINE)
+	end
+
+	return ast.extension(start.value, positional_args, named_args, body, start.line, start.column)
+end
+
+--- Name of a variable expression, nil for other expressions
+local function variable_name(node)
+	if node and (node.type == N.IDENTIFIER or node.type == "IDENT") then
+		return node.name
+	end
+	return nil
+end
+
+--- Build the message id of a @trans body
+-- @param body table Body nodes
+-- @param variables table Variables of the block, extended with the
+--   variables the body uses
+-- @param used table Names of the variables the body uses, in order
+-- @param trimmed boolean Drop the whitespace around the message and
+--   collapse line breaks with their indentation
+-- @return string Message id
+-- @return string Whitespace before the message, kept in the output
+-- @return string Whitespace after the message, kept in the output
+local function trans_message(body, variables, used, trimmed)
+	local parts = {}
+	for _, node in ipairs(body) do
+		local name = node.type == N.INTERPOLATION and variable_name(node.expression)
+		if node.type == N.TEXT then
+			parts[#parts + 1] = node.value:gsub("%%", "%%%%")
+		elseif name then
+			if not variables[name] then
+				variables[name] = node.expression
+				used[#used + 1] = name
+			end
+			parts[#parts + 1] = "%(" .. name .. ")s"
+		else
+			local message = "@trans blocks can only contain text and variable names; "
+				.. "pass expressions as arguments, like @trans name=user.name"
+			errors.raise(errors.parse(message, node.line, node.column))
+		end
+	end
+
+	local message = table.concat(parts)
+	local prefix, text, suffix = message:match("^(%s*)(.-)(%s*)$")
+	if trimmed then
+		return (text:gsub("%s*\n%s*", " ")), "", ""
+	end
+	return text, prefix, suffix
+end
+
+--- Parse @trans block
+-- Syntax: @trans name=value, count=n, trimmed ... @pluralize ... @end
+-- The body holds text and variables; variables not given as arguments
+-- are read from the context.
+-- @param stream table Token stream
+-- @return table Trans AST node
+function parser.parse_trans(stream)
+	local start = stream:advance() -- skip DIR_TRANS
+
+	-- Parse optional arguments
+	local positional_args = {}
+	local named_args = nil
+	if not start.bare and not stream:check(T.NEWLINE) and not stream:is_eof() then
+		positional_args, named_args = expressions.parse_args(stream)
+	end
+	stream:match(T.NEWLINE)
+
+	local variables = {}
+	local used = {}
+	local trimmed = false
+	for name, value in pairs(named_args or {}) do
+		variables[name] = value
+		used[#used + 1] = name
+	end
+	for _, arg in ipairs(positional_args) do
+		local name = variable_name(arg)
+		if name == "trimmed" then
+			trimmed = true
+		elseif name then
+			variables[name] = arg
+			used[#used + 1] = name
+		else
+			errors.raise(errors.parse("Expected a variable name in @trans", arg.line, arg.column))
+		end
+	end
+
+	-- Parse singular body until @pluralize or @end
+	local singular_body = parser.parse_body(stream, { T.DIR_PLURALIZE, T.DIR_END })
+	local singular, prefix, suffix = trans_message(singular_body, variables, used, trimmed)
+
+	-- Parse plural body
+	local plural, count = nil, nil
+	if stream:check(T.DIR_PLURALIZE) then
+		local pluralize = stream:advance()
+		if not pluralize.bare and stream:check(T.IDENT) then
+			count = stream:advance().value
+		end
+		stream:match(T.NEWLINE)
+		local plural_body = parser.parse_body(stream, { T.DIR_END })
+		plural = trans_message(plural_body, variables, used, trimmed)
+
+		if not count then
+			if variables.count then
+				count = "count"
+			elseif #used == 1 then
+				count = used[1]
+			else
+				errors.raise(
+					errors.parse(
+						"@pluralize needs a count variable: name it after @pluralize or call it count",
+						pluralize.line,
+						pluralize.column
+					)
+				)
+			end
+		elseif not variables[count] then
+			variables[count] = ast.identifier(count, pluralize.line, pluralize.column)
+		end
+	end
+
+	stream:expect(T.DIR_END, "Expected @end to close @trans")
+	stream:match(T.NEWLINE)
+
+	local node = ast.trans(singular, plural, variables, count, start.line, start.column)
+	node.prefix = prefix
+	node.suffix = suffix
+	return node
+end
+
 --- Parse @do statement
 -- Syntax: {% do expression %} - executes expression without output
 -- @param stream table Token stream
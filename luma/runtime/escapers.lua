@@ -0,0 +1,228 @@
+--- Output format escaping for Luma
+-- Quotes values for YAML, JSON, POSIX shell and HCL output
+-- @module luma.runtime.escapers
+
+local escapers = {}
+
+--- JSON escape sequences for control and special characters
+local JSON_ESCAPES = {
+	['"'] = '\\"',
+	["\\"] = "\\\\",
+	["\b"] = "\\b",
+	["\f"] = "\\f",
+	["\n"] = "\\n",
+	["\r"] = "\\r",
+	["\t"] = "\\t",
+}
+
+--- Escape a string body for a JSON string literal
+-- @param s string String to escape
+-- @param html_safe boolean Also escape <, > and & so the result is safe in HTML
+-- @return string Escaped string without quotes
+local function json_escape(s, html_safe)
+	local pattern = html_safe and '[%c"\\<>&]' or '[%c"\\]'
+	return (s:gsub(pattern, function(c)
+		return JSON_ESCAPES[c] or string.format("\\u%04x", c:byte())
+	end))
+end
+
+--- Check whether a table is a sequence
+-- Tables whose metatable has __luma_array or __luma_object set, as the
+-- Go bindings give converted slices and maps, are arrays or objects
+-- whatever their keys; others are arrays when empty or keyed 1..n only.
+-- @param t table Table to check
+-- @return boolean True if t encodes as an array
+local function is_array(t)
+	local mt = getmetatable(t)
+	if mt and (mt.__luma_array or mt.__luma_object) then
+		return mt.__luma_array == true
+	end
+	local count = 0
+	for k in pairs(t) do
+		if type(k) ~= "number" or k < 1 or math.floor(k) ~= k then
+			return false
+		end
+		count = count + 1
+	end
+	return count == #t
+end
+
+--- Check whether a value is a plain table rather than an object that
+-- renders through __tostring (such as a safe string or Go value)
+-- @param v any Value to check
+-- @return boolean True for tables to encode as collections
+local function is_collection(v)
+	if type(v) ~= "table" then
+		return false
+	end
+	local mt = getmetatable(v)
+	return not (mt and mt.__tostring) and not v.__luma_safe
+end
+
+--- Encode a value as JSON
+-- Object keys are sorted so the output is deterministic.
+-- @param value any Value to encode
+-- @param options table|nil Options: html_safe, hcl (escape ${ and %{ template sequences)
+-- @return string JSON text
+function escapers.encode_json(value, options)
+	options = options or {}
+
+	local function encode(v)
+		local t = type(v)
+		if v == nil then
+			return "null"
+		elseif t == "boolean" then
+			return tostring(v)
+		elseif t == "number" then
+			if v ~= v or v == math.huge or v == -math.huge then
+				return "null"
+			end
+			if v == math.floor(v) and math.abs(v) < 1e15 then
+				return string.format("%d", v)
+			end
+			return string.format("%.14g", v)
+		elseif t == "table" and v.__luma_safe then
+			return encode(tostring(v.value))
+		elseif is_collection(v) then
+			local parts = {}
+			if is_array(v) then
+				for _, item in ipairs(v) do
+					parts[#parts + 1] = encode(item)
+				end
+				return "[" .. table.concat(parts, ",") .. "]"
+			end
+			local keys = {}
+			for k in pairs(v) do
+				keys[#keys + 1] = tostring(k)
+			end
+			table.sort(keys)
+			for _, k in ipairs(keys) do
+				local item = v[k]
+				if item == nil then
+					item = v[tonumber(k)]
+				end
+				parts[#parts + 1] = encode(k) .. ":" .. encode(item)
+			end
+			return "{" .. table.concat(parts, ",") .. "}"
+		end
+
+		local s = json_escape(tostring(v), options.html_safe)
+		if options.hcl then
+			s = s:gsub("([$%%]){", "%1%1{")
+		end
+		return '"' .. s .. '"'
+	end
+
+	return encode(value)
+end
+
+--- Words YAML 1.1 and 1.2 resolve to booleans or null
+local YAML_RESERVED = {
+	["true"] = true,
+	["false"] = true,
+	["yes"] = true,
+	["no"] = true,
+	["on"] = true,
+	["off"] = true,
+	["y"] = true,
+	["n"] = true,
+	["null"] = true,
+	["~"] = true,
+}
+
+--- Check whether a string can be written as a plain YAML scalar
+-- and still be read back as the same string
+-- @param s string String to check
+-- @return boolean True if no quoting is needed
+local function yaml_plain_safe(s)
+	if s == "" or s:find("^%s") or s:find("%s$") then
+		return false
+	end
+	if s:find("%c") or s:find("[,%[%]{}]") then
+		return false
+	end
+	-- Indicator characters and anything that may resolve to a number
+	if s:find("^[%-%?:#&%*!|>'\"%%@`%d%.%+~]") then
+		return false
+	end
+	if s:find(": ") or s:find(" #") or s:find(":$") then
+		return false
+	end
+	return not YAML_RESERVED[s:lower()]
+end
+
+--- Quote a string as a YAML double-quoted scalar
+-- @param value any Value to quote
+-- @return string Quoted scalar
+function escapers.yaml_quote(value)
+	return escapers.encode_json(tostring(value))
+end
+
+--- Escape a value for YAML output
+-- Numbers and booleans stay plain, strings are quoted only when a plain
+-- scalar would change their meaning, tables become flow collections.
+-- @param str string String form of the value
+-- @param value any Original value
+-- @return string YAML scalar or flow collection
+function escapers.yaml(str, value)
+	local t = type(value)
+	if t == "number" or t == "boolean" then
+		return str
+	end
+	if is_collection(value) then
+		return escapers.encode_json(value)
+	end
+	if yaml_plain_safe(str) then
+		return str
+	end
+	return escapers.yaml_quote(str)
+end
+
+--- Escape a value for JSON output
+-- @param _ string String form of the value
+-- @param value any Original value
+-- @return string JSON text
+function escapers.json(_, value)
+	return escapers.encode_json(value)
+end
+
+--- Quote a string as a single POSIX shell word
+-- @param value any Value to quote
+-- @return string Single-quoted word
+function escapers.shell_quote(value)
+	return "'" .. tostring(value):gsub("'", "'\\''") .. "'"
+end
+
+--- Escape a value for POSIX shell output
+-- Strings made only of characters that are never special to the shell
+-- are left as is; everything else is single-quoted. Lists and maps have
+-- no shell form and raise an error.
+-- @param str string String form of the value
+-- @param value any Original value
+-- @return string Shell word
+function escapers.shell(str, value)
+	if is_collection(value) then
+		error("cannot write a list or map in shell output; join it or use the tojson filter", 0)
+	end
+	if str:find("^[%w@%%+=:,%./_%-]+$") then
+		return str
+	end
+	return escapers.shell_quote(str)
+end
+
+--- Quote a string as an HCL string literal
+-- @param value any Value to quote
+-- @return string Quoted string with template sequences escaped
+function escapers.hcl_quote(value)
+	return escapers.encode_json(tostring(value), { hcl = true })
+end
+
+--- Escape a value for HCL output
+-- @param _ string String form of the value
+-- @param value any Original value
+-- @return string HCL expression
+function escapers.hcl(_, value)
+	return escapers.encode_json(value, { hcl = true })
+end
+
+return escapers
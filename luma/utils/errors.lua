@@ -158,13 +158,39 @@ function errors.format(err, source)
 	return table.concat(parts, "\n")
 end
 
+--- The error object last raised, see errors.capture
+local last_raised = nil
+
 --- Raise an error (throws)
 -- @param err table Error object
 -- @param source string|nil Original source for context
 function errors.raise(err, source)
+	last_raised = err
 	error(errors.format(err, source), 2)
 end
 
+--- Call a function in protected mode, returning the error it raised as
+-- an error object
+-- Errors raised with errors.raise keep their type and position; any
+-- other error becomes an error of type "Error".
+-- @param fn function Function to call
+-- @param ... any Arguments to pass to fn
+-- @return boolean success
+-- @return any First result, or the error object
+function errors.capture(fn, ...)
+	last_raised = nil
+	local ok, result = pcall(fn, ...)
+	if ok then
+		return true, result
+	end
+	local raised = last_raised
+	last_raised = nil
+	if raised and tostring(result):find(raised.type .. ": " .. raised.message, 1, true) then
+		return false, raised
+	end
+	return false, make_error("Error", tostring(result))
+end
+
 --- Check if a value is a Luma error
 -- @param v any Value to check
 -- @return boolean True if v is a Luma error
@@ -0,0 +1,56 @@
+--- Tests for access tracking of context reads
+-- @module spec.access_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+
+describe("Access Tracking", function()
+	before_each(function()
+		luma.clear_cache()
+		runtime.set_access_tracking(true)
+	end)
+
+	after_each(function()
+		runtime.set_access_tracking(false)
+		luma.clear_cache()
+	end)
+
+	--- Render a template and return its output and the reads it recorded
+	local function render(source, context)
+		local roots = {}
+		for name in pairs(context) do
+			roots[name] = true
+		end
+		runtime.begin_access(roots)
+		local out = luma.render(source, context)
+		return out, runtime.take_access()
+	end
+
+	it("should record the paths a template reads", function()
+		local out, reads = render("${app.name} ${app.missing | default('x')} $nope", { app = { name = "web" } })
+		assert.equals("web x ", out)
+		assert.same({ found = true, whole = false, iterated = false }, reads["app"])
+		assert.same({ found = true, whole = true, iterated = false }, reads["app.name"])
+		assert.is_false(reads["app.missing"].found)
+		assert.is_false(reads["nope"].found)
+	end)
+
+	it("should follow loop variables to the elements they stand for", function()
+		local _, reads = render("@for i in items\n${i.n}\n@end", { items = { { n = 1 }, { n = 2 } } })
+		assert.is_true(reads["items"].iterated)
+		assert.is_true(reads["items[0].n"].found)
+		assert.is_true(reads["items[1].n"].found)
+	end)
+
+	it("should not record template variables", function()
+		local _, reads = render("@let z = 1\n$z", { a = 1 })
+		assert.is_nil(reads["z"])
+	end)
+
+	it("should not change templates compiled without tracking", function()
+		runtime.set_access_tracking(false)
+		luma.clear_cache()
+		local _, reads = render("${app.name}", { app = { name = "web" } })
+		assert.same({}, reads)
+	end)
+end)
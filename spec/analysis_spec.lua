@@ -0,0 +1,140 @@
+--- Tests for static analysis of context references
+-- @module spec.analysis_spec
+
+local luma = require("luma")
+
+--- Format the paths of references as a.b[].c strings
+local function paths(refs)
+	local out = {}
+	for _, ref in ipairs(refs) do
+		local s = ""
+		for i, segment in ipairs(ref.path) do
+			if segment == "[]" then
+				s = s .. segment
+			elseif i > 1 then
+				s = s .. "." .. segment
+			else
+				s = segment
+			end
+		end
+		out[#out + 1] = s
+	end
+	return out
+end
+
+--- Find the reference to a path
+local function find(refs, path)
+	for i, p in ipairs(paths(refs)) do
+		if p == path then
+			return refs[i]
+		end
+	end
+end
+
+describe("Analysis", function()
+	it("should find the paths a template reads", function()
+		local refs = luma.references("Hello ${user.name}!\n@if enabled\n$title\n@end")
+		assert.same({ "user.name", "enabled", "title" }, paths(refs))
+	end)
+
+	it("should record where each segment is read", function()
+		local refs = luma.references("x\n  ${ spec.image.tag }", { name = "page.luma" })
+		local ref = refs[1]
+		assert.same({ "page.luma", 2, 6 }, ref.positions[1])
+		assert.same({ "page.luma", 2, 10 }, ref.positions[2])
+		assert.same({ "page.luma", 2, 16 }, ref.positions[3])
+	end)
+
+	it("should follow loop variables to the elements they stand for", function()
+		local refs = luma.references("@for c in spec.containers\n${c.image}\n@end")
+		assert.same({ "spec.containers", "spec.containers[].image" }, paths(refs))
+		assert.equals("list", refs[1].iterate)
+	end)
+
+	it("should mark two variable loops as iterating pairs", function()
+		local refs = luma.references("@for k, v in labels\n$k=${v.value}\n@end")
+		assert.equals("pairs", refs[1].iterate)
+		assert.is_not_nil(find(refs, "labels[].value"))
+		assert.is_nil(find(refs, "k"))
+	end)
+
+	it("should follow assignments of paths", function()
+		local refs = luma.references("@let cfg = settings.db\n${cfg.host}\n@let n = 1\n$n")
+		assert.is_not_nil(find(refs, "settings.db.host"))
+		assert.is_nil(find(refs, "n"))
+	end)
+
+	it("should mark called paths", function()
+		local refs = luma.references("${ user.FullName() }")
+		assert.is_true(refs[1].call)
+	end)
+
+	it("should skip names the runtime provides", function()
+		local refs = luma.references("@for x in xs\n${loop.index}\n@end")
+		assert.same({ "xs" }, paths(refs))
+	end)
+
+	it("should skip macro parameters", function()
+		local refs = luma.references("@macro card(title)\n${title} ${site}\n@end")
+		assert.same({ "site" }, paths(refs))
+	end)
+
+	it("should mark paths read through a default filter as optional", function()
+		local refs = luma.references('${ port | default(8080) } ${ host | d("localhost") } $name')
+		assert.is_true(find(refs, "port").optional)
+		assert.equals(8080, find(refs, "port").default)
+		assert.equals("localhost", find(refs, "host").default)
+		assert.is_nil(find(refs, "name").optional)
+	end)
+
+	it("should mark paths behind is defined tests as optional", function()
+		local source = table.concat({
+			"@if tls is defined and debug",
+			"${tls.cert}",
+			"@else",
+			"${fallback}",
+			"@end",
+			"@if proxy is not defined",
+			"none",
+			"@else",
+			"${proxy.url}",
+			"@end",
+		}, "\n")
+		local refs = luma.references(source)
+		assert.is_true(find(refs, "tls").optional)
+		assert.is_true(find(refs, "tls.cert").optional)
+		assert.is_nil(find(refs, "debug").optional)
+		assert.is_nil(find(refs, "fallback").optional)
+		assert.is_true(find(refs, "proxy.url").optional)
+	end)
+
+	describe("includes", function()
+		local runtime = require("luma.runtime")
+
+		before_each(function()
+			runtime.set_loader(function(name)
+				if name == "item.luma" then
+					return "${item.name}"
+				elseif name == "loop.luma" then
+					return '@include "loop.luma"\n$again'
+				end
+			end)
+		end)
+
+		after_each(function()
+			runtime.set_loader(nil)
+		end)
+
+		it("should follow templates included with context", function()
+			local refs = luma.references('@for item in items\n@include "item.luma"\n@end')
+			local ref = find(refs, "items[].name")
+			assert.is_not_nil(ref)
+			assert.equals("item.luma", ref.position[1])
+		end)
+
+		it("should not follow an include cycle", function()
+			local refs = luma.references('@include "loop.luma"')
+			assert.same({ "again" }, paths(refs))
+		end)
+	end)
+end)
@@ -29,6 +29,13 @@ describe("Autoescape Blocks", function()
 			assert.matches("&lt;b&gt;bold&lt;/b&gt;", result)
 		end)
 
+		it("should disable escaping in autoescape off block", function()
+			local template = '{% autoescape "off" %}{{ html }}{% endautoescape %} {{ html }}'
+			local result = luma.render(template, { html = "<i>" }, { syntax = "jinja" })
+			assert.equals("<i> &lt;i&gt;", result)
+			assert.equals("<i>", luma.render("${html}", { html = "<i>" }, { autoescape = "off" }))
+		end)
+
 		it("should work with Luma native syntax", function()
 			local template = [[
 @autoescape false
@@ -171,6 +178,57 @@ Back L1: $html
 			local result = luma.render(template, { html = "<tag>" }, { syntax = "jinja" })
 			assert.matches("<tag>", result)
 		end)
+
+		it("should escape apostrophes as entities in xml mode", function()
+			local template = [[
+{% autoescape "xml" %}
+{{ text }}
+{% endautoescape %}]]
+			local result = luma.render(template, { text = "<a href='x'>" }, { syntax = "jinja" })
+			assert.matches("&lt;a href=&apos;x&apos;&gt;", result)
+		end)
+	end)
+
+	describe("autoescape option", function()
+		local runtime = require("luma.runtime")
+
+		after_each(function()
+			runtime.set_autoescape(true)
+			runtime.set_loader(nil)
+			luma.clear_cache()
+		end)
+
+		it("should disable escaping with autoescape = false", function()
+			local result = luma.render("${html}", { html = "<b>" }, { autoescape = false })
+			assert.equals("<b>", result)
+		end)
+
+		it("should select the xml mode", function()
+			local result = luma.render("${text}", { text = "'" }, { autoescape = "xml" })
+			assert.equals("&apos;", result)
+		end)
+
+		it("should select the mode by template name", function()
+			runtime.set_autoescape(function(name)
+				return name and name:match("%.html$") and "html" or false
+			end)
+			runtime.set_loader(function(name)
+				return "${value}"
+			end)
+
+			local result = luma.render(
+				'{% include "page.html" %} {% include "notes.txt" %}',
+				{ value = "<b>" },
+				{ syntax = "jinja" }
+			)
+			assert.equals("&lt;b&gt; <b>", result)
+		end)
+
+		it("should reject unknown modes", function()
+			assert.has_error(function()
+				luma.render("${value}", { value = "x" }, { autoescape = "klingon" })
+			end)
+		end)
 	end)
 
 	describe("interaction with safe filter", function()
@@ -0,0 +1,154 @@
+--- Tests for template caching and cache invalidation
+-- @module spec.cache_invalidation_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+
+describe("Cache Invalidation", function()
+	local templates
+	local loads
+
+	before_each(function()
+		templates = {}
+		loads = {}
+		luma.clear_cache()
+		runtime.set_loader(function(name)
+			loads[name] = (loads[name] or 0) + 1
+			return templates[name]
+		end)
+	end)
+
+	after_each(function()
+		runtime.set_loader(nil)
+		luma.clear_cache()
+	end)
+
+	it("should cache included templates until invalidated", function()
+		templates["partial.luma"] = "v1"
+		assert.equals("v1", luma.render('@include "partial.luma"', {}))
+
+		templates["partial.luma"] = "v2"
+		assert.equals("v1", luma.render('@include "partial.luma"', {}))
+
+		luma.invalidate("partial.luma")
+		assert.equals("v2", luma.render('@include "partial.luma"', {}))
+	end)
+
+	it("should keep unrelated templates cached", function()
+		templates["a.luma"] = "a"
+		templates["b.luma"] = "b"
+		luma.render('@include "a.luma"\n@include "b.luma"', {})
+
+		luma.invalidate("a.luma")
+		luma.render('@include "a.luma"\n@include "b.luma"', {})
+		assert.equals(2, loads["a.luma"])
+		assert.equals(1, loads["b.luma"])
+	end)
+
+	it("should invalidate templates that include a changed template", function()
+		templates["page.luma"] = '@include "footer.luma"\n'
+		templates["footer.luma"] = "old"
+		luma.render('@include "page.luma"', {})
+
+		templates["footer.luma"] = "new"
+		luma.invalidate("footer.luma")
+		assert.equals("new", luma.render('@include "page.luma"', {}))
+		assert.equals(2, loads["page.luma"])
+	end)
+
+	it("should invalidate templates that extend a changed template", function()
+		templates["base.luma"] = "old base\n@block body\ndefault\n@end\n"
+		templates["child.luma"] = '@extends "base.luma"\n@block body\nchild\n@end\n'
+		assert.matches("old base", luma.render('@include "child.luma"', {}))
+
+		templates["base.luma"] = "new base\n@block body\ndefault\n@end\n"
+		luma.invalidate("base.luma")
+		local result = luma.render('@include "child.luma"', {})
+		assert.matches("new base", result)
+		assert.matches("child", result)
+	end)
+
+	it("should invalidate imported macros", function()
+		templates["macros.luma"] = "@macro hi()\nhello\n@end"
+		assert.matches("hello", luma.render('@import "macros.luma" as m\n${m.hi()}', {}))
+
+		templates["macros.luma"] = "@macro hi()\nbonjour\n@end"
+		luma.invalidate("macros.luma")
+		assert.matches("bonjour", luma.render('@import "macros.luma" as m\n${m.hi()}', {}))
+	end)
+
+	it("should handle templates that include each other", function()
+		templates["a.luma"] = '@if depth\n@include "b.luma"\n@end'
+		templates["b.luma"] = "b"
+		luma.render('@include "a.luma"', { depth = true })
+		luma.invalidate("b.luma")
+		assert.equals("b", luma.render('@include "a.luma"', { depth = true }))
+	end)
+end)
+
+describe("Code Cache", function()
+	local compiler = require("luma.compiler")
+	local stored
+	local templates
+
+	before_each(function()
+		stored = {}
+		templates = {}
+		compiler.set_code_cache({
+			fingerprint = function(data)
+				return data
+			end,
+			get = function(key)
+				local entry = stored[key]
+				if entry then
+					return entry.code, entry.parents
+				end
+			end,
+			put = function(key, code, parents)
+				stored[key] = { code = code, parents = parents }
+			end,
+		})
+		runtime.set_loader(function(name)
+			return templates[name]
+		end)
+	end)
+
+	after_each(function()
+		compiler.set_code_cache(nil)
+		runtime.set_loader(nil)
+		luma.clear_cache()
+	end)
+
+	local function count(t)
+		local n = 0
+		for _ in pairs(t) do
+			n = n + 1
+		end
+		return n
+	end
+
+	it("should store generated code and reuse it", function()
+		assert.equals("Hello, World!", luma.render("Hello, $name!", { name = "World" }))
+		assert.equals(1, count(stored))
+
+		for _, entry in pairs(stored) do
+			entry.code = entry.code:gsub("Hello", "Howdy")
+		end
+		assert.equals("Howdy, World!", luma.render("Hello, $name!", { name = "World" }))
+	end)
+
+	it("should key entries by options", function()
+		luma.render("$x", { x = "<" }, { autoescape = true })
+		luma.render("$x", { x = "<" }, { autoescape = false })
+		assert.equals(2, count(stored))
+	end)
+
+	it("should not use code generated with a different parent", function()
+		templates["base.luma"] = "v1\n@block body\n@end"
+		local child = '@extends "base.luma"\n@block body\nchild\n@end'
+		assert.matches("v1", luma.render(child, {}))
+
+		templates["base.luma"] = "v2\n@block body\n@end"
+		assert.matches("v2", luma.render(child, {}))
+	end)
+end)
@@ -0,0 +1,108 @@
+--- Tests for template coverage collection
+-- @module spec.coverage_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+
+--- Sum the counts of the probes matching kind and line, by template,
+-- x, y and name
+local function hits(taken, kind, template, line, y)
+	local total = 0
+	for _, entry in ipairs(taken) do
+		for i, p in ipairs(entry.probes) do
+			if p[1] == kind and p[2] == template and p[3] == line and (y == nil or p[5] == y) then
+				total = total + entry.counts[i]
+			end
+		end
+	end
+	return total
+end
+
+--- Check whether any probe of kind exists at line
+local function probed(taken, kind, template, line)
+	for _, entry in ipairs(taken) do
+		for _, p in ipairs(entry.probes) do
+			if p[1] == kind and p[2] == template and p[3] == line then
+				return true
+			end
+		end
+	end
+	return false
+end
+
+describe("Coverage", function()
+	local templates
+
+	before_each(function()
+		templates = {}
+		luma.clear_cache()
+		runtime.take_coverage()
+		runtime.set_coverage(true)
+		runtime.set_loader(function(name)
+			return templates[name]
+		end)
+	end)
+
+	after_each(function()
+		runtime.set_coverage(false)
+		runtime.set_loader(nil)
+		runtime.take_coverage()
+		luma.clear_cache()
+	end)
+
+	it("should count if branches", function()
+		local source = "@if x\nyes\n@elif y\nmaybe\n@end"
+		luma.render(source, { x = true }, { name = "if.luma" })
+		luma.render(source, { x = true }, { name = "if.luma" })
+		local taken = runtime.take_coverage()
+
+		assert.equals(2, hits(taken, "branch", "if.luma", 1, 0))
+		assert.equals(0, hits(taken, "branch", "if.luma", 1, 1))
+		assert.equals(0, hits(taken, "branch", "if.luma", 3, 0))
+		assert.is_true(probed(taken, "branch", "if.luma", 3))
+		assert.equals(2, hits(taken, "line", "if.luma", 2))
+		assert.equals(0, hits(taken, "line", "if.luma", 4))
+	end)
+
+	it("should count loop bodies and empty loops", function()
+		local source = "@for i in items\n$i\n@end"
+		luma.render(source, { items = { 1, 2, 3 } }, { name = "for.luma" })
+		luma.render(source, { items = {} }, { name = "for.luma" })
+		local taken = runtime.take_coverage()
+
+		assert.equals(3, hits(taken, "branch", "for.luma", 1, 0))
+		assert.equals(1, hits(taken, "branch", "for.luma", 1, 1))
+	end)
+
+	it("should count macro calls", function()
+		local source = "@macro used()\nu\n@end\n@macro unused()\nn\n@end\n@call used()\n@call used()"
+		luma.render(source, {}, { name = "macros.luma" })
+		local taken = runtime.take_coverage()
+
+		assert.equals(2, hits(taken, "macro", "macros.luma", 1))
+		assert.equals(0, hits(taken, "macro", "macros.luma", 4))
+	end)
+
+	it("should attribute inherited lines to the parent template", function()
+		templates["base.luma"] = "header\n@block body\n@end\nfooter"
+		luma.render('@extends "base.luma"\n@block body\nchild\n@end', {}, { name = "child.luma" })
+		local taken, sources = runtime.take_coverage()
+
+		assert.equals(1, hits(taken, "line", "base.luma", 1))
+		assert.equals(1, hits(taken, "line", "child.luma", 3))
+		assert.equals(templates["base.luma"], sources["base.luma"])
+		assert.is_not_nil(sources["child.luma"])
+	end)
+
+	it("should reset counts once taken", function()
+		luma.render("@if x\ny\n@end", { x = true }, { name = "reset.luma" })
+		runtime.take_coverage()
+		assert.same({}, runtime.take_coverage())
+	end)
+
+	it("should not instrument templates when disabled", function()
+		runtime.set_coverage(false)
+		luma.render("@if x\ny\n@end", { x = true }, { name = "off.luma" })
+		assert.same({}, runtime.take_coverage())
+	end)
+end)
@@ -0,0 +1,102 @@
+--- Tests for output format escaping
+-- @module spec.escapers_spec
+
+local luma = require("luma")
+
+describe("Output Format Escaping", function()
+	describe("yaml mode", function()
+		local function render(value)
+			return luma.render("v: ${value}", { value = value }, { autoescape = "yaml" })
+		end
+
+		it("should leave plain strings unquoted", function()
+			assert.equals("v: nginx:1.25", render("nginx:1.25"))
+			assert.equals("v: hello world", render("hello world"))
+		end)
+
+		it("should quote strings YAML would misread", function()
+			assert.equals('v: "a: b"', render("a: b"))
+			assert.equals('v: "x # y"', render("x # y"))
+			assert.equals('v: "yes"', render("yes"))
+			assert.equals('v: "007"', render("007"))
+			assert.equals('v: ""', render(""))
+			assert.equals('v: "- item"', render("- item"))
+			assert.equals('v: "line\\nbreak"', render("line\nbreak"))
+		end)
+
+		it("should keep numbers and booleans plain", function()
+			assert.equals("v: 3", render(3))
+			assert.equals("v: true", render(true))
+		end)
+
+		it("should write tables as flow collections", function()
+			assert.equals('v: ["a","b"]', render({ "a", "b" }))
+			assert.equals('v: {"x":1,"y":"z"}', render({ y = "z", x = 1 }))
+		end)
+
+		it("should not quote safe values", function()
+			local result = luma.render("v: ${value | safe}", { value = "a: b" }, { autoescape = "yaml" })
+			assert.equals("v: a: b", result)
+		end)
+	end)
+
+	describe("json mode", function()
+		it("should encode values as JSON", function()
+			local result = luma.render(
+				'{"name": ${name}, "port": ${port}, "tags": ${tags}}',
+				{ name = 'say "hi"', port = 80, tags = {} },
+				{ autoescape = "json" }
+			)
+			assert.equals('{"name": "say \\"hi\\"", "port": 80, "tags": []}', result)
+		end)
+
+		it("should keep the kind of marked empty tables", function()
+			local context = {
+				map = setmetatable({}, { __luma_object = true }),
+				list = setmetatable({}, { __luma_array = true }),
+				numbered = setmetatable({ "a" }, { __luma_object = true }),
+			}
+			for _, mode in ipairs({ "json", "yaml", "hcl" }) do
+				local result = luma.render("${map} ${list} ${numbered}", context, { autoescape = mode })
+				assert.equals('{} [] {"1":"a"}', result)
+			end
+		end)
+	end)
+
+	describe("shell mode", function()
+		it("should quote words with special characters", function()
+			local template = "echo ${a} ${b} ${c}"
+			local result = luma.render(template, { a = "plain-word", b = "$(id)", c = "it's" }, { autoescape = "shell" })
+			assert.equals("echo plain-word '$(id)' 'it'\\''s'", result)
+		end)
+
+		it("should reject lists and maps", function()
+			for _, value in ipairs({ { "a", "b" }, { k = "v" }, {} }) do
+				assert.has_error(function()
+					luma.render("echo ${v}", { v = value }, { autoescape = "shell" })
+				end)
+			end
+			assert.equals("echo 'a b'", luma.render("echo ${v | join(' ')}", { v = { "a", "b" } }, { autoescape = "shell" }))
+		end)
+	end)
+
+	describe("hcl mode", function()
+		it("should quote strings and escape template sequences", function()
+			local result = luma.render("x = ${v}", { v = "${file(\"/etc/passwd\")}" }, { autoescape = "hcl" })
+			assert.equals('x = "$${file(\\"/etc/passwd\\")}"', result)
+		end)
+	end)
+
+	describe("quoting filters", function()
+		it("should quote values regardless of autoescape mode", function()
+			local template = "${v | yaml_quote} ${v | shell_quote} ${v | hcl_quote} ${v | json}"
+			local result = luma.render(template, { v = "a'b" }, { autoescape = false })
+			assert.equals([["a'b" 'a'\''b' "a'b" "a'b"]], result)
+		end)
+
+		it("should not be escaped again by html autoescape", function()
+			local result = luma.render("${v | json}", { v = "<x>" })
+			assert.equals('"\\u003cx\\u003e"', result)
+		end)
+	end)
+end)
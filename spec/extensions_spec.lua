@@ -0,0 +1,108 @@
+--- Tests for extension directives
+-- @module spec.extensions_spec
+
+local luma = require("luma")
+local extensions = require("luma.extensions")
+
+describe("Extensions", function()
+	before_each(function()
+		extensions.register("feature", {
+			block = true,
+			render = function(args, _, body)
+				if args[1] == "beta" then
+					return body
+				end
+				return ""
+			end,
+		})
+		extensions.register("stamp", {
+			render = function(args, named)
+				local parts = {}
+				for i = 1, args.n do
+					parts[#parts + 1] = tostring(args[i])
+				end
+				if named and named.sep then
+					return table.concat(parts, named.sep)
+				end
+				return "stamp(" .. table.concat(parts, ",") .. ")"
+			end,
+		})
+	end)
+
+	after_each(function()
+		extensions.unregister("feature")
+		extensions.unregister("stamp")
+	end)
+
+	describe("registry", function()
+		it("should list registered extensions", function()
+			assert.same({ "feature", "stamp" }, extensions.list())
+		end)
+
+		it("should reject reserved and invalid names", function()
+			local render = function()
+				return ""
+			end
+			assert.has_error(function()
+				extensions.register("if", { render = render })
+			end)
+			assert.has_error(function()
+				extensions.register("my-ext", { render = render })
+			end)
+			assert.has_error(function()
+				extensions.register("nop", {})
+			end)
+		end)
+	end)
+
+	describe("native syntax", function()
+		it("should pass the rendered body to block extensions", function()
+			local template = '@feature "beta"\nHello $name\n@end\n@feature "gamma"\nHidden\n@end'
+			local result = luma.render(template, { name = "World" })
+			assert.matches("Hello World", result)
+			assert.not_matches("Hidden", result)
+		end)
+
+		it("should pass positional and named arguments", function()
+			assert.equals("1-x", luma.render('@stamp 1, "x", sep="-"\n', {}))
+		end)
+
+		it("should not read the next line as arguments", function()
+			assert.equals("stamp()name", luma.render("@stamp\nname", {}))
+		end)
+
+		it("should keep the text after an inline extension", function()
+			assert.equals("inline stamp() here", luma.render("inline @stamp here", {}))
+			assert.equals("a stamp(1,x) b\n", luma.render('a @stamp(1, "x") b\n', {}))
+			assert.equals("a 1:2 (b)", luma.render('a @stamp((1), 2, sep=":") (b)', {}))
+		end)
+
+		it("should nest inside other directives", function()
+			local template = '@if true\n@feature "beta"\nin\n@end\n@end\n'
+			assert.matches("in", luma.render(template, {}))
+		end)
+	end)
+
+	describe("jinja syntax", function()
+		it("should close blocks with the end tag", function()
+			local template = "{% feature 'beta' %}<{{ n }}>{% endfeature %}|{% stamp n %}"
+			local result = luma.render(template, { n = 1 }, { syntax = "jinja" })
+			assert.equals("<1>|stamp(1)", result)
+		end)
+	end)
+
+	it("should not autoescape the output", function()
+		local result = luma.render('@stamp "<b>", sep=""\n', {}, { autoescape = true })
+		assert.equals("<b>", result)
+	end)
+
+	it("should describe the registered extensions", function()
+		assert.equals("feature:block,stamp:inline", extensions.signature())
+	end)
+
+	it("should fail on unregistered directives", function()
+		assert.has_error(function()
+			luma.render("@nope\n", {})
+		end)
+	end)
+end)
@@ -71,6 +71,38 @@ describe("Extended Filters", function()
 			end)
 		end)
 
+		describe("nindent", function()
+			it("should start a new line indented to an explicit width", function()
+				local result = luma.render("labels:${s | nindent(4)}", { s = "a: 1\nb: 2" })
+				assert.equals("labels:\n    a: 1\n    b: 2", result)
+			end)
+
+			it("should indent relative to the current line without a width", function()
+				local template = "spec:\n  labels:${s | nindent}"
+				local result = luma.render(template, { s = "a: 1\nb: 2" })
+				assert.equals("spec:\n  labels:\n    a: 1\n    b: 2", result)
+			end)
+
+			it("should still escape the value", function()
+				local result = luma.render("x:${s | nindent(2)}", { s = "<b>" })
+				assert.equals("x:\n  &lt;b&gt;", result)
+			end)
+
+			it("should return a string other filters can take", function()
+				local context = { s = "a\nb", html = "<b>" }
+				assert.equals("x:\n    A\n    B", luma.render("x:${s | nindent(4) | upper}", context))
+				assert.equals("x:a\n  b", luma.render("x:${s | nindent(2) | trim}", context))
+				assert.equals("8", luma.render("${s | nindent | length}", context))
+				assert.equals("x:\n  <b>", luma.render("x:${html | safe | nindent}", context))
+			end)
+
+			it("should indent filter block output", function()
+				local template = "data:\n  config:{% filter nindent %}key: value{% endfilter %}"
+				local result = luma.render(template, {})
+				assert.equals("data:\n  config:\n    key: value", result)
+			end)
+		end)
+
 		describe("truncate", function()
 			it("should truncate long strings", function()
 				local result = luma.render("${s | truncate(10)}", { s = "Hello World Test" })
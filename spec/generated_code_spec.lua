@@ -0,0 +1,60 @@
+--- Tests for the generated code and its line map
+-- @module spec.generated_code_spec
+
+local luma = require("luma")
+local compiler = require("luma.compiler")
+local runtime = require("luma.runtime")
+
+describe("Generated Code", function()
+	after_each(function()
+		compiler.set_code_dump(nil)
+		runtime.set_loader(nil)
+		luma.clear_cache()
+	end)
+
+	it("should map generated lines back to template lines", function()
+		local compiled = compiler.compile("a\n@if x\n${x}\n@end", { name = "page.luma" })
+		local lua_line
+		local n = 0
+		for line in (compiled.source .. "\n"):gmatch("([^\n]*)\n") do
+			n = n + 1
+			if line:find("__esc(", 1, true) and line:find('__ctx["x"]', 1, true) then
+				lua_line = n
+			end
+		end
+
+		local name, line = compiled:template_line(lua_line)
+		assert.equals("page.luma", name)
+		assert.equals(3, line)
+	end)
+
+	it("should report runtime errors at the template line", function()
+		local ok, err = pcall(luma.render, "first\n\n${ 1 + {} }", {}, { name = "math.luma" })
+		assert.is_false(ok)
+		assert.matches("at math%.luma:3", tostring(err))
+		assert.matches(">    3 | %${ 1 %+ {} }", tostring(err))
+	end)
+
+	it("should report errors in inherited blocks at the parent template line", function()
+		runtime.set_loader(function(name)
+			if name == "base.luma" then
+				return "top\n@block body\n@end\n${ {} .. 1 }"
+			end
+		end)
+		local ok, err = pcall(luma.render, '@extends "base.luma"\n@block body\nx\n@end', {}, { name = "child.luma" })
+		assert.is_false(ok)
+		assert.matches("at base%.luma:4", tostring(err))
+	end)
+
+	it("should pass generated code to the code dump", function()
+		local dumped = {}
+		compiler.set_code_dump(function(name, code)
+			dumped[#dumped + 1] = { name, code }
+		end)
+		local compiled = compiler.compile("hi", { name = "hi.luma" })
+
+		assert.equals(1, #dumped)
+		assert.equals("hi.luma", dumped[1][1])
+		assert.equals(compiled.source, dumped[1][2])
+	end)
+end)
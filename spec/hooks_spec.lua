@@ -0,0 +1,70 @@
+--- Tests for instrumentation hooks
+-- @module spec.hooks_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+
+describe("Instrumentation Hooks", function()
+	local templates
+	local events
+
+	before_each(function()
+		templates = {}
+		events = {}
+		luma.clear_cache()
+		runtime.set_loader(function(name)
+			return templates[name]
+		end)
+		runtime.set_hooks({
+			start = function(kind, name)
+				table.insert(events, "start " .. kind .. " " .. tostring(name))
+			end,
+			finish = function(kind, name, size, err)
+				local event = "finish " .. kind .. " " .. tostring(name) .. " " .. size
+				if err then
+					event = event .. " error"
+				end
+				table.insert(events, event)
+			end,
+		})
+	end)
+
+	after_each(function()
+		runtime.set_hooks(nil)
+		runtime.set_loader(nil)
+		luma.clear_cache()
+	end)
+
+	it("should report compiles, includes and filters in order", function()
+		templates["footer.luma"] = "${name | upper}"
+		local result = luma.render('@include "footer.luma"', { name = "x" }, { name = "page.luma" })
+		assert.equals("X", result)
+
+		assert.equals("start compile page.luma", events[1])
+		assert.matches("^finish compile page%.luma %d+$", events[2])
+		assert.same({
+			"start include footer.luma",
+			"start compile footer.luma",
+		}, { events[3], events[4] })
+		assert.matches("^finish compile footer%.luma %d+$", events[5])
+		assert.same({
+			"start filter upper",
+			"finish filter upper 1",
+			"finish include footer.luma 1",
+		}, { events[6], events[7], events[8] })
+		assert.equals(8, #events)
+	end)
+
+	it("should report nothing once removed", function()
+		runtime.set_hooks(nil)
+		assert.equals("HI", luma.render("${'hi' | upper}", {}))
+		assert.equals(0, #events)
+	end)
+
+	it("should report failures and pass the error on", function()
+		local ok, err = pcall(luma.render, '@include "missing.luma"', {})
+		assert.is_false(ok)
+		assert.matches("missing.luma", tostring(err))
+		assert.equals("finish include missing.luma 0 error", events[#events])
+	end)
+end)
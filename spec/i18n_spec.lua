@@ -0,0 +1,109 @@
+--- Tests for translatable blocks and translation functions
+-- @module spec.i18n_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+local analysis = require("luma.compiler.analysis")
+
+describe("Internationalization", function()
+	after_each(function()
+		runtime.set_translator(nil)
+	end)
+
+	describe("trans blocks", function()
+		it("should render untranslated messages with their variables", function()
+			local template = "@trans name=user.name\nHello $name, 100% done\n@end"
+			assert.equals("Hello Ada, 100% done\n", luma.render(template, { user = { name = "Ada" } }))
+		end)
+
+		it("should read variables not given as arguments from the context", function()
+			assert.equals("Hi Bo\n", luma.render("@trans\nHi $who\n@end", { who = "Bo" }))
+		end)
+
+		it("should escape variables but not the message", function()
+			runtime.set_translator({
+				gettext = function()
+					return "<b>%(name)s</b>"
+				end,
+			})
+			local result = luma.render("@trans\nHi $name\n@end", { name = "<i>" }, { autoescape = true })
+			assert.equals("<b>&lt;i&gt;</b>\n", result)
+		end)
+
+		it("should choose the plural form by count", function()
+			local template = "@trans count=n\nOne file\n@pluralize\n$count files\n@end"
+			assert.equals("One file\n", luma.render(template, { n = 1 }))
+			assert.equals("4 files\n", luma.render(template, { n = 4 }))
+		end)
+
+		it("should support Jinja syntax with a named count", function()
+			local template = "{% trans n=items|length %}{{ n }} item{% pluralize n %}{{ n }} items{% endtrans %}"
+			local result = luma.render(template, { items = { 1, 2 } }, { syntax = "jinja" })
+			assert.equals("2 items", result)
+		end)
+
+		it("should collapse whitespace when trimmed", function()
+			local template = "{% trans trimmed %}\n  Hello\n  {{ name }}\n{% endtrans %}"
+			assert.equals("Hello x", luma.render(template, { name = "x" }, { syntax = "jinja" }))
+		end)
+
+		it("should pass message ids to the translator", function()
+			local seen = {}
+			runtime.set_translator({
+				ngettext = function(singular, plural, n)
+					seen[#seen + 1] = singular .. "|" .. plural .. "|" .. n
+					return plural
+				end,
+			})
+			luma.render("@trans count=n\n  One file\n@pluralize\n  $count files\n@end", { n = 2 })
+			assert.same({ "One file|%(count)s files|2" }, seen)
+		end)
+
+		it("should reject expressions in the body", function()
+			assert.has_error(function()
+				luma.render("@trans\nHi $user.name\n@end", {})
+			end)
+			assert.has_error(function()
+				luma.render("@trans\n@if x\nno\n@end\n@end", {})
+			end)
+		end)
+	end)
+
+	describe("translation functions", function()
+		it("should format named arguments", function()
+			local template = "${_('Hi %(name)s')} ${gettext('%(a)s%%', a=5)} ${ngettext('%(num)s day', '%(num)s days', 2)}"
+			assert.equals("Hi  5% 2 days", luma.render(template, {}))
+		end)
+
+		it("should use the translator", function()
+			runtime.set_translator({
+				gettext = function(message)
+					return message:upper()
+				end,
+			})
+			assert.equals("SETTINGS", luma.render("${_('Settings')}", {}))
+		end)
+
+		it("should prefer context values", function()
+			local context = {
+				_ = function(message)
+					return "ctx:" .. message
+				end,
+			}
+			assert.equals("ctx:Settings", luma.render("${_('Settings')}", context))
+		end)
+	end)
+
+	describe("message extraction", function()
+		it("should find messages in template order", function()
+			local template = "${_('b')}\n@trans count=n\nOne\n@pluralize\nMany\n@end\n${ngettext('x', 'xs', n)} ${_(dynamic)}"
+			local messages = analysis.messages(template, { name = "t.luma" })
+			assert.equals(3, #messages)
+			assert.equals("b", messages[1].id)
+			assert.same({ "t.luma", 1, 3 }, messages[1].position)
+			assert.equals("One", messages[2].id)
+			assert.equals("Many", messages[2].plural)
+			assert.equals("xs", messages[3].plural)
+		end)
+	end)
+end)
@@ -296,4 +296,84 @@ Continued]]
 			assert.matches("Continued", result)
 		end)
 	end)
+
+	describe("file loading", function()
+		local runtime = require("luma.runtime")
+
+		after_each(function()
+			runtime.set_file_loading(true)
+			runtime.set_loader(nil)
+			luma.clear_cache()
+		end)
+
+		it("should not read files when file loading is disabled", function()
+			local partial = create_temp_file("disabled.luma", "From disk")
+			runtime.set_file_loading(false)
+
+			local ok, err = pcall(luma.render, '{% include "' .. partial .. '" %}', {})
+			assert.is_false(ok)
+			assert.matches("Template not found", tostring(err))
+
+			remove_temp_file(partial)
+		end)
+
+		it("should still use the custom loader when file loading is disabled", function()
+			runtime.set_file_loading(false)
+			runtime.set_loader(function(name)
+				if name == "partial.luma" then
+					return "From loader"
+				end
+			end)
+
+			local result = luma.render('{% include "partial.luma" %}', {})
+			assert.equals("From loader", result)
+		end)
+	end)
+
+	describe("indentation", function()
+		local runtime = require("luma.runtime")
+
+		before_each(function()
+			runtime.set_loader(function(name)
+				if name == "labels.luma" then
+					return "app: web\ntier: frontend\n"
+				end
+			end)
+		end)
+
+		after_each(function()
+			runtime.set_loader(nil)
+			luma.clear_cache()
+		end)
+
+		it("should indent to the directive's own column", function()
+			local template = 'metadata:\n  labels:\n    @include "labels.luma" indent\n'
+			local result = luma.render(template, {})
+			assert.equals("metadata:\n  labels:\n    app: web\n    tier: frontend\n", result)
+		end)
+
+		it("should indent to an explicit width", function()
+			local template = 'spec:\n@include "labels.luma" indent 6\n'
+			local result = luma.render(template, {})
+			assert.equals("spec:\n      app: web\n      tier: frontend\n", result)
+		end)
+
+		it("should apply filters to the included output", function()
+			local template = 'labels:{% include "labels.luma" | trim | nindent(4) %}\n'
+			local result = luma.render(template, {})
+			assert.equals("labels:\n    app: web\n    tier: frontend\n", result)
+		end)
+
+		it("should nest two spaces deeper with nindent and no width", function()
+			local template = '  selector:{% include "labels.luma" | trim | nindent %}\n'
+			local result = luma.render(template, {})
+			assert.equals("  selector:\n    app: web\n    tier: frontend\n", result)
+		end)
+
+		it("should combine indent with ignore missing", function()
+			local template = 'a:\n  @include "absent.luma" ignore missing indent\nb: 1'
+			local result = luma.render(template, {})
+			assert.equals("a:\nb: 1", result)
+		end)
+	end)
 end)
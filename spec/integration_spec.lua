@@ -18,6 +18,32 @@ describe("Luma Integration", function()
 			assert.equals("Bob", result)
 		end)
 
+		it("renders zero-argument calls in simple interpolation", function()
+			local user = {
+				name = "Bob",
+				FullName = function()
+					return "Bob Smith"
+				end,
+			}
+			local result = luma.render("$user.FullName() ($user.name)", { user = user })
+			assert.equals("Bob Smith (Bob)", result)
+		end)
+
+		it("keeps parentheses after values that are not callable", function()
+			local result = luma.render("Call $name() now\n$fn() {", { name = "Bob" })
+			assert.equals("Call Bob() now\n() {", result)
+		end)
+
+		it("renders functions reached without a call as empty", function()
+			local result = luma.render("[$fn] [${ns | default('x')}]", {
+				fn = function()
+					return "called"
+				end,
+				ns = function() end,
+			})
+			assert.equals("[] [x]", result)
+		end)
+
 		it("renders expression interpolation", function()
 			local result = luma.render("${name}", { name = "Charlie" })
 			assert.equals("Charlie", result)
@@ -47,6 +47,14 @@ describe("Lexer", function()
 				assert.equals("user.profile.name", result[1].value)
 			end)
 
+			it("tokenizes $obj.method() calls", function()
+				local result = lexer.tokenize("$user.FullName()!")
+				assert.equals(3, #result)
+				assert.equals(T.INTERP_SIMPLE, result[1].type)
+				assert.equals("user.FullName()", result[1].value)
+				assert.equals("!", result[2].value)
+			end)
+
 			it("escapes $$ to literal $", function()
 				local result = lexer.tokenize("Price: $$100")
 				assert.equals(2, #result)
@@ -221,4 +229,74 @@ describe("Lexer", function()
 			end)
 		end)
 	end)
+
+	describe("syntax options", function()
+		local luma = require("luma")
+
+		--- List the token types of a template, marking inline directives
+		local function types(source, options)
+			local out = {}
+			for _, token in ipairs(lexer.tokenize(source, options)) do
+				out[#out + 1] = token.type .. (token.inline and "*" or "")
+			end
+			return out
+		end
+
+		after_each(function()
+			lexer.set_syntax(nil)
+			luma.clear_cache()
+		end)
+
+		it("uses custom Jinja delimiters", function()
+			local options = {
+				variable_start_string = "[[",
+				variable_end_string = "]]",
+				block_start_string = "<%",
+				block_end_string = "%>",
+				comment_start_string = "<#",
+				comment_end_string = "#>",
+			}
+			local out = luma.render("[[ name ]] {{ kept }}<% if x -%> yes<% endif %><# note #>", {
+				name = "a",
+				x = true,
+			}, options)
+			assert.equals("a {{ kept }}yes", out)
+		end)
+
+		it("detects Jinja syntax by its custom delimiters", function()
+			local options = { variable_start_string = "[[", variable_end_string = "]]" }
+			assert.equals(T.INTERP_START, lexer.tokenize("[[ x ]]", options)[1].type)
+			assert.equals(T.TEXT, lexer.tokenize("{{ x }}", options)[1].type)
+		end)
+
+		it("uses custom native sigils", function()
+			local options = { directive_sigil = "%", interpolation_sigil = "~" }
+			local out = luma.render("$HOME @x ~name ~~\n%if x\n~{ x + 1 }\n%end", { name = "a", x = 1 }, options)
+			assert.equals("$HOME @x a ~\n2\n", out)
+		end)
+
+		it("disables inline detection", function()
+			local on = types("a @if x\nb\n@end c")
+			assert.same({ "TEXT", "DIR_IF*", "IDENT", "NEWLINE", "TEXT", "DIR_END*", "TEXT", "EOF" }, on)
+			local off = types("a @if x\nb\n@end c", { inline_detection = false })
+			assert.same({ "TEXT", "DIR_IF", "IDENT", "NEWLINE", "TEXT", "DIR_END", "TEXT", "EOF" }, off)
+		end)
+
+		it("applies the options set with set_syntax", function()
+			lexer.set_syntax({ interpolation_sigil = "%" })
+			assert.equals("1 $y", luma.render("%x $y", { x = 1 }))
+		end)
+
+		it("rejects invalid options", function()
+			assert.has_error(function()
+				lexer.set_syntax({ directive_sigil = "@@" })
+			end)
+			assert.has_error(function()
+				lexer.set_syntax({ directive_sigil = "$" })
+			end)
+			assert.has_error(function()
+				lexer.set_syntax({ block_start_string = "{{" })
+			end)
+		end)
+	end)
 end)
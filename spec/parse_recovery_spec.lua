@@ -0,0 +1,62 @@
+--- Tests for parser error recovery
+-- @module spec.parse_recovery_spec
+
+local luma = require("luma")
+
+describe("Parse Recovery", function()
+	it("should return the AST and no errors for a valid template", function()
+		local ast, errs = luma.parse_all("Hello ${name}\n@if x\nyes\n@end")
+		assert.is_not_nil(ast)
+		assert.equals(0, #errs)
+	end)
+
+	it("should collect every syntax error in a template", function()
+		local source = table.concat({
+			"line one",
+			"${ 1 + }",
+			"fine ${name}",
+			"@set = 3",
+			"${ a b }",
+			"last",
+		}, "\n")
+		local _, errs = luma.parse_all(source, { name = "page.luma" })
+		assert.equals(3, #errs)
+		assert.equals(2, errs[1].line)
+		assert.equals("ParseError", errs[1].type)
+		assert.equals("page.luma", errs[1].source_name)
+		assert.equals(4, errs[2].line)
+		assert.equals(5, errs[3].line)
+	end)
+
+	it("should keep parsing the nodes after an error", function()
+		local ast, errs = luma.parse_all("${ 1 + }\nafter ${name}")
+		assert.equals(1, #errs)
+		local text = {}
+		for _, node in ipairs(ast.body) do
+			if node.type == "TEXT" then
+				table.insert(text, node.value)
+			end
+		end
+		assert.matches("after", table.concat(text))
+	end)
+
+	it("should report errors in source order", function()
+		local _, errs = luma.parse_all("${ ) }\n@for in\n${ ] }")
+		for i = 2, #errs do
+			assert.is_true(errs[i - 1].line <= errs[i].line)
+		end
+	end)
+
+	it("should stop at lexer errors", function()
+		local ast, errs = luma.parse_all('${ "unterminated }\n${ 1 + }')
+		assert.is_nil(ast)
+		assert.equals(1, #errs)
+		assert.equals("LexerError", errs[1].type)
+	end)
+
+	it("should leave luma.parse failing at the first error", function()
+		local ok, err = pcall(luma.parse, "${ 1 + }\n${ ) }")
+		assert.is_false(ok)
+		assert.matches("ParseError", tostring(err))
+	end)
+end)
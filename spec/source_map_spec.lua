@@ -0,0 +1,107 @@
+--- Tests for source maps
+-- @module spec.source_map_spec
+
+local luma = require("luma")
+local runtime = require("luma.runtime")
+
+--- Find the segment covering a byte offset of the output
+local function segment_at(segments, offset)
+	for _, seg in ipairs(segments or {}) do
+		if seg.start <= offset and offset < seg.stop then
+			return seg
+		end
+	end
+	return nil
+end
+
+--- Describe a location as template:line
+local function where(location)
+	return tostring(location[1]) .. ":" .. location[2]
+end
+
+--- Describe the template line an output offset comes from, following
+-- the lines of template text
+local function source_of(output, segments, offset)
+	local seg = segment_at(segments, offset)
+	local line = seg.location[2]
+	if seg.location[4] then
+		local _, newlines = output:sub(seg.start + 1, offset):gsub("\n", "")
+		line = line + newlines
+	end
+	return tostring(seg.location[1]) .. ":" .. line
+end
+
+describe("Source Maps", function()
+	local templates
+
+	before_each(function()
+		templates = {}
+		luma.clear_cache()
+		runtime.set_source_maps(true)
+		runtime.set_loader(function(name)
+			return templates[name]
+		end)
+	end)
+
+	after_each(function()
+		runtime.set_source_maps(false)
+		runtime.set_loader(nil)
+		luma.clear_cache()
+	end)
+
+	it("should map output to template lines", function()
+		local output = luma.render("first\n@if x\n${x}\n@end\nlast", { x = "value" }, { name = "page.luma" })
+		local segments = runtime.take_source_map(output)
+
+		assert.equals("page.luma:1", source_of(output, segments, 0))
+		assert.equals("page.luma:3", source_of(output, segments, output:find("value") - 1))
+		assert.equals("page.luma:5", source_of(output, segments, output:find("last") - 1))
+	end)
+
+	it("should map included output with its include chain", function()
+		templates["inner.luma"] = "inner ${name}"
+		local output = luma.render('top\n@include "inner.luma"', { name = "x" }, { name = "outer.luma" })
+		local segments = runtime.take_source_map(output)
+
+		local seg = segment_at(segments, output:find("inner") - 1)
+		assert.equals("inner.luma:1", where(seg.location))
+		assert.equals(1, #seg.chain)
+		assert.equals("outer.luma:2", where(seg.chain[1]))
+	end)
+
+	it("should shift indented includes", function()
+		templates["items.luma"] = "a: 1\nb: 2\n"
+		local output = luma.render('spec:\n  @include "items.luma" indent', {}, { name = "deploy.yaml" })
+		local segments = runtime.take_source_map(output)
+
+		assert.equals("spec:\n  a: 1\n  b: 2\n", output)
+		assert.equals("items.luma:2", source_of(output, segments, output:find("b: 2") - 1))
+		assert.equals("deploy.yaml:2", where(segment_at(segments, output:find("b: 2") - 1).chain[1]))
+	end)
+
+	it("should map macro output to the macro body", function()
+		local source = "@macro greet(n)\nhi ${n}\n@end\n@call greet('x')"
+		local output = luma.render(source, {}, { name = "macros.luma" })
+		local segments = runtime.take_source_map(output)
+
+		local seg = segment_at(segments, output:find("hi") - 1)
+		assert.equals("macros.luma:2", where(seg.location))
+		assert.equals("macros.luma:4", where(seg.chain[1]))
+	end)
+
+	it("should map inherited blocks to the template defining them", function()
+		templates["base.luma"] = "header\n@block body\n@end\nfooter"
+		local output = luma.render('@extends "base.luma"\n@block body\nchild\n@end', {}, { name = "child.luma" })
+		local segments = runtime.take_source_map(output)
+
+		assert.equals("base.luma:1", source_of(output, segments, 0))
+		assert.equals("child.luma:3", source_of(output, segments, output:find("child") - 1))
+		assert.equals("base.luma:4", source_of(output, segments, output:find("footer") - 1))
+	end)
+
+	it("should record nothing when disabled", function()
+		runtime.set_source_maps(false)
+		local output = luma.render("plain\n${x}", { x = 1 })
+		assert.is_nil(runtime.take_source_map(output))
+	end)
+end)